@@ -0,0 +1,43 @@
+// Command mock-oidc is a minimal OpenID Connect provider to try the single sign-on locally.
+// It approves every authorization request without asking for credentials and issues ID
+// tokens for a configurable user. It must never be exposed outside a development machine.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"tokilane/internal/mockoidc"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9999", "Listen address")
+	issuer := flag.String("issuer", "http://127.0.0.1:9999", "Issuer URL (OIDC_ISSUER of the server)")
+	clientID := flag.String("client-id", "tokilane", "Client ID")
+	clientSecret := flag.String("client-secret", "secret", "Client secret")
+	subject := flag.String("sub", "mock-user-1", "Subject of the user")
+	username := flag.String("username", "alice", "preferred_username claim")
+	email := flag.String("email", "alice@example.com", "email claim")
+	groups := flag.String("groups", "", "Comma-separated groups claim")
+	flag.Parse()
+
+	claims := map[string]interface{}{
+		"sub":                *subject,
+		"preferred_username": *username,
+		"email":              *email,
+		"name":               *username,
+	}
+	if *groups != "" {
+		claims["groups"] = strings.Split(*groups, ",")
+	}
+
+	provider, err := mockoidc.New(*issuer, *clientID, *clientSecret, claims)
+	if err != nil {
+		log.Fatalf("Error generating the signing key: %v", err)
+	}
+
+	log.Printf("Mock OpenID Connect provider on %s (issuer %s, client %s)", *addr, provider.Issuer(), *clientID)
+	log.Fatal(http.ListenAndServe(*addr, provider))
+}
@@ -6,6 +6,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"tokilane/internal/config"
 	"tokilane/internal/content"
@@ -15,10 +16,13 @@ import (
 
 func main() {
 	// Load configuration
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	log.Printf("Starting Tokilane...")
-	log.Printf("Configuration: Port=%s, FilesRoot=%s, Debug=%v, AppLang=%s", cfg.Port, cfg.FilesRoot, cfg.Debug, cfg.AppLang)
+	log.Printf("Configuration: Port=%s, Roots=%d, Debug=%v, AppLang=%s", cfg.Port, len(cfg.Roots), cfg.Debug, cfg.AppLang)
 
 	// Create necessary directories
 	if err := ensureDirectories(cfg); err != nil {
@@ -45,12 +49,29 @@ func main() {
 	}
 
 	// Initialize file indexer
+	var roots []content.LibraryRoot
+	for _, root := range cfg.Roots {
+		roots = append(roots, content.LibraryRoot{
+			ID:        root.ID,
+			Path:      root.Path,
+			ScanDepth: root.ScanDepth,
+			Ignore:    root.Ignore,
+			Upload:    root.Upload,
+		})
+	}
+
 	indexerConfig := &content.IndexerConfig{
-		RootPath:   cfg.FilesRoot,
-		ThumbsPath: filepath.Join(filepath.Dir(cfg.DBPath), "thumbs"),
-		Debug:      cfg.Debug,
-		ScanDepth:  cfg.ScanDepth,
-		ScanWorkers: cfg.ScanWorkers,
+		Roots:                roots,
+		ThumbsPath:           filepath.Join(filepath.Dir(cfg.DBPath), "thumbs"),
+		Debug:                cfg.Debug,
+		ScanWorkers:          cfg.ScanWorkers,
+		IgnorePatterns:       cfg.IgnorePatterns,
+		RespectGitignore:     cfg.RespectGitignore,
+		DateSources:          cfg.DateSources,
+		FilenameDatePatterns: cfg.FilenameDatePatterns,
+		ContentHashing:       cfg.ContentHashing,
+		WatchQuietPeriod:     time.Duration(cfg.WatchQuietPeriod) * time.Millisecond,
+		WatchWorkers:         cfg.WatchWorkers,
 	}
 
 	indexer, err := content.NewIndexer(indexerConfig, database)
@@ -58,6 +79,23 @@ func main() {
 		log.Fatalf("Error initializing indexer: %v", err)
 	}
 
+	// Initialize web server
+	server := web.NewServer(cfg, database, indexer)
+
+	// Forward indexer events to the browsers (subscribed before the initial scan)
+	webEvents := indexer.Subscribe("web", content.SubscribeOptions{
+		BufferSize:   cfg.EventBufferSize,
+		Backpressure: cfg.EventBackpressure,
+	})
+	go func() {
+		for event := range webEvents.Events() {
+			if cfg.Debug {
+				log.Printf("File event: %s - %s", event.Type, event.FilePath)
+			}
+			server.PublishEvent(event)
+		}
+	}()
+
 	// Start indexer
 	if err := indexer.Start(); err != nil {
 		log.Fatalf("Error starting indexer: %v", err)
@@ -68,9 +106,6 @@ func main() {
 		}
 	}()
 
-	// Initialize web server
-	server := web.NewServer(cfg, database, indexer)
-
 	// Channel to handle graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -83,15 +118,6 @@ func main() {
 		}
 	}()
 
-	// Optional: Listen to indexer events for logging
-	go func() {
-		for event := range indexer.GetEventChannel() {
-			if cfg.Debug {
-				log.Printf("File event: %s - %s", event.Type, event.FilePath)
-			}
-		}
-	}()
-
 	// Wait for shutdown signal
 	<-quit
 	log.Println("Shutting down server...")
@@ -107,10 +133,12 @@ func main() {
 // ensureDirectories creates necessary directories if they don't exist
 func ensureDirectories(cfg *config.Config) error {
 	dirs := []string{
-		cfg.FilesRoot,
 		filepath.Dir(cfg.DBPath),
 		filepath.Join(filepath.Dir(cfg.DBPath), "thumbs"),
 	}
+	for _, root := range cfg.Roots {
+		dirs = append(dirs, root.Path)
+	}
 
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
@@ -118,9 +146,9 @@ func ensureDirectories(cfg *config.Config) error {
 		}
 	}
 
-	// Create a sample file in the files folder if empty
-	if isEmpty, err := isDirEmpty(cfg.FilesRoot); err == nil && isEmpty {
-		createSampleFiles(cfg.FilesRoot)
+	// Create a sample file in the first root if empty
+	if isEmpty, err := isDirEmpty(cfg.Roots[0].Path); err == nil && isEmpty {
+		createSampleFiles(cfg.Roots[0].Path)
 	}
 
 	return nil
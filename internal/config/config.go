@@ -1,44 +1,205 @@
 package config
 
 import (
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/joho/godotenv"
 )
 
+// RootConfig describes a named library root
+type RootConfig struct {
+	ID        string   // Identifier used in the API (lowercase)
+	Path      string   // Directory of the root
+	ScanDepth int      // Directory scanning depth (0 = unlimited, 1 = root only, 2 = root+1 level, etc.)
+	Ignore    []string // Gitignore-style patterns specific to the root
+	Upload    bool     // Whether files can be uploaded to this root
+}
+
 type Config struct {
-	Port           string
-	FilesRoot      string
-	EnableUpload   bool
-	AllowedExt     []string
-	DBPath         string
-	Debug          bool
-	MaxUploadSize  int64 // in MB
-	AppLang        string // Application language
-	ScanDepth      int    // Directory scanning depth (0 = unlimited, 1 = root only, 2 = root+1 level, etc.)
-	ScanWorkers    int    // Number of parallel workers for scanning (0 = auto)
-	ResetDB        bool   // Reset database on startup
-}
-
-func Load() *Config {
+	Port                 string
+	FilesRoot            string
+	Roots                []RootConfig // Library roots (a single "files" root at FILES_ROOT by default)
+	EnableUpload         bool
+	EnableFileOperations bool     // Allow deleting, renaming and moving files through the API
+	AllowedExt           []string
+	AllowedMime          []string // MIME types accepted for upload, wildcards allowed (image/*); empty = all
+	DeniedMime           []string // MIME types refused for upload, even if allowed
+	DBPath               string
+	Debug                bool
+	MaxUploadSize        int64 // in MB
+	ResumableMaxSize     int64 // Maximum size of a resumable upload, in MB (0 = unlimited)
+	ResumableExpiry      int   // Hours after which an interrupted resumable upload is removed
+	AppLang              string // Application language
+	ScanDepth            int    // Directory scanning depth (0 = unlimited, 1 = root only, 2 = root+1 level, etc.)
+	ScanWorkers          int    // Number of parallel workers for scanning (0 = auto)
+	ResetDB              bool   // Reset database on startup
+	IgnorePatterns       []string // Gitignore-style patterns applied to every root
+	RespectGitignore     bool     // Honour .gitignore files in addition to .tokilaneignore
+	EventReplaySize      int      // Number of events kept for clients resuming with Last-Event-ID
+	EventBufferSize      int      // Number of file events buffered for each consumer
+	EventBackpressure    string   // Policy when a consumer buffer is full (block, drop-newest, drop-oldest)
+	ContentHashing       bool     // Compute full-content hashes in the background to detect duplicates
+	SimilarityThreshold  int      // Maximum Hamming distance between the perceptual hashes of similar images (0-64)
+	WatchQuietPeriod     int      // Milliseconds without events before a created or modified file is indexed
+	WatchWorkers         int      // Number of files indexed in parallel by the watcher
+	AuthEnabled          bool     // Require a login for the web UI and the API
+	AuthAdminUser        string   // Administrator created on first start when there is no user
+	AuthAdminPassword    string   // Password of this administrator (generated and logged if empty)
+	SessionLifetime      int      // Hours before a login session expires
+	CookieSecure         bool     // Send the session cookie over HTTPS only
+	CORSOrigins          []string // Origins allowed to call the API from a browser
+	TrustedProxies       []*net.IPNet // Reverse proxies whose X-Forwarded-For header gives the client address
+	OIDCIssuer           string   // OpenID Connect provider for single sign-on (empty = disabled)
+	OIDCClientID         string
+	OIDCClientSecret     string
+	OIDCRedirectURL      string   // Callback URL registered at the provider (derived from the request if empty)
+	OIDCScopes           []string
+	OIDCUsernameClaim    string   // Claim giving the username of the users created on first login
+	OIDCRoleClaim        string   // Claim containing the groups or roles mapped with OIDCRoleMap (empty = no mapping)
+	OIDCRoleMap          []string // Claim values and their role (value=role)
+	OIDCDefaultRole      string   // Role of the users without mapped claim value ("none" refuses them)
+	SharesEnabled        bool     // Allow public share links to files and sets of files
+	ShareSecret          string   // Key signing the share links (generated and stored next to the database if empty)
+	ShareDefaultHours    int      // Lifetime of a share link when none is requested
+	ShareMaxHours        int      // Maximum lifetime of a share link
+	ShareBaseURL         string   // Public address of the server in the share links, without trailing slash (relative links if empty)
+	DateSources          []string // Priority chain of date sources (metadata, filename, birthtime, mtime, ctime, upload)
+	FilenameDatePatterns []string // Custom regular expressions (named groups year, month, day...) for dates in file names
+}
+
+// Load reads the configuration from the environment (and a .env file). An invalid list of
+// roots or of trusted proxies is refused, so that the server does not start with a library
+// or a client address other than expected.
+func Load() (*Config, error) {
 	// Load .env file if it exists
 	_ = godotenv.Load()
 
-	return &Config{
-		Port:          getEnv("PORT", "1323"),
-		FilesRoot:     getEnv("FILES_ROOT", "./files"),
-		EnableUpload:  getEnvBool("ENABLE_UPLOAD", true),
-		AllowedExt:    getEnvSlice("ALLOWED_EXT", []string{".pdf", ".png", ".jpg", ".jpeg", ".gif", ".webp", ".svg", ".txt", ".md", ".docx", ".xlsx", ".zip", ".mp4", ".mp3"}),
-		DBPath:        getEnv("DB_PATH", "./data/app.db"),
-		Debug:         getEnvBool("DEBUG", true),
-		MaxUploadSize: getEnvInt64("MAX_UPLOAD_SIZE", 100), // 100MB by default
-		AppLang:       getEnv("APP_LANG", "en"), // English by default
-		ScanDepth:     getEnvInt("SCAN_DEPTH", 0), // 0 = unlimited depth
-		ScanWorkers:   getEnvInt("SCAN_WORKERS", 0), // 0 = auto (CPU count)
-		ResetDB:       getEnvBool("RESET_DB", true), // Reset database on startup
+	cfg := &Config{
+		Port:                 getEnv("PORT", "1323"),
+		FilesRoot:            getEnv("FILES_ROOT", "./files"),
+		EnableUpload:         getEnvBool("ENABLE_UPLOAD", true),
+		EnableFileOperations: getEnvBool("ENABLE_FILE_OPERATIONS", false),
+		AllowedExt:           getEnvSlice("ALLOWED_EXT", []string{".pdf", ".png", ".jpg", ".jpeg", ".gif", ".webp", ".svg", ".txt", ".md", ".docx", ".xlsx", ".zip", ".mp4", ".mp3"}),
+		AllowedMime:          getEnvSlice("ALLOWED_MIME", nil),
+		DeniedMime:           getEnvSlice("DENIED_MIME", []string{"application/x-msdownload", "application/x-executable", "application/x-mach-binary"}),
+		DBPath:               getEnv("DB_PATH", "./data/app.db"),
+		Debug:                getEnvBool("DEBUG", true),
+		MaxUploadSize:        getEnvInt64("MAX_UPLOAD_SIZE", 100), // 100MB by default
+		ResumableMaxSize:     getEnvInt64("RESUMABLE_MAX_SIZE", 20480), // 20GB by default
+		ResumableExpiry:      getEnvInt("RESUMABLE_EXPIRY_HOURS", 24),
+		AppLang:              getEnv("APP_LANG", "en"), // English by default
+		ScanDepth:            getEnvInt("SCAN_DEPTH", 0), // 0 = unlimited depth
+		ScanWorkers:          getEnvInt("SCAN_WORKERS", 0), // 0 = auto (CPU count)
+		ResetDB:              getEnvBool("RESET_DB", true), // Reset database on startup
+		IgnorePatterns:       getEnvSlice("IGNORE_PATTERNS", []string{"node_modules/", "*.part", "*.crdownload", "*.tmp"}),
+		RespectGitignore:     getEnvBool("RESPECT_GITIGNORE", false),
+		EventReplaySize:      getEnvInt("EVENT_REPLAY_SIZE", 1000),
+		EventBufferSize:      getEnvInt("EVENT_BUFFER_SIZE", 100),
+		EventBackpressure:    getEnv("EVENT_BACKPRESSURE", "block"),
+		ContentHashing:       getEnvBool("CONTENT_HASHING", true),
+		SimilarityThreshold:  getEnvInt("SIMILARITY_THRESHOLD", 10),
+		WatchQuietPeriod:     getEnvInt("WATCH_QUIET_PERIOD_MS", 500),
+		WatchWorkers:         getEnvInt("WATCH_WORKERS", 2),
+		AuthEnabled:          getEnvBool("AUTH_ENABLED", false),
+		AuthAdminUser:        getEnv("AUTH_ADMIN_USER", "admin"),
+		AuthAdminPassword:    getEnv("AUTH_ADMIN_PASSWORD", ""),
+		SessionLifetime:      getEnvInt("AUTH_SESSION_HOURS", 168), // 7 days
+		CookieSecure:         getEnvBool("AUTH_COOKIE_SECURE", false),
+		CORSOrigins:          getEnvSlice("CORS_ORIGINS", []string{"*"}),
+		OIDCIssuer:           getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:         getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:     getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:      getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:           getEnvSlice("OIDC_SCOPES", []string{"openid", "profile", "email"}),
+		OIDCUsernameClaim:    getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+		OIDCRoleClaim:        getEnv("OIDC_ROLE_CLAIM", ""),
+		OIDCRoleMap:          getEnvSlice("OIDC_ROLE_MAP", nil),
+		OIDCDefaultRole:      getEnv("OIDC_DEFAULT_ROLE", "viewer"),
+		SharesEnabled:        getEnvBool("SHARES_ENABLED", true),
+		ShareSecret:          getEnv("SHARE_SECRET", ""),
+		ShareDefaultHours:    getEnvInt("SHARE_DEFAULT_HOURS", 168), // 7 days
+		ShareMaxHours:        getEnvInt("SHARE_MAX_HOURS", 720),     // 30 days
+		DateSources:          getEnvSlice("DATE_SOURCES", []string{"metadata", "filename", "birthtime", "mtime"}),
+		FilenameDatePatterns: getEnvSliceSep("FILENAME_DATE_PATTERNS", ";", nil), // Regexes contain commas
+	}
+	roots, err := loadRoots(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Roots = roots
+
+	proxies, err := parseTrustedProxies(getEnvSlice("TRUSTED_PROXIES", nil))
+	if err != nil {
+		return nil, err
+	}
+	cfg.TrustedProxies = proxies
+
+	baseURL, err := parseBaseURL(getEnv("SHARE_BASE_URL", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SHARE_BASE_URL: %w", err)
+	}
+	cfg.ShareBaseURL = baseURL
+
+	return cfg, nil
+}
+
+// loadRoots reads the roots listed in ROOTS, each configured with ROOT_<ID>_PATH,
+// ROOT_<ID>_SCAN_DEPTH, ROOT_<ID>_IGNORE and ROOT_<ID>_UPLOAD.
+// Without ROOTS, FILES_ROOT is used as a single root named "files".
+// Empty and duplicate IDs (compared without case) are refused. Paths are made absolute, as the
+// paths of the indexed files and the paths given to the API are derived from them.
+func loadRoots(cfg *Config) ([]RootConfig, error) {
+	var roots []RootConfig
+	seen := make(map[string]bool)
+	prefixes := make(map[string]string)
+	for _, id := range getEnvSlice("ROOTS", nil) {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" {
+			return nil, fmt.Errorf("ROOTS contains an empty root ID: %q", os.Getenv("ROOTS"))
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("ROOTS contains the root ID %q more than once", id)
+		}
+		seen[id] = true
+
+		// my-root and my_root would read the same variables
+		prefix := "ROOT_" + strings.ToUpper(strings.ReplaceAll(id, "-", "_")) + "_"
+		if other, ok := prefixes[prefix]; ok {
+			return nil, fmt.Errorf("the root IDs %q and %q are both configured by %s*", other, id, prefix)
+		}
+		prefixes[prefix] = id
+		path, err := filepath.Abs(getEnv(prefix+"PATH", filepath.Join(cfg.FilesRoot, id)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid path of the root %q: %w", id, err)
+		}
+		roots = append(roots, RootConfig{
+			ID:        id,
+			Path:      path,
+			ScanDepth: getEnvInt(prefix+"SCAN_DEPTH", cfg.ScanDepth),
+			Ignore:    getEnvSlice(prefix+"IGNORE", nil),
+			Upload:    getEnvBool(prefix+"UPLOAD", cfg.EnableUpload),
+		})
+	}
+
+	if len(roots) == 0 {
+		path, err := filepath.Abs(cfg.FilesRoot)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FILES_ROOT: %w", err)
+		}
+		roots = append(roots, RootConfig{
+			ID:        "files",
+			Path:      path,
+			ScanDepth: cfg.ScanDepth,
+			Upload:    cfg.EnableUpload,
+		})
 	}
+	return roots, nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -75,9 +236,63 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// parseTrustedProxies parses the addresses (192.0.2.1) and networks (10.0.0.0/8) of the
+// trusted reverse proxies. Without them, the client address is the address of the connection.
+func parseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %q", value)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// parseBaseURL checks the public address of the server (http or https, optionally under a
+// path) and removes its trailing slash. Empty values stay empty.
+func parseBaseURL(value string) (string, error) {
+	value = strings.TrimRight(strings.TrimSpace(value), "/")
+	if value == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("%q is not an http or https URL", value)
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" || parsed.User != nil {
+		return "", fmt.Errorf("%q has a query, a fragment or credentials", value)
+	}
+	return value, nil
+}
+
 func getEnvSlice(key string, defaultValue []string) []string {
+	return getEnvSliceSep(key, ",", defaultValue)
+}
+
+func getEnvSliceSep(key, sep string, defaultValue []string) []string {
 	if value := os.Getenv(key); value != "" {
-		return strings.Split(value, ",")
+		return strings.Split(value, sep)
 	}
 	return defaultValue
 }
@@ -92,3 +307,50 @@ func (c *Config) IsAllowedExtension(ext string) bool {
 	}
 	return false
 }
+
+// IsAllowedMime checks if the MIME type is allowed for upload: it must match ALLOWED_MIME
+// (when set) and not match DENIED_MIME
+func (c *Config) IsAllowedMime(mimeType string) bool {
+	if matchesMime(c.DeniedMime, mimeType) {
+		return false
+	}
+	return len(c.AllowedMime) == 0 || matchesMime(c.AllowedMime, mimeType)
+}
+
+// matchesMime checks if a MIME type matches one of the patterns (image/png, image/* or */*)
+func matchesMime(patterns []string, mimeType string) bool {
+	mimeType = strings.ToLower(mimeType)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if pattern == mimeType || pattern == "*/*" || pattern == "*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Root returns the root with the given ID
+func (c *Config) Root(id string) (*RootConfig, bool) {
+	for i := range c.Roots {
+		if c.Roots[i].ID == id {
+			return &c.Roots[i], true
+		}
+	}
+	return nil, false
+}
+
+// DefaultUploadRoot returns the first root accepting uploads
+func (c *Config) DefaultUploadRoot() (*RootConfig, bool) {
+	for i := range c.Roots {
+		if c.Roots[i].Upload {
+			return &c.Roots[i], true
+		}
+	}
+	return nil, false
+}
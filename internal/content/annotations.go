@@ -0,0 +1,96 @@
+package content
+
+import (
+	"log"
+
+	"tokilane/internal/db"
+)
+
+// relinkAnnotations moves the tags, favourites and notes of files that are no longer
+// indexed to newly indexed files found at the same path (re-index) or with the same
+// content (rename or move). A content matching several of them is left alone.
+func (i *Indexer) relinkAnnotations(items []*db.FileItem) {
+	orphans, err := i.annotations.OrphanAnchors()
+	if err != nil {
+		log.Printf("Error retrieving orphaned annotations: %v", err)
+		return
+	}
+	if len(orphans) == 0 {
+		return
+	}
+
+	byPath := make(map[string]db.FileAnchor)
+	bySize := make(map[int64][]db.FileAnchor)
+	for _, anchor := range orphans {
+		byPath[anchor.Path] = anchor
+		bySize[anchor.Size] = append(bySize[anchor.Size], anchor)
+	}
+	relinked := make(map[string]bool)
+
+	for _, item := range items {
+		anchor, found := byPath[item.AbsPath]
+		fingerprint := ""
+		// Only hash the files having the size of an orphaned file
+		if candidates := bySize[item.Size]; len(candidates) > 0 {
+			fingerprint, _ = AnchorFingerprint(item)
+			if !found && fingerprint != "" {
+				matches := 0
+				for _, candidate := range candidates {
+					if candidate.Fingerprint == fingerprint {
+						anchor, matches = candidate, matches+1
+					}
+				}
+				found = matches == 1
+			}
+		}
+		if !found || relinked[anchor.FileID] {
+			continue
+		}
+
+		if err := i.annotations.Relink(anchor.FileID, item, fingerprint); err != nil {
+			log.Printf("Error relinking the annotations of %s: %v", item.AbsPath, err)
+			continue
+		}
+		relinked[anchor.FileID] = true
+		if i.config.Debug {
+			log.Printf("Annotations relinked: %s -> %s", anchor.Path, item.AbsPath)
+		}
+	}
+}
+
+// AnchorFingerprint returns the hash recognizing an annotated file after a rename: the SHA256 of
+// its entire content, as files of the same size may share their first and last bytes. The hash
+// computed in the background is used while the file is unchanged.
+func AnchorFingerprint(item *db.FileItem) (string, error) {
+	if item.ContentHash != "" {
+		return item.ContentHash, nil
+	}
+	return ComputeContentHash(item.AbsPath)
+}
+
+// refreshAnnotationAnchors updates the fingerprint of annotated files whose content changed
+func (i *Indexer) refreshAnnotationAnchors(items []*db.FileItem) {
+	ids := make([]string, len(items))
+	byID := make(map[string]*db.FileItem, len(items))
+	for idx, item := range items {
+		ids[idx] = item.ID
+		byID[item.ID] = item
+	}
+
+	anchors, err := i.annotations.GetAnchors(ids)
+	if err != nil {
+		log.Printf("Error retrieving annotation anchors: %v", err)
+		return
+	}
+
+	for _, anchor := range anchors {
+		item := byID[anchor.FileID]
+		fingerprint, err := AnchorFingerprint(item)
+		if err != nil {
+			continue
+		}
+		if err := i.annotations.SaveAnchor(item, fingerprint); err != nil {
+			log.Printf("Error updating the annotation anchor of %s: %v", item.AbsPath, err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package content
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tokilane/internal/db"
+)
+
+// annotateTestFile tags, stars and annotates a file, recording its anchor like the API does
+func annotateTestFile(t *testing.T, indexer *Indexer, item *db.FileItem, tag, note string) {
+	t.Helper()
+	fingerprint, err := AnchorFingerprint(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.annotations.SaveAnchor(item, fingerprint); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.annotations.AddTag(item.ID, tag); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.annotations.SetFavorite(item.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.annotations.CreateNote(&db.Note{FileID: item.ID, Body: note}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertAnnotations checks the annotations of the file indexed at a path
+func assertAnnotations(t *testing.T, indexer *Indexer, path, tag, note string) {
+	t.Helper()
+	item, err := indexer.repo.GetByPath(path)
+	if err != nil {
+		t.Fatalf("%s not indexed: %v", path, err)
+	}
+	annotations, err := indexer.annotations.Get(item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotations.Tags) != 1 || annotations.Tags[0] != tag || !annotations.Favorite ||
+		len(annotations.Notes) != 1 || annotations.Notes[0].Body != note {
+		t.Errorf("annotations of %s: %+v, want the tag %s, the favourite and the note %q", path, annotations, tag, note)
+	}
+}
+
+// newRelinkTest opens a database and an indexer of a root, whose files are written by setup
+// before a first scan
+func newRelinkTest(t *testing.T, setup func(rootPath string)) (string, *db.Database, *Indexer) {
+	t.Helper()
+	dir := t.TempDir()
+	rootPath := filepath.Join(dir, "files")
+	if err := os.MkdirAll(rootPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	setup(rootPath)
+
+	database, err := db.New(filepath.Join(dir, "app.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	indexer, err := NewIndexer(&IndexerConfig{
+		Roots:      []LibraryRoot{{ID: "files", Path: rootPath}},
+		ThumbsPath: filepath.Join(dir, "thumbs"),
+	}, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { indexer.Stop() })
+	if err := indexer.ScanAll(); err != nil {
+		t.Fatal(err)
+	}
+	return rootPath, database, indexer
+}
+
+// The index is reset at startup (RESET_DB): annotations follow the files indexed again at the
+// same path, and the files renamed or moved while the server was stopped
+func TestScanRelinksAnnotationsAfterReset(t *testing.T) {
+	var kept, renamed string
+	rootPath, database, indexer := newRelinkTest(t, func(rootPath string) {
+		kept = filepath.Join(rootPath, "kept.txt")
+		renamed = filepath.Join(rootPath, "old.txt")
+		writeTestFile(t, kept, "a file staying where it is\n")
+		writeTestFile(t, renamed, "a file renamed while the server is stopped\n")
+	})
+
+	oldIDs := make(map[string]string)
+	for path, tag := range map[string]string{kept: "kept", renamed: "renamed"} {
+		item, err := indexer.repo.GetByPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		annotateTestFile(t, indexer, item, tag, "note on "+tag)
+		oldIDs[path] = item.ID
+	}
+	shares := db.NewShareRepository(database)
+	share := &db.Share{ID: "share1", Kind: db.ShareFile, Target: oldIDs[renamed], FileID: oldIDs[renamed], ExpiresAt: time.Now().Add(time.Hour)}
+	if err := shares.Create(share); err != nil {
+		t.Fatal(err)
+	}
+
+	moved := filepath.Join(rootPath, "2024", "new.txt")
+	if err := os.MkdirAll(filepath.Dir(moved), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(renamed, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.ScanAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	assertAnnotations(t, indexer, kept, "kept", "note on kept")
+	assertAnnotations(t, indexer, moved, "renamed", "note on renamed")
+	if orphans, err := indexer.annotations.OrphanAnchors(); err != nil || len(orphans) != 0 {
+		t.Errorf("orphaned annotations left after the scan: %+v, %v", orphans, err)
+	}
+	// Share links only follow the moves keeping the ID of their file
+	if share, err := shares.Get(share.ID); err != nil || share.FileID != oldIDs[renamed] {
+		t.Errorf("share link moved to the new record: %+v, %v", share, err)
+	}
+	for path, oldID := range oldIDs {
+		if annotations, err := indexer.annotations.Get(oldID); err != nil || len(annotations.Tags) != 0 || annotations.Favorite || len(annotations.Notes) != 0 {
+			t.Errorf("annotations of %s left on its previous record: %+v, %v", path, annotations, err)
+		}
+	}
+}
+
+// Renamed files are recognized by their entire content, and only when a single annotated file
+// had it
+func TestScanRelinksAnnotationsByContent(t *testing.T) {
+	// Large files of the same size, with the same first and last bytes
+	large := func(middle byte) string {
+		data := bytes.Repeat([]byte{'a'}, 3<<20)
+		data[len(data)/2] = middle
+		return string(data)
+	}
+	rootPath, database, indexer := newRelinkTest(t, func(rootPath string) {
+		writeTestFile(t, filepath.Join(rootPath, "video.bin"), large('b'))
+		writeTestFile(t, filepath.Join(rootPath, "copy1.txt"), "the same content\n")
+		writeTestFile(t, filepath.Join(rootPath, "copy2.txt"), "the same content\n")
+	})
+	for _, name := range []string{"video.bin", "copy1.txt", "copy2.txt"} {
+		item, err := indexer.repo.GetByPath(filepath.Join(rootPath, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		annotateTestFile(t, indexer, item, name, "note on "+name)
+	}
+
+	// While the server is stopped, the large file is replaced by another one and the copies are renamed
+	if err := os.Remove(filepath.Join(rootPath, "video.bin")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(rootPath, "other.bin"), large('c'))
+	for _, name := range []string{"copy1.txt", "copy2.txt"} {
+		if err := os.Rename(filepath.Join(rootPath, name), filepath.Join(rootPath, "renamed-"+name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.ScanAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"other.bin", "renamed-copy1.txt", "renamed-copy2.txt"} {
+		item, err := indexer.repo.GetByPath(filepath.Join(rootPath, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		annotations, err := indexer.annotations.Get(item.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(annotations.Tags) != 0 || annotations.Favorite || len(annotations.Notes) != 0 {
+			t.Errorf("annotations %+v given to %s", annotations, name)
+		}
+	}
+	if orphans, err := indexer.annotations.OrphanAnchors(); err != nil || len(orphans) != 3 {
+		t.Errorf("%d orphaned annotations, want 3: %v", len(orphans), err)
+	}
+}
@@ -0,0 +1,98 @@
+package content
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// bmffBox represents a box of an ISO base media file (HEIF, MP4, MOV...)
+type bmffBox struct {
+	Type   string
+	Offset int64 // Offset of the payload (after the header)
+	Size   int64 // Size of the payload
+}
+
+// readBMFFBoxes reads the sibling boxes located between start and end
+func readBMFFBoxes(r io.ReaderAt, start, end int64) ([]bmffBox, error) {
+	var boxes []bmffBox
+	header := make([]byte, 16)
+
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return boxes, err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+
+		switch size {
+		case 0:
+			// The box extends to the end of the container
+			size = end - offset
+		case 1:
+			// 64-bit size stored after the type
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return boxes, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+
+		// Compared with the space left so that huge sizes cannot overflow
+		if size < headerSize || size > end-offset {
+			return boxes, fmt.Errorf("invalid box %q at offset %d", boxType, offset)
+		}
+
+		boxes = append(boxes, bmffBox{
+			Type:   boxType,
+			Offset: offset + headerSize,
+			Size:   size - headerSize,
+		})
+		offset += size
+	}
+
+	return boxes, nil
+}
+
+// findBMFFBox returns the first box of the given type
+func findBMFFBox(boxes []bmffBox, boxType string) (bmffBox, bool) {
+	for _, box := range boxes {
+		if box.Type == boxType {
+			return box, true
+		}
+	}
+	return bmffBox{}, false
+}
+
+// readBMFFPayload reads the payload of a box, refusing boxes larger than maxSize
+func readBMFFPayload(r io.ReaderAt, box bmffBox, maxSize int64) ([]byte, error) {
+	if box.Size > maxSize {
+		return nil, fmt.Errorf("box %q too large: %d bytes", box.Type, box.Size)
+	}
+	payload := make([]byte, box.Size)
+	if _, err := r.ReadAt(payload, box.Offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// readUintN reads a big-endian unsigned integer of n bytes (0, 2, 4 or 8)
+func readUintN(data []byte, pos, n int) (uint64, int, error) {
+	if pos+n > len(data) {
+		return 0, pos, io.ErrUnexpectedEOF
+	}
+	switch n {
+	case 0:
+		return 0, pos, nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(data[pos:])), pos + 2, nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(data[pos:])), pos + 4, nil
+	case 8:
+		return binary.BigEndian.Uint64(data[pos:]), pos + 8, nil
+	default:
+		return 0, pos, fmt.Errorf("unsupported integer size: %d", n)
+	}
+}
@@ -0,0 +1,69 @@
+package content
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testBox builds an ISO media box with a 32-bit size
+func testBox(boxType string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+	return append(append(box, boxType...), data...)
+}
+
+// testLargeBox builds a box header with a 64-bit size, followed by the given payload
+func testLargeBox(boxType string, size uint64, payload []byte) []byte {
+	box := binary.BigEndian.AppendUint32(nil, 1)
+	box = append(box, boxType...)
+	box = binary.BigEndian.AppendUint64(box, size)
+	return append(box, payload...)
+}
+
+func TestReadBMFFBoxes(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []bmffBox
+		invalid bool
+	}{
+		{"empty", nil, nil, false},
+		{
+			"siblings",
+			append(testBox("ftyp", []byte("heic")), testBox("free")...),
+			[]bmffBox{{"ftyp", 8, 4}, {"free", 20, 0}},
+			false,
+		},
+		{"64-bit size", testLargeBox("mdat", 20, []byte("abcd")), []bmffBox{{"mdat", 16, 4}}, false},
+		{"size zero extends to the end", append([]byte{0, 0, 0, 0}, "mdat abc"...), []bmffBox{{"mdat", 8, 4}}, false},
+		{"truncated header", []byte{0, 0, 0, 8, 'f', 't'}, nil, false},
+		{"truncated 64-bit size", append([]byte{0, 0, 0, 1}, "mdat\x00\x00"...), nil, true},
+		{"size below the header", append([]byte{0, 0, 0, 4}, "free"...), nil, true},
+		{"64-bit size below the header", testLargeBox("mdat", 8, nil), nil, true},
+		{"beyond the end", append(testBox("ftyp", []byte("heic")), 0, 0, 1, 0, 'f', 'r', 'e', 'e'), []bmffBox{{"ftyp", 8, 4}}, true},
+		{"64-bit size beyond the end", testLargeBox("mdat", 1<<40, []byte("abcd")), nil, true},
+		{"64-bit size overflowing", testLargeBox("mdat", 0x7FFFFFFFFFFFFFFF, []byte("abcd")), nil, true},
+		{"negative 64-bit size", testLargeBox("mdat", 0xFFFFFFFFFFFFFFFF, []byte("abcd")), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			boxes, err := readBMFFBoxes(bytes.NewReader(tt.data), 0, int64(len(tt.data)))
+			if tt.invalid && err == nil {
+				t.Errorf("no error, boxes %+v", boxes)
+			}
+			if !tt.invalid && err != nil {
+				t.Errorf("error: %v", err)
+			}
+			if len(boxes) != len(tt.want) {
+				t.Fatalf("boxes %+v, want %+v", boxes, tt.want)
+			}
+			for n, box := range boxes {
+				if box != tt.want[n] {
+					t.Errorf("box %d is %+v, want %+v", n, box, tt.want[n])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package content
+
+import (
+	"log"
+)
+
+// Number of files fetched at once by the hashing worker
+const contentHashBatchSize = 100
+
+// contentHashWorker computes the full-content hashes of the indexed files in the background.
+// Unlike the quick hash used to detect changes, these hashes only depend on the content
+// and identify duplicates across folders. It also computes the perceptual hashes of the
+// images whose thumbnail was generated before these hashes existed.
+func (i *Indexer) contentHashWorker() {
+	defer i.hashWg.Done()
+
+	for {
+		select {
+		case <-i.stopChannel:
+			return
+		case <-i.hashWake:
+			if i.config.ContentHashing {
+				i.hashPendingContents()
+			}
+			i.hashPendingImages()
+		}
+	}
+}
+
+// scheduleContentHashing wakes the hashing worker up, without blocking if it is already busy
+func (i *Indexer) scheduleContentHashing() {
+	select {
+	case i.hashWake <- struct{}{}:
+	default:
+	}
+}
+
+// hashPendingContents hashes all the files without a full-content hash.
+// Files that cannot be read are skipped until the next wake-up.
+func (i *Indexer) hashPendingContents() {
+	hashed := 0
+	afterID := ""
+	for {
+		items, err := i.repo.PendingContentHashes(afterID, contentHashBatchSize)
+		if err != nil {
+			log.Printf("Error retrieving files to hash: %v", err)
+			return
+		}
+		if len(items) == 0 {
+			break
+		}
+
+		for _, item := range items {
+			select {
+			case <-i.stopChannel:
+				return
+			default:
+			}
+
+			contentHash, err := ComputeContentHash(item.AbsPath)
+			if err != nil {
+				if i.config.Debug {
+					log.Printf("Error hashing the content of %s: %v", item.AbsPath, err)
+				}
+				continue
+			}
+			// Ignored if the file was modified in the meantime, it is then hashed again
+			if err := i.repo.SetContentHash(item.ID, item.Hash, contentHash); err != nil {
+				log.Printf("Error saving the content hash of %s: %v", item.AbsPath, err)
+				continue
+			}
+			hashed++
+		}
+		afterID = items[len(items)-1].ID
+	}
+
+	if hashed > 0 {
+		log.Printf("Content hashing completed: %d files hashed", hashed)
+	}
+}
+
+// hashPendingImages computes the missing perceptual hashes of images from their thumbnail
+func (i *Indexer) hashPendingImages() {
+	hashed := 0
+	afterID := ""
+	for {
+		items, err := i.repo.PendingPerceptualHashes(afterID, contentHashBatchSize)
+		if err != nil {
+			log.Printf("Error retrieving images to hash: %v", err)
+			return
+		}
+		if len(items) == 0 {
+			break
+		}
+
+		for _, item := range items {
+			select {
+			case <-i.stopChannel:
+				return
+			default:
+			}
+
+			perceptualHash, err := i.thumbnailSvc.PerceptualHashOfThumbnail(*item.ThumbPath)
+			if err != nil {
+				if i.config.Debug {
+					log.Printf("Error hashing the thumbnail of %s: %v", item.AbsPath, err)
+				}
+				continue
+			}
+			if err := i.repo.SetPerceptualHash(item.ID, perceptualHash); err != nil {
+				log.Printf("Error saving the perceptual hash of %s: %v", item.AbsPath, err)
+				continue
+			}
+			hashed++
+		}
+		afterID = items[len(items)-1].ID
+	}
+
+	if hashed > 0 {
+		log.Printf("Perceptual hashing completed: %d images hashed", hashed)
+	}
+}
@@ -0,0 +1,181 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrContentMismatch is returned when the content of a file does not match its extension
+var ErrContentMismatch = errors.New("content does not match the extension")
+
+// mimeAliases groups the MIME types designating the same format, or formats sharing a
+// container that the signatures do not tell apart
+var mimeAliases = map[string]string{
+	// ZIP containers
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   "application/zip",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         "application/zip",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": "application/zip",
+	"application/vnd.oasis.opendocument.text":                                   "application/zip",
+	"application/vnd.oasis.opendocument.spreadsheet":                            "application/zip",
+	"application/vnd.oasis.opendocument.presentation":                           "application/zip",
+	"application/epub+zip":         "application/zip",
+	"application/java-archive":     "application/zip",
+	"application/x-zip-compressed": "application/zip",
+
+	// Legacy Office documents (OLE containers)
+	"application/vnd.ms-excel":      "application/msword",
+	"application/vnd.ms-powerpoint": "application/msword",
+	"application/vnd.ms-outlook":    "application/msword",
+
+	// ISO media files (ftyp box)
+	"video/quicktime": "video/mp4",
+	"video/x-m4v":     "video/mp4",
+	"video/3gpp":      "video/mp4",
+	"audio/mp4":       "video/mp4",
+	"audio/x-m4a":     "video/mp4",
+	"image/heic":      "video/mp4",
+	"image/heif":      "video/mp4",
+	"image/avif":      "video/mp4",
+
+	// Other names of the same formats
+	"image/pjpeg":                   "image/jpeg",
+	"image/x-ms-bmp":                "image/bmp",
+	"video/avi":                     "video/x-msvideo",
+	"video/msvideo":                 "video/x-msvideo",
+	"audio/x-wav":                   "audio/wav",
+	"audio/wave":                    "audio/wav",
+	"audio/vnd.wave":                "audio/wav",
+	"audio/x-flac":                  "audio/flac",
+	"audio/mp3":                     "audio/mpeg",
+	"video/ogg":                     "audio/ogg",
+	"application/ogg":               "audio/ogg",
+	"audio/opus":                    "audio/ogg",
+	"application/vnd.rar":           "application/x-rar-compressed",
+	"application/x-rar":             "application/x-rar-compressed",
+	"application/x-gzip":            "application/gzip",
+	"application/x-compressed-tar":  "application/gzip",
+	"application/x-gtar-compressed": "application/gzip",
+
+	// Executables
+	"application/vnd.microsoft.portable-executable": "application/x-msdownload",
+	"application/x-ms-dos-executable":               "application/x-msdownload",
+	"application/x-dosexec":                         "application/x-msdownload",
+	"application/x-elf":                             "application/x-executable",
+	"application/x-sharedlib":                       "application/x-executable",
+}
+
+// unreliableSignatures are the formats whose files may not start with the signature of
+// fileSignatures (MP3 frames without ID3 tag)
+var unreliableSignatures = map[string]bool{
+	"audio/mpeg": true,
+}
+
+// VerifyContentType checks that the first bytes of a file match the type claimed by its
+// name, so that a renamed executable is not accepted as a document. Returns the MIME type
+// of the file: the one of its extension when it is verified, the detected one otherwise.
+func VerifyContentType(r io.Reader, name string) (string, error) {
+	buffer := make([]byte, 512)
+	n, err := io.ReadFull(r, buffer)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	buffer = buffer[:n]
+
+	ext := strings.ToLower(GetFileExtension(name))
+	claimed := baseMime(mimeByExtension(ext))
+	detected := sniffMime(buffer, ext)
+	text := detected == "" && looksLikeText(buffer)
+
+	// Unknown extension: nothing to compare with
+	if claimed == "application/octet-stream" {
+		if detected != "" {
+			return detected, nil
+		}
+		return claimed, nil
+	}
+
+	switch {
+	case isTextMime(claimed):
+		// Any text format may be detected as plain text (or XML for SVG)
+		if text || isTextMime(detected) {
+			return claimed, nil
+		}
+	case detected == "" || isTextMime(detected):
+		// Content not recognized: only the formats without reliable signature are accepted
+		if !text && !isTextMime(detected) && !hasSignature(claimed) {
+			return claimed, nil
+		}
+	case mimeFamily(detected) == mimeFamily(claimed):
+		return claimed, nil
+	}
+
+	if detected == "" {
+		detected = "unknown binary content"
+		if text {
+			detected = "text"
+		}
+	}
+	return detected, fmt.Errorf("%w: %s content in a %s file", ErrContentMismatch, detected, ext)
+}
+
+// baseMime removes the parameters of a MIME type ("text/plain; charset=utf-8")
+func baseMime(mimeType string) string {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+// mimeFamily returns the reference type of a format, so that aliases are compared equal
+func mimeFamily(mimeType string) string {
+	if family, ok := mimeAliases[mimeType]; ok {
+		return family
+	}
+	return mimeType
+}
+
+// hasSignature reports whether the files of a format always start with a known signature
+func hasSignature(mimeType string) bool {
+	family := mimeFamily(mimeType)
+	if unreliableSignatures[family] {
+		return false
+	}
+	for _, sig := range fileSignatures {
+		if mimeFamily(sig.MimeType) == family {
+			return true
+		}
+	}
+	return false
+}
+
+// isTextMime reports whether a MIME type designates a text format
+func isTextMime(mimeType string) bool {
+	if strings.HasPrefix(mimeType, "text/") || strings.HasSuffix(mimeType, "+xml") || strings.HasSuffix(mimeType, "+json") {
+		return true
+	}
+	switch mimeType {
+	case "application/xml", "application/json", "application/javascript", "application/x-yaml", "application/yaml", "application/toml", "application/x-sh":
+		return true
+	}
+	return false
+}
+
+// looksLikeText completes isTextContent for UTF-8 text with many non-ASCII characters
+func looksLikeText(data []byte) bool {
+	if isTextContent(data) {
+		return true
+	}
+	for _, b := range data {
+		if b == 0 {
+			return false
+		}
+	}
+	// The buffer may end in the middle of a character
+	for cut := 0; cut < utf8.UTFMax && cut < len(data); cut++ {
+		if utf8.Valid(data[:len(data)-cut]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package content
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Beginnings of files of a few formats, followed by some padding
+var (
+	jpegContent = append([]byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00}, make([]byte, 64)...)
+	pngContent  = append([]byte{0x89, 'P', 'N', 'G', 0x0D, 0x0A, 0x1A, 0x0A, 0x00, 0x00, 0x00, 0x0D}, make([]byte, 64)...)
+	pdfContent  = []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+	zipContent  = append([]byte{'P', 'K', 0x03, 0x04, 0x14, 0x00, 0x06, 0x00}, make([]byte, 64)...)
+	exeContent  = append([]byte{'M', 'Z', 0x90, 0x00, 0x03, 0x00, 0x00, 0x00}, make([]byte, 64)...)
+	htmlContent = []byte("<!DOCTYPE html>\n<html><body><script>alert(document.cookie)</script></body></html>\n")
+	svgContent  = []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="10" height="10"/></svg>`)
+)
+
+func TestVerifyContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		content  []byte
+		want     string // Returned MIME type
+		mismatch bool
+	}{
+		{"JPEG image", "photo.jpg", jpegContent, "image/jpeg", false},
+		{"extension in capitals", "PHOTO.JPG", jpegContent, "image/jpeg", false},
+		{"PNG image", "photo.png", pngContent, "image/png", false},
+		{"PDF document", "report.pdf", pdfContent, "application/pdf", false},
+		{"Office document in a ZIP container", "letter.docx", zipContent, "application/vnd.openxmlformats-officedocument.wordprocessingml.document", false},
+		{"plain text", "notes.txt", []byte("Shopping list\n- bread\n- café\n"), "text/plain", false},
+		{"markdown", "README.md", []byte("# Title\n\nSome *text*.\n"), "text/markdown", false},
+		{"SVG image", "logo.svg", svgContent, "image/svg+xml", false},
+		{"MP3 without ID3 tag", "song.mp3", append([]byte{0xFF, 0xF3, 0x44, 0xC4}, make([]byte, 64)...), "audio/mpeg", false},
+		{"unknown extension: detected type", "photo.bin", pngContent, "image/png", false},
+		{"unknown extension and content", "data.bin", []byte{0x00, 0x01, 0x02, 0x03}, "application/octet-stream", false},
+
+		{"HTML as a JPEG image", "photo.jpg", htmlContent, "text", true},
+		{"PNG as a JPEG image", "photo.jpg", pngContent, "image/png", true},
+		{"executable as a PDF", "invoice.pdf", exeContent, "application/x-msdownload", true},
+		{"executable as a JPEG image", "photo.jpg", exeContent, "application/x-msdownload", true},
+		{"executable as text", "notes.txt", exeContent, "application/x-msdownload", true},
+		{"image as text", "notes.txt", pngContent, "image/png", true},
+		{"text as a ZIP archive", "archive.zip", []byte("not an archive\n"), "text", true},
+		{"binary as an Office document", "letter.docx", []byte{0x00, 0x01, 0x02, 0x03, 0x04}, "unknown binary content", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyContentType(bytes.NewReader(tt.content), tt.fileName)
+			if tt.mismatch {
+				if !errors.Is(err, ErrContentMismatch) {
+					t.Fatalf("VerifyContentType(%s) = %q, %v, want a mismatch", tt.fileName, got, err)
+				}
+				if !strings.HasPrefix(got, tt.want) {
+					t.Errorf("detected %q, want %q", got, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyContentType(%s) refused: %v", tt.fileName, err)
+			}
+			if got != tt.want {
+				t.Errorf("VerifyContentType(%s) = %q, want %q", tt.fileName, got, tt.want)
+			}
+		})
+	}
+}
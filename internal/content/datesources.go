@@ -0,0 +1,183 @@
+package content
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sources of the creation date of a file
+const (
+	DateSourceMetadata  = "metadata"  // Date embedded in the file (EXIF, PDF, Office, QuickTime, ID3)
+	DateSourceFilename  = "filename"  // Date found in the file name
+	DateSourceBirthtime = "birthtime" // Filesystem birth time
+	DateSourceMtime     = "mtime"     // Filesystem modification time
+	DateSourceCtime     = "ctime"     // Filesystem inode change time
+	DateSourceUpload    = "upload"    // Time the file was added to the index
+	DateSourceClient    = "client"    // Date provided by the client that uploaded the file
+)
+
+// DefaultDateSources is the priority chain used when none is configured
+var DefaultDateSources = []string{DateSourceMetadata, DateSourceFilename, DateSourceBirthtime, DateSourceMtime}
+
+// dateSourceAliases maps alternative names accepted in DATE_SOURCES
+var dateSourceAliases = map[string]string{
+	"exif":     DateSourceMetadata,
+	"embedded": DateSourceMetadata,
+	"added":    DateSourceUpload,
+}
+
+// dateSourceInput contains what the date sources can inspect about a file
+type dateSourceInput struct {
+	Path     string
+	Stat     os.FileInfo
+	AddedAt  time.Time
+	Metadata *FileMetadata // Embedded metadata (nil if absent)
+}
+
+// dateSourceFunc returns the date provided by a source, if any
+type dateSourceFunc func(input dateSourceInput) (time.Time, bool)
+
+// dateSourceFuncs contains the date sources that need no configuration
+var dateSourceFuncs = map[string]dateSourceFunc{
+	DateSourceMetadata: func(input dateSourceInput) (time.Time, bool) {
+		if input.Metadata == nil || input.Metadata.CreatedAt.IsZero() {
+			return time.Time{}, false
+		}
+		return input.Metadata.CreatedAt, true
+	},
+	DateSourceBirthtime: func(input dateSourceInput) (time.Time, bool) {
+		// Ignore a birthtime more recent than mtime (copy preserving mtime)
+		birthtime, ok := fileBirthTime(input.Path, input.Stat)
+		return birthtime, ok && !birthtime.After(input.Stat.ModTime())
+	},
+	DateSourceMtime: func(input dateSourceInput) (time.Time, bool) {
+		return input.Stat.ModTime(), true
+	},
+	DateSourceCtime: func(input dateSourceInput) (time.Time, bool) {
+		return fileChangeTime(input.Stat)
+	},
+	DateSourceUpload: func(input dateSourceInput) (time.Time, bool) {
+		return input.AddedAt, !input.AddedAt.IsZero()
+	},
+}
+
+// DateResolution is the result of the date-source chain for a file
+type DateResolution struct {
+	CreatedAt  time.Time
+	Source     string               // Source of the date; the metadata format (exif, pdf, ...) for embedded dates
+	Candidates map[string]time.Time // Dates reported by every known source
+}
+
+// WithOverride replaces the resolved date by a date set explicitly for the file, which takes
+// precedence over the whole chain; the dates of the other sources are kept for auditing
+func (r DateResolution) WithOverride(date *time.Time) DateResolution {
+	if date == nil || date.IsZero() {
+		return r
+	}
+	r.Candidates[DateSourceClient] = *date
+	r.CreatedAt = *date
+	r.Source = DateSourceClient
+	return r
+}
+
+// DateResolver walks a priority chain of date sources
+type DateResolver struct {
+	sources []string
+	funcs   map[string]dateSourceFunc
+}
+
+// NewDateResolver creates a resolver for the given chain, ignoring unknown sources.
+// The filename parser is used by the "filename" source (built-in patterns when nil).
+func NewDateResolver(sources []string, filenameParser *FilenameDateParser) *DateResolver {
+	if filenameParser == nil {
+		filenameParser, _ = NewFilenameDateParser(nil)
+	}
+
+	resolver := &DateResolver{
+		funcs: make(map[string]dateSourceFunc, len(dateSourceFuncs)+1),
+	}
+	for name, source := range dateSourceFuncs {
+		resolver.funcs[name] = source
+	}
+	resolver.funcs[DateSourceFilename] = func(input dateSourceInput) (time.Time, bool) {
+		return filenameParser.Parse(input.Path)
+	}
+
+	seen := make(map[string]bool)
+
+	for _, source := range sources {
+		name := strings.ToLower(strings.TrimSpace(source))
+		if alias, ok := dateSourceAliases[name]; ok {
+			name = alias
+		}
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := resolver.funcs[name]; !ok {
+			log.Printf("Unknown date source ignored: %s", source)
+			continue
+		}
+		seen[name] = true
+		resolver.sources = append(resolver.sources, name)
+	}
+
+	if len(resolver.sources) == 0 {
+		resolver.sources = DefaultDateSources
+	}
+
+	return resolver
+}
+
+// Sources returns the normalized priority chain
+func (r *DateResolver) Sources() []string {
+	return r.sources
+}
+
+// Resolve returns the date of the first source of the chain that reports one,
+// along with the dates of all known sources so disagreements can be audited.
+// mtime is used when no source of the chain matches.
+func (r *DateResolver) Resolve(path string, stat os.FileInfo, addedAt time.Time, metadata *FileMetadata) DateResolution {
+	resolution := DateResolution{
+		Candidates: make(map[string]time.Time),
+	}
+	input := dateSourceInput{Path: path, Stat: stat, AddedAt: addedAt, Metadata: metadata}
+
+	for name, source := range r.funcs {
+		if date, ok := source(input); ok {
+			resolution.Candidates[name] = date
+		}
+	}
+
+	for _, name := range r.sources {
+		if date, ok := resolution.Candidates[name]; ok {
+			resolution.CreatedAt = date
+			resolution.Source = name
+			if name == DateSourceMetadata {
+				resolution.Source = metadata.Format
+			}
+			return resolution
+		}
+	}
+
+	resolution.CreatedAt = stat.ModTime()
+	resolution.Source = DateSourceMtime
+	return resolution
+}
+
+// defaultDateResolver is used by DetectCreatedAt
+var defaultDateResolver = NewDateResolver(DefaultDateSources, nil)
+
+// DetectCreatedAt detects the creation date of a file using the default chain
+// (embedded metadata, then file name, then birthtime, then mtime) and returns the source used
+func DetectCreatedAt(path string) (time.Time, string, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	metadata, _ := ExtractMetadata(path, DetectMime(path))
+	resolution := defaultDateResolver.Resolve(path, stat, time.Time{}, metadata)
+	return resolution.CreatedAt, resolution.Source, nil
+}
@@ -0,0 +1,122 @@
+package content
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testFileInfo is the stat of a file that does not exist on disk
+type testFileInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (f testFileInfo) Name() string       { return f.name }
+func (f testFileInfo) Size() int64        { return 0 }
+func (f testFileInfo) Mode() os.FileMode  { return 0644 }
+func (f testFileInfo) ModTime() time.Time { return f.modTime }
+func (f testFileInfo) IsDir() bool        { return false }
+func (f testFileInfo) Sys() interface{}   { return nil }
+
+func TestDateResolver(t *testing.T) {
+	exifDate := time.Date(2019, 7, 14, 18, 30, 0, 0, time.UTC)
+	nameDate := time.Date(2021, 1, 2, 3, 4, 5, 0, time.Local)
+	birthtime := time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC)
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ctime := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	addedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// A photo with every date, a document with its own metadata and a file with none
+	photo := dateSourceInput{
+		Path:     "/photos/IMG_20210102_030405.jpg",
+		Stat:     testFileInfo{name: "IMG_20210102_030405.jpg", modTime: mtime},
+		AddedAt:  addedAt,
+		Metadata: &FileMetadata{Format: MetadataFormatExif, CreatedAt: exifDate},
+	}
+	document := dateSourceInput{
+		Path:     "/docs/report.pdf",
+		Stat:     testFileInfo{name: "report.pdf", modTime: mtime},
+		Metadata: &FileMetadata{Format: MetadataFormatPDF, CreatedAt: exifDate},
+	}
+	bare := dateSourceInput{
+		Path: "/photos/holiday.jpg",
+		Stat: testFileInfo{name: "holiday.jpg", modTime: mtime},
+	}
+
+	tests := []struct {
+		name       string
+		sources    []string // DATE_SOURCES
+		input      dateSourceInput
+		chain      []string // Normalized chain
+		source     string
+		date       time.Time
+		candidates []string // Sources reporting a date
+	}{
+		{"default chain", nil, photo, DefaultDateSources, MetadataFormatExif, exifDate,
+			[]string{DateSourceMetadata, DateSourceFilename, DateSourceBirthtime, DateSourceMtime, DateSourceCtime, DateSourceUpload}},
+		{"priority order", []string{"filename", "metadata"}, photo, []string{DateSourceFilename, DateSourceMetadata}, DateSourceFilename, nameDate,
+			[]string{DateSourceMetadata, DateSourceFilename, DateSourceBirthtime, DateSourceMtime, DateSourceCtime, DateSourceUpload}},
+		{"format of the metadata", []string{"metadata"}, document, []string{DateSourceMetadata}, MetadataFormatPDF, exifDate,
+			[]string{DateSourceMetadata, DateSourceBirthtime, DateSourceMtime, DateSourceCtime}},
+		{"aliases", []string{" EXIF ", "embedded", "added"}, photo, []string{DateSourceMetadata, DateSourceUpload}, MetadataFormatExif, exifDate, nil},
+		{"added alias first", []string{"added", "exif"}, photo, []string{DateSourceUpload, DateSourceMetadata}, DateSourceUpload, addedAt, nil},
+		{"unknown and duplicate names", []string{"mtime", "bogus", "MTIME", "", "metadata"}, photo, []string{DateSourceMtime, DateSourceMetadata}, DateSourceMtime, mtime, nil},
+		{"only unknown names", []string{"bogus", ""}, photo, DefaultDateSources, MetadataFormatExif, exifDate, nil},
+		{"birthtime", []string{"birthtime", "mtime"}, bare, []string{DateSourceBirthtime, DateSourceMtime}, DateSourceBirthtime, birthtime, nil},
+		{"ctime", []string{"ctime"}, bare, []string{DateSourceCtime}, DateSourceCtime, ctime, nil},
+		{"fallback to mtime", []string{"metadata", "filename", "upload"}, bare, []string{DateSourceMetadata, DateSourceFilename, DateSourceUpload}, DateSourceMtime, mtime,
+			[]string{DateSourceBirthtime, DateSourceMtime, DateSourceCtime}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := NewDateResolver(tt.sources, nil)
+			if !reflect.DeepEqual(resolver.Sources(), tt.chain) {
+				t.Errorf("chain %v, want %v", resolver.Sources(), tt.chain)
+			}
+			// The file does not exist: its birth and change times are given
+			resolver.funcs[DateSourceBirthtime] = func(dateSourceInput) (time.Time, bool) { return birthtime, true }
+			resolver.funcs[DateSourceCtime] = func(dateSourceInput) (time.Time, bool) { return ctime, true }
+
+			resolution := resolver.Resolve(tt.input.Path, tt.input.Stat, tt.input.AddedAt, tt.input.Metadata)
+			if resolution.Source != tt.source || !resolution.CreatedAt.Equal(tt.date) {
+				t.Errorf("date %v from %s, want %v from %s", resolution.CreatedAt, resolution.Source, tt.date, tt.source)
+			}
+			if tt.candidates == nil {
+				return
+			}
+			if len(resolution.Candidates) != len(tt.candidates) {
+				t.Errorf("candidates %v, want %v", resolution.Candidates, tt.candidates)
+			}
+			for _, name := range tt.candidates {
+				if _, ok := resolution.Candidates[name]; !ok {
+					t.Errorf("no %s candidate in %v", name, resolution.Candidates)
+				}
+			}
+		})
+	}
+}
+
+func TestDateResolutionWithOverride(t *testing.T) {
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	override := time.Date(2001, 9, 9, 1, 46, 40, 0, time.UTC)
+	stat := testFileInfo{name: "holiday.jpg", modTime: mtime}
+	resolver := NewDateResolver([]string{"mtime"}, nil)
+
+	resolution := resolver.Resolve("/photos/holiday.jpg", stat, time.Time{}, nil).WithOverride(&override)
+	if resolution.Source != DateSourceClient || !resolution.CreatedAt.Equal(override) {
+		t.Errorf("date %v from %s, want the override", resolution.CreatedAt, resolution.Source)
+	}
+	if !resolution.Candidates[DateSourceClient].Equal(override) || !resolution.Candidates[DateSourceMtime].Equal(mtime) {
+		t.Errorf("candidates %v, want the override and mtime", resolution.Candidates)
+	}
+
+	for _, date := range []*time.Time{nil, {}} {
+		resolution := resolver.Resolve("/photos/holiday.jpg", stat, time.Time{}, nil).WithOverride(date)
+		if resolution.Source != DateSourceMtime || !resolution.CreatedAt.Equal(mtime) {
+			t.Errorf("date %v from %s without override, want mtime", resolution.CreatedAt, resolution.Source)
+		}
+	}
+}
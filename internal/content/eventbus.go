@@ -0,0 +1,267 @@
+package content
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Back-pressure policies applied when the buffer of a subscriber is full
+const (
+	BackpressureBlock      = "block"       // Wait until the subscriber has room (no event is lost)
+	BackpressureDropNewest = "drop-newest" // Discard the event being published
+	BackpressureDropOldest = "drop-oldest" // Discard the oldest buffered event to make room
+)
+
+// DefaultEventBufferSize is the buffer of a subscriber when none is configured
+const DefaultEventBufferSize = 100
+
+// SubscribeOptions configures a subscriber of the event bus
+type SubscribeOptions struct {
+	BufferSize   int    // Number of events buffered for the subscriber (0 = DefaultEventBufferSize)
+	Backpressure string // Policy when the buffer is full (block, drop-newest, drop-oldest)
+}
+
+// Subscription receives the events published on the bus
+type Subscription struct {
+	name      string
+	policy    string
+	events    chan FileEvent
+	done      chan struct{}
+	closeOnce sync.Once
+	sendMu    sync.Mutex // Held while an event is delivered, so that the channel is not closed meanwhile
+	closed    bool       // Whether the channel is closed (guarded by sendMu)
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	bus       *EventBus
+}
+
+// Events returns the channel of the subscriber, closed on unsubscribe or when the bus is closed
+func (s *Subscription) Events() <-chan FileEvent {
+	return s.events
+}
+
+// Unsubscribe stops the delivery of events to the subscriber
+func (s *Subscription) Unsubscribe() {
+	s.bus.unsubscribe(s)
+}
+
+// SubscriberStats contains the delivery counters of a subscriber
+type SubscriberStats struct {
+	Name         string `json:"name"`
+	Backpressure string `json:"backpressure"`
+	Buffered     int    `json:"buffered"`
+	Capacity     int    `json:"capacity"`
+	Delivered    uint64 `json:"delivered"` // Events queued for the subscriber
+	Dropped      uint64 `json:"dropped"`
+}
+
+// EventBusStats contains the counters of the event bus
+type EventBusStats struct {
+	Published   uint64            `json:"published"`
+	Dropped     uint64            `json:"dropped"` // Including the drops of removed subscribers
+	Subscribers []SubscriberStats `json:"subscribers"`
+}
+
+// EventBus fans file events out to any number of subscribers, each with its own buffer
+type EventBus struct {
+	mu          sync.RWMutex // Guards the subscribers, never held while an event is delivered
+	subscribers map[*Subscription]struct{}
+	closed      chan struct{}
+	closeOnce   sync.Once
+	published   atomic.Uint64
+	dropped     atomic.Uint64
+}
+
+// NewEventBus creates an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[*Subscription]struct{}),
+		closed:      make(chan struct{}),
+	}
+}
+
+// Subscribe registers a subscriber. Unknown back-pressure policies fall back to block.
+func (b *EventBus) Subscribe(name string, options SubscribeOptions) *Subscription {
+	bufferSize := options.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultEventBufferSize
+	}
+
+	policy := strings.ToLower(strings.TrimSpace(options.Backpressure))
+	switch policy {
+	case BackpressureBlock, BackpressureDropNewest, BackpressureDropOldest:
+	case "":
+		policy = BackpressureBlock
+	default:
+		log.Printf("Unknown event back-pressure policy %q for %s, using %s", options.Backpressure, name, BackpressureBlock)
+		policy = BackpressureBlock
+	}
+
+	sub := &Subscription{
+		name:   name,
+		policy: policy,
+		events: make(chan FileEvent, bufferSize),
+		done:   make(chan struct{}),
+		bus:    b,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.closed:
+		sub.closed = true
+		close(sub.events)
+		return sub
+	default:
+	}
+
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe removes a subscriber and closes its channel
+func (b *EventBus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	delete(b.subscribers, sub)
+	b.mu.Unlock()
+
+	sub.closeEvents()
+}
+
+// closeEvents releases the publishers blocked on a subscriber, then closes its channel once
+// no event is being delivered to it
+func (s *Subscription) closeEvents() {
+	s.closeOnce.Do(func() { close(s.done) })
+
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+}
+
+// Publish delivers an event to every subscriber according to its back-pressure policy.
+// Publishing on a closed bus does nothing. The subscribers are delivered one after the other
+// without holding the lock of the bus: a publisher blocked by a full subscriber delays the
+// following subscribers, but not the subscriptions and unsubscriptions.
+func (b *EventBus) Publish(event FileEvent) {
+	b.mu.RLock()
+	select {
+	case <-b.closed:
+		b.mu.RUnlock()
+		return
+	default:
+	}
+
+	b.published.Add(1)
+	subscribers := make([]*Subscription, 0, len(b.subscribers))
+	for sub := range b.subscribers {
+		subscribers = append(subscribers, sub)
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range subscribers {
+		b.deliver(sub, event)
+	}
+}
+
+// deliver sends an event to a subscriber, unless it unsubscribed since the event was published
+func (b *EventBus) deliver(sub *Subscription, event FileEvent) {
+	sub.sendMu.Lock()
+	defer sub.sendMu.Unlock()
+	if sub.closed {
+		return
+	}
+
+	select {
+	case sub.events <- event:
+		sub.delivered.Add(1)
+		return
+	default:
+	}
+
+	switch sub.policy {
+	case BackpressureBlock:
+		select {
+		case sub.events <- event:
+			sub.delivered.Add(1)
+		case <-sub.done:
+			b.drop(sub, event)
+		case <-b.closed:
+			b.drop(sub, event)
+		}
+
+	case BackpressureDropOldest:
+		for {
+			select {
+			case sub.events <- event:
+				sub.delivered.Add(1)
+				return
+			default:
+			}
+			select {
+			case oldest := <-sub.events:
+				b.drop(sub, oldest)
+			default:
+			}
+		}
+
+	default:
+		b.drop(sub, event)
+	}
+}
+
+// drop counts an event lost by a subscriber
+func (b *EventBus) drop(sub *Subscription, event FileEvent) {
+	sub.dropped.Add(1)
+	b.dropped.Add(1)
+	log.Printf("Event dropped for %s (%s): %s %s", sub.name, sub.policy, event.Type, event.FilePath)
+}
+
+// Stats returns the counters of the bus and of its subscribers
+func (b *EventBus) Stats() EventBusStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stats := EventBusStats{
+		Published:   b.published.Load(),
+		Dropped:     b.dropped.Load(),
+		Subscribers: make([]SubscriberStats, 0, len(b.subscribers)),
+	}
+	for sub := range b.subscribers {
+		stats.Subscribers = append(stats.Subscribers, SubscriberStats{
+			Name:         sub.name,
+			Backpressure: sub.policy,
+			Buffered:     len(sub.events),
+			Capacity:     cap(sub.events),
+			Delivered:    sub.delivered.Load(),
+			Dropped:      sub.dropped.Load(),
+		})
+	}
+	sort.Slice(stats.Subscribers, func(i, j int) bool {
+		return stats.Subscribers[i].Name < stats.Subscribers[j].Name
+	})
+	return stats
+}
+
+// Close releases blocked publishers and closes the channels of all subscribers
+func (b *EventBus) Close() {
+	b.closeOnce.Do(func() { close(b.closed) })
+
+	b.mu.Lock()
+	subscribers := make([]*Subscription, 0, len(b.subscribers))
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		subscribers = append(subscribers, sub)
+	}
+	b.mu.Unlock()
+
+	for _, sub := range subscribers {
+		sub.closeEvents()
+	}
+}
@@ -0,0 +1,147 @@
+package content
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testEvent returns the event numbered n
+func testEvent(n int) FileEvent {
+	return FileEvent{Type: "added", FilePath: fmt.Sprintf("/files/%d", n)}
+}
+
+// collect reads the events of a subscription until its channel is closed, sleeping between them
+func collect(sub *Subscription, delay time.Duration) <-chan []FileEvent {
+	result := make(chan []FileEvent, 1)
+	go func() {
+		var events []FileEvent
+		for event := range sub.Events() {
+			events = append(events, event)
+			time.Sleep(delay)
+		}
+		result <- events
+	}()
+	return result
+}
+
+// assertInOrder checks that events are the events numbered from first, in order
+func assertInOrder(t *testing.T, events []FileEvent, first, count int) {
+	t.Helper()
+	if len(events) != count {
+		t.Fatalf("received %d events, want %d", len(events), count)
+	}
+	for idx, event := range events {
+		if want := testEvent(first + idx).FilePath; event.FilePath != want {
+			t.Fatalf("event %d is %s, want %s", idx, event.FilePath, want)
+		}
+	}
+}
+
+func TestEventBusBlockLosesNoEvent(t *testing.T) {
+	const count = 200
+	bus := NewEventBus()
+	sub := bus.Subscribe("slow", SubscribeOptions{BufferSize: 4, Backpressure: BackpressureBlock})
+	received := collect(sub, 100*time.Microsecond)
+
+	for n := 0; n < count; n++ {
+		bus.Publish(testEvent(n))
+	}
+	bus.Close()
+
+	assertInOrder(t, <-received, 0, count)
+	if stats := bus.Stats(); stats.Published != count || stats.Dropped != 0 {
+		t.Errorf("published %d and dropped %d events, want %d and 0", stats.Published, stats.Dropped, count)
+	}
+}
+
+func TestEventBusDropNextToBlock(t *testing.T) {
+	const count = 50
+	bus := NewEventBus()
+	slow := bus.Subscribe("slow", SubscribeOptions{BufferSize: 8, Backpressure: BackpressureBlock})
+	newest := bus.Subscribe("newest", SubscribeOptions{BufferSize: 2, Backpressure: BackpressureDropNewest})
+	oldest := bus.Subscribe("oldest", SubscribeOptions{BufferSize: 3, Backpressure: BackpressureDropOldest})
+	received := collect(slow, 100*time.Microsecond)
+
+	// The drop subscribers are not read until the end: their buffers stay full
+	for n := 0; n < count; n++ {
+		bus.Publish(testEvent(n))
+	}
+
+	stats := bus.Stats()
+	dropped := map[string]uint64{}
+	for _, sub := range stats.Subscribers {
+		dropped[sub.Name] = sub.Dropped
+	}
+	if dropped["slow"] != 0 || dropped["newest"] != count-2 || dropped["oldest"] != count-3 {
+		t.Errorf("dropped %v, want slow 0, newest %d and oldest %d", dropped, count-2, count-3)
+	}
+	if stats.Dropped != 2*count-5 {
+		t.Errorf("the bus dropped %d events, want %d", stats.Dropped, 2*count-5)
+	}
+
+	bus.Close()
+	assertInOrder(t, <-received, 0, count)
+	assertInOrder(t, drain(newest), 0, 2)
+	assertInOrder(t, drain(oldest), count-3, 3)
+}
+
+// drain returns the events left in the channel of a closed subscription
+func drain(sub *Subscription) []FileEvent {
+	var events []FileEvent
+	for event := range sub.Events() {
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestEventBusBlockedPublisherDoesNotStallSubscriptions(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+	stuck := bus.Subscribe("stuck", SubscribeOptions{BufferSize: 1, Backpressure: BackpressureBlock})
+
+	// The second event waits for room in the buffer of the subscriber, which never reads
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(testEvent(0))
+		bus.Publish(testEvent(1))
+		close(published)
+	}()
+
+	subscribed := make(chan *Subscription)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		other := bus.Subscribe("other", SubscribeOptions{})
+		other.Unsubscribe()
+		subscribed <- other
+	}()
+	select {
+	case <-subscribed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Subscribe and Unsubscribe wait for a blocked publisher")
+	}
+
+	// Unsubscribing releases the publisher, the pending event being counted as dropped
+	stuck.Unsubscribe()
+	select {
+	case <-published:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the publisher is still blocked after Unsubscribe")
+	}
+	if stats := bus.Stats(); stats.Dropped != 1 {
+		t.Errorf("dropped %d events, want 1", stats.Dropped)
+	}
+	assertInOrder(t, drain(stuck), 0, 1)
+}
+
+func TestEventBusClosedBus(t *testing.T) {
+	bus := NewEventBus()
+	bus.Close()
+
+	sub := bus.Subscribe("late", SubscribeOptions{})
+	bus.Publish(testEvent(0))
+	if events := drain(sub); len(events) != 0 {
+		t.Errorf("received %d events from a closed bus", len(events))
+	}
+	sub.Unsubscribe() // Must not close the channel twice
+}
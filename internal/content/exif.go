@@ -0,0 +1,524 @@
+package content
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// EXIF tags used to determine the capture date
+const (
+	exifTagExifIFDPointer     = 0x8769
+	exifTagDateTimeOriginal   = 0x9003
+	exifTagCreateDate         = 0x9004
+	exifTagOffsetTime         = 0x9010
+	exifTagOffsetTimeOriginal = 0x9011
+	exifTagOffsetTimeDigit    = 0x9012
+)
+
+// exifTagNames lists the ASCII tags exposed in the raw metadata
+var exifTagNames = map[uint16]string{
+	0x010F:                    "Make",
+	0x0110:                    "Model",
+	0x0131:                    "Software",
+	0x0132:                    "ModifyDate",
+	0x013B:                    "Artist",
+	exifTagDateTimeOriginal:   "DateTimeOriginal",
+	exifTagCreateDate:         "CreateDate",
+	exifTagOffsetTime:         "OffsetTime",
+	exifTagOffsetTimeOriginal: "OffsetTimeOriginal",
+	exifTagOffsetTimeDigit:    "OffsetTimeDigitized",
+	0xA434:                    "LensModel",
+}
+
+// Maximum amount of metadata read from a container
+const maxExifSize = 1024 * 1024
+
+var (
+	errNoExif      = errors.New("no EXIF data found")
+	exifPrefix     = []byte("Exif\x00\x00")
+	exifDateLayout = "2006:01:02 15:04:05"
+)
+
+// ReadExifDate reads the capture date from the EXIF data of a JPEG, TIFF, HEIC or WebP file.
+// DateTimeOriginal is preferred over CreateDate, and the offset tags are applied when present.
+func ReadExifDate(path string) (time.Time, error) {
+	metadata, err := ReadExif(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if metadata.CreatedAt.IsZero() {
+		return time.Time{}, errNoExif
+	}
+	return metadata.CreatedAt, nil
+}
+
+// ReadExif reads the EXIF data of a JPEG, TIFF, HEIC or WebP file
+func ReadExif(path string) (*FileMetadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil, errNoExif
+	}
+
+	var tiff []byte
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		tiff, err = readJPEGExif(file)
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		tiff, err = readTIFFExif(file, stat.Size())
+	case bytes.HasPrefix(header, []byte("RIFF")) && string(header[8:12]) == "WEBP":
+		tiff, err = readWebPExif(file)
+	case string(header[4:8]) == "ftyp":
+		tiff, err = readHEIFExif(file, stat.Size())
+	default:
+		return nil, errNoExif
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseExif(tiff)
+}
+
+// readJPEGExif extracts the TIFF structure stored in the APP1 segment of a JPEG
+func readJPEGExif(file *os.File) ([]byte, error) {
+	if _, err := file.Seek(2, io.SeekStart); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	segment := make([]byte, 4)
+
+	for {
+		if _, err := io.ReadFull(reader, segment); err != nil {
+			return nil, errNoExif
+		}
+		if segment[0] != 0xFF {
+			return nil, errNoExif
+		}
+
+		marker := segment[1]
+		length := int(binary.BigEndian.Uint16(segment[2:4])) - 2
+		if length < 0 {
+			return nil, errNoExif
+		}
+
+		// Start of scan: no more metadata segments
+		if marker == 0xDA {
+			return nil, errNoExif
+		}
+
+		if marker == 0xE1 {
+			data := make([]byte, length)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return nil, err
+			}
+			if bytes.HasPrefix(data, exifPrefix) {
+				return data[len(exifPrefix):], nil
+			}
+			continue
+		}
+
+		if _, err := reader.Discard(length); err != nil {
+			return nil, errNoExif
+		}
+	}
+}
+
+// readTIFFExif reads the beginning of a TIFF file (the IFDs are usually stored first)
+func readTIFFExif(file *os.File, size int64) ([]byte, error) {
+	if size > maxExifSize {
+		size = maxExifSize
+	}
+	data := make([]byte, size)
+	if _, err := file.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readWebPExif extracts the EXIF chunk of a WebP file
+func readWebPExif(file *os.File) ([]byte, error) {
+	if _, err := file.Seek(12, io.SeekStart); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	chunk := make([]byte, 8)
+
+	for {
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return nil, errNoExif
+		}
+
+		fourCC := string(chunk[:4])
+		length := int(binary.LittleEndian.Uint32(chunk[4:8]))
+		padded := length + length%2
+
+		if fourCC == "EXIF" {
+			if length > maxExifSize {
+				return nil, fmt.Errorf("EXIF chunk too large: %d bytes", length)
+			}
+			data := make([]byte, length)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return nil, err
+			}
+			return bytes.TrimPrefix(data, exifPrefix), nil
+		}
+
+		if _, err := reader.Discard(padded); err != nil {
+			return nil, errNoExif
+		}
+	}
+}
+
+// readHEIFExif extracts the "Exif" item of a HEIF/HEIC file using the iinf and iloc boxes
+func readHEIFExif(file *os.File, size int64) ([]byte, error) {
+	boxes, err := readBMFFBoxes(file, 0, size)
+	if err != nil && len(boxes) == 0 {
+		return nil, err
+	}
+
+	metaBox, ok := findBMFFBox(boxes, "meta")
+	if !ok {
+		return nil, errNoExif
+	}
+
+	// meta is a full box: skip version and flags
+	children, err := readBMFFBoxes(file, metaBox.Offset+4, metaBox.Offset+metaBox.Size)
+	if err != nil && len(children) == 0 {
+		return nil, err
+	}
+
+	iinfBox, ok := findBMFFBox(children, "iinf")
+	if !ok {
+		return nil, errNoExif
+	}
+	ilocBox, ok := findBMFFBox(children, "iloc")
+	if !ok {
+		return nil, errNoExif
+	}
+
+	iinf, err := readBMFFPayload(file, iinfBox, maxExifSize)
+	if err != nil {
+		return nil, err
+	}
+	itemID, err := findHEIFItem(iinf, "Exif")
+	if err != nil {
+		return nil, err
+	}
+
+	iloc, err := readBMFFPayload(file, ilocBox, maxExifSize)
+	if err != nil {
+		return nil, err
+	}
+	offset, length, err := findHEIFItemLocation(iloc, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxExifSize || length < 4 {
+		return nil, fmt.Errorf("invalid Exif item length: %d", length)
+	}
+	if offset > uint64(size) || length > uint64(size)-offset {
+		return nil, fmt.Errorf("Exif item outside of the file: offset %d, length %d", offset, length)
+	}
+
+	data := make([]byte, length)
+	if _, err := file.ReadAt(data, int64(offset)); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	// The item starts with the offset of the TIFF header
+	headerOffset := 4 + int(binary.BigEndian.Uint32(data[:4]))
+	if headerOffset > len(data) {
+		return nil, errNoExif
+	}
+	return bytes.TrimPrefix(data[headerOffset:], exifPrefix), nil
+}
+
+// findHEIFItem returns the ID of the first item of the given type in an iinf payload
+func findHEIFItem(iinf []byte, itemType string) (uint64, error) {
+	if len(iinf) < 4 {
+		return 0, errNoExif
+	}
+	version := iinf[0]
+	pos := 4
+	countSize := 2
+	if version > 0 {
+		countSize = 4
+	}
+	_, pos, err := readUintN(iinf, pos, countSize)
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := readBMFFBoxes(bytes.NewReader(iinf), int64(pos), int64(len(iinf)))
+	if err != nil && len(entries) == 0 {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		if entry.Type != "infe" {
+			continue
+		}
+		if entry.Offset < 0 || entry.Size < 0 || entry.Size > int64(len(iinf))-entry.Offset {
+			continue
+		}
+		infe := iinf[entry.Offset : entry.Offset+entry.Size]
+		if len(infe) < 4 || infe[0] < 2 {
+			// Versions 0 and 1 have no item type
+			continue
+		}
+		idSize := 2
+		if infe[0] >= 3 {
+			idSize = 4
+		}
+		id, next, err := readUintN(infe, 4, idSize)
+		if err != nil {
+			continue
+		}
+		// Skip item_protection_index
+		next += 2
+		if next >= 0 && next+4 <= len(infe) && string(infe[next:next+4]) == itemType {
+			return id, nil
+		}
+	}
+
+	return 0, errNoExif
+}
+
+// findHEIFItemLocation returns the absolute offset and length of an item from an iloc payload
+func findHEIFItemLocation(iloc []byte, itemID uint64) (uint64, uint64, error) {
+	if len(iloc) < 6 {
+		return 0, 0, errNoExif
+	}
+	version := iloc[0]
+	offsetSize := int(iloc[4] >> 4)
+	lengthSize := int(iloc[4] & 0x0F)
+	baseOffsetSize := int(iloc[5] >> 4)
+	indexSize := 0
+	if version == 1 || version == 2 {
+		indexSize = int(iloc[5] & 0x0F)
+	}
+
+	pos := 6
+	countSize := 2
+	if version == 2 {
+		countSize = 4
+	}
+	itemCount, pos, err := readUintN(iloc, pos, countSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for n := uint64(0); n < itemCount; n++ {
+		var id uint64
+		if id, pos, err = readUintN(iloc, pos, countSize); err != nil {
+			return 0, 0, err
+		}
+		if version == 1 || version == 2 {
+			// Reserved bits and construction method
+			pos += 2
+		}
+		// Data reference index
+		pos += 2
+
+		var baseOffset uint64
+		if baseOffset, pos, err = readUintN(iloc, pos, baseOffsetSize); err != nil {
+			return 0, 0, err
+		}
+		var extentCount uint64
+		if extentCount, pos, err = readUintN(iloc, pos, 2); err != nil {
+			return 0, 0, err
+		}
+
+		var firstOffset, totalLength uint64
+		for e := uint64(0); e < extentCount; e++ {
+			if indexSize > 0 {
+				if _, pos, err = readUintN(iloc, pos, indexSize); err != nil {
+					return 0, 0, err
+				}
+			}
+			var extentOffset, extentLength uint64
+			if extentOffset, pos, err = readUintN(iloc, pos, offsetSize); err != nil {
+				return 0, 0, err
+			}
+			if extentLength, pos, err = readUintN(iloc, pos, lengthSize); err != nil {
+				return 0, 0, err
+			}
+			if e == 0 {
+				firstOffset = extentOffset
+			}
+			if totalLength+extentLength < totalLength {
+				return 0, 0, fmt.Errorf("invalid extent length: %d", extentLength)
+			}
+			totalLength += extentLength
+		}
+
+		if id == itemID {
+			if baseOffset+firstOffset < baseOffset {
+				return 0, 0, fmt.Errorf("invalid item offset: %d", firstOffset)
+			}
+			return baseOffset + firstOffset, totalLength, nil
+		}
+	}
+
+	return 0, 0, errNoExif
+}
+
+// parseExif reads the tags and the capture date from a TIFF structure
+func parseExif(tiff []byte) (*FileMetadata, error) {
+	if len(tiff) < 8 {
+		return nil, errNoExif
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errNoExif
+	}
+
+	ifd0 := readIFD(tiff, order, order.Uint32(tiff[4:8]))
+	tags := ifd0
+	if pointer, ok := ifd0[exifTagExifIFDPointer]; ok {
+		exifIFD := readIFD(tiff, order, pointer.offset(order))
+		for tag, entry := range exifIFD {
+			tags[tag] = entry
+		}
+	}
+
+	metadata := &FileMetadata{
+		Format: MetadataFormatExif,
+		Raw:    make(map[string]string),
+	}
+	for tag, name := range exifTagNames {
+		if entry, ok := tags[tag]; ok {
+			if value := entry.ascii(tiff, order); value != "" {
+				metadata.Raw[name] = value
+			}
+		}
+	}
+
+	candidates := []struct {
+		dateTag   uint16
+		offsetTag uint16
+	}{
+		{exifTagDateTimeOriginal, exifTagOffsetTimeOriginal},
+		{exifTagCreateDate, exifTagOffsetTimeDigit},
+	}
+
+	for _, candidate := range candidates {
+		entry, ok := tags[candidate.dateTag]
+		if !ok {
+			continue
+		}
+		value := entry.ascii(tiff, order)
+
+		offset := ""
+		if offsetEntry, ok := tags[candidate.offsetTag]; ok {
+			offset = offsetEntry.ascii(tiff, order)
+		} else if offsetEntry, ok := tags[exifTagOffsetTime]; ok {
+			offset = offsetEntry.ascii(tiff, order)
+		}
+
+		if date, err := parseExifDateTime(value, offset); err == nil {
+			metadata.CreatedAt = date
+			break
+		}
+	}
+
+	return metadata, nil
+}
+
+// parseExifDateTime parses an EXIF date ("2006:01:02 15:04:05") with an optional offset ("+02:00")
+func parseExifDateTime(value, offset string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < len(exifDateLayout) || strings.HasPrefix(value, "0000") {
+		return time.Time{}, fmt.Errorf("invalid EXIF date: %q", value)
+	}
+	value = value[:len(exifDateLayout)]
+
+	offset = strings.TrimSpace(offset)
+	if offset != "" {
+		if date, err := time.Parse(exifDateLayout+"-07:00", value+offset); err == nil {
+			return date, nil
+		}
+	}
+
+	// Without offset, EXIF dates are expressed in the local time of the camera
+	return time.ParseInLocation(exifDateLayout, value, time.Local)
+}
+
+// ifdEntry represents an entry of an image file directory
+type ifdEntry struct {
+	dataType uint16
+	count    uint32
+	value    []byte
+}
+
+// readIFD reads the entries of the IFD located at the given offset
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) map[uint16]ifdEntry {
+	entries := make(map[uint16]ifdEntry)
+	if int(offset)+2 > len(tiff) {
+		return entries
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	pos := int(offset) + 2
+	for n := 0; n < count && pos+12 <= len(tiff); n++ {
+		entries[order.Uint16(tiff[pos:])] = ifdEntry{
+			dataType: order.Uint16(tiff[pos+2:]),
+			count:    order.Uint32(tiff[pos+4:]),
+			value:    tiff[pos+8 : pos+12],
+		}
+		pos += 12
+	}
+
+	return entries
+}
+
+// offset returns the entry value interpreted as an offset
+func (e ifdEntry) offset(order binary.ByteOrder) uint32 {
+	return order.Uint32(e.value)
+}
+
+// ascii returns the entry value interpreted as an ASCII string
+func (e ifdEntry) ascii(tiff []byte, order binary.ByteOrder) string {
+	const typeASCII = 2
+	if e.dataType != typeASCII {
+		return ""
+	}
+
+	var data []byte
+	if e.count <= 4 {
+		data = e.value[:e.count]
+	} else {
+		start := int(e.offset(order))
+		end := start + int(e.count)
+		if start < 0 || end > len(tiff) {
+			return ""
+		}
+		data = tiff[start:end]
+	}
+
+	return strings.TrimRight(string(data), "\x00 ")
+}
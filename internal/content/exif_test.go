@@ -0,0 +1,237 @@
+package content
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testTag is an ASCII tag of a test TIFF structure
+type testTag struct {
+	tag   uint16
+	value string
+}
+
+// testTIFF builds a little-endian TIFF structure with ASCII tags in IFD0 and in the EXIF IFD
+func testTIFF(ifd0, exifIFD []testTag) []byte {
+	order := binary.LittleEndian
+	ifdSize := func(count int) int { return 2 + 12*count + 4 }
+
+	ifd0Count := len(ifd0)
+	if len(exifIFD) > 0 {
+		ifd0Count++
+	}
+	exifOffset := 8 + ifdSize(ifd0Count)
+	dataOffset := exifOffset
+	if len(exifIFD) > 0 {
+		dataOffset += ifdSize(len(exifIFD))
+	}
+
+	var values []byte
+	appendIFD := func(tiff []byte, tags []testTag, pointer int) []byte {
+		count := len(tags)
+		if pointer > 0 {
+			count++
+		}
+		tiff = order.AppendUint16(tiff, uint16(count))
+		for _, tag := range tags {
+			value := tag.value + "\x00"
+			tiff = order.AppendUint16(tiff, tag.tag)
+			tiff = order.AppendUint16(tiff, 2)
+			tiff = order.AppendUint32(tiff, uint32(len(value)))
+			if len(value) <= 4 {
+				tiff = append(tiff, make([]byte, 4)...)
+				copy(tiff[len(tiff)-4:], value)
+			} else {
+				tiff = order.AppendUint32(tiff, uint32(dataOffset+len(values)))
+				values = append(values, value...)
+			}
+		}
+		if pointer > 0 {
+			tiff = order.AppendUint16(tiff, exifTagExifIFDPointer)
+			tiff = order.AppendUint16(tiff, 4)
+			tiff = order.AppendUint32(tiff, 1)
+			tiff = order.AppendUint32(tiff, uint32(pointer))
+		}
+		return order.AppendUint32(tiff, 0)
+	}
+
+	tiff := append([]byte("II*\x00"), 8, 0, 0, 0)
+	pointer := 0
+	if len(exifIFD) > 0 {
+		pointer = exifOffset
+	}
+	tiff = appendIFD(tiff, ifd0, pointer)
+	if len(exifIFD) > 0 {
+		tiff = appendIFD(tiff, exifIFD, 0)
+	}
+	return append(tiff, values...)
+}
+
+// testJPEG wraps a TIFF structure in the APP1 segment of a JPEG
+func testJPEG(tiff []byte) []byte {
+	jpeg := []byte{0xFF, 0xD8}
+	jpeg = append(jpeg, 0xFF, 0xE0, 0, 16)
+	jpeg = append(jpeg, "JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"...)
+	segment := append(append([]byte{}, exifPrefix...), tiff...)
+	jpeg = append(jpeg, 0xFF, 0xE1)
+	jpeg = binary.BigEndian.AppendUint16(jpeg, uint16(2+len(segment)))
+	jpeg = append(jpeg, segment...)
+	return append(jpeg, 0xFF, 0xDA, 0, 2)
+}
+
+// testWebP stores a TIFF structure in the EXIF chunk of a WebP file, after a padded chunk
+func testWebP(tiff []byte) []byte {
+	chunk := func(fourCC string, data []byte) []byte {
+		c := binary.LittleEndian.AppendUint32([]byte(fourCC), uint32(len(data)))
+		c = append(c, data...)
+		if len(data)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+	body := append([]byte("WEBP"), chunk("VP8X", []byte{1, 2, 3})...)
+	body = append(body, chunk("EXIF", append(append([]byte{}, exifPrefix...), tiff...))...)
+	return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+}
+
+// testHEIF stores a TIFF structure as the "Exif" item of a HEIF file
+func testHEIF(tiff []byte) []byte {
+	ftyp := testBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+
+	// Version 2 item entries: ID, protection index, type and empty name
+	infe := func(id uint16, itemType string) []byte {
+		payload := append([]byte{2, 0, 0, 0}, byte(id>>8), byte(id), 0, 0)
+		return testBox("infe", append(append(payload, itemType...), 0))
+	}
+	iinf := testBox("iinf", []byte{0, 0, 0, 0, 0, 2}, infe(1, "hvc1"), infe(2, "Exif"))
+
+	item := binary.BigEndian.AppendUint32(nil, uint32(len(exifPrefix)))
+	item = append(append(item, exifPrefix...), tiff...)
+
+	// The iloc box has a fixed size: compute the offset of the item in mdat from it
+	iloc := func(offset uint32) []byte {
+		payload := []byte{0, 0, 0, 0, 0x44, 0x00, 0, 1}
+		payload = append(payload, 0, 2, 0, 0, 0, 1)
+		payload = binary.BigEndian.AppendUint32(payload, offset)
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(item)))
+		return testBox("iloc", payload)
+	}
+	meta := func(offset uint32) []byte {
+		return testBox("meta", []byte{0, 0, 0, 0}, iinf, iloc(offset))
+	}
+	offset := uint32(len(ftyp) + len(meta(0)) + 8)
+	return bytes.Join([][]byte{ftyp, meta(offset), testBox("mdat", item)}, nil)
+}
+
+// writeExifTestFile writes the data of a test image in a temporary file
+func writeExifTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadExif(t *testing.T) {
+	ifd0 := []testTag{{0x010F, "Canon"}, {0x0110, "EOS R6"}}
+	withOffset := testTIFF(ifd0, []testTag{
+		{exifTagDateTimeOriginal, "2023:05:14 10:12:33"},
+		{exifTagOffsetTimeOriginal, "+02:00"},
+	})
+	paris := time.FixedZone("", 2*60*60)
+
+	tests := []struct {
+		name string
+		data []byte
+		want time.Time
+	}{
+		{"photo.tif", withOffset, time.Date(2023, 5, 14, 10, 12, 33, 0, paris)},
+		{"photo.jpg", testJPEG(withOffset), time.Date(2023, 5, 14, 10, 12, 33, 0, paris)},
+		{"photo.webp", testWebP(withOffset), time.Date(2023, 5, 14, 10, 12, 33, 0, paris)},
+		{"photo.heic", testHEIF(withOffset), time.Date(2023, 5, 14, 10, 12, 33, 0, paris)},
+		{
+			"local.jpg",
+			testJPEG(testTIFF(ifd0, []testTag{{exifTagDateTimeOriginal, "2021:06:04 18:22:31"}})),
+			time.Date(2021, 6, 4, 18, 22, 31, 0, time.Local),
+		},
+		{
+			"create-date.jpg",
+			testJPEG(testTIFF(ifd0, []testTag{
+				{exifTagDateTimeOriginal, "0000:00:00 00:00:00"},
+				{exifTagCreateDate, "2020:01:05 13:02:03"},
+				{exifTagOffsetTime, "-05:00"},
+			})),
+			time.Date(2020, 1, 5, 13, 2, 3, 0, time.FixedZone("", -5*60*60)),
+		},
+		{"no-date.jpg", testJPEG(testTIFF(ifd0, nil)), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := ReadExif(writeExifTestFile(t, tt.name, tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !metadata.CreatedAt.Equal(tt.want) {
+				t.Errorf("date %v, want %v", metadata.CreatedAt, tt.want)
+			}
+			if metadata.Raw["Make"] != "Canon" || metadata.Raw["Model"] != "EOS R6" {
+				t.Errorf("raw metadata %v", metadata.Raw)
+			}
+		})
+	}
+}
+
+func TestReadExifMalformed(t *testing.T) {
+	tiff := testTIFF([]testTag{{0x010F, "Canon"}}, []testTag{{exifTagDateTimeOriginal, "2023:05:14 10:12:33"}})
+
+	// Boxes whose 64-bit size overflows the offsets, at each level of the HEIF structure
+	huge := uint64(0x7FFFFFFFFFFFFFFF)
+	heif := func(boxes ...[]byte) []byte {
+		return append(testBox("ftyp", []byte("heic")), bytes.Join(boxes, nil)...)
+	}
+	fullBox := []byte{0, 0, 0, 0}
+	exifEntry := testBox("infe", []byte{2, 0, 0, 0, 0, 1, 0, 0}, []byte("Exif\x00"))
+	// One item with one extent of 8-byte offset and length
+	hugeLocation := testBox("iloc", []byte{0, 0, 0, 0, 0x88, 0x00, 0, 1, 0, 1, 0, 0, 0, 1},
+		[]byte{0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0, 0, 0, 0x10, 0})
+	oversized := map[string][]byte{
+		"top-level box": heif(testLargeBox("meta", huge, make([]byte, 8))),
+		"meta child":    heif(testBox("meta", fullBox, testLargeBox("iinf", huge, make([]byte, 8)))),
+		"item entry": heif(testBox("meta", fullBox,
+			testBox("iinf", []byte{0, 0, 0, 0, 0, 1}, testLargeBox("infe", huge, nil)), testBox("iloc"))),
+		"item location": heif(testBox("meta", fullBox,
+			testBox("iinf", []byte{0, 0, 0, 0, 0, 1}, exifEntry), hugeLocation)),
+	}
+	for name, data := range oversized {
+		t.Run(name, func(t *testing.T) {
+			if metadata, err := ReadExif(writeExifTestFile(t, "crafted.heic", data)); err == nil {
+				t.Errorf("crafted file accepted: %+v", metadata)
+			}
+		})
+	}
+
+	// Every truncation of valid files is refused or read without a date, never with a crash
+	for name, data := range map[string][]byte{
+		"photo.tif":  tiff,
+		"photo.jpg":  testJPEG(tiff),
+		"photo.webp": testWebP(tiff),
+		"photo.heic": testHEIF(tiff),
+	} {
+		path := filepath.Join(t.TempDir(), name)
+		dateEnd := bytes.Index(data, []byte("2023:05:14 10:12:33")) + len(exifDateLayout)
+		for size := 0; size < len(data); size++ {
+			if err := os.WriteFile(path, data[:size], 0644); err != nil {
+				t.Fatal(err)
+			}
+			if metadata, err := ReadExif(path); err == nil && !metadata.CreatedAt.IsZero() && size < dateEnd {
+				t.Errorf("%s truncated to %d bytes read with the date %v", name, size, metadata.CreatedAt)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package content
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// builtinFilenamePatterns matches the names produced by common cameras, phones and tools.
+// Patterns use named groups: year, month, day and optionally hour, minute, second, ampm.
+// They are tried in order, the most precise first.
+var builtinFilenamePatterns = []string{
+	// Screenshot 2024-02-01 at 10.22.11.png, WhatsApp Image 2021-06-04 at 18.22.31.jpeg,
+	// Screen Shot 2020-01-05 at 1.02.03 PM.png
+	`(?:^|\D)(?P<year>(?:19|20)\d{2})-(?P<month>\d{2})-(?P<day>\d{2})[ _]at[ _](?P<hour>\d{1,2})[.:](?P<minute>\d{2})[.:](?P<second>\d{2})(?:[\s\x{202F}]?(?P<ampm>[AaPp][Mm]))?`,
+	// IMG_20230514_101233.jpg, PXL_20230514_101233123.jpg, Screenshot_20230514-101233.png,
+	// 2023-05-14 10.12.33.jpg, 2023-05-14_10-12-33.mp4, signal-2023-05-14-101233.jpg
+	`(?:^|\D)(?P<year>(?:19|20)\d{2})[-_.]?(?P<month>\d{2})[-_.]?(?P<day>\d{2})[T _-](?P<hour>\d{2})[-_.:h]?(?P<minute>\d{2})[-_.:m]?(?P<second>\d{2})`,
+	// report_2022-11-30.pdf, scan 2022.11.30.pdf, notes_2022_11_30.txt
+	`(?:^|\D)(?P<year>(?:19|20)\d{2})[-_.](?P<month>\d{2})[-_.](?P<day>\d{2})(?:\D|$)`,
+	// IMG-20210604-WA0001.jpg, 20230514.pdf
+	`(?:^|\D)(?P<year>(?:19|20)\d{2})(?P<month>\d{2})(?P<day>\d{2})(?:\D|$)`,
+	// Facture 30.11.2022.pdf, invoice_30-11-2022.pdf
+	`(?:^|\D)(?P<day>\d{2})[-.](?P<month>\d{2})[-.](?P<year>(?:19|20)\d{2})(?:\D|$)`,
+}
+
+// FilenameDateParser extracts dates from file names
+type FilenameDateParser struct {
+	patterns []*regexp.Regexp
+	location *time.Location
+}
+
+// NewFilenameDateParser creates a parser using the custom patterns first, then the built-in ones.
+// Custom patterns must define at least the year, month and day named groups.
+func NewFilenameDateParser(customPatterns []string) (*FilenameDateParser, error) {
+	parser := &FilenameDateParser{location: time.Local}
+
+	for _, pattern := range customPatterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filename date pattern %q: %w", pattern, err)
+		}
+		for _, group := range []string{"year", "month", "day"} {
+			if re.SubexpIndex(group) < 0 {
+				return nil, fmt.Errorf("filename date pattern %q has no %q group", pattern, group)
+			}
+		}
+		parser.patterns = append(parser.patterns, re)
+	}
+
+	for _, pattern := range builtinFilenamePatterns {
+		parser.patterns = append(parser.patterns, regexp.MustCompile(pattern))
+	}
+
+	return parser, nil
+}
+
+// Parse returns the date found in the name of a file, interpreted in local time
+func (p *FilenameDateParser) Parse(name string) (time.Time, bool) {
+	name = filepath.Base(name)
+
+	for _, re := range p.patterns {
+		for _, match := range re.FindAllStringSubmatch(name, -1) {
+			if date, ok := p.dateFromMatch(re, match); ok {
+				return date, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// dateFromMatch builds and validates a date from the named groups of a match
+func (p *FilenameDateParser) dateFromMatch(re *regexp.Regexp, match []string) (time.Time, bool) {
+	group := func(name string) (int, bool) {
+		index := re.SubexpIndex(name)
+		if index < 0 || match[index] == "" {
+			return 0, false
+		}
+		value, err := strconv.Atoi(match[index])
+		return value, err == nil
+	}
+
+	year, okYear := group("year")
+	month, okMonth := group("month")
+	day, okDay := group("day")
+	if !okYear || !okMonth || !okDay {
+		return time.Time{}, false
+	}
+	hour, _ := group("hour")
+	minute, _ := group("minute")
+	second, _ := group("second")
+
+	if index := re.SubexpIndex("ampm"); index >= 0 && match[index] != "" {
+		if hour < 1 || hour > 12 {
+			return time.Time{}, false
+		}
+		hour %= 12
+		if strings.EqualFold(match[index], "pm") {
+			hour += 12
+		}
+	}
+
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, false
+	}
+
+	date := time.Date(year, time.Month(month), day, hour, minute, second, 0, p.location)
+
+	// Reject normalized dates (e.g. February 30th) and dates in the future
+	if date.Day() != day || date.Month() != time.Month(month) {
+		return time.Time{}, false
+	}
+	if date.After(time.Now().Add(24 * time.Hour)) {
+		return time.Time{}, false
+	}
+
+	return date, true
+}
@@ -0,0 +1,110 @@
+package content
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilenameDateParser(t *testing.T) {
+	parser, err := NewFilenameDateParser(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Names produced by real cameras, phones and tools; an empty date means no date
+	tests := []struct {
+		name string
+		want string
+	}{
+		// Cameras and phones
+		{"IMG_20230101_120000.jpg", "2023-01-01 12:00:00"},
+		{"VID_20230514_101233.mp4", "2023-05-14 10:12:33"},
+		{"PXL_20230514_101233123.jpg", "2023-05-14 10:12:33"},
+		{"PXL_20230514_101233123.MP.jpg", "2023-05-14 10:12:33"},
+		{"IMG-20210604-WA0001.jpg", "2021-06-04 00:00:00"},
+		{"signal-2023-05-14-101233.jpg", "2023-05-14 10:12:33"},
+		{"2023-05-14 10.12.33.jpg", "2023-05-14 10:12:33"},
+		{"2023-05-14_10-12-33.mp4", "2023-05-14 10:12:33"},
+		{"/photos/2019/IMG_20230101_120000.jpg", "2023-01-01 12:00:00"},
+
+		// Screenshots
+		{"Screenshot 2023-01-01 at 12.00.00.png", "2023-01-01 12:00:00"},
+		{"Screenshot_20230514-101233.png", "2023-05-14 10:12:33"},
+		{"Screen Shot 2020-01-05 at 1.02.03 PM.png", "2020-01-05 13:02:03"},
+		{"Screen Shot 2020-01-05 at 12.02.03 AM.png", "2020-01-05 00:02:03"},
+		{"Screenshot 2020-01-05 at 1.02.03\u202fPM.png", "2020-01-05 13:02:03"}, // Narrow no-break space (macOS 13)
+
+		// Messaging apps
+		{"WhatsApp Image 2021-06-04 at 18.22.31.jpeg", "2021-06-04 18:22:31"},
+		{"WhatsApp Video 2021-06-04 at 18.22.31.mp4", "2021-06-04 18:22:31"},
+		{"WhatsApp Image 2021-06-04 at 18.22.31 (1).jpeg", "2021-06-04 18:22:31"},
+
+		// Documents
+		{"report_2022-11-30.pdf", "2022-11-30 00:00:00"},
+		{"scan 2022.11.30.pdf", "2022-11-30 00:00:00"},
+		{"notes_2022_11_30.txt", "2022-11-30 00:00:00"},
+		{"20230514.pdf", "2023-05-14 00:00:00"},
+		{"Facture 30.11.2022.pdf", "2022-11-30 00:00:00"},
+		{"invoice_30-11-2022.pdf", "2022-11-30 00:00:00"},
+
+		// An invalid time keeps the date
+		{"IMG_20230101_256199.jpg", "2023-01-01 00:00:00"},
+		{"Screen Shot 2020-01-05 at 13.02.03 PM.png", "2020-01-05 00:00:00"},
+
+		// Invalid dates
+		{"20231399.pdf", ""},
+		{"IMG_20231399_120000.jpg", ""},
+		{"IMG_20230230_120000.jpg", ""},
+		{"20230001.pdf", ""},
+		{"report_2022-11-31.pdf", ""},
+		{"Facture 30.02.2022.pdf", ""},
+		{"IMG_20990101_120000.jpg", ""}, // In the future
+
+		// No date
+		{"holiday.jpg", ""},
+		{"DSC01234.JPG", ""},
+		{"1234567890.jpg", ""},
+		{"IMG_120230101.jpg", ""}, // Digits around the date
+		{"/photos/20230101/holiday.jpg", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, ok := parser.Parse(tt.name)
+			if tt.want == "" {
+				if ok {
+					t.Errorf("Parse(%q) = %v, want no date", tt.name, date)
+				}
+				return
+			}
+			want, err := time.ParseInLocation("2006-01-02 15:04:05", tt.want, time.Local)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || !date.Equal(want) {
+				t.Errorf("Parse(%q) = %v, %v, want %v", tt.name, date, ok, want)
+			}
+		})
+	}
+}
+
+func TestFilenameDateParserCustomPatterns(t *testing.T) {
+	parser, err := NewFilenameDateParser([]string{`scan-(?P<day>\d{2})(?P<month>\d{2})(?P<year>\d{4})`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2022, 11, 30, 0, 0, 0, 0, time.Local)
+	if date, ok := parser.Parse("scan-30112022.pdf"); !ok || !date.Equal(want) {
+		t.Errorf("custom pattern: got %v, %v, want %v", date, ok, want)
+	}
+	// The built-in patterns still apply
+	if _, ok := parser.Parse("IMG_20230101_120000.jpg"); !ok {
+		t.Error("built-in patterns not used after the custom ones")
+	}
+
+	for _, pattern := range []string{`(?P<year>\d{4})(?P<month>\d{2})`, `(?P<year>\d{4}`} {
+		if _, err := NewFilenameDateParser([]string{pattern}); err == nil {
+			t.Errorf("pattern %q accepted", pattern)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/google/uuid"
+
+	"tokilane/internal/db"
+)
+
+// Refusals of a rename or a move
+var (
+	ErrDestinationExists  = errors.New("a file with the same name exists")
+	ErrInvalidDestination = errors.New("invalid destination")
+)
+
+// DeleteFile deletes a file from disk together with its record, full-text entry, thumbnail,
+// annotations and share links. The file is first renamed to a hidden name in its folder, so
+// that it can be put back if the index cannot be updated; a file already missing from disk is
+// only removed from the index.
+func (i *Indexer) DeleteFile(item *db.FileItem) error {
+	path := item.AbsPath
+	if i.rootForPath(path) == nil {
+		return fmt.Errorf("path outside of the library roots")
+	}
+
+	i.operationsMu.Lock()
+	defer i.operationsMu.Unlock()
+
+	trashPath := filepath.Join(filepath.Dir(path), ".tokilane-delete-"+uuid.New().String())
+	trashed := false
+	err := i.repo.DeleteWith(item, func() error {
+		if err := os.Rename(path, trashPath); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		trashed = true
+		return nil
+	})
+	if err != nil {
+		if trashed {
+			if err := os.Rename(trashPath, path); err != nil {
+				log.Printf("Error restoring %s: %v", path, err)
+			}
+		}
+		return err
+	}
+
+	if trashed {
+		if err := os.Remove(trashPath); err != nil {
+			log.Printf("Error deleting %s: %v", path, err)
+		}
+	}
+	i.changes.Cancel(path)
+	i.fileRemoved(item)
+	return nil
+}
+
+// MoveFile renames or moves a file on disk together with its record, which keeps its ID,
+// thumbnail and annotations. The destination must be a free path indexed by one of the roots;
+// the file is put back if the index cannot be updated.
+func (i *Indexer) MoveFile(item *db.FileItem, path string) error {
+	root := i.rootForPath(path)
+	if root == nil || i.rootForPath(item.AbsPath) == nil {
+		return fmt.Errorf("%w: path outside of the library roots", ErrInvalidDestination)
+	}
+	if IsHiddenFile(filepath.Base(path)) || root.IsPathIgnored(path, false) {
+		return fmt.Errorf("%w: path ignored by the rules of its root", ErrInvalidDestination)
+	}
+	if !i.isPathWithinDepth(root, path) {
+		return fmt.Errorf("%w: path beyond the scan depth of its root", ErrInvalidDestination)
+	}
+
+	i.operationsMu.Lock()
+	defer i.operationsMu.Unlock()
+
+	oldPath := item.AbsPath
+	if path == oldPath {
+		return nil
+	}
+
+	// The destination must be free, unless only the case of the name changes on a
+	// case-insensitive file system. The move itself never replaces a file created since.
+	move := MoveNoReplace
+	if existing, err := os.Lstat(path); err == nil {
+		current, err := os.Lstat(oldPath)
+		if err != nil || !os.SameFile(existing, current) {
+			return ErrDestinationExists
+		}
+		move = os.Rename
+	}
+
+	previous := *item
+	moved := false
+	err := i.repo.MoveWith(item, func() error {
+		if err := move(oldPath, path); err != nil {
+			return err
+		}
+		moved = true
+
+		stat, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return i.relocate(item, path, stat)
+	})
+	if err != nil {
+		*item = previous
+		if moved {
+			if err := move(path, oldPath); err != nil {
+				log.Printf("Error moving %s back to %s: %v", path, oldPath, err)
+			}
+		}
+		return err
+	}
+
+	i.changes.Cancel(oldPath)
+	i.fileMoved(item, oldPath)
+	return nil
+}
+
+// MoveNoReplace moves a file without ever replacing a file at the destination, which fails
+// with ErrDestinationExists. Without an atomic rename refusing to replace, the file is linked
+// to its new path then unlinked from the old one. A file moved to another file system is
+// copied, synced to disk, then removed.
+func MoveNoReplace(src, dst string) error {
+	err := renameNoReplace(src, dst)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrExist):
+		return ErrDestinationExists
+	case errors.Is(err, syscall.EXDEV):
+		return copyAndRemove(src, dst)
+	case !errors.Is(err, errors.ErrUnsupported):
+		return err
+	}
+
+	if err := os.Link(src, dst); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return ErrDestinationExists
+		}
+		// Another file system, or one without hard links
+		return copyAndRemove(src, dst)
+	}
+	if err := os.Remove(src); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// copyAndRemove moves a file by copying it, with its permissions and modification time.
+// The copy is synced to disk before the file is removed; on failure the file is left as is.
+func copyAndRemove(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	stat, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, stat.Mode().Perm())
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return ErrDestinationExists
+		}
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(dst, stat.ModTime(), stat.ModTime())
+	}
+	if err == nil {
+		in.Close()
+		err = os.Remove(src)
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package content
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writeTestFile creates a file with an old modification time
+func writeTestFile(t *testing.T, path, data string) time.Time {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0640); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2019, 6, 1, 12, 0, 0, 0, time.Local)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	return mtime
+}
+
+// assertContent checks the content of a file
+func assertContent(t *testing.T, path, want string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("%s contains %q, want %q", filepath.Base(path), data, want)
+	}
+}
+
+// assertMoved checks that a file was moved with its content, permissions and modification time
+func assertMoved(t *testing.T, src, dst, data string, mtime time.Time) {
+	t.Helper()
+	if _, err := os.Lstat(src); !os.IsNotExist(err) {
+		t.Errorf("source still present: %v", err)
+	}
+	assertContent(t, dst, data)
+	stat, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stat.ModTime().Equal(mtime) || stat.Mode().Perm() != 0640 {
+		t.Errorf("moved file has mtime %v and mode %v, want %v and 0640", stat.ModTime(), stat.Mode().Perm(), mtime)
+	}
+}
+
+func TestMoveNoReplace(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.txt")
+	dst := filepath.Join(dir, "sub", "b.txt")
+	if err := os.Mkdir(filepath.Dir(dst), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := writeTestFile(t, src, "content of a")
+	if err := MoveNoReplace(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	assertMoved(t, src, dst, "content of a", mtime)
+
+	// An existing file is never replaced
+	other := filepath.Join(dir, "c.txt")
+	writeTestFile(t, other, "content of c")
+	if err := MoveNoReplace(other, dst); !errors.Is(err, ErrDestinationExists) {
+		t.Errorf("move onto an existing file: %v, want ErrDestinationExists", err)
+	}
+	assertContent(t, dst, "content of a")
+	assertContent(t, other, "content of c")
+
+	// A missing source is reported as such
+	if err := MoveNoReplace(filepath.Join(dir, "missing.txt"), filepath.Join(dir, "d.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("move of a missing file: %v, want ErrNotExist", err)
+	}
+}
+
+func TestCopyAndRemove(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.txt")
+	dst := filepath.Join(dir, "b.txt")
+
+	mtime := writeTestFile(t, src, "content of a")
+	if err := copyAndRemove(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	assertMoved(t, src, dst, "content of a", mtime)
+
+	writeTestFile(t, src, "new content")
+	if err := copyAndRemove(src, dst); !errors.Is(err, ErrDestinationExists) {
+		t.Errorf("copy onto an existing file: %v, want ErrDestinationExists", err)
+	}
+	assertContent(t, src, "new content")
+	assertContent(t, dst, "content of a")
+}
+
+func TestMoveNoReplaceAcrossFileSystems(t *testing.T) {
+	// /dev/shm is usually a tmpfs, distinct from the file system of the temporary directories
+	other, err := os.MkdirTemp("/dev/shm", "tokilane-test-")
+	if err != nil {
+		t.Skip("no second file system available")
+	}
+	defer os.RemoveAll(other)
+
+	src := filepath.Join(t.TempDir(), "a.txt")
+	mtime := writeTestFile(t, src, "content of a")
+	dst := filepath.Join(other, "a.txt")
+	if err := os.Link(src, dst); err == nil || !errors.Is(err, syscall.EXDEV) {
+		t.Skip("the directories are on the same file system")
+	}
+
+	if err := MoveNoReplace(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	assertMoved(t, src, dst, "content of a", mtime)
+}
+
+func TestIndexerMoveFileNeverReplaces(t *testing.T) {
+	indexer, rootPath := startTestIndexer(t, testQuietPeriod)
+
+	path := filepath.Join(rootPath, "a.txt")
+	writeTestFile(t, path, "content of a")
+	item, err := indexer.IndexPath(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existing := filepath.Join(rootPath, "b.txt")
+	writeTestFile(t, existing, "content of b")
+	if err := indexer.MoveFile(item, existing); !errors.Is(err, ErrDestinationExists) {
+		t.Errorf("move onto an existing file: %v, want ErrDestinationExists", err)
+	}
+	assertContent(t, existing, "content of b")
+	if item.AbsPath != path {
+		t.Errorf("record moved to %s", item.AbsPath)
+	}
+
+	dest := filepath.Join(rootPath, "2019", "a.txt")
+	if err := os.Mkdir(filepath.Dir(dest), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.MoveFile(item, dest); err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, dest, "content of a")
+	if item.AbsPath != dest {
+		t.Errorf("record at %s, want %s", item.AbsPath, dest)
+	}
+}
+
+func TestIndexerMoveFileWithRelativeRoot(t *testing.T) {
+	chdir(t, t.TempDir())
+	indexer := startIndexer(t, "data", &IndexerConfig{
+		Roots:            []LibraryRoot{{ID: "files", Path: "./files"}},
+		WatchQuietPeriod: testQuietPeriod,
+	})
+	events := recordEvents(indexer)
+	rootPath := indexer.Roots()[0].Path
+
+	path := filepath.Join(rootPath, "a.txt")
+	writeTestFile(t, path, "content of a")
+	item, err := indexer.IndexPath(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.annotations.AddTag(item.ID, "holidays"); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(rootPath, "2019", "a.txt")
+	if err := os.Mkdir(filepath.Dir(dest), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.MoveFile(item, dest); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * testQuietPeriod)
+
+	// The watcher sees the moved file at the path recorded by the move
+	moved, err := indexer.repo.GetByPath(dest)
+	if err != nil {
+		t.Fatalf("moved file not found: %v", err)
+	}
+	if moved.ID != item.ID {
+		t.Errorf("moved file has the ID %s, want %s", moved.ID, item.ID)
+	}
+	if count := countRecords(t, indexer); count != 1 {
+		t.Errorf("%d records after the move, want 1", count)
+	}
+	annotations, err := indexer.annotations.Get(item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotations.Tags) != 1 || annotations.Tags[0] != "holidays" {
+		t.Errorf("tags %v after the move, want [holidays]", annotations.Tags)
+	}
+	if count := events.count("moved", dest); count != 1 {
+		t.Errorf("%d moved events, want 1", count)
+	}
+	if count := events.count("added", dest); count != 0 {
+		t.Errorf("moved file added %d times", count)
+	}
+}
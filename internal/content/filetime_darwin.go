@@ -0,0 +1,41 @@
+//go:build darwin
+
+package content
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileBirthTime returns the birth time stored in the stat structure on macOS
+func fileBirthTime(_ string, info os.FileInfo) (time.Time, bool) {
+	unixStat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	if unixStat.Birthtimespec.Sec == 0 && unixStat.Birthtimespec.Nsec == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(unixStat.Birthtimespec.Sec, unixStat.Birthtimespec.Nsec), true
+}
+
+// fileChangeTime returns the inode change time (ctime)
+func fileChangeTime(info os.FileInfo) (time.Time, bool) {
+	unixStat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(unixStat.Ctimespec.Sec, unixStat.Ctimespec.Nsec), true
+}
+
+// fileInode returns the inode number of a file, used to recognize it after a rename
+func fileInode(info os.FileInfo) (uint64, bool) {
+	unixStat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return unixStat.Ino, true
+}
@@ -0,0 +1,45 @@
+//go:build linux
+
+package content
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileBirthTime returns the birth time reported by statx(STATX_BTIME)
+// ext4, btrfs, xfs and tmpfs report it; older kernels (ENOSYS), restricted
+// sandboxes (EPERM) and filesystems without birth time are handled as "unknown"
+func fileBirthTime(path string, _ os.FileInfo) (time.Time, bool) {
+	var stx unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, path, unix.AT_STATX_SYNC_AS_STAT, unix.STATX_BTIME, &stx); err != nil {
+		return time.Time{}, false
+	}
+
+	if stx.Mask&unix.STATX_BTIME == 0 || (stx.Btime.Sec == 0 && stx.Btime.Nsec == 0) {
+		return time.Time{}, false
+	}
+
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), true
+}
+
+// fileChangeTime returns the inode change time (ctime)
+func fileChangeTime(info os.FileInfo) (time.Time, bool) {
+	unixStat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(unixStat.Ctim.Sec, unixStat.Ctim.Nsec), true
+}
+
+// fileInode returns the inode number of a file, used to recognize it after a rename
+func fileInode(info os.FileInfo) (uint64, bool) {
+	unixStat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return unixStat.Ino, true
+}
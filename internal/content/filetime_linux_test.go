@@ -0,0 +1,81 @@
+//go:build linux
+
+package content
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// supportsBirthTime reports whether the filesystem of a file reports its birth time
+func supportsBirthTime(t *testing.T, path string) bool {
+	t.Helper()
+	var stx unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, path, unix.AT_STATX_SYNC_AS_STAT, unix.STATX_BTIME, &stx); err != nil {
+		t.Logf("statx unavailable: %v", err)
+		return false
+	}
+	return stx.Mask&unix.STATX_BTIME != 0
+}
+
+func TestFileBirthTime(t *testing.T) {
+	// No embedded metadata and no date in the name: only the filesystem dates apply
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	before := time.Now().Add(-time.Second)
+	if err := os.WriteFile(path, []byte("some notes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().Add(time.Second)
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	birthtime, ok := fileBirthTime(path, stat)
+
+	if !supportsBirthTime(t, path) {
+		t.Log("the filesystem does not report the birth time, checking the mtime fallback")
+		if ok {
+			t.Errorf("birth time %v reported without STATX_BTIME", birthtime)
+		}
+		date, source, err := DetectCreatedAt(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if source != DateSourceMtime || !date.Equal(stat.ModTime()) {
+			t.Errorf("DetectCreatedAt = %v (%s), want the mtime %v", date, source, stat.ModTime())
+		}
+		return
+	}
+
+	if !ok {
+		t.Fatal("no birth time although the filesystem reports it")
+	}
+	if birthtime.Before(before) || birthtime.After(after) {
+		t.Errorf("birth time %v is not between %v and %v", birthtime, before, after)
+	}
+	date, source, err := DetectCreatedAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != DateSourceBirthtime || !date.Equal(birthtime) {
+		t.Errorf("DetectCreatedAt = %v (%s), want the birth time %v", date, source, birthtime)
+	}
+
+	// A birth time more recent than the mtime (copy preserving the mtime) falls back to the mtime
+	mtime := time.Date(2019, 6, 1, 12, 0, 0, 0, time.Local)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	date, source, err = DetectCreatedAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != DateSourceMtime || !date.Equal(mtime) {
+		t.Errorf("DetectCreatedAt = %v (%s), want the mtime %v", date, source, mtime)
+	}
+}
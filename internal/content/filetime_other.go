@@ -0,0 +1,23 @@
+//go:build !linux && !darwin
+
+package content
+
+import (
+	"os"
+	"time"
+)
+
+// fileBirthTime is not supported on this platform
+func fileBirthTime(_ string, _ os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// fileChangeTime is not supported on this platform
+func fileChangeTime(_ os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// fileInode is not supported on this platform, renamed files are indexed again
+func fileInode(_ os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,287 @@
+package content
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// IgnoreFileName is the name of the per-directory ignore files
+const IgnoreFileName = ".tokilaneignore"
+
+// gitignoreFileName is read as well when RESPECT_GITIGNORE is enabled
+const gitignoreFileName = ".gitignore"
+
+// ignoreRule is a compiled gitignore-style pattern
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool // "!pattern" re-includes a path
+	dirOnly bool // "pattern/" only matches directories
+}
+
+// match checks if a path relative to the directory of the rule matches it
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	return r.pattern.MatchString(rel)
+}
+
+// IgnoreMatcher evaluates gitignore-style rules for the files of a root: the global
+// patterns first, then the ignore files from the root down to the file's directory
+// (deeper files take precedence, the last matching rule wins).
+type IgnoreMatcher struct {
+	root      string
+	global    []ignoreRule
+	fileNames []string
+	mu        sync.RWMutex
+	dirRules  map[string][]ignoreRule // Rules of the ignore files, by directory relative to the root
+}
+
+// NewIgnoreMatcher creates a matcher for a root with the given global patterns
+func NewIgnoreMatcher(root string, patterns []string, respectGitignore bool) *IgnoreMatcher {
+	matcher := &IgnoreMatcher{
+		root:      root,
+		global:    parseIgnoreRules(patterns),
+		fileNames: []string{IgnoreFileName},
+		dirRules:  make(map[string][]ignoreRule),
+	}
+	if respectGitignore {
+		matcher.fileNames = append(matcher.fileNames, gitignoreFileName)
+	}
+	return matcher
+}
+
+// IsIgnoreFile checks if a file name is one of the ignore files read by the matcher
+func (m *IgnoreMatcher) IsIgnoreFile(name string) bool {
+	for _, fileName := range m.fileNames {
+		if name == fileName {
+			return true
+		}
+	}
+	return false
+}
+
+// Invalidate forgets the cached rules of a directory after its ignore file changed
+func (m *IgnoreMatcher) Invalidate(dir string) {
+	rel, ok := m.relPath(dir)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	delete(m.dirRules, rel)
+	m.mu.Unlock()
+}
+
+// Match checks if a path inside the root is ignored, either directly or through one of its parent directories
+func (m *IgnoreMatcher) Match(filePath string, isDir bool) bool {
+	rel, ok := m.relPath(filePath)
+	if !ok || rel == "" {
+		return false
+	}
+
+	// A file inside an ignored directory cannot be re-included
+	parts := strings.Split(rel, "/")
+	for k := 1; k < len(parts); k++ {
+		if m.ignored(strings.Join(parts[:k], "/"), true) {
+			return true
+		}
+	}
+	return m.ignored(rel, isDir)
+}
+
+// ignored evaluates the rules applying to a path relative to the root
+func (m *IgnoreMatcher) ignored(rel string, isDir bool) bool {
+	result := false
+	for _, rule := range m.global {
+		if rule.match(rel, isDir) {
+			result = !rule.negate
+		}
+	}
+
+	// Ignore files of the root and of every parent directory of the path
+	dir := ""
+	remaining := rel
+	for {
+		for _, rule := range m.rulesFor(dir) {
+			if rule.match(remaining, isDir) {
+				result = !rule.negate
+			}
+		}
+
+		slash := strings.Index(remaining, "/")
+		if slash < 0 {
+			break
+		}
+		dir = path.Join(dir, remaining[:slash])
+		remaining = remaining[slash+1:]
+	}
+
+	return result
+}
+
+// rulesFor returns the rules of the ignore files of a directory, reading them on first use
+func (m *IgnoreMatcher) rulesFor(dir string) []ignoreRule {
+	m.mu.RLock()
+	rules, ok := m.dirRules[dir]
+	m.mu.RUnlock()
+	if ok {
+		return rules
+	}
+
+	for _, fileName := range m.fileNames {
+		patterns, err := readIgnoreFile(filepath.Join(m.root, filepath.FromSlash(dir), fileName))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("Error reading ignore file in %s: %v", dir, err)
+			}
+			continue
+		}
+		rules = append(rules, parseIgnoreRules(patterns)...)
+	}
+
+	m.mu.Lock()
+	m.dirRules[dir] = rules
+	m.mu.Unlock()
+	return rules
+}
+
+// relPath returns the slash-separated path relative to the root ("" for the root itself)
+func (m *IgnoreMatcher) relPath(filePath string) (string, bool) {
+	rel, err := filepath.Rel(m.root, filePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if rel == "." {
+		return "", true
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// readIgnoreFile reads the lines of an ignore file
+func readIgnoreFile(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// parseIgnoreRules compiles gitignore-style patterns, skipping comments and invalid patterns
+func parseIgnoreRules(patterns []string) []ignoreRule {
+	var rules []ignoreRule
+	for _, pattern := range patterns {
+		rule, ok := parseIgnoreRule(pattern)
+		if ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// parseIgnoreRule compiles a single gitignore-style pattern
+func parseIgnoreRule(pattern string) (ignoreRule, bool) {
+	var rule ignoreRule
+
+	// Trailing spaces are ignored unless escaped
+	pattern = strings.TrimLeft(pattern, " \t")
+	for strings.HasSuffix(pattern, " ") && !strings.HasSuffix(pattern, "\\ ") {
+		pattern = pattern[:len(pattern)-1]
+	}
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return rule, false
+	}
+
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, "\\!") || strings.HasPrefix(pattern, "\\#") {
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return rule, false
+	}
+
+	// Patterns without a slash match at any depth, others are relative to the ignore file
+	prefix := "^(?:.*/)?"
+	if strings.Contains(pattern, "/") {
+		prefix = "^"
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+
+	re, err := regexp.Compile(prefix + globToRegexp(pattern) + "$")
+	if err != nil {
+		log.Printf("Invalid ignore pattern ignored: %s", pattern)
+		return rule, false
+	}
+	rule.pattern = re
+	return rule, true
+}
+
+// globToRegexp converts a gitignore glob (*, ?, [...], **) to a regular expression
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' && (i == 0 || glob[i-1] == '/') {
+				switch {
+				case i+2 == len(glob):
+					// Trailing "**" matches everything inside
+					b.WriteString(".*")
+					i++
+					continue
+				case glob[i+2] == '/':
+					// "**/" matches zero or more directories
+					b.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				}
+			}
+			b.WriteString("[^/]*")
+			for i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
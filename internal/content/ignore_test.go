@@ -0,0 +1,165 @@
+package content
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIgnoreMatcherPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string // Relative to the root, slash-separated
+		isDir    bool
+		want     bool
+	}{
+		{"extension", []string{"*.log"}, "a.log", false, true},
+		{"extension at any depth", []string{"*.log"}, "x/y/a.log", false, true},
+		{"extension in the middle", []string{"*.log"}, "a.log.txt", false, false},
+		{"directory only: directory", []string{"build/"}, "build", true, true},
+		{"directory only: file", []string{"build/"}, "build", false, false},
+		{"directory only at any depth", []string{"build/"}, "src/build", true, true},
+		{"directory only: content", []string{"build/"}, "src/build/x.o", false, true},
+		{"anchored at the root", []string{"/top.txt"}, "top.txt", false, true},
+		{"anchored: deeper file", []string{"/top.txt"}, "sub/top.txt", false, false},
+		{"slash anchors", []string{"docs/*.md"}, "docs/a.md", false, true},
+		{"slash anchors: deeper folder", []string{"docs/*.md"}, "x/docs/a.md", false, false},
+		{"star stops at slashes", []string{"docs/*.md"}, "docs/sub/a.md", false, false},
+		{"leading double star", []string{"**/cache"}, "cache", true, true},
+		{"leading double star at depth", []string{"**/cache"}, "a/b/cache", false, true},
+		{"trailing double star", []string{"logs/**"}, "logs/a/b.txt", false, true},
+		{"trailing double star: folder itself", []string{"logs/**"}, "logs", true, false},
+		{"middle double star: no folder", []string{"a/**/b"}, "a/b", false, true},
+		{"middle double star: folders", []string{"a/**/b"}, "a/x/y/b", false, true},
+		{"middle double star is anchored", []string{"a/**/b"}, "c/a/b", false, false},
+		{"negation", []string{"*.log", "!keep.log"}, "keep.log", false, false},
+		{"negation at depth", []string{"*.log", "!keep.log"}, "x/keep.log", false, false},
+		{"negation of another file", []string{"*.log", "!keep.log"}, "other.log", false, true},
+		{"last rule wins", []string{"!keep.log", "*.log"}, "keep.log", false, true},
+		{"parent excludes its children", []string{"private/", "!private/keep.txt"}, "private/keep.txt", false, true},
+		{"parent through a glob", []string{"tmp*/"}, "tmp-1/a/b.txt", false, true},
+		{"single character", []string{"?.txt"}, "a.txt", false, true},
+		{"single character only", []string{"?.txt"}, "ab.txt", false, false},
+		{"class", []string{"[abc].txt"}, "b.txt", false, true},
+		{"class: other character", []string{"[abc].txt"}, "d.txt", false, false},
+		{"negated class", []string{"[!abc].txt"}, "d.txt", false, true},
+		{"comment", []string{"# notes.txt"}, "# notes.txt", false, false},
+		{"escaped hash", []string{`\#notes.txt`}, "#notes.txt", false, true},
+		{"escaped exclamation mark", []string{`\!important.txt`}, "!important.txt", false, true},
+		{"trailing spaces", []string{"*.bak  "}, "x.bak", false, true},
+		{"no pattern", nil, "a.log", false, false},
+	}
+
+	root := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher := NewIgnoreMatcher(root, tt.patterns, false)
+			if got := matcher.Match(filepath.Join(root, filepath.FromSlash(tt.path)), tt.isDir); got != tt.want {
+				t.Errorf("Match(%q) with %q = %v, want %v", tt.path, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreMatcherFiles(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, data string) {
+		t.Helper()
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(IgnoreFileName, "*.log\n/top.txt\nbuild/\n")
+	write("sub/"+IgnoreFileName, "# Logs kept in this folder\n!*.log\n/local.txt\n")
+	write("sub/deep/"+IgnoreFileName, "debug.log\n")
+	write("other/.gitignore", "*.txt\n")
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"a.log", false, true},
+		{"top.txt", false, true},
+		{"other/top.txt", false, false},      // Anchored to the directory of its ignore file
+		{"sub/a.log", false, false},          // Re-included by a deeper ignore file
+		{"sub/deep/a.log", false, false},     // The rules of every parent directory apply
+		{"sub/deep/debug.log", false, true},  // The deepest ignore file wins
+		{"sub/local.txt", false, true},       // Anchored to sub
+		{"sub/deep/local.txt", false, false}, // Not to its subfolders
+		{"sub/build", true, true},            // Rules of the root apply to subfolders
+		{"sub/build/a.txt", false, true},     // An ignored folder excludes its content
+		{"other/notes.txt", false, false},    // .gitignore files are not read by default
+		{"global.tmp", false, true},          // Global patterns apply
+		{"sub/global.tmp", false, true},      // At any depth
+		{"sub/deep/global.tmp", false, true},
+	}
+
+	matcher := NewIgnoreMatcher(root, []string{"*.tmp"}, false)
+	for _, tt := range tests {
+		if got := matcher.Match(filepath.Join(root, filepath.FromSlash(tt.path)), tt.isDir); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	// .gitignore files are read when requested
+	gitignore := NewIgnoreMatcher(root, nil, true)
+	if !gitignore.Match(filepath.Join(root, "other", "notes.txt"), false) {
+		t.Error(".gitignore not applied with RESPECT_GITIGNORE")
+	}
+
+	// Ignore files are cached until invalidated
+	write("sub/"+IgnoreFileName, "")
+	sub := filepath.Join(root, "sub", "local.txt")
+	if !matcher.Match(sub, false) {
+		t.Error("rules read again before invalidation")
+	}
+	matcher.Invalidate(filepath.Join(root, "sub"))
+	if matcher.Match(sub, false) {
+		t.Error("removed rule still applied after invalidation")
+	}
+	if !matcher.Match(filepath.Join(root, "sub", "a.log"), false) {
+		t.Error("rule of the root not applied once the negation is removed")
+	}
+}
+
+func TestWatcherRemovesNewlyIgnoredFiles(t *testing.T) {
+	indexer, rootPath := startTestIndexer(t, testQuietPeriod)
+	events := recordEvents(indexer)
+
+	logPath := filepath.Join(rootPath, "sub", "server.log")
+	textPath := filepath.Join(rootPath, "sub", "notes.txt")
+	if err := os.Mkdir(filepath.Dir(logPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(testQuietPeriod) // The watcher adds the new directory
+	appendTo(t, logPath, "started\n")
+	appendTo(t, textPath, "notes\n")
+	waitFor(t, 10*time.Second, func() bool {
+		return events.count("added", logPath) == 1 && events.count("added", textPath) == 1
+	})
+
+	appendTo(t, filepath.Join(rootPath, IgnoreFileName), "*.log\n")
+	waitFor(t, 10*time.Second, func() bool { return events.count("removed", logPath) == 1 })
+
+	if _, err := indexer.repo.GetByPath(logPath); err == nil {
+		t.Error("ignored file still indexed")
+	}
+	if _, err := indexer.repo.GetByPath(textPath); err != nil {
+		t.Errorf("file not ignored removed: %v", err)
+	}
+
+	// A new file matching the rules is not indexed
+	ignored := filepath.Join(rootPath, "new.log")
+	appendTo(t, ignored, "started\n")
+	time.Sleep(5 * testQuietPeriod)
+	if count := events.count("added", ignored); count != 0 {
+		t.Errorf("ignored file added %d times", count)
+	}
+}
@@ -29,29 +29,47 @@ type Indexer struct {
 	config          *IndexerConfig
 	db              *db.Database
 	repo            *db.FileItemRepository
+	annotations     *db.AnnotationRepository
 	thumbnailSvc    *ThumbnailService
 	watcher         *fsnotify.Watcher
-	eventChannel    chan FileEvent
+	events          *EventBus
 	stopChannel     chan bool
 	thumbnailQueue  chan ThumbnailUpdate
 	thumbnailWg     sync.WaitGroup
+	dateResolver    *DateResolver
+	rescanMu        sync.Mutex
+	rescanTimer     *time.Timer
+	hashWake        chan struct{}
+	hashWg          sync.WaitGroup
+	movesMu         sync.Mutex
+	pendingMoves    map[string]*pendingMove // Renamed files and directories by previous path
+	changes         *indexQueue             // Created and modified files waiting for the end of their writes
+	operationsMu    sync.Mutex              // Held while a file is deleted or moved through the API, and by the watcher
 }
 
 // IndexerConfig configuration of the indexer
 type IndexerConfig struct {
-	RootPath    string
-	ThumbsPath  string
-	Debug       bool
-	ScanDepth   int // Directory scanning depth (0 = unlimited, 1 = root only, 2 = root+1 level, etc.)
-	ScanWorkers int // Number of parallel workers for scanning (0 = auto)
+	Roots                []LibraryRoot
+	ThumbsPath           string
+	Debug                bool
+	ScanWorkers          int           // Number of parallel workers for scanning (0 = auto)
+	IgnorePatterns       []string      // Global gitignore-style patterns applied to every root
+	RespectGitignore     bool          // Read .gitignore files in addition to .tokilaneignore
+	DateSources          []string      // Priority chain of date sources (metadata, filename, birthtime, mtime, ctime, upload)
+	FilenameDatePatterns []string      // Custom regular expressions for dates in file names
+	ContentHashing       bool          // Compute full-content hashes in the background for duplicate detection
+	WatchQuietPeriod     time.Duration // Time without events after which a created or modified file is indexed
+	WatchWorkers         int           // Number of files indexed in parallel by the watcher
 }
 
 // FileEvent represents an event on a file
 type FileEvent struct {
-	Type     string // "added", "updated", "removed"
-	FileID   string
-	FilePath string
-	FileItem *db.FileItem
+	Type      string // "added", "updated", "removed", "moved"
+	FileID    string
+	FilePath  string
+	OldPath   string // Previous path of a moved file
+	OldRootID string // Root of the previous path of a moved file
+	FileItem  *db.FileItem
 }
 
 // NewIndexer creates a new indexer
@@ -59,6 +77,17 @@ func NewIndexer(config *IndexerConfig, database *db.Database) (*Indexer, error)
 	repo := db.NewFileItemRepository(database)
 	thumbnailSvc := NewThumbnailService(config.ThumbsPath)
 
+	roots, err := prepareRoots(config.Roots, config.IgnorePatterns, config.RespectGitignore)
+	if err != nil {
+		return nil, err
+	}
+	config.Roots = roots
+
+	filenameParser, err := NewFilenameDateParser(config.FilenameDatePatterns)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create the watcher
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -69,34 +98,50 @@ func NewIndexer(config *IndexerConfig, database *db.Database) (*Indexer, error)
 		config:         config,
 		db:             database,
 		repo:           repo,
+		annotations:    db.NewAnnotationRepository(database),
 		thumbnailSvc:   thumbnailSvc,
 		watcher:        watcher,
-		eventChannel:   make(chan FileEvent, 100),
+		events:         NewEventBus(),
 		stopChannel:    make(chan bool),
 		thumbnailQueue: make(chan ThumbnailUpdate, 1000), // Buffer for thumbnail tasks
+		dateResolver:   NewDateResolver(config.DateSources, filenameParser),
+		hashWake:       make(chan struct{}, 1),
+		pendingMoves:   make(map[string]*pendingMove),
 	}
+	indexer.changes = newIndexQueue(config.WatchQuietPeriod, config.WatchWorkers, indexer.indexChangedFile)
 
 	// Start thumbnail worker
 	go indexer.thumbnailWorker()
 
+	// Start the content and perceptual hashing worker
+	indexer.hashWg.Add(1)
+	go indexer.contentHashWorker()
+
 	return indexer, nil
 }
 
 // Start starts the indexer
 func (i *Indexer) Start() error {
-	log.Printf("Starting indexer for the folder: %s", i.config.RootPath)
+	for _, root := range i.config.Roots {
+		log.Printf("Starting indexer for the root %s: %s", root.ID, root.Path)
+	}
 
 	// Initial scan
 	if err := i.ScanAll(); err != nil {
 		return fmt.Errorf("error during initial scan: %w", err)
 	}
 
+	// Hash the contents and images of the files indexed by the scan
+	i.scheduleContentHashing()
+
 	// Start the watcher
 	go i.watchFiles()
 
-	// Add the root folder to the watcher
-	if err := i.addWatchRecursive(i.config.RootPath); err != nil {
-		return fmt.Errorf("error adding the watcher: %w", err)
+	// Add the root folders to the watcher
+	for idx := range i.config.Roots {
+		if err := i.addWatchRecursive(&i.config.Roots[idx]); err != nil {
+			return fmt.Errorf("error adding the watcher: %w", err)
+		}
 	}
 
 	log.Println("Indexer started successfully")
@@ -108,11 +153,29 @@ func (i *Indexer) Stop() error {
 	log.Println("Stopping indexer...")
 	
 	close(i.stopChannel)
+
+	i.rescanMu.Lock()
+	if i.rescanTimer != nil {
+		i.rescanTimer.Stop()
+	}
+	i.rescanMu.Unlock()
+
+	i.movesMu.Lock()
+	for _, move := range i.pendingMoves {
+		move.timer.Stop()
+	}
+	i.movesMu.Unlock()
+
+	// Wait for the files being indexed by the watcher
+	i.changes.Stop()
 	
 	// Wait for all thumbnail processing to complete
 	log.Println("Waiting for thumbnail processing to complete...")
 	i.thumbnailWg.Wait()
 	close(i.thumbnailQueue)
+
+	// Wait for the file being hashed
+	i.hashWg.Wait()
 	
 	if i.watcher != nil {
 		if err := i.watcher.Close(); err != nil {
@@ -120,12 +183,12 @@ func (i *Indexer) Stop() error {
 		}
 	}
 	
-	close(i.eventChannel)
+	i.events.Close()
 	log.Println("Indexer stopped")
 	return nil
 }
 
-// ScanAll scans all files in the root folder with high performance
+// ScanAll scans all files in the root folders with high performance
 func (i *Indexer) ScanAll() error {
 	log.Println("Starting high-performance scan...")
 	
@@ -133,35 +196,38 @@ func (i *Indexer) ScanAll() error {
 	
 	// Collect all file paths first (fast)
 	var filePaths []string
-	err := i.walkWithDepth(i.config.RootPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Printf("Error scanning %s: %v", path, err)
-			return nil
-		}
+	for idx := range i.config.Roots {
+		root := &i.config.Roots[idx]
+		err := i.walkWithDepth(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				log.Printf("Error scanning %s: %v", path, err)
+				return nil
+			}
 
-		if info.IsDir() {
-			if ShouldSkipDirectory(info.Name()) {
-				if i.config.Debug {
-					log.Printf("Directory ignored: %s", path)
+			if info.IsDir() {
+				if path != root.Path && (ShouldSkipDirectory(info.Name()) || i.isInternalDir(path) || root.IsPathIgnored(path, true)) {
+					if i.config.Debug {
+						log.Printf("Directory ignored: %s", path)
+					}
+					return filepath.SkipDir
 				}
-				return filepath.SkipDir
+				return nil
 			}
-			return nil
-		}
 
-		if IsHiddenFile(info.Name()) {
+			if IsHiddenFile(info.Name()) || root.IsPathIgnored(path, false) {
+				return nil
+			}
+
+			if i.config.Debug {
+				log.Printf("File found for indexing in %s: %s", root.ID, path)
+			}
+			filePaths = append(filePaths, path)
 			return nil
-		}
+		})
 
-		if i.config.Debug {
-			log.Printf("File found for indexing: %s", path)
+		if err != nil {
+			return err
 		}
-		filePaths = append(filePaths, path)
-		return nil
-	})
-
-	if err != nil {
-		return err
 	}
 
 	log.Printf("Found %d files to process", len(filePaths))
@@ -206,7 +272,7 @@ func (i *Indexer) ScanAll() error {
 	duration := time.Since(startTime)
 	log.Printf("High-performance scan completed: %d files processed in %v", fileCount, duration)
 	
-	// Clean up files that don't match current depth settings
+	// Clean up files that don't match current root and depth settings
 	go i.cleanupFilesOutsideDepth()
 	
 	// Clean up orphaned thumbnails
@@ -273,13 +339,13 @@ func (i *Indexer) fileWorker(fileChan <-chan string, resultChan chan<- *db.FileI
 	defer wg.Done()
 	
 	for path := range fileChan {
-		fileItem, err := i.processFile(path, existingFiles[path])
+		fileItem, changed, err := i.processFile(path, existingFiles[path], nil)
 		if err != nil {
 			log.Printf("Error processing %s: %v", path, err)
 			continue
 		}
 		
-		if fileItem != nil {
+		if changed {
 			resultChan <- fileItem
 		}
 	}
@@ -298,6 +364,10 @@ func (i *Indexer) resultCollector(resultChan <-chan *db.FileItem, wg *sync.WaitG
 			if err := i.repo.CreateBatch(newItems); err != nil {
 				log.Printf("Error saving new items batch: %v", err)
 			} else {
+				if err := i.repo.IndexContents(newItems); err != nil {
+					log.Printf("Error indexing contents of new items batch: %v", err)
+				}
+				i.relinkAnnotations(newItems)
 				for _, item := range newItems {
 					// Generate thumbnail asynchronously after DB save
 					go i.generateThumbnailAsync(item.ID, item.AbsPath, item.Mime)
@@ -317,6 +387,10 @@ func (i *Indexer) resultCollector(resultChan <-chan *db.FileItem, wg *sync.WaitG
 			if err := i.repo.UpdateBatch(updatedItems); err != nil {
 				log.Printf("Error updating items batch: %v", err)
 			} else {
+				if err := i.repo.IndexContents(updatedItems); err != nil {
+					log.Printf("Error indexing contents of updated items batch: %v", err)
+				}
+				i.refreshAnnotationAnchors(updatedItems)
 				for _, item := range updatedItems {
 					// Generate thumbnail asynchronously after DB save
 					go i.generateThumbnailAsync(item.ID, item.AbsPath, item.Mime)
@@ -350,72 +424,124 @@ func (i *Indexer) resultCollector(resultChan <-chan *db.FileItem, wg *sync.WaitG
 	
 	// Save remaining items
 	saveBatch()
+
+	// Hash the contents of the new and modified files
+	i.scheduleContentHashing()
 }
 
-// processFile processes a single file (fast, no I/O blocking)
-func (i *Indexer) processFile(path string, existing *db.FileItem) (*db.FileItem, error) {
+// processFile builds the record of a file for the scan and the watcher, from its existing
+// record if any. It returns false when the file is unchanged (with the existing record) and
+// a nil record for a directory. New records have no ID yet; a non-nil date override
+// replaces the one stored for the file.
+func (i *Indexer) processFile(path string, existing *db.FileItem, dateOverride *time.Time) (*db.FileItem, bool, error) {
 	stat, err := os.Stat(path)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	// Skip directories - they should not be indexed as files
 	if stat.IsDir() {
-		return nil, nil
+		return nil, false, nil
+	}
+
+	root := i.rootForPath(path)
+	if root == nil {
+		return nil, false, fmt.Errorf("path outside of the library roots")
 	}
 
 	// Calculate hash (optimized)
 	hash, err := ComputeHash(path)
 	if err != nil {
-		return nil, fmt.Errorf("error calculating hash: %w", err)
+		return nil, false, fmt.Errorf("error calculating hash: %w", err)
 	}
 
-	// If file exists and hasn't changed, skip
-	if existing != nil && existing.Hash == hash {
-		return nil, nil // No change
+	// If file exists and hasn't changed, skip (but only if not deleted)
+	if existing != nil && !existing.DeletedAt.Valid && existing.Hash == hash && existing.RootID == root.ID && dateOverride == nil {
+		i.recordInode(existing, stat)
+		return existing, false, nil
 	}
 
-	// Detect creation date
-	createdAt, err := DetectCreatedAt(path)
-	if err != nil {
-		log.Printf("Error detecting creation date for %s: %v", path, err)
-		createdAt = stat.ModTime()
-	}
+	// Resolve creation date from the configured sources
+	mime := DetectMime(path)
+	metadata, _ := ExtractMetadata(path, mime)
+	dates := i.resolveDates(path, stat, existing, metadata).WithOverride(dateOverride)
+	text, _ := ExtractText(path, mime)
+	inode, _ := fileInode(stat)
 
 	var fileItem *db.FileItem
 	if existing != nil {
 		// Update existing
 		fileItem = existing
+		fileItem.RootID = root.ID
 		fileItem.Size = stat.Size()
+		fileItem.Inode = inode
+		if fileItem.Hash != hash {
+			// Computed again in the background and with the thumbnail
+			fileItem.ContentHash = ""
+			fileItem.PerceptualHash = ""
+		}
 		fileItem.Hash = hash
-		fileItem.CreatedAt = createdAt
-		fileItem.Mime = DetectMime(path)
+		fileItem.CreatedAt = dates.CreatedAt
+		fileItem.DateSource = dates.Source
+		fileItem.DateCandidates = dates.Candidates
+		fileItem.Metadata = metadata.RawWithFormat()
+		fileItem.Mime = mime
+		fileItem.Content = text
+		if dateOverride != nil || existing.DeletedAt.Valid {
+			fileItem.DateOverride = dateOverride
+		}
+		// Resurrect files that were previously removed from the index
+		fileItem.DeletedAt = gorm.DeletedAt{}
 	} else {
 		// Create new
 		fileItem = &db.FileItem{
-			// ID will be set by collector
-			AbsPath:   path,
-			Name:      stat.Name(),
-			Ext:       GetFileExtension(stat.Name()),
-			Mime:      DetectMime(path),
-			Size:      stat.Size(),
-			CreatedAt: createdAt,
-			Hash:      hash,
+			// ID will be set by the caller
+			RootID:         root.ID,
+			AbsPath:        path,
+			Name:           stat.Name(),
+			Ext:            GetFileExtension(stat.Name()),
+			Mime:           mime,
+			Size:           stat.Size(),
+			Inode:          inode,
+			CreatedAt:      dates.CreatedAt,
+			DateSource:     dates.Source,
+			DateCandidates: dates.Candidates,
+			DateOverride:   dateOverride,
+			Metadata:       metadata.RawWithFormat(),
+			Hash:           hash,
+			Content:        text,
 		}
 	}
 
-	// Note: Thumbnail generation will be handled after DB save
-	return fileItem, nil
+	// Note: Thumbnail generation will be handled by the caller
+	return fileItem, true, nil
+}
+
+// resolveDates walks the date-source chain for a file. The date set by the client that
+// uploaded the file, if any, is kept by its record, unless the record was removed: another
+// file may have been placed at its path since.
+func (i *Indexer) resolveDates(path string, stat os.FileInfo, existing *db.FileItem, metadata *FileMetadata) DateResolution {
+	addedAt := time.Now()
+	var override *time.Time
+	if existing != nil {
+		if !existing.AddedAt.IsZero() {
+			addedAt = existing.AddedAt
+		}
+		if !existing.DeletedAt.Valid {
+			override = existing.DateOverride
+		}
+	}
+	return i.dateResolver.Resolve(path, stat, addedAt, metadata).WithOverride(override)
 }
 
 // thumbnailWorker processes thumbnail updates sequentially to avoid database locks
 func (i *Indexer) thumbnailWorker() {
 	for update := range i.thumbnailQueue {
-		if thumbPath, err := i.thumbnailSvc.GenerateIfNeeded(update.FileID, update.Path, update.MimeType); err != nil {
+		if thumbnail, err := i.thumbnailSvc.GenerateIfNeeded(update.FileID, update.Path, update.MimeType); err != nil {
 			log.Printf("Error generating thumbnail for %s: %v", update.Path, err)
-		} else if thumbPath != "" {
-			// Update thumbnail path in database (with retry mechanism)
-			if err := i.repo.UpdateThumbnailPath(update.FileID, thumbPath); err != nil {
+		} else if thumbnail != nil {
+			// Update thumbnail path and perceptual hash in database (with retry mechanism)
+			if err := i.repo.UpdateThumbnail(update.FileID, thumbnail.Path, thumbnail.PerceptualHash); err != nil {
 				log.Printf("Error updating thumbnail path for %s: %v", update.Path, err)
 			}
 		}
@@ -440,80 +566,65 @@ func (i *Indexer) generateThumbnailAsync(fileID, path, mime string) {
 	}
 }
 
-// indexFile indexes a unique file
-func (i *Indexer) indexFile(path string) error {
-	// Check if the file exists in the database (including soft-deleted records)
-	existing, err := i.repo.GetByPathIncludingDeleted(path)
-	if err != nil && err != gorm.ErrRecordNotFound {
-		return err
+// IndexPath indexes a file right away, without waiting for the watcher, and returns its record.
+// A non-nil date override (date provided by an uploading client) replaces the date sources.
+func (i *Indexer) IndexPath(path string, dateOverride *time.Time) (*db.FileItem, error) {
+	root := i.rootForPath(path)
+	if root == nil {
+		return nil, fmt.Errorf("path outside of the library roots")
 	}
-
-	// Get the file information
-	stat, err := os.Stat(path)
-	if err != nil {
-		return err
+	if IsHiddenFile(filepath.Base(path)) || root.IsPathIgnored(path, false) {
+		return nil, fmt.Errorf("path ignored by the rules of its root")
 	}
-
-	// Skip directories - they should not be indexed as files
-	if stat.IsDir() {
-		return nil
+	if !i.isPathWithinDepth(root, path) {
+		return nil, fmt.Errorf("path beyond the scan depth of its root")
 	}
 
-	// Calculate the hash
-	hash, err := ComputeHash(path)
+	// Already up to date when the events of the watcher settle
+	i.changes.Cancel(path)
+
+	item, err := i.indexFile(path, dateOverride)
 	if err != nil {
-		return fmt.Errorf("error calculating hash: %w", err)
+		return nil, err
 	}
-
-	// If the file exists and hasn't changed, skip (but only if not deleted)
-	if existing != nil && !existing.DeletedAt.Valid && existing.Hash == hash {
-		return nil
+	if item == nil {
+		return nil, fmt.Errorf("not a file")
 	}
+	return item, nil
+}
 
-	// Detect the creation date
-	createdAt, err := DetectCreatedAt(path)
-	if err != nil {
-		log.Printf("Error detecting creation date for %s: %v", path, err)
-		createdAt = stat.ModTime()
+// indexFile indexes a unique file and returns its record (nil for a directory).
+// The date override, when not nil, replaces the one stored for the file.
+func (i *Indexer) indexFile(path string, dateOverride *time.Time) (*db.FileItem, error) {
+	// Check if the file exists in the database (including soft-deleted records)
+	existing, err := i.repo.GetByPathIncludingDeleted(path)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
 	}
 
-	// Create or update the item
-	var fileItem *db.FileItem
-	
-	if existing != nil {
-		// Update the item (or resurrect if it was deleted)
-		fileItem = existing
-		fileItem.Size = stat.Size()
-		fileItem.Hash = hash
-		fileItem.CreatedAt = createdAt
-		fileItem.Mime = DetectMime(path)
-		// Clear the DeletedAt field to resurrect the file
-		fileItem.DeletedAt = gorm.DeletedAt{}
-	} else {
-		// Create a new item
-		fileItem = &db.FileItem{
-			ID:        uuid.New().String(),
-			AbsPath:   path,
-			Name:      stat.Name(),
-			Ext:       GetFileExtension(stat.Name()),
-			Mime:      DetectMime(path),
-			Size:      stat.Size(),
-			CreatedAt: createdAt,
-			Hash:      hash,
-		}
+	// Read before the record is updated
+	resurrected := existing != nil && existing.DeletedAt.Valid
+
+	fileItem, changed, err := i.processFile(path, existing, dateOverride)
+	if err != nil || !changed {
+		return fileItem, err
+	}
+	if existing == nil {
+		fileItem.ID = uuid.New().String()
 	}
 
 	// Generate a thumbnail if needed
-	if thumbPath, err := i.thumbnailSvc.GenerateIfNeeded(fileItem.ID, path, fileItem.Mime); err != nil {
+	if thumbnail, err := i.thumbnailSvc.GenerateIfNeeded(fileItem.ID, path, fileItem.Mime); err != nil {
 		log.Printf("Error generating thumbnail for %s: %v", path, err)
-	} else if thumbPath != "" {
-		fileItem.ThumbPath = &thumbPath
+	} else if thumbnail != nil {
+		fileItem.ThumbPath = &thumbnail.Path
+		fileItem.PerceptualHash = thumbnail.PerceptualHash
 	}
 
 	// Save to database
 	if existing != nil {
 		// Use UpdateUnscoped if the file was previously deleted (resurrection)
-		if existing.DeletedAt.Valid {
+		if resurrected {
 			err = i.repo.UpdateUnscoped(fileItem)
 		} else {
 			err = i.repo.Update(fileItem)
@@ -523,13 +634,26 @@ func (i *Indexer) indexFile(path string) error {
 	}
 
 	if err != nil {
-		return fmt.Errorf("error saving: %w", err)
+		return nil, fmt.Errorf("error saving: %w", err)
+	}
+
+	// Update the full-text entry
+	if err := i.repo.IndexContents([]*db.FileItem{fileItem}); err != nil {
+		log.Printf("Error indexing the content of %s: %v", path, err)
+	}
+
+	// Keep the annotations attached to the file
+	if existing != nil {
+		i.refreshAnnotationAnchors([]*db.FileItem{fileItem})
+	} else {
+		i.relinkAnnotations([]*db.FileItem{fileItem})
 	}
+	i.scheduleContentHashing()
 
 	// Emit an event
 	eventType := "added"
 	if existing != nil {
-		if existing.DeletedAt.Valid {
+		if resurrected {
 			eventType = "added" // Treat resurrection as addition
 		} else {
 			eventType = "updated"
@@ -547,7 +671,7 @@ func (i *Indexer) indexFile(path string) error {
 		log.Printf("File %s: %s", eventType, path)
 	}
 
-	return nil
+	return fileItem, nil
 }
 
 // watchFiles watches for file changes
@@ -563,7 +687,10 @@ func (i *Indexer) watchFiles() {
 				log.Printf("fsnotify event: %s %s", event.Op, event.Name)
 			}
 
+			// The events of the changes made through the API wait until the index is up to date
+			i.operationsMu.Lock()
 			i.handleFileSystemEvent(event)
+			i.operationsMu.Unlock()
 
 		case err, ok := <-i.watcher.Errors:
 			if !ok {
@@ -579,20 +706,43 @@ func (i *Indexer) watchFiles() {
 
 // handleFileSystemEvent handles a file system event
 func (i *Indexer) handleFileSystemEvent(event fsnotify.Event) {
-	// Ignore temporary and hidden directories
+	root := i.rootForPath(event.Name)
+	if root == nil {
+		return
+	}
+
+	// Ignore files are hidden: reload their rules and rescan when they change
+	if root.ignore.IsIgnoreFile(filepath.Base(event.Name)) {
+		root.ignore.Invalidate(filepath.Dir(event.Name))
+		i.scheduleRescan("Ignore rules changed")
+		return
+	}
+
+	// Ignore hidden files and directories
 	if ShouldSkipDirectory(filepath.Base(event.Name)) || IsHiddenFile(filepath.Base(event.Name)) {
 		return
 	}
 
+	// Ignore paths excluded by the ignore rules of their root
+	isDir := false
+	if stat, err := os.Stat(event.Name); err == nil {
+		isDir = stat.IsDir()
+	}
+	if i.isInternalDir(event.Name) || root.IsPathIgnored(event.Name, isDir) {
+		return
+	}
+
 	switch {
 	case event.Op&fsnotify.Create == fsnotify.Create:
 		i.handleCreate(event.Name)
 	case event.Op&fsnotify.Write == fsnotify.Write:
 		i.handleWrite(event.Name)
 	case event.Op&fsnotify.Remove == fsnotify.Remove:
+		i.changes.Cancel(event.Name)
 		i.handleRemove(event.Name)
 	case event.Op&fsnotify.Rename == fsnotify.Rename:
-		i.handleRemove(event.Name)
+		i.changes.Cancel(event.Name)
+		i.handleRename(event.Name)
 	}
 }
 
@@ -604,17 +754,19 @@ func (i *Indexer) handleCreate(path string) {
 	}
 
 	if stat.IsDir() {
-		// New directory: add it to the watcher
-		if err := i.watcher.Add(path); err != nil {
-			log.Printf("Error adding watcher for %s: %v", path, err)
-		}
+		// New directory: move the files of a renamed directory, then watch it and index its new files
+		i.completeDirectoryMove(path)
+		i.indexDirectory(path)
 		return
 	}
 
-	// Index the file
-	if err := i.indexFile(path); err != nil {
-		log.Printf("Error indexing %s: %v", path, err)
+	// A renamed file keeps its record
+	if i.completeMove(path, stat) {
+		return
 	}
+
+	// Index the file once it is completely written
+	i.changes.Enqueue(path)
 }
 
 // handleWrite handles the modification of a file
@@ -625,12 +777,28 @@ func (i *Indexer) handleWrite(path string) {
 		return
 	}
 
-	// Reindex the file
-	if err := i.indexFile(path); err != nil {
-		log.Printf("Error reindexing %s: %v", path, err)
+	// Reindex the file once the burst of writes is over
+	i.changes.Enqueue(path)
+}
+
+// indexChangedFile indexes a created or modified file once its writes are over
+func (i *Indexer) indexChangedFile(path string) {
+	// Renamed or removed while waiting
+	stat, err := os.Stat(path)
+	if err != nil || stat.IsDir() {
+		return
+	}
+
+	if _, err := i.indexFile(path, nil); err != nil {
+		log.Printf("Error indexing %s: %v", path, err)
 	}
 }
 
+// QueueStats returns the counters of the files waiting to be indexed by the watcher
+func (i *Indexer) QueueStats() IndexQueueStats {
+	return i.changes.Stats()
+}
+
 // handleRemove handles the deletion of a file
 func (i *Indexer) handleRemove(path string) {
 	// Try to retrieve the file from the database
@@ -639,38 +807,46 @@ func (i *Indexer) handleRemove(path string) {
 		return // File not in database
 	}
 
-	// Delete the thumbnail
-	if err := i.thumbnailSvc.DeleteThumbnail(existing.ID); err != nil {
-		log.Printf("Error deleting thumbnail for %s: %v", path, err)
-	}
-
 	// Delete from the database
 	if err := i.repo.DeleteByPath(path); err != nil {
 		log.Printf("Error deleting %s: %v", path, err)
 		return
 	}
 
+	i.fileRemoved(existing)
+}
+
+// fileRemoved deletes the thumbnail of a file removed from the index and announces its removal
+func (i *Indexer) fileRemoved(item *db.FileItem) {
+	if err := i.thumbnailSvc.DeleteThumbnail(item.ID); err != nil {
+		log.Printf("Error deleting thumbnail for %s: %v", item.AbsPath, err)
+	}
+
 	// Emit an event
 	i.emitEvent(FileEvent{
 		Type:     "removed",
-		FileID:   existing.ID,
-		FilePath: path,
-		FileItem: existing,
+		FileID:   item.ID,
+		FilePath: item.AbsPath,
+		FileItem: item,
 	})
 
 	if i.config.Debug {
-		log.Printf("File removed: %s", path)
+		log.Printf("File removed: %s", item.AbsPath)
 	}
 }
 
 // addWatchRecursive adds recursive watchers
-func (i *Indexer) addWatchRecursive(root string) error {
+func (i *Indexer) addWatchRecursive(root *LibraryRoot) error {
 	return i.walkWithDepth(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil
 		}
 
-		if info.IsDir() && !ShouldSkipDirectory(info.Name()) {
+		if info.IsDir() && path != root.Path && (ShouldSkipDirectory(info.Name()) || i.isInternalDir(path) || root.IsPathIgnored(path, true)) {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() {
 			if err := i.watcher.Add(path); err != nil {
 				log.Printf("Error adding watcher for %s: %v", path, err)
 			}
@@ -680,17 +856,95 @@ func (i *Indexer) addWatchRecursive(root string) error {
 	})
 }
 
-// walkWithDepth walks the file tree with depth control
-func (i *Indexer) walkWithDepth(root string, walkFn filepath.WalkFunc) error {
-	if i.config.ScanDepth == 0 {
+// rootForPath returns the root containing a path (the innermost one for nested roots)
+func (i *Indexer) rootForPath(path string) *LibraryRoot {
+	var found *LibraryRoot
+	for idx := range i.config.Roots {
+		root := &i.config.Roots[idx]
+		if root.Contains(path) && (found == nil || len(root.Path) > len(found.Path)) {
+			found = root
+		}
+	}
+	return found
+}
+
+// isInternalDir checks if a directory is one of the application's own data directories
+func (i *Indexer) isInternalDir(path string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	thumbsPath, err := filepath.Abs(i.config.ThumbsPath)
+	if err != nil {
+		return false
+	}
+	return absPath == thumbsPath || absPath == filepath.Dir(thumbsPath)
+}
+
+// scheduleRescan rescans the roots shortly after ignore rules changed or a rescan was requested,
+// coalescing bursts of events.
+// Newly ignored files are removed by the cleanup following the scan.
+func (i *Indexer) scheduleRescan(reason string) {
+	i.rescanMu.Lock()
+	defer i.rescanMu.Unlock()
+
+	if i.rescanTimer != nil {
+		i.rescanTimer.Stop()
+	}
+	i.rescanTimer = time.AfterFunc(time.Second, func() {
+		select {
+		case <-i.stopChannel:
+			return
+		default:
+		}
+
+		log.Printf("%s, rescanning...", reason)
+		for idx := range i.config.Roots {
+			if err := i.addWatchRecursive(&i.config.Roots[idx]); err != nil {
+				log.Printf("Error adding the watcher: %v", err)
+			}
+		}
+		if err := i.ScanAll(); err != nil {
+			log.Printf("Error rescanning: %v", err)
+		}
+		i.scheduleContentHashing()
+	})
+}
+
+// Rescan scans all the roots again in the background
+func (i *Indexer) Rescan() {
+	i.scheduleRescan("Rescan requested")
+}
+
+// Reset empties the index and the thumbnails, keeping the users and annotations, then scans
+// all the roots again in the background
+func (i *Indexer) Reset() error {
+	i.operationsMu.Lock()
+	err := i.db.ResetWithThumbnails(i.config.ThumbsPath)
+	i.operationsMu.Unlock()
+	if err != nil {
+		return err
+	}
+	i.scheduleRescan("Index reset")
+	return nil
+}
+
+// Roots returns the library roots
+func (i *Indexer) Roots() []LibraryRoot {
+	return i.config.Roots
+}
+
+// walkWithDepth walks the file tree of a root with depth control
+func (i *Indexer) walkWithDepth(root *LibraryRoot, walkFn filepath.WalkFunc) error {
+	if root.ScanDepth == 0 {
 		// Unlimited depth - use standard filepath.Walk
-		return filepath.Walk(root, walkFn)
+		return filepath.Walk(root.Path, walkFn)
 	}
 	
 	// Walk with depth limit (1 = root only, 2 = root+1 level, etc.)
 	// Convert to internal depth: ScanDepth 1 -> maxDepth 0, ScanDepth 2 -> maxDepth 1, etc.
-	maxDepth := i.config.ScanDepth - 1
-	return i.walkWithDepthLimit(root, root, 0, maxDepth, walkFn)
+	maxDepth := root.ScanDepth - 1
+	return i.walkWithDepthLimit(root.Path, root.Path, 0, maxDepth, walkFn)
 }
 
 // walkWithDepthLimit walks the file tree with a depth limit
@@ -742,18 +996,19 @@ func (i *Indexer) walkWithDepthLimit(root, path string, currentDepth, maxDepth i
 	return nil
 }
 
-// emitEvent emits an event
+// emitEvent publishes an event to the subscribers
 func (i *Indexer) emitEvent(event FileEvent) {
-	select {
-	case i.eventChannel <- event:
-	default:
-		log.Printf("Event channel full, event ignored: %s %s", event.Type, event.FilePath)
-	}
+	i.events.Publish(event)
 }
 
-// GetEventChannel returns the event channel
-func (i *Indexer) GetEventChannel() <-chan FileEvent {
-	return i.eventChannel
+// Subscribe registers a consumer of the file events
+func (i *Indexer) Subscribe(name string, options SubscribeOptions) *Subscription {
+	return i.events.Subscribe(name, options)
+}
+
+// EventStats returns the delivery counters of the file events
+func (i *Indexer) EventStats() EventBusStats {
+	return i.events.Stats()
 }
 
 // cleanupOrphanedThumbnails cleans up orphaned thumbnails
@@ -780,14 +1035,9 @@ func (i *Indexer) cleanupOrphanedThumbnails() {
 	}
 }
 
-// cleanupFilesOutsideDepth removes files that don't match current depth settings
+// cleanupFilesOutsideDepth removes files that don't match current root, ignore and depth settings
 func (i *Indexer) cleanupFilesOutsideDepth() {
-	if i.config.ScanDepth == -1 {
-		// No depth limit, nothing to clean up
-		return
-	}
-	
-	log.Printf("Cleaning up files outside depth limit (%d)...", i.config.ScanDepth)
+	log.Println("Cleaning up files outside roots and depth limits...")
 
 	// Get all files from database
 	var allFiles []db.FileItem
@@ -798,17 +1048,23 @@ func (i *Indexer) cleanupFilesOutsideDepth() {
 
 	var filesToRemove []string
 	for _, file := range allFiles {
-		if !i.isPathWithinDepth(file.AbsPath) {
+		// Files indexed under a relative root path are indexed again under its absolute path
+		if !filepath.IsAbs(file.AbsPath) {
+			filesToRemove = append(filesToRemove, file.AbsPath)
+			continue
+		}
+		root := i.rootForPath(file.AbsPath)
+		if root == nil || root.IsPathIgnored(file.AbsPath, false) || !i.isPathWithinDepth(root, file.AbsPath) {
 			filesToRemove = append(filesToRemove, file.AbsPath)
 		}
 	}
 
 	if len(filesToRemove) == 0 {
-		log.Println("No files to remove based on depth settings")
+		log.Println("No files to remove based on root and depth settings")
 		return
 	}
 
-	log.Printf("Removing %d files that are outside depth limit", len(filesToRemove))
+	log.Printf("Removing %d files that are outside roots or depth limits", len(filesToRemove))
 	for _, path := range filesToRemove {
 		// Use the same logic as handleRemove
 		existing, err := i.repo.GetByPath(path)
@@ -836,28 +1092,28 @@ func (i *Indexer) cleanupFilesOutsideDepth() {
 		})
 
 		if i.config.Debug {
-			log.Printf("File removed (outside depth): %s", path)
+			log.Printf("File removed (outside roots or depth): %s", path)
 		}
 	}
 
 	log.Printf("Depth cleanup completed: %d files removed", len(filesToRemove))
 }
 
-// isPathWithinDepth checks if a file path is within the configured scan depth
-func (i *Indexer) isPathWithinDepth(filePath string) bool {
-	if i.config.ScanDepth == 0 {
+// isPathWithinDepth checks if a file path is within the scan depth of its root
+func (i *Indexer) isPathWithinDepth(root *LibraryRoot, filePath string) bool {
+	if root.ScanDepth == 0 {
 		return true // No depth limit
 	}
 
 	// Calculate relative path from root
-	relPath, err := filepath.Rel(i.config.RootPath, filePath)
+	relPath, err := filepath.Rel(root.Path, filePath)
 	if err != nil {
 		return false // If we can't calculate relative path, consider it outside
 	}
 
 	// If file is directly in root directory
 	if relPath == filepath.Base(filePath) {
-		return i.config.ScanDepth >= 1 // Depth 1 allows root files
+		return root.ScanDepth >= 1 // Depth 1 allows root files
 	}
 
 	// Count directory separators to determine depth
@@ -876,8 +1132,8 @@ func (i *Indexer) isPathWithinDepth(filePath string) bool {
 
 	if i.config.Debug {
 		log.Printf("isPathWithinDepth: file=%s, relPath=%s, depth=%d, requiredScanDepth=%d, configScanDepth=%d, allowed=%v", 
-			filePath, relPath, depth, requiredScanDepth, i.config.ScanDepth, requiredScanDepth <= i.config.ScanDepth)
+			filePath, relPath, depth, requiredScanDepth, root.ScanDepth, requiredScanDepth <= root.ScanDepth)
 	}
 
-	return requiredScanDepth <= i.config.ScanDepth
+	return requiredScanDepth <= root.ScanDepth
 }
@@ -0,0 +1,347 @@
+package content
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"tokilane/internal/db"
+)
+
+// eventRecorder counts the file events published by an indexer, by type and path
+type eventRecorder struct {
+	mu     sync.Mutex
+	counts map[string]map[string]int
+}
+
+func recordEvents(indexer *Indexer) *eventRecorder {
+	recorder := &eventRecorder{counts: make(map[string]map[string]int)}
+	sub := indexer.Subscribe("test", SubscribeOptions{BufferSize: 1000})
+	go func() {
+		for event := range sub.Events() {
+			recorder.mu.Lock()
+			if recorder.counts[event.Type] == nil {
+				recorder.counts[event.Type] = make(map[string]int)
+			}
+			recorder.counts[event.Type][event.FilePath]++
+			recorder.mu.Unlock()
+		}
+	}()
+	return recorder
+}
+
+func (r *eventRecorder) count(eventType, path string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[eventType][path]
+}
+
+func (r *eventRecorder) total(eventType string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := 0
+	for _, count := range r.counts[eventType] {
+		total += count
+	}
+	return total
+}
+
+// startTestIndexer starts an indexer watching an empty root in a temporary directory
+func startTestIndexer(t *testing.T, quietPeriod time.Duration) (*Indexer, string) {
+	t.Helper()
+	dir := t.TempDir()
+	rootPath := filepath.Join(dir, "files")
+	indexer := startIndexer(t, filepath.Join(dir, "data"), &IndexerConfig{
+		Roots:            []LibraryRoot{{ID: "files", Path: rootPath}},
+		WatchQuietPeriod: quietPeriod,
+	})
+	return indexer, rootPath
+}
+
+// startIndexer creates the roots of a configuration and starts an indexer with its database
+// and thumbnails in a data directory
+func startIndexer(t *testing.T, dataPath string, config *IndexerConfig) *Indexer {
+	t.Helper()
+	for _, root := range config.Roots {
+		if err := os.MkdirAll(root.Path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config.ThumbsPath = filepath.Join(dataPath, "thumbs")
+	if config.WatchWorkers == 0 {
+		config.WatchWorkers = 2
+	}
+
+	database, err := db.New(filepath.Join(dataPath, "app.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer, err := NewIndexer(config, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		indexer.Stop()
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return indexer
+}
+
+func TestWatcherIndexesBurstsOnce(t *testing.T) {
+	indexer, rootPath := startTestIndexer(t, testQuietPeriod)
+	events := recordEvents(indexer)
+
+	// Files written in many chunks, as by a copy, each chunk within the quiet period
+	names := []string{"a.txt", "b.txt", "c.md"}
+	for chunk := 0; chunk < 20; chunk++ {
+		for _, name := range names {
+			appendTo(t, filepath.Join(rootPath, name), "a chunk of the file\n")
+		}
+		time.Sleep(testQuietPeriod / 10)
+	}
+
+	// A download renamed once complete: only its final name is indexed
+	partial := filepath.Join(rootPath, "video.part.txt")
+	final := filepath.Join(rootPath, "video.txt")
+	for chunk := 0; chunk < 10; chunk++ {
+		appendTo(t, partial, "frames\n")
+		time.Sleep(testQuietPeriod / 10)
+	}
+	if err := os.Rename(partial, final); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file in a new directory
+	if err := os.MkdirAll(filepath.Join(rootPath, "2024"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(rootPath, "2024", "d.txt")
+	time.Sleep(testQuietPeriod / 2) // The watcher adds the new directory
+	for chunk := 0; chunk < 10; chunk++ {
+		appendTo(t, nested, "nested\n")
+	}
+
+	expected := []string{filepath.Join(rootPath, "a.txt"), filepath.Join(rootPath, "b.txt"), filepath.Join(rootPath, "c.md"), final, nested}
+	waitFor(t, 10*time.Second, func() bool { return events.total("added") >= len(expected) })
+	time.Sleep(5 * testQuietPeriod)
+
+	for _, path := range expected {
+		if count := events.count("added", path); count != 1 {
+			t.Errorf("%s added %d times, want 1", path, count)
+		}
+	}
+	if count := events.count("added", partial); count != 0 {
+		t.Errorf("partial download indexed %d times", count)
+	}
+	if updated := events.total("updated"); updated != 0 {
+		t.Errorf("%d updates for files written before their indexing", updated)
+	}
+	if stats := indexer.QueueStats(); stats.Coalesced == 0 || stats.Pending != 0 {
+		t.Errorf("unexpected queue stats: %+v", stats)
+	}
+}
+
+func TestWatcherReindexesAfterQuietPeriod(t *testing.T) {
+	indexer, rootPath := startTestIndexer(t, testQuietPeriod)
+	events := recordEvents(indexer)
+
+	path := filepath.Join(rootPath, "notes.txt")
+	appendTo(t, path, "first version\n")
+	waitFor(t, 10*time.Second, func() bool { return events.count("added", path) == 1 })
+
+	// A second burst of writes is one update
+	for chunk := 0; chunk < 10; chunk++ {
+		appendTo(t, path, "edit\n")
+		time.Sleep(testQuietPeriod / 10)
+	}
+	waitFor(t, 10*time.Second, func() bool { return events.count("updated", path) >= 1 })
+	time.Sleep(5 * testQuietPeriod)
+	if count := events.count("updated", path); count != 1 {
+		t.Errorf("%d updates after a burst of writes, want 1", count)
+	}
+}
+
+func TestIndexPathResurrectsDeletedFile(t *testing.T) {
+	indexer, rootPath := startTestIndexer(t, testQuietPeriod)
+	events := recordEvents(indexer)
+
+	path := filepath.Join(rootPath, "notes.txt")
+	appendTo(t, path, "first version\n")
+	item, err := indexer.IndexPath(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.repo.DeleteByPath(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Indexed again, the removed record comes back with its ID
+	date := time.Date(2020, 5, 14, 10, 12, 33, 0, time.Local)
+	resurrected, err := indexer.IndexPath(path, &date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resurrected.ID != item.ID {
+		t.Errorf("resurrected with the ID %s, want %s", resurrected.ID, item.ID)
+	}
+	current, err := indexer.repo.GetByPath(path)
+	if err != nil {
+		t.Fatalf("resurrected file not found: %v", err)
+	}
+	if !current.CreatedAt.Equal(date) || current.DateOverride == nil {
+		t.Errorf("date %v (override %v), want %v", current.CreatedAt, current.DateOverride, date)
+	}
+	waitFor(t, 10*time.Second, func() bool { return events.count("added", path) == 2 })
+	if count := events.count("updated", path); count != 0 {
+		t.Errorf("resurrection published as %d updates", count)
+	}
+}
+
+func TestIndexPathForgetsDateOfDeletedFile(t *testing.T) {
+	indexer, rootPath := startTestIndexer(t, testQuietPeriod)
+
+	path := filepath.Join(rootPath, "notes.txt")
+	appendTo(t, path, "uploaded with a date\n")
+	date := time.Date(2020, 5, 14, 10, 12, 33, 0, time.Local)
+	if _, err := indexer.IndexPath(path, &date); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.repo.DeleteByPath(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another file placed at the same path gets its own date
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	appendTo(t, path, "another file\n")
+	item, err := indexer.IndexPath(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := indexer.repo.GetByPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, current := range []*db.FileItem{item, stored} {
+		if current.DateOverride != nil || current.CreatedAt.Equal(date) || current.DateSource == DateSourceClient {
+			t.Errorf("date %v from %s (override %v) of the deleted file kept", current.CreatedAt, current.DateSource, current.DateOverride)
+		}
+	}
+}
+
+func TestResetScansAgain(t *testing.T) {
+	indexer, rootPath := startTestIndexer(t, testQuietPeriod)
+
+	path := filepath.Join(rootPath, "notes.txt")
+	appendTo(t, path, "notes\n")
+	item, err := indexer.IndexPath(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.annotations.AddTag(item.ID, "kept"); err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := AnchorFingerprint(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.annotations.SaveAnchor(item, fingerprint); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the watcher is done with the file, only the rescan indexes it again
+	waitFor(t, 10*time.Second, func() bool {
+		stats := indexer.QueueStats()
+		return stats.Received > 0 && stats.Pending == 0 && stats.InFlight == 0
+	})
+	if err := indexer.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := indexer.repo.GetByID(item.ID); err == nil {
+		t.Error("record kept by the reset")
+	}
+
+	// Indexed again by the rescan, with its annotations
+	var current *db.FileItem
+	waitFor(t, 10*time.Second, func() bool {
+		current, err = indexer.repo.GetByPath(path)
+		return err == nil
+	})
+	annotations, err := indexer.annotations.Get(current.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotations.Tags) != 1 || annotations.Tags[0] != "kept" {
+		t.Errorf("tags %v after the reset, want [kept]", annotations.Tags)
+	}
+}
+
+// chdir changes the working directory for the duration of a test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+}
+
+func TestIndexPathWithRelativeRoot(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	if err := os.MkdirAll(filepath.Join("files", "uploads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	indexer := startIndexer(t, "data", &IndexerConfig{
+		Roots:            []LibraryRoot{{ID: "files", Path: "./files"}},
+		IgnorePatterns:   []string{"*.tmp"},
+		WatchQuietPeriod: testQuietPeriod,
+	})
+	events := recordEvents(indexer)
+
+	// The root is absolute, as are the paths reported by the watcher
+	rootPath := indexer.Roots()[0].Path
+	if want, _ := filepath.EvalSymlinks(filepath.Join(dir, "files")); rootPath != filepath.Join(dir, "files") && rootPath != want {
+		t.Fatalf("root path %s, want %s", rootPath, filepath.Join(dir, "files"))
+	}
+
+	// A file indexed right away then seen by the watcher has a single record
+	path := filepath.Join(rootPath, "uploads", "a.txt")
+	appendTo(t, path, "uploaded\n")
+	item, err := indexer.IndexPath(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.AbsPath != path {
+		t.Errorf("indexed as %s, want %s", item.AbsPath, path)
+	}
+	time.Sleep(5 * testQuietPeriod)
+
+	if count := countRecords(t, indexer); count != 1 {
+		t.Errorf("%d records for one file, want 1", count)
+	}
+	if added := events.total("added"); added != 1 {
+		t.Errorf("%d added events, want 1", added)
+	}
+	if updated := events.total("updated"); updated != 0 {
+		t.Errorf("%d updates of a file indexed right away", updated)
+	}
+
+	// The ignore rules of the root apply
+	ignored := filepath.Join(rootPath, "uploads", "b.tmp")
+	appendTo(t, ignored, "temporary\n")
+	if _, err := indexer.IndexPath(ignored, nil); err == nil {
+		t.Error("ignored file indexed")
+	}
+}
@@ -0,0 +1,224 @@
+package content
+
+import (
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default quiet period and number of workers of the queue of file system changes
+const (
+	DefaultWatchQuietPeriod = 500 * time.Millisecond
+	DefaultWatchWorkers     = 2
+)
+
+// queuedPath is a path waiting for the end of its burst of events
+type queuedPath struct {
+	timer   *time.Timer
+	size    int64 // Size and modification time at the last check, to wait for a stable file
+	modTime time.Time
+}
+
+// IndexQueueStats are the counters of the queue of file system changes
+type IndexQueueStats struct {
+	Pending   int    `json:"pending"`   // Paths waiting for their quiet period
+	InFlight  int    `json:"in_flight"` // Paths being indexed
+	Received  uint64 `json:"received"`  // Events received
+	Coalesced uint64 `json:"coalesced"` // Events merged with a pending one
+	Unstable  uint64 `json:"unstable"`  // Checks postponed because the file was still growing
+	Processed uint64 `json:"processed"` // Paths indexed
+}
+
+// indexQueue coalesces the events of each path: a path is processed once no event was
+// received for it during the quiet period and its size stopped changing, by a bounded
+// number of workers, and never by two workers at once
+type indexQueue struct {
+	quietPeriod time.Duration
+	process     func(path string)
+
+	mu       sync.Mutex
+	pending  map[string]*queuedPath
+	inFlight map[string]bool
+
+	work    chan string
+	stop    chan struct{}
+	stopped bool
+	wg      sync.WaitGroup
+
+	received  atomic.Uint64
+	coalesced atomic.Uint64
+	unstable  atomic.Uint64
+	processed atomic.Uint64
+}
+
+// newIndexQueue creates a queue and starts its workers
+func newIndexQueue(quietPeriod time.Duration, workers int, process func(path string)) *indexQueue {
+	if quietPeriod <= 0 {
+		quietPeriod = DefaultWatchQuietPeriod
+	}
+	if workers < 1 {
+		workers = DefaultWatchWorkers
+	}
+
+	q := &indexQueue{
+		quietPeriod: quietPeriod,
+		process:     process,
+		pending:     make(map[string]*queuedPath),
+		inFlight:    make(map[string]bool),
+		work:        make(chan string),
+		stop:        make(chan struct{}),
+	}
+
+	for w := 0; w < workers; w++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	return q
+}
+
+// Enqueue schedules the processing of a path, postponing it if the path is already pending
+func (q *indexQueue) Enqueue(path string) {
+	q.received.Add(1)
+
+	size, modTime := fileState(path)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopped {
+		return
+	}
+
+	if entry, ok := q.pending[path]; ok {
+		q.coalesced.Add(1)
+		entry.size, entry.modTime = size, modTime
+		entry.timer.Reset(q.quietPeriod)
+		return
+	}
+
+	entry := &queuedPath{size: size, modTime: modTime}
+	entry.timer = time.AfterFunc(q.quietPeriod, func() {
+		q.settle(path, entry)
+	})
+	q.pending[path] = entry
+}
+
+// Cancel drops a pending path (removed or renamed)
+func (q *indexQueue) Cancel(path string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if entry, ok := q.pending[path]; ok {
+		entry.timer.Stop()
+		delete(q.pending, path)
+	}
+}
+
+// settle hands a quiet path to the workers if its size is stable, or waits another period
+func (q *indexQueue) settle(path string, entry *queuedPath) {
+	size, modTime := fileState(path)
+
+	q.mu.Lock()
+	if q.stopped || q.pending[path] != entry {
+		q.mu.Unlock()
+		return
+	}
+
+	if size < 0 {
+		// Removed in the meantime
+		delete(q.pending, path)
+		q.mu.Unlock()
+		return
+	}
+
+	if q.inFlight[path] {
+		// Processed again once the current processing is done
+		entry.timer.Reset(q.quietPeriod)
+		q.mu.Unlock()
+		return
+	}
+
+	if size != entry.size || !modTime.Equal(entry.modTime) {
+		// Still being written without events (or the events were lost)
+		q.unstable.Add(1)
+		entry.size, entry.modTime = size, modTime
+		entry.timer.Reset(q.quietPeriod)
+		q.mu.Unlock()
+		return
+	}
+
+	delete(q.pending, path)
+	q.inFlight[path] = true
+	q.mu.Unlock()
+
+	select {
+	case q.work <- path:
+	case <-q.stop:
+	}
+}
+
+// worker processes the settled paths
+func (q *indexQueue) worker() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case path := <-q.work:
+			q.process(path)
+			q.processed.Add(1)
+
+			q.mu.Lock()
+			delete(q.inFlight, path)
+			q.mu.Unlock()
+		}
+	}
+}
+
+// Stats returns the counters of the queue
+func (q *indexQueue) Stats() IndexQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return IndexQueueStats{
+		Pending:   len(q.pending),
+		InFlight:  len(q.inFlight),
+		Received:  q.received.Load(),
+		Coalesced: q.coalesced.Load(),
+		Unstable:  q.unstable.Load(),
+		Processed: q.processed.Load(),
+	}
+}
+
+// Stop drops the pending paths and waits for the paths being processed
+func (q *indexQueue) Stop() {
+	q.mu.Lock()
+	if q.stopped {
+		q.mu.Unlock()
+		return
+	}
+	q.stopped = true
+	for path, entry := range q.pending {
+		entry.timer.Stop()
+		delete(q.pending, path)
+	}
+	close(q.stop)
+	q.mu.Unlock()
+
+	q.wg.Wait()
+	if pending := len(q.inFlight); pending > 0 {
+		log.Printf("File changes queue stopped with %d paths not indexed", pending)
+	}
+}
+
+// fileState returns the size and modification time of a file, or a negative size if it does not exist
+func fileState(path string) (int64, time.Time) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return -1, time.Time{}
+	}
+	return stat.Size(), stat.ModTime()
+}
@@ -0,0 +1,214 @@
+package content
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testQuietPeriod = 100 * time.Millisecond
+
+// processRecorder counts the processing of each path and the largest number of paths
+// processed at once
+type processRecorder struct {
+	mu          sync.Mutex
+	counts      map[string]int
+	running     int
+	maxRunning  int
+	processTime time.Duration
+}
+
+func newProcessRecorder(processTime time.Duration) *processRecorder {
+	return &processRecorder{counts: make(map[string]int), processTime: processTime}
+}
+
+func (r *processRecorder) process(path string) {
+	r.mu.Lock()
+	r.counts[path]++
+	r.running++
+	if r.running > r.maxRunning {
+		r.maxRunning = r.running
+	}
+	r.mu.Unlock()
+
+	time.Sleep(r.processTime)
+
+	r.mu.Lock()
+	r.running--
+	r.mu.Unlock()
+}
+
+func (r *processRecorder) count(path string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[path]
+}
+
+func (r *processRecorder) total() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := 0
+	for _, count := range r.counts {
+		total += count
+	}
+	return total
+}
+
+// waitFor polls a condition until it holds or the timeout expires
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before the timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// appendTo appends data to a file, creating it if needed
+func appendTo(t *testing.T, path, data string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexQueueCoalescesBursts(t *testing.T) {
+	dir := t.TempDir()
+	recorder := newProcessRecorder(0)
+	queue := newIndexQueue(testQuietPeriod, 2, recorder.process)
+	defer queue.Stop()
+
+	// Bursts of writes on several files, each event well within the quiet period of the previous one
+	paths := make([]string, 5)
+	for idx := range paths {
+		paths[idx] = filepath.Join(dir, string(rune('a'+idx))+".txt")
+	}
+	var lastEvent time.Time
+	for burst := 0; burst < 10; burst++ {
+		if burst > 0 {
+			time.Sleep(testQuietPeriod / 5)
+		}
+		for _, path := range paths {
+			appendTo(t, path, "chunk\n")
+			queue.Enqueue(path)
+		}
+		lastEvent = time.Now()
+	}
+
+	if total := recorder.total(); total != 0 {
+		t.Fatalf("%d paths processed during the bursts", total)
+	}
+
+	waitFor(t, 5*time.Second, func() bool { return recorder.total() == len(paths) })
+	if elapsed := time.Since(lastEvent); elapsed < testQuietPeriod {
+		t.Errorf("paths processed %v after the last event, before the quiet period", elapsed)
+	}
+	time.Sleep(3 * testQuietPeriod)
+	for _, path := range paths {
+		if count := recorder.count(path); count != 1 {
+			t.Errorf("%s processed %d times, want 1", filepath.Base(path), count)
+		}
+	}
+
+	stats := queue.Stats()
+	if stats.Received != 50 || stats.Coalesced != 45 || stats.Processed != 5 || stats.Pending != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestIndexQueueWaitsForStableSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "growing.bin")
+	recorder := newProcessRecorder(0)
+	queue := newIndexQueue(testQuietPeriod, 1, recorder.process)
+	defer queue.Stop()
+
+	// A single event, then writes without events (lost or coalesced by the kernel)
+	appendTo(t, path, "start")
+	queue.Enqueue(path)
+	for idx := 0; idx < 6; idx++ {
+		time.Sleep(testQuietPeriod / 2)
+		appendTo(t, path, "more data")
+		if count := recorder.count(path); count != 0 {
+			t.Fatalf("processed while still growing")
+		}
+	}
+
+	waitFor(t, 5*time.Second, func() bool { return recorder.count(path) == 1 })
+	if stats := queue.Stats(); stats.Unstable == 0 {
+		t.Errorf("no unstable check recorded: %+v", stats)
+	}
+}
+
+func TestIndexQueueRenameAndRemove(t *testing.T) {
+	dir := t.TempDir()
+	recorder := newProcessRecorder(0)
+	queue := newIndexQueue(testQuietPeriod, 2, recorder.process)
+	defer queue.Stop()
+
+	oldPath := filepath.Join(dir, "download.part")
+	newPath := filepath.Join(dir, "video.mp4")
+	removed := filepath.Join(dir, "removed.txt")
+
+	// Created and written, then renamed before the end of the quiet period (the watcher
+	// cancels the old path and enqueues the new one)
+	for idx := 0; idx < 5; idx++ {
+		appendTo(t, oldPath, "data")
+		queue.Enqueue(oldPath)
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+	queue.Cancel(oldPath)
+	queue.Enqueue(newPath)
+
+	// Created then removed without a remove event: dropped when it settles
+	appendTo(t, removed, "temporary")
+	queue.Enqueue(removed)
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, 5*time.Second, func() bool { return recorder.count(newPath) == 1 })
+	time.Sleep(3 * testQuietPeriod)
+	if count := recorder.count(oldPath); count != 0 {
+		t.Errorf("old path processed %d times", count)
+	}
+	if count := recorder.count(removed); count != 0 {
+		t.Errorf("removed path processed %d times", count)
+	}
+	if count := recorder.count(newPath); count != 1 {
+		t.Errorf("new path processed %d times, want 1", count)
+	}
+}
+
+func TestIndexQueueBoundsConcurrency(t *testing.T) {
+	dir := t.TempDir()
+	recorder := newProcessRecorder(50 * time.Millisecond)
+	queue := newIndexQueue(testQuietPeriod, 2, recorder.process)
+	defer queue.Stop()
+
+	const files = 8
+	for idx := 0; idx < files; idx++ {
+		path := filepath.Join(dir, string(rune('a'+idx))+".txt")
+		appendTo(t, path, "data")
+		queue.Enqueue(path)
+	}
+
+	waitFor(t, 5*time.Second, func() bool { return recorder.total() == files })
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if recorder.maxRunning > 2 {
+		t.Errorf("%d paths processed at once with 2 workers", recorder.maxRunning)
+	}
+}
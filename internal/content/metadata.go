@@ -0,0 +1,89 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Formats of the metadata embedded in files
+const (
+	MetadataFormatExif      = "exif"      // EXIF of JPEG, TIFF, HEIC and WebP images
+	MetadataFormatPDF       = "pdf"       // PDF Info dictionary and XMP packet
+	MetadataFormatOffice    = "office"    // docProps/core.xml of DOCX, XLSX and PPTX documents
+	MetadataFormatQuickTime = "quicktime" // mvhd box of MP4 and MOV files
+	MetadataFormatID3       = "id3"       // ID3v2 tag of MP3 files
+)
+
+// errNoMetadata is returned when a file carries no supported metadata
+var errNoMetadata = errors.New("no embedded metadata found")
+
+// FileMetadata represents the metadata embedded in a file
+type FileMetadata struct {
+	Format    string            // Format of the metadata (exif, pdf, office, quicktime, id3)
+	CreatedAt time.Time         // Embedded creation date (zero if absent)
+	Raw       map[string]string // Raw metadata fields
+}
+
+// metadataExtractor reads the metadata embedded in a file
+type metadataExtractor func(path string) (*FileMetadata, error)
+
+// metadataExtractors associates MIME types with their extractor
+var metadataExtractors = map[string]metadataExtractor{
+	"image/jpeg":      ReadExif,
+	"image/tiff":      ReadExif,
+	"image/webp":      ReadExif,
+	"image/heic":      ReadExif,
+	"image/heif":      ReadExif,
+	"application/pdf": readPDFMetadata,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   readOfficeMetadata,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         readOfficeMetadata,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": readOfficeMetadata,
+	"application/zip": readOfficeMetadata, // Content sniffing reports OOXML documents as ZIP
+	"video/mp4":       readISOMediaMetadata,
+	"video/quicktime": readISOMediaMetadata,
+	"audio/mp4":       readISOMediaMetadata,
+	"audio/mpeg":      readID3Metadata,
+}
+
+// ExtractMetadata reads the metadata embedded in a file according to its MIME type.
+// The parsers read untrusted files from the scan and the watcher: a panic in one of them
+// is returned as an error instead of stopping the server.
+func ExtractMetadata(path, mimeType string) (metadata *FileMetadata, err error) {
+	extractor, ok := metadataExtractors[strings.ToLower(mimeType)]
+	if !ok {
+		return nil, errNoMetadata
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Error reading the metadata of %s: %v", path, r)
+			metadata, err = nil, fmt.Errorf("invalid metadata: %v", r)
+		}
+	}()
+
+	metadata, err = extractor(path)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.Raw == nil {
+		metadata.Raw = make(map[string]string)
+	}
+
+	return metadata, nil
+}
+
+// RawWithFormat returns the raw metadata including the format, for storage
+func (m *FileMetadata) RawWithFormat() map[string]string {
+	if m == nil {
+		return nil
+	}
+	raw := make(map[string]string, len(m.Raw)+1)
+	for key, value := range m.Raw {
+		raw[key] = value
+	}
+	raw["format"] = m.Format
+	return raw
+}
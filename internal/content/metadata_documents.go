@@ -0,0 +1,269 @@
+package content
+
+import (
+	"archive/zip"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Amount of data read at each end of a PDF to find the Info dictionary and the XMP packet
+const pdfScanSize = 1024 * 1024
+
+var (
+	// Literal "(...)" or hexadecimal "<...>" string values of the Info dictionary
+	pdfInfoPattern = regexp.MustCompile(`/(CreationDate|ModDate|Title|Author|Subject|Creator|Producer)\s*(\((?:\\.|[^\\)])*\)|<[0-9A-Fa-f\s]*>)`)
+	// xmp:CreateDate as element or attribute
+	xmpCreatePattern = regexp.MustCompile(`xmp:CreateDate(?:>|\s*=\s*")([^<"]+)`)
+	// D:YYYYMMDDHHmmSSOHH'mm'
+	pdfDatePattern = regexp.MustCompile(`^(?:D:)?(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?(?:([Zz+-])(\d{2})?'?(\d{2})?'?)?`)
+)
+
+// readPDFMetadata reads the Info dictionary and the XMP creation date of a PDF
+func readPDFMetadata(path string) (*FileMetadata, error) {
+	data, err := readFileEnds(path, pdfScanSize)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &FileMetadata{
+		Format: MetadataFormatPDF,
+		Raw:    make(map[string]string),
+	}
+
+	// The last occurrence wins: incremental updates are appended to the file
+	for _, match := range pdfInfoPattern.FindAllSubmatch(data, -1) {
+		if value := decodePDFString(string(match[2])); value != "" {
+			metadata.Raw[string(match[1])] = value
+		}
+	}
+	if match := xmpCreatePattern.FindSubmatch(data); match != nil {
+		metadata.Raw["xmp:CreateDate"] = strings.TrimSpace(string(match[1]))
+	}
+
+	if value, ok := metadata.Raw["CreationDate"]; ok {
+		if date, err := parsePDFDate(value); err == nil {
+			metadata.CreatedAt = date
+		}
+	}
+	if value, ok := metadata.Raw["xmp:CreateDate"]; ok && metadata.CreatedAt.IsZero() {
+		if date, err := parseW3CDate(value); err == nil {
+			metadata.CreatedAt = date
+		}
+	}
+
+	if len(metadata.Raw) == 0 {
+		return nil, errNoMetadata
+	}
+	return metadata, nil
+}
+
+// readFileEnds reads the first and last size bytes of a file (the whole file if smaller)
+func readFileEnds(path string, size int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if stat.Size() <= 2*size {
+		return io.ReadAll(file)
+	}
+
+	data := make([]byte, 2*size)
+	if _, err := file.ReadAt(data[:size], 0); err != nil {
+		return nil, err
+	}
+	if _, err := file.ReadAt(data[size:], stat.Size()-size); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+// decodePDFString decodes a literal or hexadecimal PDF string (PDFDocEncoding or UTF-16BE)
+func decodePDFString(value string) string {
+	var raw []byte
+	if strings.HasPrefix(value, "<") {
+		cleaned := strings.Join(strings.Fields(strings.Trim(value, "<>")), "")
+		if len(cleaned)%2 == 1 {
+			cleaned += "0"
+		}
+		decoded, err := hex.DecodeString(cleaned)
+		if err != nil {
+			return ""
+		}
+		raw = decoded
+	} else {
+		raw = unescapePDFLiteral(value[1 : len(value)-1])
+	}
+
+	// UTF-16BE strings start with a byte order mark
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return strings.TrimSpace(string(utf16.Decode(units)))
+	}
+
+	return strings.TrimSpace(string(raw))
+}
+
+// unescapePDFLiteral resolves the escape sequences of a literal PDF string
+func unescapePDFLiteral(value string) []byte {
+	var out []byte
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c != '\\' || i+1 >= len(value) {
+			out = append(out, c)
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			end := i + 1
+			for end < len(value) && end < i+3 && value[end] >= '0' && value[end] <= '7' {
+				end++
+			}
+			code, _ := strconv.ParseUint(value[i:end], 8, 8)
+			out = append(out, byte(code))
+			i = end - 1
+		default:
+			out = append(out, value[i])
+		}
+	}
+	return out
+}
+
+// parsePDFDate parses a PDF date ("D:20230514101233+02'00'"), missing parts defaulting to their minimum
+func parsePDFDate(value string) (time.Time, error) {
+	match := pdfDatePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return time.Time{}, fmt.Errorf("invalid PDF date: %q", value)
+	}
+
+	number := func(index, defaultValue int) int {
+		if match[index] == "" {
+			return defaultValue
+		}
+		n, _ := strconv.Atoi(match[index])
+		return n
+	}
+
+	location := time.Local
+	switch match[7] {
+	case "Z", "z":
+		location = time.UTC
+	case "+", "-":
+		offset := number(8, 0)*3600 + number(9, 0)*60
+		if match[7] == "-" {
+			offset = -offset
+		}
+		location = time.FixedZone("", offset)
+	}
+
+	month := number(2, 1)
+	day := number(3, 1)
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, fmt.Errorf("invalid PDF date: %q", value)
+	}
+
+	return time.Date(number(1, 0), time.Month(month), day, number(4, 0), number(5, 0), number(6, 0), 0, location), nil
+}
+
+// parseW3CDate parses the W3C date formats used by XMP and Office documents
+func parseW3CDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %q", value)
+}
+
+// officeCoreProperties represents docProps/core.xml (elements are matched by local name)
+type officeCoreProperties struct {
+	Title          string `xml:"title"`
+	Subject        string `xml:"subject"`
+	Creator        string `xml:"creator"`
+	Keywords       string `xml:"keywords"`
+	LastModifiedBy string `xml:"lastModifiedBy"`
+	Created        string `xml:"created"`
+	Modified       string `xml:"modified"`
+}
+
+// readOfficeMetadata reads the core properties of a DOCX, XLSX or PPTX document
+func readOfficeMetadata(path string) (*FileMetadata, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	for _, entry := range archive.File {
+		if entry.Name != "docProps/core.xml" {
+			continue
+		}
+
+		reader, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		var core officeCoreProperties
+		if err := xml.NewDecoder(io.LimitReader(reader, maxExifSize)).Decode(&core); err != nil {
+			return nil, fmt.Errorf("invalid core properties: %w", err)
+		}
+
+		metadata := &FileMetadata{
+			Format: MetadataFormatOffice,
+			Raw:    make(map[string]string),
+		}
+		fields := map[string]string{
+			"dc:title":          core.Title,
+			"dc:subject":        core.Subject,
+			"dc:creator":        core.Creator,
+			"cp:keywords":       core.Keywords,
+			"cp:lastModifiedBy": core.LastModifiedBy,
+			"dcterms:created":   core.Created,
+			"dcterms:modified":  core.Modified,
+		}
+		for key, value := range fields {
+			if value = strings.TrimSpace(value); value != "" {
+				metadata.Raw[key] = value
+			}
+		}
+
+		if date, err := parseW3CDate(core.Created); err == nil {
+			metadata.CreatedAt = date
+		}
+
+		return metadata, nil
+	}
+
+	return nil, errNoMetadata
+}
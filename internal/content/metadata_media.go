@@ -0,0 +1,278 @@
+package content
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// ISO media times are expressed in seconds since 1904-01-01 UTC
+var isoMediaEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// heifBrands identifies HEIF images sharing the ISO media container with videos
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true,
+	"hevc": true, "hevx": true, "mif1": true, "msf1": true, "avif": true,
+}
+
+// readISOMediaMetadata reads the mvhd box of an MP4/MOV file (or the EXIF of a HEIF image)
+func readISOMediaMetadata(path string) (*FileMetadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	boxes, err := readBMFFBoxes(file, 0, stat.Size())
+	if err != nil && len(boxes) == 0 {
+		return nil, err
+	}
+
+	metadata := &FileMetadata{
+		Format: MetadataFormatQuickTime,
+		Raw:    make(map[string]string),
+	}
+
+	if ftyp, ok := findBMFFBox(boxes, "ftyp"); ok && ftyp.Size >= 4 {
+		brand := make([]byte, 4)
+		if _, err := file.ReadAt(brand, ftyp.Offset); err == nil {
+			if heifBrands[string(brand)] {
+				return ReadExif(path)
+			}
+			metadata.Raw["major_brand"] = strings.TrimSpace(string(brand))
+		}
+	}
+
+	moov, ok := findBMFFBox(boxes, "moov")
+	if !ok {
+		return nil, errNoMetadata
+	}
+	children, err := readBMFFBoxes(file, moov.Offset, moov.Offset+moov.Size)
+	if err != nil && len(children) == 0 {
+		return nil, err
+	}
+	mvhdBox, ok := findBMFFBox(children, "mvhd")
+	if !ok {
+		return nil, errNoMetadata
+	}
+	mvhd, err := readBMFFPayload(file, mvhdBox, 1024)
+	if err != nil {
+		return nil, err
+	}
+
+	// Version 1 uses 64-bit times and duration
+	var created, modified, timescale, duration uint64
+	pos := 4
+	timeSize := 4
+	if len(mvhd) > 0 && mvhd[0] == 1 {
+		timeSize = 8
+	}
+	if created, pos, err = readUintN(mvhd, pos, timeSize); err != nil {
+		return nil, err
+	}
+	if modified, pos, err = readUintN(mvhd, pos, timeSize); err != nil {
+		return nil, err
+	}
+	if timescale, pos, err = readUintN(mvhd, pos, 4); err != nil {
+		return nil, err
+	}
+	if duration, _, err = readUintN(mvhd, pos, timeSize); err != nil {
+		return nil, err
+	}
+
+	// A zero creation time means "unknown"
+	if created > 0 {
+		metadata.CreatedAt = isoMediaEpoch.Add(time.Duration(created) * time.Second)
+		metadata.Raw["creation_time"] = metadata.CreatedAt.Format(time.RFC3339)
+	}
+	if modified > 0 {
+		metadata.Raw["modification_time"] = isoMediaEpoch.Add(time.Duration(modified) * time.Second).Format(time.RFC3339)
+	}
+	if timescale > 0 {
+		metadata.Raw["duration"] = strconv.FormatFloat(float64(duration)/float64(timescale), 'f', 2, 64)
+	}
+
+	return metadata, nil
+}
+
+// id3TextFrames lists the ID3v2 text frames exposed in the raw metadata (v2.3/v2.4 and v2.2 names)
+var id3TextFrames = map[string]string{
+	"TIT2": "title", "TT2": "title",
+	"TPE1": "artist", "TP1": "artist",
+	"TALB": "album", "TAL": "album",
+	"TDRC": "recording_time",
+	"TYER": "year", "TYE": "year",
+	"TDAT": "date", "TDA": "date",
+	"TIME": "time", "TIM": "time",
+	"TCON": "genre", "TCO": "genre",
+}
+
+// readID3Metadata reads the ID3v2 tag of an MP3 file
+func readID3Metadata(path string) (*FileMetadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(file, header); err != nil || string(header[:3]) != "ID3" {
+		return nil, errNoMetadata
+	}
+
+	version := header[3]
+	flags := header[5]
+	size := syncsafeUint32(header[6:10])
+	if size > maxExifSize {
+		size = maxExifSize
+	}
+
+	tag := make([]byte, size)
+	n, err := io.ReadFull(file, tag)
+	if err != nil && n == 0 {
+		return nil, err
+	}
+	tag = tag[:n]
+
+	pos := 0
+	// Skip the extended header
+	if flags&0x40 != 0 && version >= 3 && len(tag) >= 4 {
+		extended := int(binary.BigEndian.Uint32(tag[:4]))
+		if version == 4 {
+			extended = int(syncsafeUint32(tag[:4]))
+		} else {
+			extended += 4
+		}
+		pos = extended
+	}
+
+	metadata := &FileMetadata{
+		Format: MetadataFormatID3,
+		Raw:    map[string]string{"version": fmt.Sprintf("2.%d", version)},
+	}
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+
+	for pos+headerSize <= len(tag) {
+		id := string(tag[pos : pos+idSize])
+		if id[0] == 0 {
+			// Padding
+			break
+		}
+
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(tag[pos+3])<<16 | int(tag[pos+4])<<8 | int(tag[pos+5])
+		case 4:
+			frameSize = int(syncsafeUint32(tag[pos+4 : pos+8]))
+		default:
+			frameSize = int(binary.BigEndian.Uint32(tag[pos+4 : pos+8]))
+		}
+
+		start := pos + headerSize
+		end := start + frameSize
+		if frameSize <= 0 || end > len(tag) {
+			break
+		}
+
+		if name, ok := id3TextFrames[id]; ok {
+			if value := decodeID3Text(tag[start:end]); value != "" {
+				metadata.Raw[name] = value
+			}
+		}
+		pos = end
+	}
+
+	metadata.CreatedAt = id3RecordingTime(metadata.Raw)
+	return metadata, nil
+}
+
+// id3RecordingTime builds the recording time from TDRC (v2.4) or TYER/TDAT/TIME (v2.3)
+func id3RecordingTime(raw map[string]string) time.Time {
+	if value, ok := raw["recording_time"]; ok {
+		for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02T15", "2006-01-02", "2006-01", "2006"} {
+			if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+				return date
+			}
+		}
+	}
+
+	year, err := strconv.Atoi(raw["year"])
+	if err != nil || year < 1000 {
+		return time.Time{}
+	}
+	month, day, hour, minute := 1, 1, 0, 0
+	// TDAT is DDMM, TIME is HHMM
+	if value := raw["date"]; len(value) == 4 {
+		day, _ = strconv.Atoi(value[:2])
+		month, _ = strconv.Atoi(value[2:])
+	}
+	if value := raw["time"]; len(value) == 4 {
+		hour, _ = strconv.Atoi(value[:2])
+		minute, _ = strconv.Atoi(value[2:])
+	}
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		month, day = 1, 1
+	}
+
+	return time.Date(year, time.Month(month), day, hour, minute, 0, 0, time.Local)
+}
+
+// syncsafeUint32 decodes a 28-bit syncsafe integer
+func syncsafeUint32(data []byte) uint32 {
+	return uint32(data[0]&0x7F)<<21 | uint32(data[1]&0x7F)<<14 | uint32(data[2]&0x7F)<<7 | uint32(data[3]&0x7F)
+}
+
+// decodeID3Text decodes a text frame according to its encoding byte
+func decodeID3Text(frame []byte) string {
+	if len(frame) < 2 {
+		return ""
+	}
+	encoding, data := frame[0], frame[1:]
+
+	var text string
+	switch encoding {
+	case 1, 2:
+		// UTF-16 with BOM (1) or UTF-16BE (2)
+		bigEndian := encoding == 2
+		if len(data) >= 2 && data[0] == 0xFE && data[1] == 0xFF {
+			bigEndian, data = true, data[2:]
+		} else if len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE {
+			bigEndian, data = false, data[2:]
+		}
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			if bigEndian {
+				units = append(units, binary.BigEndian.Uint16(data[i:]))
+			} else {
+				units = append(units, binary.LittleEndian.Uint16(data[i:]))
+			}
+		}
+		text = string(utf16.Decode(units))
+	case 3:
+		text = string(data)
+	default:
+		// ISO-8859-1
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+
+	return strings.TrimSpace(strings.TrimRight(text, "\x00"))
+}
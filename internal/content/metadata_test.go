@@ -0,0 +1,373 @@
+package content
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// assertTruncationsRefused reads every truncation of a file with an extractor, which must
+// fail or return metadata without a date until the bytes of the date are included
+func assertTruncationsRefused(t *testing.T, name string, data []byte, dateEnd int, extractor metadataExtractor) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	for size := 0; size < len(data); size++ {
+		if err := os.WriteFile(path, data[:size], 0644); err != nil {
+			t.Fatal(err)
+		}
+		if metadata, err := extractor(path); err == nil && !metadata.CreatedAt.IsZero() && size < dateEnd {
+			t.Errorf("%s truncated to %d bytes read with the date %v", name, size, metadata.CreatedAt)
+		}
+	}
+}
+
+func TestReadPDFMetadata(t *testing.T) {
+	paris := time.FixedZone("", 2*60*60)
+
+	tests := []struct {
+		name  string
+		data  string
+		want  time.Time
+		title string
+	}{
+		{
+			"info dictionary",
+			"%PDF-1.7\n1 0 obj\n<< /Title (Annual \\(draft\\) report) /CreationDate (D:20230514101233+02'00') >>\nendobj\n%%EOF",
+			time.Date(2023, 5, 14, 10, 12, 33, 0, paris),
+			"Annual (draft) report",
+		},
+		{
+			"hexadecimal UTF-16 title",
+			"%PDF-1.4\n<< /Title <FEFF00C9007400E9> /CreationDate (D:20220101) >>\n%%EOF",
+			time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local),
+			"Été",
+		},
+		{
+			"incremental update",
+			"%PDF-1.4\n<< /CreationDate (D:20200101000000Z) >>\n%%EOF\n<< /CreationDate (D:20210101000000Z) >>\n%%EOF",
+			time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			"",
+		},
+		{
+			"XMP only",
+			"%PDF-1.7\n<x:xmpmeta><rdf:Description xmp:CreateDate=\"2019-07-01T08:30:00-04:00\"/></x:xmpmeta>\n%%EOF",
+			time.Date(2019, 7, 1, 8, 30, 0, 0, time.FixedZone("", -4*60*60)),
+			"",
+		},
+		{
+			"invalid Info date falls back to XMP",
+			"%PDF-1.7\n<< /CreationDate (yesterday) >>\n<xmp:CreateDate>2019-07-01</xmp:CreateDate>\n%%EOF",
+			time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC),
+			"",
+		},
+		{
+			"no date",
+			"%PDF-1.7\n<< /Producer (LibreOffice) >>\n%%EOF",
+			time.Time{},
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := readPDFMetadata(writeExifTestFile(t, "document.pdf", []byte(tt.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !metadata.CreatedAt.Equal(tt.want) {
+				t.Errorf("date %v, want %v", metadata.CreatedAt, tt.want)
+			}
+			if metadata.Raw["Title"] != tt.title {
+				t.Errorf("title %q, want %q", metadata.Raw["Title"], tt.title)
+			}
+		})
+	}
+
+	if _, err := readPDFMetadata(writeExifTestFile(t, "empty.pdf", []byte("%PDF-1.7\n%%EOF"))); err != errNoMetadata {
+		t.Errorf("PDF without metadata: %v, want %v", err, errNoMetadata)
+	}
+	data := []byte(tests[0].data)
+	assertTruncationsRefused(t, "document.pdf", data, bytes.Index(data, []byte("+02'00')"))+len("+02'00')"), readPDFMetadata)
+}
+
+func TestParsePDFDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"D:20230514101233+02'00'", time.Date(2023, 5, 14, 10, 12, 33, 0, time.FixedZone("", 2*60*60))},
+		{"D:20230514101233-05'30", time.Date(2023, 5, 14, 10, 12, 33, 0, time.FixedZone("", -(5*60*60+30*60)))},
+		{"D:20230514101233Z", time.Date(2023, 5, 14, 10, 12, 33, 0, time.UTC)},
+		{"D:202305141012", time.Date(2023, 5, 14, 10, 12, 0, 0, time.Local)},
+		{"20230514", time.Date(2023, 5, 14, 0, 0, 0, 0, time.Local)},
+		{"D:2023", time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local)},
+		{"D:20231399", time.Time{}},
+		{"D:", time.Time{}},
+		{"", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		date, err := parsePDFDate(tt.value)
+		if tt.want.IsZero() {
+			if err == nil {
+				t.Errorf("parsePDFDate(%q) = %v, want an error", tt.value, date)
+			}
+			continue
+		}
+		if err != nil || !date.Equal(tt.want) {
+			t.Errorf("parsePDFDate(%q) = %v, %v, want %v", tt.value, date, err, tt.want)
+		}
+	}
+}
+
+// testOfficeDocument builds a ZIP archive with the given entries
+func testOfficeDocument(t *testing.T, entries map[string]string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for name, content := range entries {
+		writer, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestReadOfficeMetadata(t *testing.T) {
+	core := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<dc:title>Budget 2023</dc:title><dc:creator>Alice</dc:creator>
+<dcterms:created xsi:type="dcterms:W3CDTF">2023-05-14T10:12:33Z</dcterms:created>
+<dcterms:modified xsi:type="dcterms:W3CDTF">2023-06-01T08:00:00Z</dcterms:modified>
+</cp:coreProperties>`
+
+	tests := []struct {
+		name    string
+		entries map[string]string
+		want    time.Time
+		invalid bool
+	}{
+		{"core properties", map[string]string{"[Content_Types].xml": "<Types/>", "docProps/core.xml": core}, time.Date(2023, 5, 14, 10, 12, 33, 0, time.UTC), false},
+		{"invalid date", map[string]string{"docProps/core.xml": "<coreProperties><created>soon</created><title>Notes</title></coreProperties>"}, time.Time{}, false},
+		{"no core properties", map[string]string{"word/document.xml": "<document/>"}, time.Time{}, true},
+		{"invalid XML", map[string]string{"docProps/core.xml": "<coreProperties><created>"}, time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := readOfficeMetadata(writeExifTestFile(t, "document.docx", testOfficeDocument(t, tt.entries)))
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("no error, metadata %+v", metadata)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !metadata.CreatedAt.Equal(tt.want) {
+				t.Errorf("date %v, want %v", metadata.CreatedAt, tt.want)
+			}
+		})
+	}
+
+	metadata, err := readOfficeMetadata(writeExifTestFile(t, "budget.xlsx", testOfficeDocument(t, tests[0].entries)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Raw["dc:title"] != "Budget 2023" || metadata.Raw["dc:creator"] != "Alice" || metadata.Raw["dcterms:modified"] != "2023-06-01T08:00:00Z" {
+		t.Errorf("raw metadata %v", metadata.Raw)
+	}
+
+	// The central directory is at the end: no truncation can be read
+	data := testOfficeDocument(t, tests[0].entries)
+	assertTruncationsRefused(t, "document.docx", data, len(data), readOfficeMetadata)
+}
+
+// testMovie builds an MP4 file with a movie header of the given version
+func testMovie(brand string, version byte, created time.Time) []byte {
+	seconds := uint64(created.Sub(isoMediaEpoch) / time.Second)
+	mvhd := []byte{version, 0, 0, 0}
+	if version == 1 {
+		mvhd = binary.BigEndian.AppendUint64(mvhd, seconds)
+		mvhd = binary.BigEndian.AppendUint64(mvhd, seconds+60)
+		mvhd = binary.BigEndian.AppendUint32(mvhd, 1000)
+		mvhd = binary.BigEndian.AppendUint64(mvhd, 90500)
+	} else {
+		mvhd = binary.BigEndian.AppendUint32(mvhd, uint32(seconds))
+		mvhd = binary.BigEndian.AppendUint32(mvhd, uint32(seconds+60))
+		mvhd = binary.BigEndian.AppendUint32(mvhd, 1000)
+		mvhd = binary.BigEndian.AppendUint32(mvhd, 90500)
+	}
+	mvhd = append(mvhd, make([]byte, 80)...)
+
+	ftyp := testBox("ftyp", []byte(brand), []byte{0, 0, 2, 0}, []byte("isomiso2mp41"))
+	return bytes.Join([][]byte{ftyp, testBox("moov", testBox("mvhd", mvhd), testBox("trak")), testBox("mdat", []byte("frames"))}, nil)
+}
+
+func TestReadISOMediaMetadata(t *testing.T) {
+	created := time.Date(2023, 5, 14, 10, 12, 33, 0, time.UTC)
+	zero := isoMediaEpoch
+
+	tests := []struct {
+		name     string
+		data     []byte
+		want     time.Time
+		duration string
+		invalid  bool
+	}{
+		{"version 0", testMovie("isom", 0, created), created, "90.50", false},
+		{"version 1", testMovie("qt  ", 1, created), created, "90.50", false},
+		{"unknown creation time", testMovie("isom", 0, zero), time.Time{}, "90.50", false},
+		{"no movie box", testBox("ftyp", []byte("isom")), time.Time{}, "", true},
+		{"truncated movie header", append(testBox("ftyp", []byte("isom")), testBox("moov", testBox("mvhd", []byte{0, 0, 0, 0, 1, 2}))...), time.Time{}, "", true},
+		{
+			"oversized movie box",
+			append(testBox("ftyp", []byte("isom")), testLargeBox("moov", 0x7FFFFFFFFFFFFFFF, testBox("mvhd", make([]byte, 100)))...),
+			time.Time{}, "", true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := readISOMediaMetadata(writeExifTestFile(t, "movie.mp4", tt.data))
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("no error, metadata %+v", metadata)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !metadata.CreatedAt.Equal(tt.want) {
+				t.Errorf("date %v, want %v", metadata.CreatedAt, tt.want)
+			}
+			if metadata.Raw["duration"] != tt.duration {
+				t.Errorf("duration %q, want %q", metadata.Raw["duration"], tt.duration)
+			}
+		})
+	}
+
+	// HEIF images share the container and are read as EXIF
+	tiff := testTIFF(nil, []testTag{{exifTagDateTimeOriginal, "2023:05:14 10:12:33"}})
+	metadata, err := readISOMediaMetadata(writeExifTestFile(t, "photo.heic", testHEIF(tiff)))
+	if err != nil || metadata.Format != MetadataFormatExif || metadata.CreatedAt.IsZero() {
+		t.Errorf("HEIF image read as %+v, %v", metadata, err)
+	}
+
+	data := testMovie("isom", 0, created)
+	assertTruncationsRefused(t, "movie.mp4", data, bytes.Index(data, []byte("mvhd"))+12, readISOMediaMetadata)
+}
+
+// testID3Frame builds a text frame of an ID3v2.3 or v2.4 tag
+func testID3Frame(id string, encoding byte, text []byte) []byte {
+	frame := append([]byte(id), 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(frame[4:8], uint32(1+len(text)))
+	return append(append(frame, encoding), text...)
+}
+
+// testID3 builds an MP3 file starting with an ID3v2 tag
+func testID3(version byte, flags byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	body = append(body, make([]byte, 16)...) // Padding
+	size := len(body)
+	header := []byte{'I', 'D', '3', version, 0, flags, byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+	return append(append(header, body...), 0xFF, 0xFB, 0x90, 0x00)
+}
+
+func TestReadID3Metadata(t *testing.T) {
+	utf16Title := []byte{0xFF, 0xFE, 'C', 0, 0xE9, 0, 'l', 0, 0xE8, 0, 'b', 0, 'r', 0, 'e', 0}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		want  time.Time
+		title string
+	}{
+		{
+			"version 2.3",
+			testID3(3, 0, testID3Frame("TIT2", 0, []byte("Intro")), testID3Frame("TYER", 0, []byte("2019")),
+				testID3Frame("TDAT", 0, []byte("0106")), testID3Frame("TIME", 0, []byte("0830"))),
+			time.Date(2019, 6, 1, 8, 30, 0, 0, time.Local),
+			"Intro",
+		},
+		{
+			"version 2.4",
+			testID3(4, 0, testID3Frame("TIT2", 1, utf16Title), testID3Frame("TDRC", 3, []byte("2021-03-04T05:06"))),
+			time.Date(2021, 3, 4, 5, 6, 0, 0, time.Local),
+			"Célèbre",
+		},
+		{
+			"version 2.2",
+			testID3(2, 0, []byte{'T', 'T', '2', 0, 0, 5, 0, 'S', 'o', 'n', 'g'}, []byte{'T', 'Y', 'E', 0, 0, 5, 0, '1', '9', '9', '9'}),
+			time.Date(1999, 1, 1, 0, 0, 0, 0, time.Local),
+			"Song",
+		},
+		{
+			"extended header",
+			testID3(3, 0x40, []byte{0, 0, 0, 6, 0, 0, 0, 0, 0, 0}, testID3Frame("TYER", 0, []byte("2005"))),
+			time.Date(2005, 1, 1, 0, 0, 0, 0, time.Local),
+			"",
+		},
+		{
+			"invalid date",
+			testID3(3, 0, testID3Frame("TYER", 0, []byte("soon")), testID3Frame("TDAT", 0, []byte("3213"))),
+			time.Time{},
+			"",
+		},
+		{
+			"frame beyond the tag",
+			testID3(3, 0, testID3Frame("TIT2", 0, []byte("Intro")), []byte{'T', 'Y', 'E', 'R', 0x7F, 0xFF, 0xFF, 0xFF, 0, 0}),
+			time.Time{},
+			"Intro",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := readID3Metadata(writeExifTestFile(t, "song.mp3", tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !metadata.CreatedAt.Equal(tt.want) {
+				t.Errorf("date %v, want %v", metadata.CreatedAt, tt.want)
+			}
+			if metadata.Raw["title"] != tt.title {
+				t.Errorf("title %q, want %q", metadata.Raw["title"], tt.title)
+			}
+		})
+	}
+
+	if _, err := readID3Metadata(writeExifTestFile(t, "song.mp3", []byte{0xFF, 0xFB, 0x90, 0x00})); err != errNoMetadata {
+		t.Errorf("MP3 without tag: %v, want %v", err, errNoMetadata)
+	}
+	data := tests[0].data
+	assertTruncationsRefused(t, "song.mp3", data, bytes.Index(data, []byte("2019"))+4, readID3Metadata)
+}
+
+func TestExtractMetadataRecoversFromPanics(t *testing.T) {
+	metadataExtractors["application/x-test-panic"] = func(path string) (*FileMetadata, error) {
+		var boxes []bmffBox
+		return &FileMetadata{Format: boxes[1].Type}, nil
+	}
+	defer delete(metadataExtractors, "application/x-test-panic")
+
+	if metadata, err := ExtractMetadata("crafted.bin", "application/x-test-panic"); err == nil {
+		t.Errorf("panic not reported: %+v", metadata)
+	}
+	if _, err := ExtractMetadata("notes.txt", "text/plain"); err != errNoMetadata {
+		t.Errorf("unsupported type: %v, want %v", err, errNoMetadata)
+	}
+}
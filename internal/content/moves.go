@@ -0,0 +1,335 @@
+package content
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tokilane/internal/db"
+)
+
+// Time during which a renamed file waits for the creation of its new path before being
+// removed from the index (moved out of the roots or deleted)
+const moveWindow = time.Second
+
+// pendingMove is a renamed file or directory waiting for its new path
+type pendingMove struct {
+	item  *db.FileItem // The renamed file, or a file of the renamed directory to recognize it
+	dir   string       // Previous path of a renamed directory (empty for a file)
+	timer *time.Timer
+}
+
+// handleRename handles the renaming of a file or directory. The old path is kept for a
+// short while so that the creation of the new path can be recognized as a move.
+func (i *Indexer) handleRename(path string) {
+	i.unwatchDirectory(path)
+
+	move := &pendingMove{}
+	if existing, err := i.repo.GetByPath(path); err == nil {
+		move.item = existing
+	} else {
+		items, err := i.repo.GetUnderDirectory(path, 1)
+		if err != nil || len(items) == 0 {
+			return // Not indexed
+		}
+		move.item = &items[0]
+		move.dir = path
+	}
+
+	i.movesMu.Lock()
+	defer i.movesMu.Unlock()
+
+	if previous, ok := i.pendingMoves[path]; ok {
+		previous.timer.Stop()
+	}
+	move.timer = time.AfterFunc(moveWindow, func() {
+		i.expireMove(path, move)
+	})
+	i.pendingMoves[path] = move
+}
+
+// expireMove removes a renamed file or directory whose new path was not seen
+func (i *Indexer) expireMove(path string, move *pendingMove) {
+	i.movesMu.Lock()
+	if i.pendingMoves[path] != move {
+		i.movesMu.Unlock()
+		return // Completed or renamed again
+	}
+	delete(i.pendingMoves, path)
+	i.movesMu.Unlock()
+
+	select {
+	case <-i.stopChannel:
+		return
+	default:
+	}
+
+	if move.dir == "" {
+		i.removeIfMissing(path)
+		return
+	}
+
+	items, err := i.repo.GetUnderDirectory(move.dir, 0)
+	if err != nil {
+		log.Printf("Error retrieving the files of %s: %v", move.dir, err)
+		return
+	}
+	for _, item := range items {
+		i.removeIfMissing(item.AbsPath)
+	}
+}
+
+// unwatchDirectory removes the watches of a renamed directory and its subdirectories.
+// They would follow the directory to its new location under their old paths; the new
+// paths are watched when the directory appears again.
+func (i *Indexer) unwatchDirectory(dir string) {
+	prefix := dir + string(filepath.Separator)
+	for _, watched := range i.watcher.WatchList() {
+		if watched == dir || strings.HasPrefix(watched, prefix) {
+			i.watcher.Remove(watched)
+		}
+	}
+}
+
+// removeIfMissing removes a file from the index unless it exists again at the same path
+func (i *Indexer) removeIfMissing(path string) {
+	if _, err := os.Stat(path); err == nil {
+		if _, err := i.indexFile(path, nil); err != nil {
+			log.Printf("Error reindexing %s: %v", path, err)
+		}
+		return
+	}
+	i.handleRemove(path)
+}
+
+// completeMove recognizes a created file as a renamed one (same inode and size) and moves
+// its record, keeping its ID. Returns false if the file is new.
+func (i *Indexer) completeMove(path string, stat os.FileInfo) bool {
+	inode, ok := fileInode(stat)
+	if !ok || inode == 0 {
+		return false
+	}
+
+	// A file replaced by another one (atomic save) keeps the record of its path
+	if _, err := i.repo.GetByPathIncludingDeleted(path); err == nil {
+		return false
+	}
+
+	var item *db.FileItem
+	i.movesMu.Lock()
+	for oldPath, move := range i.pendingMoves {
+		if move.dir == "" && move.item.Inode == inode && move.item.Size == stat.Size() {
+			move.timer.Stop()
+			delete(i.pendingMoves, oldPath)
+			item = move.item
+			break
+		}
+	}
+	i.movesMu.Unlock()
+
+	// The rename event may be missing or come later: look for a vanished file with the same inode
+	if item == nil {
+		candidates, err := i.repo.GetByInode(inode, stat.Size())
+		if err != nil {
+			return false
+		}
+		for idx := range candidates {
+			if _, err := os.Stat(candidates[idx].AbsPath); os.IsNotExist(err) {
+				item = &candidates[idx]
+				break
+			}
+		}
+	}
+	if item == nil {
+		return false
+	}
+
+	if err := i.moveFile(item, path, stat); err != nil {
+		log.Printf("Error moving %s to %s: %v", item.AbsPath, path, err)
+		return false
+	}
+	return true
+}
+
+// completeDirectoryMove recognizes a created directory as a renamed one and moves the
+// records of its files. Returns false if the directory is new.
+func (i *Indexer) completeDirectoryMove(path string) bool {
+	var oldDir string
+	i.movesMu.Lock()
+	for oldPath, move := range i.pendingMoves {
+		if move.dir == "" {
+			continue
+		}
+		relPath, err := filepath.Rel(move.dir, move.item.AbsPath)
+		if err != nil {
+			continue
+		}
+		stat, err := os.Stat(filepath.Join(path, relPath))
+		if err != nil {
+			continue
+		}
+		if inode, ok := fileInode(stat); ok && inode != 0 && inode == move.item.Inode && stat.Size() == move.item.Size {
+			move.timer.Stop()
+			delete(i.pendingMoves, oldPath)
+			oldDir = move.dir
+			break
+		}
+	}
+	i.movesMu.Unlock()
+
+	if oldDir == "" {
+		return false
+	}
+
+	items, err := i.repo.GetUnderDirectory(oldDir, 0)
+	if err != nil {
+		log.Printf("Error retrieving the files of %s: %v", oldDir, err)
+		return true
+	}
+
+	for idx := range items {
+		item := &items[idx]
+		newPath := filepath.Join(path, strings.TrimPrefix(item.AbsPath, oldDir))
+
+		stat, err := os.Stat(newPath)
+		root := i.rootForPath(newPath)
+		if err != nil || root == nil || root.IsPathIgnored(newPath, false) || !i.isPathWithinDepth(root, newPath) {
+			i.handleRemove(item.AbsPath)
+			continue
+		}
+
+		if err := i.moveFile(item, newPath, stat); err != nil {
+			log.Printf("Error moving %s to %s: %v", item.AbsPath, newPath, err)
+		}
+	}
+
+	return true
+}
+
+// moveFile updates the record of a renamed file, keeping its ID, thumbnail and annotations
+func (i *Indexer) moveFile(item *db.FileItem, path string, stat os.FileInfo) error {
+	oldPath := item.AbsPath
+	renamed := stat.Name() != item.Name
+	if err := i.relocate(item, path, stat); err != nil {
+		return err
+	}
+
+	if err := i.repo.Move(item); err != nil {
+		return fmt.Errorf("error saving: %w", err)
+	}
+
+	if renamed {
+		if err := i.repo.RenameContents(item); err != nil {
+			log.Printf("Error updating the full-text entry of %s: %v", path, err)
+		}
+	}
+	i.fileMoved(item, oldPath)
+	return nil
+}
+
+// relocate updates the fields of a record for the new path of its file, without saving it
+func (i *Indexer) relocate(item *db.FileItem, path string, stat os.FileInfo) error {
+	root := i.rootForPath(path)
+	if root == nil {
+		return fmt.Errorf("path outside of the library roots")
+	}
+
+	// The quick hash depends on the path
+	hash, err := ComputeHash(path)
+	if err != nil {
+		return fmt.Errorf("error calculating hash: %w", err)
+	}
+
+	renamed := stat.Name() != item.Name
+	item.AbsPath = path
+	item.RootID = root.ID
+	item.Name = stat.Name()
+	item.Ext = GetFileExtension(stat.Name())
+	item.Hash = hash
+
+	// The creation date may come from the file name
+	if renamed {
+		metadata, _ := ExtractMetadata(path, item.Mime)
+		dates := i.resolveDates(path, stat, item, metadata)
+		item.CreatedAt = dates.CreatedAt
+		item.DateSource = dates.Source
+		item.DateCandidates = dates.Candidates
+	}
+	return nil
+}
+
+// fileMoved keeps the annotations attached to a moved file and announces its new path
+func (i *Indexer) fileMoved(item *db.FileItem, oldPath string) {
+	i.refreshAnnotationAnchors([]*db.FileItem{item})
+
+	oldRootID := ""
+	if root := i.rootForPath(oldPath); root != nil {
+		oldRootID = root.ID
+	}
+	i.emitEvent(FileEvent{
+		Type:      "moved",
+		FileID:    item.ID,
+		FilePath:  item.AbsPath,
+		OldPath:   oldPath,
+		OldRootID: oldRootID,
+		FileItem:  item,
+	})
+
+	if i.config.Debug {
+		log.Printf("File moved: %s -> %s", oldPath, item.AbsPath)
+	}
+}
+
+// indexDirectory watches a new directory and indexes its files: directories moved or
+// copied into the roots produce no event for their content
+func (i *Indexer) indexDirectory(dir string) {
+	root := i.rootForPath(dir)
+	if root == nil {
+		return
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if info.IsDir() {
+			if path != dir && (ShouldSkipDirectory(info.Name()) || i.isInternalDir(path) || root.IsPathIgnored(path, true)) {
+				return filepath.SkipDir
+			}
+			// A directory is within the depth if a file in it is
+			if !i.isPathWithinDepth(root, filepath.Join(path, info.Name())) {
+				return filepath.SkipDir
+			}
+			if err := i.watcher.Add(path); err != nil {
+				log.Printf("Error adding watcher for %s: %v", path, err)
+			}
+			return nil
+		}
+
+		if IsHiddenFile(info.Name()) || root.IsPathIgnored(path, false) {
+			return nil
+		}
+		// The files of a directory being copied may still be written
+		i.changes.Enqueue(path)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error indexing the directory %s: %v", dir, err)
+	}
+}
+
+// recordInode stores the inode of an unchanged file indexed before inodes were recorded,
+// so that its renames are tracked
+func (i *Indexer) recordInode(item *db.FileItem, stat os.FileInfo) {
+	inode, ok := fileInode(stat)
+	if !ok || inode == item.Inode {
+		return
+	}
+	if err := i.repo.UpdateInode(item.ID, inode); err != nil {
+		log.Printf("Error updating the inode of %s: %v", item.AbsPath, err)
+	}
+}
@@ -0,0 +1,131 @@
+package content
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tokilane/internal/db"
+)
+
+// indexedTestFile writes a file in a watched root and waits for the watcher to index it
+func indexedTestFile(t *testing.T, indexer *Indexer, events *eventRecorder, path, data string) *db.FileItem {
+	t.Helper()
+	appendTo(t, path, data)
+	waitFor(t, 10*time.Second, func() bool { return events.count("added", path) == 1 })
+	item, err := indexer.repo.GetByPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+// countRecords returns the number of files in the index
+func countRecords(t *testing.T, indexer *Indexer) int64 {
+	t.Helper()
+	var count int64
+	if err := indexer.db.Model(&db.FileItem{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestWatcherTracksMoves(t *testing.T) {
+	tests := []struct {
+		name string
+		dest string // New path of the file, relative to the root
+	}{
+		{"rename in the same folder", "renamed.txt"},
+		{"move to another folder", filepath.Join("2019", "notes.txt")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer, rootPath := startTestIndexer(t, testQuietPeriod)
+			events := recordEvents(indexer)
+			if err := os.MkdirAll(filepath.Join(rootPath, "2019"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(rootPath, "notes.txt")
+			item := indexedTestFile(t, indexer, events, path, "some notes\n")
+			if err := indexer.annotations.AddTag(item.ID, "holidays"); err != nil {
+				t.Fatal(err)
+			}
+			if err := indexer.annotations.SetFavorite(item.ID, true); err != nil {
+				t.Fatal(err)
+			}
+
+			dest := filepath.Join(rootPath, tt.dest)
+			if err := os.Rename(path, dest); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, 10*time.Second, func() bool { return events.count("moved", dest) >= 1 })
+			time.Sleep(moveWindow + 5*testQuietPeriod) // Past the removal of unmatched renames
+
+			moved, err := indexer.repo.GetByPath(dest)
+			if err != nil {
+				t.Fatalf("moved file not found: %v", err)
+			}
+			if moved.ID != item.ID {
+				t.Errorf("moved file has the ID %s, want %s", moved.ID, item.ID)
+			}
+			if count := countRecords(t, indexer); count != 1 {
+				t.Errorf("%d records after the move, want 1", count)
+			}
+			annotations, err := indexer.annotations.Get(item.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(annotations.Tags) != 1 || annotations.Tags[0] != "holidays" || !annotations.Favorite {
+				t.Errorf("annotations %+v after the move, want the tag holidays and the favourite", annotations)
+			}
+
+			if count := events.count("moved", dest); count != 1 {
+				t.Errorf("%d moved events, want 1", count)
+			}
+			if added, removed := events.total("added"), events.total("removed"); added != 1 || removed != 0 {
+				t.Errorf("%d added and %d removed events, want only the first addition", added, removed)
+			}
+		})
+	}
+}
+
+func TestWatcherUnmatchedMoveIsRemoveAndAdd(t *testing.T) {
+	indexer, rootPath := startTestIndexer(t, testQuietPeriod)
+	events := recordEvents(indexer)
+
+	path := filepath.Join(rootPath, "notes.txt")
+	item := indexedTestFile(t, indexer, events, path, "some notes\n")
+
+	// Moved out of the root, then copied back under another name: another inode
+	outside := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.Rename(path, outside); err != nil {
+		t.Fatal(err)
+	}
+	copied := filepath.Join(rootPath, "copy.txt")
+	appendTo(t, copied, "some notes\n")
+
+	waitFor(t, 10*time.Second, func() bool {
+		return events.count("removed", path) == 1 && events.count("added", copied) == 1
+	})
+	time.Sleep(5 * testQuietPeriod)
+
+	added, err := indexer.repo.GetByPath(copied)
+	if err != nil {
+		t.Fatalf("copied file not indexed: %v", err)
+	}
+	if added.ID == item.ID {
+		t.Error("copied file took the ID of the removed one")
+	}
+	if _, err := indexer.repo.GetByPath(path); err == nil {
+		t.Error("file moved out of the root still indexed")
+	}
+	if count := countRecords(t, indexer); count != 1 {
+		t.Errorf("%d records, want 1", count)
+	}
+	if moved := events.total("moved"); moved != 0 {
+		t.Errorf("%d moved events for unrelated files", moved)
+	}
+}
@@ -0,0 +1,234 @@
+package content
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"sort"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+)
+
+// Size of a perceptual hash in bits, and thus the maximum distance between two hashes
+const PerceptualHashBits = 64
+
+// PerceptualHash computes the difference hash (dHash) of an image: the image is reduced
+// to 9x8 gray levels and each bit tells whether a pixel is brighter than its right
+// neighbour. Resized, re-compressed or slightly edited copies get close hashes.
+func PerceptualHash(img image.Image) string {
+	small := imaging.Grayscale(imaging.Resize(img, 9, 8, imaging.Box))
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			left := small.Pix[small.PixOffset(x, y)]
+			right := small.Pix[small.PixOffset(x+1, y)]
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+
+	return fmt.Sprintf("%016x", hash)
+}
+
+// parsePerceptualHash decodes a hash produced by PerceptualHash
+func parsePerceptualHash(hash string) (uint64, bool) {
+	if len(hash) != PerceptualHashBits/4 {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(hash, 16, 64)
+	return value, err == nil
+}
+
+// HammingDistance returns the number of differing bits between two perceptual hashes,
+// and false if one of them is invalid
+func HammingDistance(a, b string) (int, bool) {
+	x, ok := parsePerceptualHash(a)
+	if !ok {
+		return 0, false
+	}
+	y, ok := parsePerceptualHash(b)
+	if !ok {
+		return 0, false
+	}
+	return bits.OnesCount64(x ^ y), true
+}
+
+// SimilarMatch is a file whose perceptual hash is close to a reference
+type SimilarMatch struct {
+	FileID   string
+	Distance int
+}
+
+// SimilarityIndex finds files with close perceptual hashes. It is a BK-tree over the
+// Hamming distance, which avoids comparing every pair of images of large libraries.
+type SimilarityIndex struct {
+	root *similarityNode
+	size int
+}
+
+// similarityNode holds the files sharing a hash and the subtrees at each distance from it
+type similarityNode struct {
+	hash     uint64
+	fileIDs  []string
+	children map[int]*similarityNode
+}
+
+// NewSimilarityIndex creates an index of perceptual hashes by file ID
+func NewSimilarityIndex(hashes map[string]string) *SimilarityIndex {
+	index := &SimilarityIndex{}
+
+	// Insert in a stable order so that results do not depend on map iteration
+	ids := make([]string, 0, len(hashes))
+	for id := range hashes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		index.add(id, hashes[id])
+	}
+	return index
+}
+
+// Len returns the number of indexed files
+func (s *SimilarityIndex) Len() int {
+	return s.size
+}
+
+// add inserts a file, ignoring invalid hashes
+func (s *SimilarityIndex) add(fileID, hash string) {
+	value, ok := parsePerceptualHash(hash)
+	if !ok {
+		return
+	}
+	s.size++
+
+	if s.root == nil {
+		s.root = &similarityNode{hash: value, fileIDs: []string{fileID}}
+		return
+	}
+
+	node := s.root
+	for {
+		distance := bits.OnesCount64(node.hash ^ value)
+		if distance == 0 {
+			node.fileIDs = append(node.fileIDs, fileID)
+			return
+		}
+		child, ok := node.children[distance]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[int]*similarityNode)
+			}
+			node.children[distance] = &similarityNode{hash: value, fileIDs: []string{fileID}}
+			return
+		}
+		node = child
+	}
+}
+
+// Search returns the files within maxDistance of a hash, the closest first
+func (s *SimilarityIndex) Search(hash string, maxDistance int) []SimilarMatch {
+	value, ok := parsePerceptualHash(hash)
+	if !ok || s.root == nil {
+		return nil
+	}
+
+	var matches []SimilarMatch
+	pending := []*similarityNode{s.root}
+	for len(pending) > 0 {
+		node := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		distance := bits.OnesCount64(node.hash ^ value)
+		if distance <= maxDistance {
+			for _, id := range node.fileIDs {
+				matches = append(matches, SimilarMatch{FileID: id, Distance: distance})
+			}
+		}
+		// By the triangle inequality, only these subtrees can contain matches
+		for childDistance, child := range node.children {
+			if childDistance >= distance-maxDistance && childDistance <= distance+maxDistance {
+				pending = append(pending, child)
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].FileID < matches[j].FileID
+	})
+	return matches
+}
+
+// Clusters groups the files linked by chains of hashes within maxDistance of each other.
+// Only groups of at least two files are returned, the largest first.
+func (s *SimilarityIndex) Clusters(maxDistance int) [][]string {
+	parent := make(map[string]string)
+	var find func(id string) string
+	find = func(id string) string {
+		if parent[id] != id {
+			parent[id] = find(parent[id])
+		}
+		return parent[id]
+	}
+	union := func(a, b string) {
+		rootA, rootB := find(a), find(b)
+		if rootA != rootB {
+			if rootA < rootB {
+				parent[rootB] = rootA
+			} else {
+				parent[rootA] = rootB
+			}
+		}
+	}
+
+	var nodes []*similarityNode
+	if s.root != nil {
+		nodes = append(nodes, s.root)
+	}
+	for k := 0; k < len(nodes); k++ {
+		for _, child := range nodes[k].children {
+			nodes = append(nodes, child)
+		}
+		for _, id := range nodes[k].fileIDs {
+			parent[id] = id
+		}
+	}
+
+	for _, node := range nodes {
+		for _, id := range node.fileIDs[1:] {
+			union(node.fileIDs[0], id)
+		}
+		for _, match := range s.Search(fmt.Sprintf("%016x", node.hash), maxDistance) {
+			union(node.fileIDs[0], match.FileID)
+		}
+	}
+
+	members := make(map[string][]string)
+	for id := range parent {
+		root := find(id)
+		members[root] = append(members[root], id)
+	}
+
+	clusters := make([][]string, 0)
+	for _, ids := range members {
+		if len(ids) > 1 {
+			sort.Strings(ids)
+			clusters = append(clusters, ids)
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i]) != len(clusters[j]) {
+			return len(clusters[i]) > len(clusters[j])
+		}
+		return clusters[i][0] < clusters[j][0]
+	})
+	return clusters
+}
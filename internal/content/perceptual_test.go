@@ -0,0 +1,189 @@
+package content
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// Default SIMILARITY_THRESHOLD
+const testSimilarityThreshold = 10
+
+// testPhoto draws a landscape: a sky gradient, a sun and hills
+func testPhoto(width, height int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx, fy := float64(x)/float64(width), float64(y)/float64(height)
+			c := color.NRGBA{R: uint8(90 + 100*fy), G: uint8(140 + 80*fy), B: 230, A: 255}
+			if math.Hypot(fx-0.75, fy-0.25) < 0.12 {
+				c = color.NRGBA{R: 250, G: 220, B: 90, A: 255}
+			}
+			if fy > 0.6+0.15*math.Sin(fx*2*math.Pi) {
+				c = color.NRGBA{R: 40, G: uint8(90 + 60*fx), B: 40, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// testDocument draws a scanned page: lines of text on white
+func testDocument(width, height int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	random := rand.New(rand.NewSource(1))
+	for y := 0; y < height; y++ {
+		line := (y/12)%2 == 1 && y > height/10 && y < height*9/10
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{R: 245, G: 245, B: 240, A: 255}
+			if line && x > width/10 && x < width*9/10 && random.Intn(3) > 0 {
+				c = color.NRGBA{R: 30, G: 30, B: 30, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// recompress encodes an image as a JPEG of the given quality and decodes it
+func recompress(t *testing.T, img image.Image, quality int) image.Image {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jpeg.Decode(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestPerceptualHashOfCopies(t *testing.T) {
+	original := testPhoto(640, 480)
+	hash := PerceptualHash(original)
+
+	var pngCopy bytes.Buffer
+	if err := png.Encode(&pngCopy, original); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(&pngCopy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		img     image.Image
+		similar bool
+	}{
+		{"lossless copy", decoded, true},
+		{"resized", imaging.Resize(original, 160, 120, imaging.Lanczos), true},
+		{"enlarged", imaging.Resize(original, 1920, 1440, imaging.Linear), true},
+		{"recompressed", recompress(t, original, 30), true},
+		{"resized and recompressed", recompress(t, imaging.Resize(original, 320, 240, imaging.Lanczos), 50), true},
+		{"slightly brighter", imaging.AdjustBrightness(original, 10), true},
+		{"grayscale", imaging.Grayscale(original), true},
+		{"document", testDocument(640, 480), false},
+		{"mirrored", imaging.FlipH(original), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance, ok := HammingDistance(hash, PerceptualHash(tt.img))
+			if !ok {
+				t.Fatal("invalid hash")
+			}
+			if similar := distance <= testSimilarityThreshold; similar != tt.similar {
+				t.Errorf("distance %d with the original, similar: %v, want %v", distance, similar, tt.similar)
+			}
+		})
+	}
+}
+
+func TestHammingDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		distance int
+		ok       bool
+	}{
+		{"0000000000000000", "0000000000000000", 0, true},
+		{"0000000000000000", "0000000000000001", 1, true},
+		{"ffffffffffffffff", "0000000000000000", PerceptualHashBits, true},
+		{"F0F0F0F0F0F0F0F0", "f0f0f0f0f0f0f0f1", 1, true},
+		{"", "0000000000000000", 0, false},
+		{"000000000000000", "0000000000000000", 0, false},
+		{"000000000000000g", "0000000000000000", 0, false},
+	}
+
+	for _, tt := range tests {
+		distance, ok := HammingDistance(tt.a, tt.b)
+		if distance != tt.distance || ok != tt.ok {
+			t.Errorf("HammingDistance(%q, %q) = %d, %v, want %d, %v", tt.a, tt.b, distance, ok, tt.distance, tt.ok)
+		}
+	}
+}
+
+func TestSimilarityIndex(t *testing.T) {
+	// Random hashes, and copies of some of them a few bits away
+	random := rand.New(rand.NewSource(1))
+	hashes := make(map[string]string)
+	for n := 0; n < 300; n++ {
+		value := random.Uint64()
+		hashes[fmt.Sprintf("file%03d", n)] = fmt.Sprintf("%016x", value)
+		if n%10 == 0 {
+			hashes[fmt.Sprintf("file%03d-copy", n)] = fmt.Sprintf("%016x", value^(1<<uint(n%64))^(1<<uint((n+7)%64)))
+		}
+	}
+	hashes["invalid"] = "not a hash"
+	index := NewSimilarityIndex(hashes)
+	if index.Len() != len(hashes)-1 {
+		t.Errorf("%d files indexed, want %d", index.Len(), len(hashes)-1)
+	}
+
+	// Searches find the same files as a comparison with every hash
+	for _, reference := range []string{"file000", "file010", "file123"} {
+		for _, maxDistance := range []int{0, 2, testSimilarityThreshold, 20} {
+			want := []SimilarMatch{}
+			for id, hash := range hashes {
+				if distance, ok := HammingDistance(hashes[reference], hash); ok && distance <= maxDistance {
+					want = append(want, SimilarMatch{FileID: id, Distance: distance})
+				}
+			}
+			got := index.Search(hashes[reference], maxDistance)
+			if len(got) != len(want) {
+				t.Errorf("search of %s within %d: %d matches, want %d", reference, maxDistance, len(got), len(want))
+				continue
+			}
+			for k := 1; k < len(got); k++ {
+				if got[k-1].Distance > got[k].Distance {
+					t.Errorf("search of %s within %d not sorted by distance: %v", reference, maxDistance, got)
+					break
+				}
+			}
+		}
+	}
+
+	// Each copy forms a cluster with its original
+	clusters := index.Clusters(2)
+	if len(clusters) != 30 {
+		t.Fatalf("%d clusters, want 30", len(clusters))
+	}
+	if !reflect.DeepEqual(clusters[0], []string{"file000", "file000-copy"}) {
+		t.Errorf("first cluster %v", clusters[0])
+	}
+	for _, cluster := range clusters {
+		if len(cluster) != 2 || cluster[1] != cluster[0]+"-copy" {
+			t.Errorf("unexpected cluster %v", cluster)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package content
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// renameNoReplace renames a file with renameat2(RENAME_NOREPLACE), which fails if the
+// destination exists. Older kernels (ENOSYS) and file systems without the flag (EINVAL)
+// report errors.ErrUnsupported.
+func renameNoReplace(src, dst string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, src, unix.AT_FDCWD, dst, unix.RENAME_NOREPLACE)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, unix.ENOSYS), errors.Is(err, unix.EINVAL):
+		return errors.ErrUnsupported
+	}
+	return &os.LinkError{Op: "rename", Old: src, New: dst, Err: err}
+}
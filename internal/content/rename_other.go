@@ -0,0 +1,10 @@
+//go:build !linux
+
+package content
+
+import "errors"
+
+// renameNoReplace is only available on Linux: the other systems use a hard link
+func renameNoReplace(src, dst string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,59 @@
+package content
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// LibraryRoot represents a named directory indexed by Tokilane
+type LibraryRoot struct {
+	ID        string
+	Path      string
+	ScanDepth int      // Directory scanning depth (0 = unlimited, 1 = root only, 2 = root+1 level, etc.)
+	Ignore    []string // Gitignore-style patterns specific to the root
+	Upload    bool     // Whether files can be uploaded to this root
+
+	ignore *IgnoreMatcher
+}
+
+// Contains checks if a path is inside the root
+func (r *LibraryRoot) Contains(path string) bool {
+	return ValidatePath(r.Path, path) == nil
+}
+
+// IsPathIgnored checks if a path inside the root, or one of its parent directories, is ignored
+func (r *LibraryRoot) IsPathIgnored(path string, isDir bool) bool {
+	return r.ignore != nil && r.ignore.Match(path, isDir)
+}
+
+// prepareRoots makes the paths of the roots absolute, checks that their IDs are unique and
+// builds their ignore rules. Indexed paths are derived from the paths of the roots, so that the
+// scan, the watcher, the uploads and the file operations all record the same absolute paths.
+func prepareRoots(roots []LibraryRoot, ignorePatterns []string, respectGitignore bool) ([]LibraryRoot, error) {
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no library root configured")
+	}
+
+	prepared := make([]LibraryRoot, 0, len(roots))
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		if root.ID == "" {
+			return nil, fmt.Errorf("library root without ID: %s", root.Path)
+		}
+		if seen[root.ID] {
+			return nil, fmt.Errorf("duplicate library root: %s", root.ID)
+		}
+		seen[root.ID] = true
+
+		path, err := filepath.Abs(root.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path of the library root %s: %w", root.ID, err)
+		}
+		root.Path = path
+		patterns := append(append([]string{}, ignorePatterns...), root.Ignore...)
+		root.ignore = NewIgnoreMatcher(root.Path, patterns, respectGitignore)
+		prepared = append(prepared, root)
+	}
+
+	return prepared, nil
+}
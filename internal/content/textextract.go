@@ -0,0 +1,367 @@
+package content
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Maximum amount of text indexed for a file
+const maxIndexedTextSize = 1024 * 1024
+
+// Maximum size of a PDF, or of a decompressed stream or document part, read for text extraction
+const maxTextSourceSize = 64 * 1024 * 1024
+
+// errNoText is returned when no text can be extracted from a file
+var errNoText = errors.New("no text content found")
+
+// textExtractor reads the text contained in a file
+type textExtractor func(path string) (string, error)
+
+// textExtractors associates MIME types with their extractor (text/* files are read as is)
+var textExtractors = map[string]textExtractor{
+	"application/json": readPlainText,
+	"application/xml":  readPlainText,
+	"application/pdf":  readPDFText,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   readOfficeText,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         readOfficeText,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": readOfficeText,
+	"application/zip": readOfficeText, // Content sniffing reports OOXML documents as ZIP
+}
+
+// ExtractText reads the text contained in a file according to its MIME type, for full-text search
+func ExtractText(path, mimeType string) (string, error) {
+	mimeType = strings.ToLower(mimeType)
+	extractor, ok := textExtractors[mimeType]
+	if !ok && strings.HasPrefix(mimeType, "text/") {
+		extractor, ok = readPlainText, true
+	}
+	if !ok {
+		return "", errNoText
+	}
+
+	text, err := extractor(path)
+	if err != nil {
+		return "", err
+	}
+	text = truncateText(strings.TrimSpace(text), maxIndexedTextSize)
+	if text == "" {
+		return "", errNoText
+	}
+	return text, nil
+}
+
+// truncateText cuts a text to at most size bytes without splitting a character
+func truncateText(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+	for size > 0 && !utf8.RuneStart(text[size]) {
+		size--
+	}
+	return text[:size]
+}
+
+// readPlainText reads the beginning of a text file (Markdown, CSV, JSON...)
+func readPlainText(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxIndexedTextSize))
+	if err != nil {
+		return "", err
+	}
+	return strings.ToValidUTF8(string(data), ""), nil
+}
+
+var (
+	// Start of a stream, preceded by its dictionary
+	pdfStreamPattern = regexp.MustCompile(`(?s)<<((?:[^<>]|<[^<>]*>|<<(?:[^<>]|<[^<>]*>)*>>)*)>>\s*stream\r?\n`)
+	// Text objects of a content stream
+	pdfTextObjectPattern = regexp.MustCompile(`(?s)\bBT\b(.*?)\bET\b`)
+)
+
+// readPDFText extracts the strings shown by the text operators of the content streams of a PDF.
+// Text drawn with fonts using custom encodings cannot be decoded and is skipped.
+func readPDFText(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxTextSourceSize))
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	for _, match := range pdfStreamPattern.FindAllSubmatchIndex(data, -1) {
+		if text.Len() >= maxIndexedTextSize {
+			break
+		}
+
+		dictionary := data[match[2]:match[3]]
+		if bytes.Contains(dictionary, []byte("/Subtype")) || bytes.Contains(dictionary, []byte("/Type")) || bytes.Contains(dictionary, []byte("/Length1")) {
+			continue // Images, fonts, object streams and XRef streams carry no page text
+		}
+
+		start := match[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		stream := data[start : start+end]
+
+		if bytes.Contains(dictionary, []byte("/Filter")) {
+			if !bytes.Contains(dictionary, []byte("/FlateDecode")) {
+				continue
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(stream))
+			if err != nil {
+				continue
+			}
+			// Truncated streams still yield the text decoded so far
+			stream, _ = io.ReadAll(io.LimitReader(reader, maxTextSourceSize))
+			reader.Close()
+		}
+
+		for _, object := range pdfTextObjectPattern.FindAllSubmatch(stream, -1) {
+			if line := pdfTextObjectText(object[1]); line != "" {
+				text.WriteString(line)
+				text.WriteByte('\n')
+			}
+		}
+	}
+
+	return text.String(), nil
+}
+
+// pdfTextObjectText returns the strings shown in a text object (between BT and ET).
+// Strings of a TJ array are joined, large negative offsets being rendered as spaces.
+func pdfTextObjectText(object []byte) string {
+	var text strings.Builder
+	var pending []string
+	inArray := false
+
+	flush := func(separator string) {
+		for _, part := range pending {
+			text.WriteString(part)
+		}
+		pending = pending[:0]
+		if text.Len() > 0 && !strings.HasSuffix(text.String(), separator) {
+			text.WriteString(separator)
+		}
+	}
+
+	for i := 0; i < len(object); i++ {
+		c := object[i]
+		switch {
+		case c == '(':
+			end := pdfLiteralEnd(object, i)
+			pending = append(pending, pdfShownString(unescapePDFLiteral(string(object[i+1:end]))))
+			i = end
+		case c == '<' && i+1 < len(object) && object[i+1] != '<':
+			end := bytes.IndexByte(object[i:], '>')
+			if end < 0 {
+				return strings.TrimSpace(text.String())
+			}
+			cleaned := strings.Join(strings.Fields(string(object[i+1:i+end])), "")
+			if len(cleaned)%2 == 1 {
+				cleaned += "0"
+			}
+			if decoded, err := hex.DecodeString(cleaned); err == nil {
+				pending = append(pending, pdfShownString(decoded))
+			}
+			i += end
+		case c == '[':
+			inArray = true
+		case c == ']':
+			inArray = false
+		case inArray && (c == '-' || (c >= '0' && c <= '9')):
+			end := i + 1
+			for end < len(object) && (object[end] == '.' || (object[end] >= '0' && object[end] <= '9')) {
+				end++
+			}
+			if offset, err := strconv.ParseFloat(string(object[i:end]), 64); err == nil && offset <= -100 && len(pending) > 0 {
+				pending = append(pending, " ") // Gap of at least a tenth of an em
+			}
+			i = end - 1
+		case isASCIILetter(c) || c == '\'' || c == '"':
+			end := i + 1
+			for end < len(object) && (isASCIILetter(object[end]) || object[end] == '*') {
+				end++
+			}
+			switch string(object[i:end]) {
+			case "Tj", "TJ":
+				flush("")
+			case "'", "\"", "T*", "Td", "TD", "Tm":
+				flush(" ")
+			}
+			i = end - 1
+		}
+	}
+	flush("")
+
+	return strings.Join(strings.Fields(text.String()), " ")
+}
+
+// isASCIILetter checks if a byte is an ASCII letter
+func isASCIILetter(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+// pdfLiteralEnd returns the index of the parenthesis closing the literal string starting at start
+func pdfLiteralEnd(data []byte, start int) int {
+	depth := 0
+	for i := start; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(data)
+}
+
+// pdfShownString decodes a shown string, dropping strings of fonts with custom encodings.
+// Single-byte strings are read as Latin-1, which matches the standard encodings for letters.
+func pdfShownString(raw []byte) string {
+	// UTF-16BE strings start with a byte order mark
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+
+	if len(raw) == 0 || !isTextContent(raw) {
+		return ""
+	}
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+
+	runes := make([]rune, len(raw))
+	for i, b := range raw {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// officeTextParts are the parts of OOXML documents containing their text
+var officeTextParts = []string{
+	"word/document.xml",
+	"word/header*.xml",
+	"word/footer*.xml",
+	"word/footnotes.xml",
+	"xl/sharedStrings.xml",
+	"xl/worksheets/sheet*.xml", // Inline strings
+	"ppt/slides/slide*.xml",
+}
+
+// readOfficeText extracts the text runs of a DOCX, XLSX or PPTX document
+func readOfficeText(path string) (string, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+
+	var text strings.Builder
+	found := false
+	for _, entry := range archive.File {
+		if !isOfficeTextPart(entry.Name) {
+			continue
+		}
+		found = true
+
+		reader, err := entry.Open()
+		if err != nil {
+			return "", err
+		}
+		err = readOfficeXMLText(io.LimitReader(reader, maxTextSourceSize), &text)
+		reader.Close()
+		if err != nil {
+			return "", err
+		}
+		if text.Len() >= maxIndexedTextSize {
+			break
+		}
+	}
+
+	if !found {
+		return "", errNoText
+	}
+	return text.String(), nil
+}
+
+// isOfficeTextPart checks if a part of an OOXML document contains text
+func isOfficeTextPart(name string) bool {
+	for _, pattern := range officeTextParts {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// readOfficeXMLText appends the content of the text elements (w:t, a:t, t) of an XML part,
+// one line per paragraph, cell or shared string
+func readOfficeXMLText(reader io.Reader, text *strings.Builder) error {
+	decoder := xml.NewDecoder(reader)
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteByte('\t')
+			case "br":
+				text.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "t":
+				inText = false
+			case "p", "si", "c":
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(element)
+			}
+		}
+	}
+}
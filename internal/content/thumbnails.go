@@ -26,45 +26,56 @@ func NewThumbnailService(thumbsDir string) *ThumbnailService {
 	}
 }
 
-// GenerateIfNeeded génère une miniature si nécessaire pour un fichier image
-func (s *ThumbnailService) GenerateIfNeeded(fileID, filePath, mimeType string) (string, error) {
+// Thumbnail décrit la miniature générée pour une image
+type Thumbnail struct {
+	Path           string // Chemin de la miniature
+	PerceptualHash string // Empreinte perceptuelle de l'image (vide si elle n'a pas pu être calculée)
+}
+
+// GenerateIfNeeded génère une miniature si nécessaire pour un fichier image,
+// et calcule l'empreinte perceptuelle de l'image à partir de la miniature
+func (s *ThumbnailService) GenerateIfNeeded(fileID, filePath, mimeType string) (*Thumbnail, error) {
 	// Vérifier si c'est une image
 	if !IsImageFile(mimeType) {
-		return "", nil
+		return nil, nil
 	}
 
 	// Ignorer les SVG (pas besoin de miniature)
 	if mimeType == "image/svg+xml" {
-		return "", nil
+		return nil, nil
 	}
 
 	// Créer le dossier de miniatures s'il n'existe pas
 	if err := EnsureDir(s.thumbsDir); err != nil {
-		return "", fmt.Errorf("impossible de créer le dossier de miniatures: %w", err)
+		return nil, fmt.Errorf("impossible de créer le dossier de miniatures: %w", err)
 	}
 
 	// Chemin de la miniature
 	thumbPath := filepath.Join(s.thumbsDir, fileID+".jpg")
 
-	// Vérifier si la miniature existe déjà
-	if _, err := os.Stat(thumbPath); err == nil {
-		return thumbPath, nil
+	// Vérifier si la miniature existe déjà et est plus récente que l'image
+	if thumbStat, err := os.Stat(thumbPath); err == nil {
+		if srcStat, err := os.Stat(filePath); err == nil && !srcStat.ModTime().After(thumbStat.ModTime()) {
+			hash, _ := s.PerceptualHashOfThumbnail(thumbPath)
+			return &Thumbnail{Path: thumbPath, PerceptualHash: hash}, nil
+		}
 	}
 
 	// Générer la miniature
-	if err := s.generateThumbnail(filePath, thumbPath); err != nil {
-		return "", fmt.Errorf("erreur lors de la génération de la miniature: %w", err)
+	thumbnail, err := s.generateThumbnail(filePath, thumbPath)
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors de la génération de la miniature: %w", err)
 	}
 
-	return thumbPath, nil
+	return &Thumbnail{Path: thumbPath, PerceptualHash: PerceptualHash(thumbnail)}, nil
 }
 
-// generateThumbnail génère une miniature pour une image
-func (s *ThumbnailService) generateThumbnail(inputPath, outputPath string) error {
+// generateThumbnail génère une miniature pour une image et retourne l'image redimensionnée
+func (s *ThumbnailService) generateThumbnail(inputPath, outputPath string) (image.Image, error) {
 	// Ouvrir l'image source
 	src, err := imaging.Open(inputPath)
 	if err != nil {
-		return fmt.Errorf("impossible d'ouvrir l'image: %w", err)
+		return nil, fmt.Errorf("impossible d'ouvrir l'image: %w", err)
 	}
 
 	// Redimensionner en gardant les proportions
@@ -72,10 +83,19 @@ func (s *ThumbnailService) generateThumbnail(inputPath, outputPath string) error
 
 	// Sauvegarder en JPEG avec qualité 85
 	if err := imaging.Save(thumbnail, outputPath, imaging.JPEGQuality(85)); err != nil {
-		return fmt.Errorf("impossible de sauvegarder la miniature: %w", err)
+		return nil, fmt.Errorf("impossible de sauvegarder la miniature: %w", err)
 	}
 
-	return nil
+	return thumbnail, nil
+}
+
+// PerceptualHashOfThumbnail calcule l'empreinte perceptuelle d'une image à partir de sa miniature
+func (s *ThumbnailService) PerceptualHashOfThumbnail(thumbPath string) (string, error) {
+	thumbnail, err := imaging.Open(thumbPath)
+	if err != nil {
+		return "", fmt.Errorf("impossible d'ouvrir la miniature: %w", err)
+	}
+	return PerceptualHash(thumbnail), nil
 }
 
 // DeleteThumbnail supprime la miniature d'un fichier
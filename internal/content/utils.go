@@ -7,11 +7,7 @@ import (
 	"mime"
 	"os"
 	"path/filepath"
-	"reflect"
-	"runtime"
 	"strings"
-	"syscall"
-	"time"
 )
 
 // FileSignature represents a file type signature
@@ -67,6 +63,12 @@ var fileSignatures = []FileSignature{
 	{MimeType: "application/msword", Offset: 0, Signature: []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}}, // DOC
 	{MimeType: "application/vnd.ms-excel", Offset: 0, Signature: []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}}, // XLS
 	{MimeType: "application/vnd.ms-powerpoint", Offset: 0, Signature: []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}}, // PPT
+	
+	// Executables
+	{MimeType: "application/x-msdownload", Offset: 0, Signature: []byte{0x4D, 0x5A}}, // MZ (Windows PE)
+	{MimeType: "application/x-executable", Offset: 0, Signature: []byte{0x7F, 0x45, 0x4C, 0x46}}, // ELF
+	{MimeType: "application/x-mach-binary", Offset: 0, Signature: []byte{0xCF, 0xFA, 0xED, 0xFE}}, // Mach-O 64-bit
+	{MimeType: "application/x-mach-binary", Offset: 0, Signature: []byte{0xCE, 0xFA, 0xED, 0xFE}}, // Mach-O 32-bit
 }
 
 // detectMimeByContent analyzes file content to determine MIME type
@@ -84,6 +86,14 @@ func detectMimeByContent(path string) string {
 		return ""
 	}
 	
+	return sniffMime(buffer[:n], strings.ToLower(filepath.Ext(path)))
+}
+
+// sniffMime determines the MIME type of the first bytes of a file. The extension only
+// tells apart the ZIP-based Office documents.
+func sniffMime(buffer []byte, ext string) string {
+	n := len(buffer)
+	
 	// Check each signature
 	for _, sig := range fileSignatures {
 		if n > sig.Offset+len(sig.Signature) {
@@ -100,7 +110,6 @@ func detectMimeByContent(path string) string {
 				   sig.MimeType == "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet" ||
 				   sig.MimeType == "application/vnd.openxmlformats-officedocument.presentationml.presentation" {
 					// Check file extension to distinguish between DOCX, XLSX, PPTX
-					ext := strings.ToLower(filepath.Ext(path))
 					switch ext {
 					case ".docx":
 						return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
@@ -114,7 +123,7 @@ func detectMimeByContent(path string) string {
 				}
 				
 				// Special handling for RIFF files (AVI vs WAV)
-				if sig.MimeType == "video/avi" && len(buffer) > 8 {
+				if sig.MimeType == "video/avi" && len(buffer) > 11 {
 					// Check for AVI signature at offset 8
 					if buffer[8] == 0x41 && buffer[9] == 0x56 && buffer[10] == 0x49 && buffer[11] == 0x20 {
 						return "video/x-msvideo"
@@ -131,9 +140,9 @@ func detectMimeByContent(path string) string {
 	}
 	
 	// Check for text files by analyzing content
-	if isTextContent(buffer[:n]) {
+	if isTextContent(buffer) {
 		// Check for specific text formats
-		content := string(buffer[:n])
+		content := string(buffer)
 		if strings.HasPrefix(content, "<?xml") {
 			return "application/xml"
 		}
@@ -180,7 +189,11 @@ func DetectMime(path string) string {
 	}
 	
 	// Fallback to extension-based detection
-	ext := strings.ToLower(filepath.Ext(path))
+	return mimeByExtension(strings.ToLower(filepath.Ext(path)))
+}
+
+// mimeByExtension returns the MIME type usually associated with an extension
+func mimeByExtension(ext string) string {
 	mimeType := mime.TypeByExtension(ext)
 	
 	if mimeType != "" {
@@ -235,80 +248,64 @@ func ComputeHash(path string) (string, error) {
 	hash.Write([]byte(fmt.Sprintf("%d", stat.Size())))
 	hash.Write([]byte(fmt.Sprintf("%d", stat.ModTime().UnixNano())))
 	
-	// For small files (< 1MB), hash the entire content
-	// For larger files, hash only the first and last 64KB
-	if stat.Size() <= 1024*1024 {
-		file, err := os.Open(path)
-		if err != nil {
-			return "", err
-		}
-		defer file.Close()
-		
-		if _, err := io.Copy(hash, file); err != nil {
-			return "", err
-		}
-	} else {
-		// Hash first 64KB and last 64KB for large files
-		file, err := os.Open(path)
-		if err != nil {
-			return "", err
-		}
-		defer file.Close()
-		
-		// Read first 64KB
-		buffer := make([]byte, 65536) // 64KB
-		n, err := file.Read(buffer)
-		if err != nil && err != io.EOF {
-			return "", err
-		}
-		hash.Write(buffer[:n])
-		
-		// Read last 64KB if file is large enough
-		if stat.Size() > 131072 { // > 128KB
-			_, err = file.Seek(-65536, io.SeekEnd) // Seek to 64KB before end
-			if err != nil {
-				return "", err
-			}
-			n, err = file.Read(buffer)
-			if err != nil && err != io.EOF {
-				return "", err
-			}
-			hash.Write(buffer[:n])
-		}
+	if err := writeContentSample(hash, path, stat.Size()); err != nil {
+		return "", err
 	}
 
 	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
-// DetectCreatedAt detects the creation date of a file
-// On macOS, try to get the birthtime if available, otherwise fallback on mtime
-// On Linux, use mtime (no reliable birthtime)
-func DetectCreatedAt(path string) (time.Time, error) {
-	stat, err := os.Stat(path)
+// ComputeContentHash computes the SHA256 of the entire content of a file, to detect identical files
+func ComputeContentHash(path string) (string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return time.Time{}, err
+		return "", err
 	}
+	defer file.Close()
 
-	// On macOS, try to get the birthtime
-	if runtime.GOOS == "darwin" {
-		if sys := stat.Sys(); sys != nil {
-			if unixStat, ok := sys.(*syscall.Stat_t); ok {
-				// Use reflection to safely access Birthtimespec (only available on Darwin)
-				birthtimeVal := reflect.ValueOf(unixStat).Elem().FieldByName("Birthtimespec")
-				if birthtimeVal.IsValid() {
-					sec := birthtimeVal.FieldByName("Sec").Int()
-					nsec := birthtimeVal.FieldByName("Nsec").Int()
-					birthtime := time.Unix(sec, nsec)
-					if !birthtime.IsZero() && birthtime.Before(stat.ModTime()) {
-						return birthtime, nil
-					}
-				}
-			}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// writeContentSample writes the content of a file to a hash: the entire content
+// for small files (< 1MB), only the first and last 64KB for larger files
+func writeContentSample(hash io.Writer, path string, size int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if size <= 1024*1024 {
+		_, err := io.Copy(hash, file)
+		return err
+	}
+
+	// Read first 64KB
+	buffer := make([]byte, 65536) // 64KB
+	n, err := file.Read(buffer)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	hash.Write(buffer[:n])
+
+	// Read last 64KB if file is large enough
+	if size > 131072 { // > 128KB
+		if _, err := file.Seek(-65536, io.SeekEnd); err != nil { // Seek to 64KB before end
+			return err
 		}
+		n, err = file.Read(buffer)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		hash.Write(buffer[:n])
 	}
 
-	// Fallback on ModTime
-	return stat.ModTime(), nil
+	return nil
 }
 
 // ValidatePath validates that a path is secure (no path traversal)
@@ -342,25 +339,9 @@ func IsHiddenFile(name string) bool {
 	return strings.HasPrefix(name, ".")
 }
 
-// ShouldSkipDirectory checks if a directory should be ignored during the scan
+// ShouldSkipDirectory checks if a directory should be ignored during the scan.
+// Only hidden directories are skipped here, other exclusions come from the ignore rules.
 func ShouldSkipDirectory(name string) bool {
-	skipDirs := []string{
-		"data",
-		"thumbs",
-		".git",
-		"node_modules",
-		"vendor",
-		"tmp",
-		"temp",
-		"cache",
-	}
-
-	for _, skip := range skipDirs {
-		if name == skip {
-			return true
-		}
-	}
-
 	return IsHiddenFile(name)
 }
 
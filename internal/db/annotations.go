@@ -0,0 +1,375 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Maximum length of a tag name
+const maxTagLength = 64
+
+// Tag is a label that can be attached to files
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"uniqueIndex;not null" json:"name"` // Normalized (trimmed, lowercase)
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name
+func (Tag) TableName() string {
+	return "tags"
+}
+
+// FileTag links a tag to a file
+type FileTag struct {
+	FileID    string    `gorm:"primaryKey"`
+	TagID     uint      `gorm:"primaryKey;index"`
+	CreatedAt time.Time
+}
+
+// TableName specifies the table name
+func (FileTag) TableName() string {
+	return "file_tags"
+}
+
+// Favorite marks a file as starred
+type Favorite struct {
+	FileID    string    `gorm:"primaryKey" json:"file_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name
+func (Favorite) TableName() string {
+	return "favorites"
+}
+
+// Note is a free-text note on a file
+type Note struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	FileID    string    `gorm:"index;not null" json:"file_id"`
+	Body      string    `gorm:"type:text;not null" json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name
+func (Note) TableName() string {
+	return "notes"
+}
+
+// FileAnchor remembers where an annotated file was and what it contained, so that its
+// annotations can be moved to the new record of the file after a re-index or a rename
+type FileAnchor struct {
+	FileID      string    `gorm:"primaryKey"`
+	Path        string    `gorm:"index"`
+	Size        int64     `gorm:"index"`
+	Fingerprint string    // SHA256 of the entire content, independent of the path
+	UpdatedAt   time.Time
+}
+
+// TableName specifies the table name
+func (FileAnchor) TableName() string {
+	return "file_anchors"
+}
+
+// annotationModels are the tables of the annotations, kept when the index is reset
+var annotationModels = []interface{}{&Tag{}, &FileTag{}, &Favorite{}, &Note{}, &FileAnchor{}}
+
+// NormalizeTag trims and lowercases a tag name, returning an empty string if it is invalid
+func NormalizeTag(name string) string {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	if len(name) > maxTagLength {
+		return ""
+	}
+	return name
+}
+
+// Annotations of a file
+type Annotations struct {
+	Tags     []string `json:"tags"`
+	Favorite bool     `json:"favorite"`
+	Notes    []Note   `json:"notes"`
+}
+
+// AnnotationRepository manages the tags, favourites and notes of files
+type AnnotationRepository struct {
+	db *Database
+}
+
+// NewAnnotationRepository creates a new repository
+func NewAnnotationRepository(db *Database) *AnnotationRepository {
+	return &AnnotationRepository{db: db}
+}
+
+// Get returns the annotations of a file
+func (r *AnnotationRepository) Get(fileID string) (*Annotations, error) {
+	annotations := &Annotations{Tags: []string{}, Notes: []Note{}}
+
+	tags, err := r.tagsByFile([]string{fileID})
+	if err != nil {
+		return nil, err
+	}
+	if tags[fileID] != nil {
+		annotations.Tags = tags[fileID]
+	}
+
+	var favorites int64
+	if err := r.db.Model(&Favorite{}).Where("file_id = ?", fileID).Count(&favorites).Error; err != nil {
+		return nil, err
+	}
+	annotations.Favorite = favorites > 0
+
+	if err := r.db.Where("file_id = ?", fileID).Order("created_at").Find(&annotations.Notes).Error; err != nil {
+		return nil, err
+	}
+
+	return annotations, nil
+}
+
+// ListTags returns all tags with the number of files carrying them, counting only the files
+// within the scopes unless they are nil
+func (r *AnnotationRepository) ListTags(scopes []PathScope) ([]TagCount, error) {
+	var tags []TagCount
+	query := r.db.Model(&Tag{}).
+		Select("tags.name AS name, COUNT(file_items.id) AS count").
+		Joins("LEFT JOIN file_tags ON file_tags.tag_id = tags.id").
+		Joins("LEFT JOIN file_items ON file_items.id = file_tags.file_id AND file_items.deleted_at IS NULL")
+	if scopes != nil {
+		// Only the tags of the files visible to the user
+		query = applyScopes(query, scopes)
+	}
+	err := query.
+		Group("tags.id").
+		Order("tags.name").
+		Scan(&tags).Error
+	return tags, err
+}
+
+// TagCount is a tag with the number of files carrying it
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// SetTags replaces the tags of a file
+func (r *AnnotationRepository) SetTags(fileID string, names []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", fileID).Delete(&FileTag{}).Error; err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := addTag(tx, fileID, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddTag attaches a tag to a file, creating the tag if needed
+func (r *AnnotationRepository) AddTag(fileID, name string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return addTag(tx, fileID, name)
+	})
+}
+
+// addTag attaches a normalized tag to a file within a transaction
+func addTag(tx *gorm.DB, fileID, name string) error {
+	tag := Tag{Name: name}
+	if err := tx.Where(Tag{Name: name}).FirstOrCreate(&tag).Error; err != nil {
+		return err
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&FileTag{FileID: fileID, TagID: tag.ID}).Error
+}
+
+// RemoveTag detaches a tag from a file
+func (r *AnnotationRepository) RemoveTag(fileID, name string) error {
+	return r.db.Where("file_id = ? AND tag_id IN (SELECT id FROM tags WHERE name = ?)", fileID, name).
+		Delete(&FileTag{}).Error
+}
+
+// SetFavorite stars or unstars a file
+func (r *AnnotationRepository) SetFavorite(fileID string, favorite bool) error {
+	if !favorite {
+		return r.db.Delete(&Favorite{}, "file_id = ?", fileID).Error
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&Favorite{FileID: fileID}).Error
+}
+
+// CreateNote adds a note to a file
+func (r *AnnotationRepository) CreateNote(note *Note) error {
+	return r.db.Create(note).Error
+}
+
+// GetNote retrieves a note of a file
+func (r *AnnotationRepository) GetNote(fileID string, id uint) (*Note, error) {
+	var note Note
+	if err := r.db.First(&note, "id = ? AND file_id = ?", id, fileID).Error; err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// UpdateNote updates a note
+func (r *AnnotationRepository) UpdateNote(note *Note) error {
+	return r.db.Save(note).Error
+}
+
+// DeleteNote removes a note of a file
+func (r *AnnotationRepository) DeleteNote(fileID string, id uint) error {
+	return r.db.Delete(&Note{}, "id = ? AND file_id = ?", id, fileID).Error
+}
+
+// SaveAnchor records the location and fingerprint of an annotated file
+func (r *AnnotationRepository) SaveAnchor(item *FileItem, fingerprint string) error {
+	return r.db.Save(&FileAnchor{
+		FileID:      item.ID,
+		Path:        item.AbsPath,
+		Size:        item.Size,
+		Fingerprint: fingerprint,
+	}).Error
+}
+
+// GetAnchors returns the anchors of the given files
+func (r *AnnotationRepository) GetAnchors(fileIDs []string) ([]FileAnchor, error) {
+	var anchors []FileAnchor
+	if len(fileIDs) == 0 {
+		return anchors, nil
+	}
+	err := r.db.Where("file_id IN ?", fileIDs).Find(&anchors).Error
+	return anchors, err
+}
+
+// OrphanAnchors returns the anchors of annotated files that are no longer indexed
+func (r *AnnotationRepository) OrphanAnchors() ([]FileAnchor, error) {
+	var anchors []FileAnchor
+	err := r.db.Where("file_id NOT IN (SELECT id FROM file_items WHERE deleted_at IS NULL)").Find(&anchors).Error
+	return anchors, err
+}
+
+// Relink moves the annotations of a file that is no longer indexed to its new record. Share
+// links only follow the moves keeping the ID of a file: a public link never opens a new file.
+func (r *AnnotationRepository) Relink(oldFileID string, item *FileItem, fingerprint string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&FileTag{}, &Favorite{}, &Note{}} {
+			if err := tx.Model(model).Where("file_id = ?", oldFileID).UpdateColumn("file_id", item.ID).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&FileAnchor{}, "file_id = ?", oldFileID).Error; err != nil {
+			return err
+		}
+		return tx.Save(&FileAnchor{
+			FileID:      item.ID,
+			Path:        item.AbsPath,
+			Size:        item.Size,
+			Fingerprint: fingerprint,
+		}).Error
+	})
+}
+
+// deleteAnnotations removes the tags, favourite, notes and anchor of a deleted file
+func deleteAnnotations(tx *gorm.DB, fileID string) error {
+	for _, model := range []interface{}{&FileTag{}, &Favorite{}, &Note{}, &FileAnchor{}} {
+		if err := tx.Where("file_id = ?", fileID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagsByFile returns the tag names of the given files
+func (r *AnnotationRepository) tagsByFile(fileIDs []string) (map[string][]string, error) {
+	var rows []struct {
+		FileID string
+		Name   string
+	}
+	err := r.db.Table("file_tags").
+		Select("file_tags.file_id AS file_id, tags.name AS name").
+		Joins("JOIN tags ON tags.id = file_tags.tag_id").
+		Where("file_tags.file_id IN ?", fileIDs).
+		Order("tags.name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string][]string)
+	for _, row := range rows {
+		tags[row.FileID] = append(tags[row.FileID], row.Name)
+	}
+	return tags, nil
+}
+
+// loadAnnotations fills the tags, favourite flag and note count of files
+func (r *AnnotationRepository) loadAnnotations(items []FileItem) error {
+	// Stay below the maximum number of SQL variables for large timelines
+	const chunkSize = 500
+	for start := 0; start < len(items); start += chunkSize {
+		end := start + chunkSize
+		if end > len(items) {
+			end = len(items)
+		}
+		if err := r.loadAnnotationsChunk(items[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAnnotationsChunk fills the annotations of a chunk of files
+func (r *AnnotationRepository) loadAnnotationsChunk(items []FileItem) error {
+	ids := make([]string, len(items))
+	for i := range items {
+		ids[i] = items[i].ID
+	}
+
+	tags, err := r.tagsByFile(ids)
+	if err != nil {
+		return err
+	}
+
+	var favorites []string
+	if err := r.db.Model(&Favorite{}).Where("file_id IN ?", ids).Pluck("file_id", &favorites).Error; err != nil {
+		return err
+	}
+	favorite := make(map[string]bool, len(favorites))
+	for _, id := range favorites {
+		favorite[id] = true
+	}
+
+	var noteCounts []struct {
+		FileID string
+		Count  int
+	}
+	if err := r.db.Model(&Note{}).Select("file_id, COUNT(*) AS count").Where("file_id IN ?", ids).
+		Group("file_id").Scan(&noteCounts).Error; err != nil {
+		return err
+	}
+	notes := make(map[string]int, len(noteCounts))
+	for _, row := range noteCounts {
+		notes[row.FileID] = row.Count
+	}
+
+	for i := range items {
+		items[i].Tags = tags[items[i].ID]
+		items[i].Favorite = favorite[items[i].ID]
+		items[i].NoteCount = notes[items[i].ID]
+	}
+	return nil
+}
+
+// applyAnnotationFilters restricts a query to the files carrying all the tags (and starred if requested)
+func applyAnnotationFilters(query *gorm.DB, filters ListFilters) *gorm.DB {
+	for _, tag := range filters.Tags {
+		query = query.Where("id IN (SELECT file_tags.file_id FROM file_tags JOIN tags ON tags.id = file_tags.tag_id WHERE tags.name = ?)", tag)
+	}
+	if filters.Favorite {
+		query = query.Where("id IN (SELECT file_id FROM favorites)")
+	}
+	return query
+}
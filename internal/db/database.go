@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -16,6 +17,7 @@ import (
 // Database encapsulates the database connection
 type Database struct {
 	*gorm.DB
+	fullText bool // Whether the FTS5 table of file contents is available
 }
 
 // New creates a new database instance
@@ -61,8 +63,23 @@ func New(dbPath string, debug bool) (*Database, error) {
 	if err := db.AutoMigrate(&FileItem{}); err != nil {
 		return nil, fmt.Errorf("migration error: %w", err)
 	}
+	if err := db.AutoMigrate(annotationModels...); err != nil {
+		return nil, fmt.Errorf("migration error: %w", err)
+	}
+	if err := db.AutoMigrate(authModels...); err != nil {
+		return nil, fmt.Errorf("migration error: %w", err)
+	}
+	if err := db.AutoMigrate(shareModels...); err != nil {
+		return nil, fmt.Errorf("migration error: %w", err)
+	}
+	if err := migrateRoles(db); err != nil {
+		return nil, fmt.Errorf("migration error: %w", err)
+	}
 
-	return &Database{DB: db}, nil
+	database := &Database{DB: db}
+	database.setupFullText()
+
+	return database, nil
 }
 
 // Close closes the database connection
@@ -125,6 +142,101 @@ func (r *FileItemRepository) GetByHash(hash string) (*FileItem, error) {
 	return &item, nil
 }
 
+// UpdateInode updates only the inode number of a file
+func (r *FileItemRepository) UpdateInode(id string, inode uint64) error {
+	return r.retryOperation(func() error {
+		return r.db.Model(&FileItem{}).Where("id = ?", id).UpdateColumn("inode", inode).Error
+	})
+}
+
+// GetByInode retrieves the files with the given inode number and size
+func (r *FileItemRepository) GetByInode(inode uint64, size int64) ([]FileItem, error) {
+	var items []FileItem
+	err := r.db.Where("inode = ? AND size = ?", inode, size).Find(&items).Error
+	return items, err
+}
+
+// GetUnderDirectory retrieves the files located under a directory
+func (r *FileItemRepository) GetUnderDirectory(dir string, limit int) ([]FileItem, error) {
+	prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+
+	var items []FileItem
+	// substr avoids escaping the wildcards of LIKE in paths
+	query := r.db.Where("substr(abs_path, 1, ?) = ?", utf8.RuneCountInString(prefix), prefix).Order("abs_path")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&items).Error
+	return items, err
+}
+
+// movedColumns are the fields of a file that change when it is renamed or moved
+var movedColumns = []string{"abs_path", "root_id", "name", "ext", "hash", "created_at", "date_source", "date_candidates"}
+
+// Move updates the location of a file after a rename, keeping its ID
+func (r *FileItemRepository) Move(item *FileItem) error {
+	return r.retryOperation(func() error {
+		return r.db.Model(item).Select(movedColumns).Updates(item).Error
+	})
+}
+
+// MoveWith moves a file on disk and its record in one transaction: relocate changes the file on
+// disk and the fields of the item, which are saved with its full-text name unless it fails.
+// The caller undoes the change on disk if the transaction fails after relocate.
+func (r *FileItemRepository) MoveWith(item *FileItem, relocate func() error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := relocate(); err != nil {
+			return err
+		}
+
+		// A record deleted at the destination would break the uniqueness of the paths
+		var stale []string
+		if err := tx.Unscoped().Model(&FileItem{}).Where("abs_path = ? AND deleted_at IS NOT NULL", item.AbsPath).Pluck("id", &stale).Error; err != nil {
+			return err
+		}
+		if len(stale) > 0 {
+			if r.db.fullText {
+				if err := tx.Exec("DELETE FROM "+contentsTable+" WHERE file_id IN ?", stale).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Unscoped().Delete(&FileItem{}, "id IN ?", stale).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(item).Select(movedColumns).Updates(item).Error; err != nil {
+			return err
+		}
+		if r.db.fullText {
+			return tx.Exec("UPDATE "+contentsTable+" SET name = ? WHERE file_id = ?", item.Name, item.ID).Error
+		}
+		return nil
+	})
+}
+
+// DeleteWith removes a file on disk and its record in one transaction: remove changes the file
+// on disk, and the record, its full-text entry, annotations and share links are deleted unless
+// it fails. The caller undoes the change on disk if the transaction fails after remove. The
+// record is deleted for good, so that a file placed later at the same path starts afresh.
+func (r *FileItemRepository) DeleteWith(item *FileItem, remove func() error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := remove(); err != nil {
+			return err
+		}
+		if err := r.deleteContents(tx, "id = ?", item.ID); err != nil {
+			return err
+		}
+		if err := deleteFileShares(tx, "id = ?", item.ID); err != nil {
+			return err
+		}
+		if err := deleteAnnotations(tx, item.ID); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&FileItem{}, "id = ?", item.ID).Error
+	})
+}
+
 // Update updates a file
 func (r *FileItemRepository) Update(item *FileItem) error {
 	return r.db.Save(item).Error
@@ -135,10 +247,13 @@ func (r *FileItemRepository) UpdateUnscoped(item *FileItem) error {
 	return r.db.Unscoped().Save(item).Error
 }
 
-// UpdateThumbnailPath updates only the thumbnail path for a file with retry mechanism
-func (r *FileItemRepository) UpdateThumbnailPath(id string, thumbPath string) error {
+// UpdateThumbnail updates only the thumbnail path and perceptual hash for a file with retry mechanism
+func (r *FileItemRepository) UpdateThumbnail(id string, thumbPath string, perceptualHash string) error {
 	return r.retryOperation(func() error {
-		return r.db.Model(&FileItem{}).Where("id = ?", id).Update("thumb_path", thumbPath).Error
+		return r.db.Model(&FileItem{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"thumb_path":      thumbPath,
+			"perceptual_hash": perceptualHash,
+		}).Error
 	})
 }
 
@@ -181,14 +296,29 @@ func isLockError(err error) bool {
 		   strings.Contains(errStr, "database table is locked")
 }
 
-// Delete removes a file
+// Delete removes a file with its full-text entry and share links
 func (r *FileItemRepository) Delete(id string) error {
-	return r.db.Delete(&FileItem{}, "id = ?", id).Error
+	return r.deleteWhere("id = ?", id)
 }
 
-// DeleteByPath removes a file by its path
+// DeleteByPath removes a file with its full-text entry and share links by its path
 func (r *FileItemRepository) DeleteByPath(path string) error {
-	return r.db.Delete(&FileItem{}, "abs_path = ?", path).Error
+	return r.deleteWhere("abs_path = ?", path)
+}
+
+// deleteWhere removes the files matching a condition with their full-text entries and share
+// links. A file indexed again at the same path gets back the ID of its removed record, which
+// must not bring back the links to the removed file.
+func (r *FileItemRepository) deleteWhere(condition string, args ...interface{}) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := r.deleteContents(tx, condition, args...); err != nil {
+			return err
+		}
+		if err := deleteFileShares(tx, condition, args...); err != nil {
+			return err
+		}
+		return tx.Where(condition, args...).Delete(&FileItem{}).Error
+	})
 }
 
 // CreateBatch creates multiple files in a single transaction
@@ -199,14 +329,14 @@ func (r *FileItemRepository) CreateBatch(items []*FileItem) error {
 	return r.db.CreateInBatches(items, 100).Error // Process in batches of 100
 }
 
-// UpdateBatch updates multiple files in a single transaction
+// UpdateBatch updates multiple files in a single transaction, including soft-deleted records (for resurrection)
 func (r *FileItemRepository) UpdateBatch(items []*FileItem) error {
 	if len(items) == 0 {
 		return nil
 	}
 	return r.db.Transaction(func(tx *gorm.DB) error {
 		for _, item := range items {
-			if err := tx.Save(item).Error; err != nil {
+			if err := tx.Unscoped().Save(item).Error; err != nil {
 				return err
 			}
 		}
@@ -214,14 +344,14 @@ func (r *FileItemRepository) UpdateBatch(items []*FileItem) error {
 	})
 }
 
-// GetExistingPaths returns a map of existing paths with their FileItems
+// GetExistingPaths returns a map of existing paths with their FileItems, including soft-deleted records
 func (r *FileItemRepository) GetExistingPaths(paths []string) (map[string]*FileItem, error) {
 	if len(paths) == 0 {
 		return make(map[string]*FileItem), nil
 	}
 	
 	var items []FileItem
-	if err := r.db.Where("abs_path IN ?", paths).Find(&items).Error; err != nil {
+	if err := r.db.Unscoped().Where("abs_path IN ?", paths).Find(&items).Error; err != nil {
 		return nil, err
 	}
 	
@@ -236,30 +366,41 @@ func (r *FileItemRepository) GetExistingPaths(paths []string) (map[string]*FileI
 // ListFilters represents filters for the file list
 type ListFilters struct {
 	Query     string    `json:"query"`
+	Root      string    `json:"root"`
 	Extension string    `json:"extension"`
+	Tags      []string  `json:"tags"`     // Files carrying all these tags
+	Favorite  bool      `json:"favorite"` // Only starred files
+	Duplicates bool     `json:"duplicates"` // Only files with identical copies
 	DateFrom  *string   `json:"date_from"`
 	DateTo    *string   `json:"date_to"`
 	MinSize   *int64    `json:"min_size"`
 	MaxSize   *int64    `json:"max_size"`
 	Page      int       `json:"page"`
 	PageSize  int       `json:"page_size"`
+	Scopes    []PathScope `json:"-"` // Folders the user may see (nil: everything, empty: nothing)
 }
 
-// ListResult represents the result of a paginated list
-type ListResult struct {
-	Items      []FileItem `json:"items"`
-	Total      int64      `json:"total"`
-	Page       int        `json:"page"`
-	PageSize   int        `json:"page_size"`
-	TotalPages int        `json:"total_pages"`
+// PathScope is a folder of a root visible to a user
+type PathScope struct {
+	RootID string
+	Dir    string // Absolute path of the folder (empty: the whole root)
 }
 
-// List retrieves a paginated list of files with filters
-func (r *FileItemRepository) List(filters ListFilters) (*ListResult, error) {
-	query := r.db.Model(&FileItem{})
+// applyFilters adds the conditions of the filters to a query.
+// The query matches names and paths, and file contents when match (an FTS5 expression) is set.
+func applyFilters(query *gorm.DB, filters ListFilters, match string) *gorm.DB {
+	if filters.Root != "" {
+		query = query.Where("root_id = ?", filters.Root)
+	}
+
+	if filters.Scopes != nil {
+		query = applyScopes(query, filters.Scopes)
+	}
 
-	// Filters
-	if filters.Query != "" {
+	if match != "" {
+		query = query.Where("name LIKE ? OR abs_path LIKE ? OR id IN (SELECT file_id FROM "+contentsTable+" WHERE "+contentsTable+" MATCH ?)",
+			"%"+filters.Query+"%", "%"+filters.Query+"%", match)
+	} else if filters.Query != "" {
 		query = query.Where("name LIKE ? OR abs_path LIKE ?", "%"+filters.Query+"%", "%"+filters.Query+"%")
 	}
 
@@ -267,6 +408,12 @@ func (r *FileItemRepository) List(filters ListFilters) (*ListResult, error) {
 		query = query.Where("ext = ?", filters.Extension)
 	}
 
+	query = applyAnnotationFilters(query, filters)
+
+	if filters.Duplicates {
+		query = query.Where("content_hash IN (?)", duplicateHashes(query.Session(&gorm.Session{NewDB: true}), filters.Root, filters.Scopes))
+	}
+
 	if filters.DateFrom != nil {
 		query = query.Where("created_at >= ?", *filters.DateFrom)
 	}
@@ -283,6 +430,64 @@ func (r *FileItemRepository) List(filters ListFilters) (*ListResult, error) {
 		query = query.Where("size <= ?", *filters.MaxSize)
 	}
 
+	return query
+}
+
+// applyScopes restricts a query to the files within the folders of the scopes
+func applyScopes(query *gorm.DB, scopes []PathScope) *gorm.DB {
+	if len(scopes) == 0 {
+		return query.Where("1 = 0")
+	}
+
+	conditions := make([]string, 0, len(scopes))
+	args := make([]interface{}, 0, 3*len(scopes))
+	for _, scope := range scopes {
+		if scope.Dir == "" {
+			conditions = append(conditions, "root_id = ?")
+			args = append(args, scope.RootID)
+			continue
+		}
+		// Compared with substr rather than LIKE, whose wildcards can appear in paths
+		dir := strings.TrimSuffix(scope.Dir, string(filepath.Separator)) + string(filepath.Separator)
+		conditions = append(conditions, "(root_id = ? AND substr(abs_path, 1, ?) = ?)")
+		args = append(args, scope.RootID, utf8.RuneCountInString(dir), dir)
+	}
+	return query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+}
+
+// ListResult represents the result of a paginated list
+type ListResult struct {
+	Items      []FileItem `json:"items"`
+	Total      int64      `json:"total"`
+	Page       int        `json:"page"`
+	PageSize   int        `json:"page_size"`
+	TotalPages int        `json:"total_pages"`
+}
+
+// searchMatch returns the FTS5 expression of the query of the filters, if contents are searchable
+func (r *FileItemRepository) searchMatch(filters ListFilters) string {
+	if !r.db.fullText {
+		return ""
+	}
+	return fullTextQuery(filters.Query)
+}
+
+// annotations returns the repository of the annotations of the files
+func (r *FileItemRepository) annotations() *AnnotationRepository {
+	return NewAnnotationRepository(r.db)
+}
+
+// List retrieves a paginated list of files with filters.
+// Searches are sorted by relevance, files matching by content coming with a highlighted snippet.
+func (r *FileItemRepository) List(filters ListFilters) (*ListResult, error) {
+	match := r.searchMatch(filters)
+	query := applyFilters(r.db.Model(&FileItem{}), filters, match)
+	order := "created_at DESC"
+	if match != "" {
+		query = joinSearchMatches(query, match)
+		order = "matches.score IS NULL, matches.score, created_at DESC"
+	}
+
 	// Count total
 	var total int64
 	if err := query.Count(&total).Error; err != nil {
@@ -298,15 +503,22 @@ func (r *FileItemRepository) List(filters ListFilters) (*ListResult, error) {
 	}
 
 	offset := (filters.Page - 1) * filters.PageSize
+	if match != "" {
+		query = selectSearchMatches(query)
+	}
 	
 	var items []FileItem
-	if err := query.Order("created_at DESC").
+	if err := query.Order(order).
 		Limit(filters.PageSize).
 		Offset(offset).
 		Find(&items).Error; err != nil {
 		return nil, err
 	}
 
+	if err := r.annotations().loadAnnotations(items); err != nil {
+		return nil, err
+	}
+
 	totalPages := int(total) / filters.PageSize
 	if int(total)%filters.PageSize > 0 {
 		totalPages++
@@ -321,39 +533,31 @@ func (r *FileItemRepository) List(filters ListFilters) (*ListResult, error) {
 	}, nil
 }
 
+// Contains reports whether a file matches the filters
+func (r *FileItemRepository) Contains(filters ListFilters, id string) (bool, error) {
+	var count int64
+	err := applyFilters(r.db.Model(&FileItem{}), filters, r.searchMatch(filters)).
+		Where("id = ?", id).
+		Count(&count).Error
+	return count > 0, err
+}
+
 // GetGroupedByDate retrieves files grouped by date
 func (r *FileItemRepository) GetGroupedByDate(filters ListFilters) (map[string][]FileItem, error) {
-	query := r.db.Model(&FileItem{})
-
 	// Apply the same filters as List
-	if filters.Query != "" {
-		query = query.Where("name LIKE ? OR abs_path LIKE ?", "%"+filters.Query+"%", "%"+filters.Query+"%")
-	}
-
-	if filters.Extension != "" {
-		query = query.Where("ext = ?", filters.Extension)
-	}
-
-	if filters.DateFrom != nil {
-		query = query.Where("created_at >= ?", *filters.DateFrom)
-	}
-
-	if filters.DateTo != nil {
-		query = query.Where("created_at <= ?", *filters.DateTo)
-	}
-
-	if filters.MinSize != nil {
-		query = query.Where("size >= ?", *filters.MinSize)
-	}
-
-	if filters.MaxSize != nil {
-		query = query.Where("size <= ?", *filters.MaxSize)
+	match := r.searchMatch(filters)
+	query := applyFilters(r.db.Model(&FileItem{}), filters, match)
+	if match != "" {
+		query = selectSearchMatches(joinSearchMatches(query, match))
 	}
 
 	var items []FileItem
 	if err := query.Order("created_at DESC").Find(&items).Error; err != nil {
 		return nil, err
 	}
+	if err := r.annotations().loadAnnotations(items); err != nil {
+		return nil, err
+	}
 
 	// Group by date (YYYY-MM-DD)
 	grouped := make(map[string][]FileItem)
@@ -365,7 +569,8 @@ func (r *FileItemRepository) GetGroupedByDate(filters ListFilters) (map[string][
 	return grouped, nil
 }
 
-// Reset drops all tables and recreates them (WARNING: destroys all data)
+// Reset drops the index tables and recreates them (WARNING: destroys all data).
+// Tags, favourites and notes are kept and re-attached to the files as they are indexed again.
 func (db *Database) Reset() error {
 	log.Println("⚠️  Resetting database - all data will be lost!")
 	
@@ -373,11 +578,15 @@ func (db *Database) Reset() error {
 	if err := db.Migrator().DropTable(&FileItem{}); err != nil {
 		log.Printf("Warning: Could not drop FileItem table: %v", err)
 	}
+	if err := db.dropFullText(); err != nil {
+		log.Printf("Warning: Could not drop full-text table: %v", err)
+	}
 	
 	// Recreate tables with migrations
 	if err := db.AutoMigrate(&FileItem{}); err != nil {
 		return fmt.Errorf("failed to recreate tables: %w", err)
 	}
+	db.setupFullText()
 	
 	log.Println("✅ Database reset completed")
 	return nil
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"gorm.io/gorm"
+)
+
+// duplicateHashes selects the content hashes shared by several files of the root (unless it is
+// empty) within the scopes (unless they are nil): a copy the user may not see is not reported.
+// Empty files all have the same hash and are not reported as duplicates.
+func duplicateHashes(db *gorm.DB, root string, scopes []PathScope) *gorm.DB {
+	query := db.Model(&FileItem{}).Select("content_hash").Where("content_hash != '' AND size > 0")
+	if root != "" {
+		query = query.Where("root_id = ?", root)
+	}
+	if scopes != nil {
+		query = applyScopes(query, scopes)
+	}
+	return query.Group("content_hash").Having("COUNT(*) > 1")
+}
+
+// PendingContentHashes returns files whose full-content hash has not been computed yet,
+// ordered by ID and starting after the given ID so that unreadable files are not retried in a loop
+func (r *FileItemRepository) PendingContentHashes(afterID string, limit int) ([]FileItem, error) {
+	var items []FileItem
+	err := r.db.Select("id, abs_path, size, hash").
+		Where("content_hash = '' AND id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&items).Error
+	return items, err
+}
+
+// CountPendingContentHashes returns the number of files whose full-content hash has not been computed yet,
+// counting only the files of the root unless it is empty, and within the scopes unless they are nil
+func (r *FileItemRepository) CountPendingContentHashes(root string, scopes []PathScope) (int64, error) {
+	var count int64
+	query := r.db.Model(&FileItem{}).Where("content_hash = ''")
+	if root != "" {
+		query = query.Where("root_id = ?", root)
+	}
+	if scopes != nil {
+		query = applyScopes(query, scopes)
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// SetContentHash stores the full-content hash of a file, unless the file changed since it was read
+func (r *FileItemRepository) SetContentHash(id, hash, contentHash string) error {
+	return r.retryOperation(func() error {
+		return r.db.Model(&FileItem{}).Where("id = ? AND hash = ?", id, hash).
+			UpdateColumn("content_hash", contentHash).Error
+	})
+}
+
+// DuplicateGroup is a set of files with identical content
+type DuplicateGroup struct {
+	ContentHash string     `json:"content_hash"`
+	Size        int64      `json:"size"`   // Size of each copy
+	Count       int        `json:"count"`  // Number of copies
+	Wasted      int64      `json:"wasted"` // Space used by the extra copies
+	Items       []FileItem `gorm:"-" json:"items"`
+}
+
+// DuplicatesResult represents a paginated list of duplicate groups with their totals
+type DuplicatesResult struct {
+	Groups         []DuplicateGroup `json:"groups"`
+	TotalGroups    int64            `json:"total_groups"`
+	DuplicateFiles int64            `json:"duplicate_files"` // Extra copies, not counting one original per group
+	WastedBytes    int64            `json:"wasted_bytes"`
+	Page           int              `json:"page"`
+	PageSize       int              `json:"page_size"`
+	TotalPages     int              `json:"total_pages"`
+}
+
+// Duplicates lists the groups of files with identical content, the most wasteful first.
+// Only the files matching the filters are compared.
+func (r *FileItemRepository) Duplicates(filters ListFilters) (*DuplicatesResult, error) {
+	filters.Duplicates = false
+	filtered := func() *gorm.DB {
+		return applyFilters(r.db.Model(&FileItem{}), filters, r.searchMatch(filters)).
+			Where("content_hash != '' AND size > 0")
+	}
+	groups := func() *gorm.DB {
+		return filtered().
+			Select("content_hash, MAX(size) AS size, COUNT(*) AS count, MAX(size) * (COUNT(*) - 1) AS wasted").
+			Group("content_hash").
+			Having("COUNT(*) > 1")
+	}
+
+	// Totals over all the groups
+	var totals struct {
+		GroupCount  int64
+		FileCount   int64
+		WastedBytes int64
+	}
+	if err := r.db.Table("(?) AS duplicate_groups", groups()).
+		Select("COUNT(*) AS group_count, COALESCE(SUM(count - 1), 0) AS file_count, COALESCE(SUM(wasted), 0) AS wasted_bytes").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+
+	// Pagination
+	if filters.Page < 1 {
+		filters.Page = 1
+	}
+	if filters.PageSize < 1 {
+		filters.PageSize = 50
+	}
+
+	var page []DuplicateGroup
+	if err := groups().Order("wasted DESC, content_hash").
+		Limit(filters.PageSize).
+		Offset((filters.Page - 1) * filters.PageSize).
+		Scan(&page).Error; err != nil {
+		return nil, err
+	}
+
+	if len(page) > 0 {
+		hashes := make([]string, len(page))
+		index := make(map[string]int, len(page))
+		for i := range page {
+			hashes[i] = page[i].ContentHash
+			index[page[i].ContentHash] = i
+		}
+
+		var items []FileItem
+		if err := filtered().Where("content_hash IN ?", hashes).Order("created_at, abs_path").Find(&items).Error; err != nil {
+			return nil, err
+		}
+		if err := r.annotations().loadAnnotations(items); err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			group := &page[index[item.ContentHash]]
+			group.Items = append(group.Items, item)
+		}
+	}
+
+	totalPages := int(totals.GroupCount) / filters.PageSize
+	if int(totals.GroupCount)%filters.PageSize > 0 {
+		totalPages++
+	}
+
+	return &DuplicatesResult{
+		Groups:         page,
+		TotalGroups:    totals.GroupCount,
+		DuplicateFiles: totals.FileCount,
+		WastedBytes:    totals.WastedBytes,
+		Page:           filters.Page,
+		PageSize:       filters.PageSize,
+		TotalPages:     totalPages,
+	}, nil
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDuplicatesFilterWithinScopes(t *testing.T) {
+	database := newTestDatabase(t)
+	repo := NewFileItemRepository(database)
+
+	// Copies of a, b and c, a and b having a copy in a folder or a root the user may not see
+	files := map[string]string{
+		"/library/photos/family/a.jpg":  "hash-a",
+		"/library/photos/private/a.jpg": "hash-a",
+		"/library/photos/family/b.jpg":  "hash-b",
+		"/library/scans/b.jpg":          "hash-b",
+		"/library/photos/family/c1.jpg": "hash-c",
+		"/library/photos/family/c2.jpg": "hash-c",
+		"/library/photos/family/d.jpg":  "hash-d",
+	}
+	ids := make(map[string]string)
+	for path, contentHash := range files {
+		rootID := "photos"
+		if path == "/library/scans/b.jpg" {
+			rootID = "scans"
+		}
+		item := createTestFile(t, repo, rootID, path, "")
+		item.Size, item.ContentHash = 1000, contentHash
+		if err := repo.Update(item); err != nil {
+			t.Fatal(err)
+		}
+		ids[path] = item.ID
+	}
+	idsOf := func(paths ...string) []string {
+		result := []string{}
+		for _, path := range paths {
+			result = append(result, ids[path])
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	family := []PathScope{{RootID: "photos", Dir: "/library/photos/family"}}
+	tests := []struct {
+		name   string
+		root   string
+		scopes []PathScope
+		want   []string
+	}{
+		{"everything", "", nil, idsOf(
+			"/library/photos/family/a.jpg", "/library/photos/private/a.jpg",
+			"/library/photos/family/b.jpg", "/library/scans/b.jpg",
+			"/library/photos/family/c1.jpg", "/library/photos/family/c2.jpg",
+		)},
+		{"root", "photos", nil, idsOf(
+			"/library/photos/family/a.jpg", "/library/photos/private/a.jpg",
+			"/library/photos/family/c1.jpg", "/library/photos/family/c2.jpg",
+		)},
+		{"folder", "", family, idsOf("/library/photos/family/c1.jpg", "/library/photos/family/c2.jpg")},
+		{"folder and root", "", append([]PathScope{{RootID: "scans"}}, family...), idsOf(
+			"/library/photos/family/b.jpg", "/library/scans/b.jpg",
+			"/library/photos/family/c1.jpg", "/library/photos/family/c2.jpg",
+		)},
+		{"nothing", "", []PathScope{}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := ListFilters{Root: tt.root, Scopes: tt.scopes, Duplicates: true}
+			if got := searchIDs(t, repo, filters); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("duplicates %v, want %v", got, tt.want)
+			}
+			for path, id := range ids {
+				contained, err := repo.Contains(filters, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if listed := contains(tt.want, id); contained != listed {
+					t.Errorf("Contains(%s) = %v, want %v", path, contained, listed)
+				}
+			}
+
+			// The groups of the duplicates page agree with the filter
+			filters.Duplicates = false
+			result, err := repo.Duplicates(filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			grouped := []string{}
+			for _, group := range result.Groups {
+				for _, item := range group.Items {
+					grouped = append(grouped, item.ID)
+				}
+			}
+			sort.Strings(grouped)
+			if !reflect.DeepEqual(grouped, tt.want) {
+				t.Errorf("duplicate groups %v, want %v", grouped, tt.want)
+			}
+		})
+	}
+}
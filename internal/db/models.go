@@ -10,17 +10,30 @@ import (
 // FileItem represents an indexed file in the database
 type FileItem struct {
 	ID        string    `gorm:"primaryKey" json:"id"`                    // UUID
+	RootID    string    `gorm:"index" json:"root_id"`                    // Library root containing the file
 	AbsPath   string    `gorm:"uniqueIndex;not null" json:"abs_path"`    // Absolute path
 	Name      string    `gorm:"not null" json:"name"`                    // File name
 	Ext       string    `gorm:"index" json:"ext"`                        // Extension
 	Mime      string    `json:"mime"`                                    // Type MIME
 	Size      int64     `json:"size"`                                    // Size in bytes
+	Inode     uint64    `gorm:"index" json:"-"`                          // Inode number, to recognize the file after a rename (0 if unknown)
 	CreatedAt time.Time `gorm:"index" json:"created_at"`                 // File creation date
-	Hash      string    `gorm:"index" json:"hash"`                       // SHA256 for deduplication
+	DateSource string   `json:"date_source"`                             // Source of the creation date (exif, pdf, office, quicktime, id3, filename, birthtime, mtime, ctime, upload, client)
+	DateCandidates DateCandidates `gorm:"type:text" json:"date_candidates,omitempty"` // Dates reported by every date source
+	DateOverride *time.Time `json:"date_override,omitempty"`                // Date provided by the uploading client, replacing the date sources
+	Metadata  Metadata  `gorm:"type:text" json:"metadata,omitempty"`      // Raw embedded metadata (EXIF, PDF, Office, QuickTime, ID3)
+	Hash      string    `gorm:"index" json:"hash"`                       // Quick change-detection hash (path, size, mtime, sampled content)
+	ContentHash string  `gorm:"index;not null;default:''" json:"content_hash,omitempty"` // SHA256 of the full content, computed in the background for deduplication
 	ThumbPath *string   `json:"thumb_path,omitempty"`                    // Thumbnail path (if image)
+	PerceptualHash string `gorm:"index;not null;default:''" json:"perceptual_hash,omitempty"` // dHash of the image (hexadecimal), computed with the thumbnail
 	AddedAt   time.Time `gorm:"autoCreateTime" json:"added_at"`          // Indexing date
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`        // Last update
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`  // Soft delete
+	Content   string    `gorm:"-" json:"-"`                              // Extracted text, stored in the full-text table
+	Snippet   string    `gorm:"->;-:migration" json:"-"`                 // Excerpt of the content matching a search
+	Tags      []string  `gorm:"-" json:"tags,omitempty"`                 // Tag names (loaded by the list queries)
+	Favorite  bool      `gorm:"-" json:"favorite,omitempty"`             // Starred (loaded by the list queries)
+	NoteCount int       `gorm:"-" json:"note_count,omitempty"`           // Number of notes (loaded by the list queries)
 }
 
 // TableName specifies the table name
@@ -74,34 +87,49 @@ func (f *FileItem) FormatSize() string {
 // FileItemResponse structure for API responses
 type FileItemResponse struct {
 	ID          string    `json:"id"`
+	RootID      string    `json:"root_id"`
 	Name        string    `json:"name"`
 	Ext         string    `json:"ext"`
 	Mime        string    `json:"mime"`
 	Size        int64     `json:"size"`
 	SizeFormatted string  `json:"size_formatted"`
 	CreatedAt   time.Time `json:"created_at"`
+	DateSource  string    `json:"date_source"`
 	HasPreview  bool      `json:"has_preview"`
 	HasThumbnail bool     `json:"has_thumbnail"`
 	ThumbUrl    string    `json:"thumb_url,omitempty"`
+	Snippet     string    `json:"snippet,omitempty"` // Matching excerpt of the content (HTML, terms in <mark>)
+	Tags        []string  `json:"tags,omitempty"`
+	Favorite    bool      `json:"favorite"`
+	NoteCount   int       `json:"note_count,omitempty"`
 }
 
 // ToResponse converts FileItem to FileItemResponse
 func (f *FileItem) ToResponse() FileItemResponse {
 	resp := FileItemResponse{
 		ID:            f.ID,
+		RootID:        f.RootID,
 		Name:          f.Name,
 		Ext:           f.Ext,
 		Mime:          f.Mime,
 		Size:          f.Size,
 		SizeFormatted: f.FormatSize(),
 		CreatedAt:     f.CreatedAt,
+		DateSource:    f.DateSource,
 		HasPreview:    f.IsPreviewable(),
 		HasThumbnail:  f.HasThumbnail(),
+		Tags:          f.Tags,
+		Favorite:      f.Favorite,
+		NoteCount:     f.NoteCount,
 	}
 	
 	if f.HasThumbnail() {
 		resp.ThumbUrl = "/files/" + f.ID + "/thumb"
 	}
+
+	if f.Snippet != "" {
+		resp.Snippet = highlightSnippet(f.Snippet)
+	}
 	
 	return resp
 }
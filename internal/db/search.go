@@ -0,0 +1,125 @@
+package db
+
+import (
+	"html"
+	"log"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Name of the FTS5 table holding the names and text content of the files
+const contentsTable = "file_contents"
+
+// Markers of the matched terms in snippets, replaced when building API responses
+const (
+	snippetMatchStart = "\x02"
+	snippetMatchEnd   = "\x03"
+)
+
+// setupFullText creates the full-text table. SQLite must be built with FTS5
+// (sqlite_fts5 build tag), otherwise searches only match names and paths.
+func (d *Database) setupFullText() {
+	var existing int64
+	d.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", contentsTable).Scan(&existing)
+
+	err := d.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS " + contentsTable +
+		" USING fts5(file_id UNINDEXED, name, content, tokenize = 'unicode61 remove_diacritics 2')").Error
+	if err != nil {
+		log.Printf("Full-text search unavailable (SQLite built without FTS5): %v", err)
+		d.fullText = false
+		return
+	}
+	d.fullText = true
+
+	// Files indexed before the table existed are re-read by the next scan
+	if existing == 0 {
+		if err := d.Model(&FileItem{}).Unscoped().Where("1 = 1").UpdateColumn("hash", "").Error; err != nil {
+			log.Printf("Warning: Could not schedule the content indexing of existing files: %v", err)
+		}
+	}
+}
+
+// dropFullText drops the full-text table
+func (d *Database) dropFullText() error {
+	return d.Exec("DROP TABLE IF EXISTS " + contentsTable).Error
+}
+
+// FullTextEnabled reports whether file contents are searchable
+func (d *Database) FullTextEnabled() bool {
+	return d.fullText
+}
+
+// IndexContents replaces the full-text entries of files with their name and extracted text
+func (r *FileItemRepository) IndexContents(items []*FileItem) error {
+	if !r.db.fullText || len(items) == 0 {
+		return nil
+	}
+	return r.retryOperation(func() error {
+		return r.db.Transaction(func(tx *gorm.DB) error {
+			for _, item := range items {
+				if err := tx.Exec("DELETE FROM "+contentsTable+" WHERE file_id = ?", item.ID).Error; err != nil {
+					return err
+				}
+				if err := tx.Exec("INSERT INTO "+contentsTable+" (file_id, name, content) VALUES (?, ?, ?)",
+					item.ID, item.Name, item.Content).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// RenameContents updates the name of a file in its full-text entry
+func (r *FileItemRepository) RenameContents(item *FileItem) error {
+	if !r.db.fullText {
+		return nil
+	}
+	return r.retryOperation(func() error {
+		return r.db.Exec("UPDATE "+contentsTable+" SET name = ? WHERE file_id = ?", item.Name, item.ID).Error
+	})
+}
+
+// deleteContents removes the full-text entries of the files matching a condition on file_items
+func (r *FileItemRepository) deleteContents(tx *gorm.DB, condition string, args ...interface{}) error {
+	if !r.db.fullText {
+		return nil
+	}
+	return tx.Exec("DELETE FROM "+contentsTable+" WHERE file_id IN (SELECT id FROM file_items WHERE "+condition+")", args...).Error
+}
+
+// fullTextQuery converts a user query into an FTS5 expression: every word must
+// match, as a prefix. Returns an empty string if the query contains no word.
+func fullTextQuery(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, `"`+word+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// joinSearchMatches adds the rank and snippet of the full-text matches of a query to the selected files
+func joinSearchMatches(query *gorm.DB, match string) *gorm.DB {
+	return query.
+		Joins("LEFT JOIN (SELECT file_id, bm25("+contentsTable+", 0, 10.0, 1.0) AS score, "+
+			"snippet("+contentsTable+", -1, ?, ?, '…', 16) AS snippet FROM "+contentsTable+" WHERE "+contentsTable+" MATCH ?) AS matches "+
+			"ON matches.file_id = file_items.id", snippetMatchStart, snippetMatchEnd, match)
+}
+
+// selectSearchMatches selects the snippet of the joined full-text matches along with the files
+func selectSearchMatches(query *gorm.DB) *gorm.DB {
+	return query.Select("file_items.*, matches.snippet AS snippet")
+}
+
+// highlightSnippet escapes a snippet for HTML and wraps the matched terms in <mark> elements
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, snippetMatchStart, "<mark>")
+	return strings.ReplaceAll(escaped, snippetMatchEnd, "</mark>")
+}
@@ -0,0 +1,273 @@
+package db
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestDatabase opens a new database in a temporary directory
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	database, err := New(filepath.Join(t.TempDir(), "app.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// requireFullText skips a test when SQLite is built without FTS5 (go test -tags sqlite_fts5)
+func requireFullText(t *testing.T, database *Database) {
+	t.Helper()
+	if !database.FullTextEnabled() {
+		t.Skip("SQLite built without FTS5: run the tests with -tags sqlite_fts5")
+	}
+}
+
+// createTestFile indexes a file of a root with its text content
+func createTestFile(t *testing.T, repo *FileItemRepository, rootID, path, text string) *FileItem {
+	t.Helper()
+	item := &FileItem{
+		ID:        strings.NewReplacer("/", "-", ".", "-").Replace(strings.TrimPrefix(path, "/")),
+		RootID:    rootID,
+		AbsPath:   path,
+		Name:      filepath.Base(path),
+		Ext:       filepath.Ext(path),
+		CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Content:   text,
+	}
+	if err := repo.Create(item); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.IndexContents([]*FileItem{item}); err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+// searchIDs returns the IDs of the files found by a search, sorted
+func searchIDs(t *testing.T, repo *FileItemRepository, filters ListFilters) []string {
+	t.Helper()
+	result, err := repo.List(filters)
+	if err != nil {
+		t.Fatalf("search %q: %v", filters.Query, err)
+	}
+	ids := []string{}
+	for _, item := range result.Items {
+		ids = append(ids, item.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// countContents returns the number of entries of the full-text table for a file
+func countContents(t *testing.T, database *Database, id string) int64 {
+	t.Helper()
+	var count int64
+	if err := database.Raw("SELECT count(*) FROM "+contentsTable+" WHERE file_id = ?", id).Scan(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestFullTextQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"invoice", `"invoice"*`},
+		{"  invoice   2024 ", `"invoice"* "2024"*`},
+		{"Été à Noël", `"Été"* "à"* "Noël"*`},
+		{`"quoted words"`, `"quoted"* "words"*`},
+		{`unbalanced "quote`, `"unbalanced"* "quote"*`},
+		{"it's", `"it"* "s"*`},
+		{"invoice AND receipt", `"invoice"* "AND"* "receipt"*`},
+		{"invoice OR NOT receipt", `"invoice"* "OR"* "NOT"* "receipt"*`},
+		{"NEAR(invoice receipt, 2)", `"NEAR"* "invoice"* "receipt"* "2"*`},
+		{"name:invoice", `"name"* "invoice"*`},
+		{"-draft +final ^start inv*", `"draft"* "final"* "start"* "inv"*`},
+		{"{name content}: (a)", `"name"* "content"* "a"*`},
+		{"", ""},
+		{`"*" - : ( ) ^`, ""},
+	}
+
+	for _, tt := range tests {
+		if got := fullTextQuery(tt.query); got != tt.want {
+			t.Errorf("fullTextQuery(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchFollowsContents(t *testing.T) {
+	database := newTestDatabase(t)
+	requireFullText(t, database)
+	repo := NewFileItemRepository(database)
+
+	item := createTestFile(t, repo, "docs", "/library/docs/letter.txt", "Invoice for the plumber")
+	other := createTestFile(t, repo, "docs", "/library/docs/recipe.txt", "Crème brûlée")
+	search := func(query string) []string {
+		return searchIDs(t, repo, ListFilters{Query: query})
+	}
+
+	// Inserted contents are searchable, by prefix and without diacritics
+	if got := search("plumb"); !reflect.DeepEqual(got, []string{item.ID}) {
+		t.Errorf("search of the content: %v, want [%s]", got, item.ID)
+	}
+	if got := search("creme brulee"); !reflect.DeepEqual(got, []string{other.ID}) {
+		t.Errorf("search without diacritics: %v, want [%s]", got, other.ID)
+	}
+	result, err := repo.List(ListFilters{Query: "plumber"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snippet := result.Items[0].ToResponse().Snippet; !strings.Contains(snippet, "<mark>plumber</mark>") {
+		t.Errorf("snippet %q does not highlight the match", snippet)
+	}
+
+	// Updated contents replace the previous ones
+	item.Content = "Invoice for the electrician"
+	if err := repo.IndexContents([]*FileItem{item}); err != nil {
+		t.Fatal(err)
+	}
+	if got := search("plumber"); len(got) != 0 {
+		t.Errorf("previous content still found: %v", got)
+	}
+	if got := search("electrician"); !reflect.DeepEqual(got, []string{item.ID}) {
+		t.Errorf("search of the updated content: %v, want [%s]", got, item.ID)
+	}
+	if count := countContents(t, database, item.ID); count != 1 {
+		t.Errorf("%d full-text entries after the update, want 1", count)
+	}
+
+	// Renames update the indexed name
+	item.Name = "quote.txt"
+	item.AbsPath = "/library/docs/quote.txt"
+	if err := repo.Move(item); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RenameContents(item); err != nil {
+		t.Fatal(err)
+	}
+	if got := search("quote"); !reflect.DeepEqual(got, []string{item.ID}) {
+		t.Errorf("search of the new name: %v, want [%s]", got, item.ID)
+	}
+	if got := search("letter"); len(got) != 0 {
+		t.Errorf("previous name still found: %v", got)
+	}
+
+	// Deleted files leave the full-text table
+	if err := repo.Delete(item.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteByPath(other.AbsPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{item.ID, other.ID} {
+		if count := countContents(t, database, id); count != 0 {
+			t.Errorf("%d full-text entries left for the deleted file %s", count, id)
+		}
+	}
+	if got := search("electrician"); len(got) != 0 {
+		t.Errorf("deleted file found: %v", got)
+	}
+}
+
+func TestSearchQueriesAreEscaped(t *testing.T) {
+	database := newTestDatabase(t)
+	requireFullText(t, database)
+	repo := NewFileItemRepository(database)
+
+	item := createTestFile(t, repo, "docs", "/library/docs/notes.txt", `He said "AND then" NEAR the door: it's done`)
+	tests := []struct {
+		query string
+		found bool
+	}{
+		{`"AND then"`, true},
+		{`said "AND`, true},
+		{"AND", true},      // Operators are searched as words
+		{"OR door", false}, // No word starts with "or"
+		{"NEAR(said door)", true},
+		{"NOT door", true}, // Prefix of the name notes.txt
+		{"near door", true},
+		{"content:door", false},
+		{"it's", true},
+		{"door*", true},
+		{"-door", true},
+		{"^said", true},
+		{"(door", true},
+		{`"`, false},
+		{"*", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := searchIDs(t, repo, ListFilters{Query: tt.query})
+			if found := reflect.DeepEqual(got, []string{item.ID}); found != tt.found {
+				t.Errorf("search %q found %v, want found %v", tt.query, got, tt.found)
+			}
+			if _, err := repo.GetGroupedByDate(ListFilters{Query: tt.query}); err != nil {
+				t.Errorf("grouped search %q: %v", tt.query, err)
+			}
+		})
+	}
+}
+
+func TestSearchContentsWithinScopes(t *testing.T) {
+	database := newTestDatabase(t)
+	requireFullText(t, database)
+	repo := NewFileItemRepository(database)
+
+	public := createTestFile(t, repo, "photos", "/library/photos/family/a.txt", "secret recipe")
+	private := createTestFile(t, repo, "photos", "/library/photos/private/b.txt", "secret diary")
+	sibling := createTestFile(t, repo, "photos", "/library/photos/family2/c.txt", "secret plan")
+	scan := createTestFile(t, repo, "scans", "/library/scans/d.txt", "secret scan")
+
+	tests := []struct {
+		name   string
+		scopes []PathScope
+		root   string
+		want   []string
+	}{
+		{"everything", nil, "", []string{public.ID, private.ID, sibling.ID, scan.ID}},
+		{"nothing", []PathScope{}, "", []string{}},
+		{"folder", []PathScope{{RootID: "photos", Dir: "/library/photos/family"}}, "", []string{public.ID}},
+		{"folder with a trailing slash", []PathScope{{RootID: "photos", Dir: "/library/photos/family/"}}, "", []string{public.ID}},
+		{"whole root", []PathScope{{RootID: "scans"}}, "", []string{scan.ID}},
+		{"folder and root", []PathScope{{RootID: "photos", Dir: "/library/photos/private"}, {RootID: "scans"}}, "", []string{private.ID, scan.ID}},
+		{"root filter within scopes", []PathScope{{RootID: "photos", Dir: "/library/photos/private"}, {RootID: "scans"}}, "scans", []string{scan.ID}},
+		{"folder of another root", []PathScope{{RootID: "scans", Dir: "/library/photos/family"}}, "", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := append([]string{}, tt.want...)
+			sort.Strings(want)
+			filters := ListFilters{Query: "secret", Root: tt.root, Scopes: tt.scopes}
+			if got := searchIDs(t, repo, filters); !reflect.DeepEqual(got, want) {
+				t.Errorf("search found %v, want %v", got, want)
+			}
+			for _, item := range []*FileItem{public, private, sibling, scan} {
+				contained, err := repo.Contains(filters, item.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if visible := contains(want, item.ID); contained != visible {
+					t.Errorf("Contains(%s) = %v, want %v", item.ID, contained, visible)
+				}
+			}
+		})
+	}
+}
+
+func contains(ids []string, id string) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
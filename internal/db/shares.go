@@ -0,0 +1,119 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of share links
+const (
+	ShareFile   = "file"   // A single file
+	ShareFilter = "filter" // The files matching filters, such as a date range
+)
+
+// Share is a public link to a file or to a set of files, valid until it expires or is revoked
+type Share struct {
+	ID           string     `gorm:"primaryKey" json:"id"` // Random identifier, part of the token
+	UserID       uint       `gorm:"index" json:"user_id"` // Creator (0 when the authentication is disabled)
+	Kind         string     `gorm:"not null" json:"kind"`
+	Target       string     `gorm:"type:text;not null" json:"-"`    // Signed by the token: the file ID at creation, or the filters as JSON
+	FileID       string     `gorm:"index" json:"file_id,omitempty"` // Shared file, follows it when it is renamed or moved
+	Name         string     `json:"name"`
+	PasswordHash string     `json:"-"` // bcrypt hash (empty: no password)
+	ExpiresAt    time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	Downloads    int64      `gorm:"not null;default:0" json:"downloads"`
+	LastAccessAt *time.Time `json:"last_access_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name
+func (Share) TableName() string {
+	return "shares"
+}
+
+// ShareTarget returns the target of a share of files matching filters (without pagination nor scopes)
+func ShareTarget(filters ListFilters) (string, error) {
+	filters.Page, filters.PageSize, filters.Scopes = 0, 0, nil
+	data, err := json.Marshal(filters)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Filters returns the filters of a share of kind ShareFilter
+func (s *Share) Filters() (ListFilters, error) {
+	var filters ListFilters
+	err := json.Unmarshal([]byte(s.Target), &filters)
+	return filters, err
+}
+
+// Active reports whether a share can still be opened
+func (s *Share) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// deleteFileShares removes the share links of the files matching a condition on file_items, so
+// that a link to a removed file never opens another file indexed later with the same ID
+func deleteFileShares(tx *gorm.DB, condition string, args ...interface{}) error {
+	return tx.Where("file_id IN (SELECT id FROM file_items WHERE "+condition+")", args...).Delete(&Share{}).Error
+}
+
+// shareModels are the tables of the share links, kept when the index is reset
+var shareModels = []interface{}{&Share{}}
+
+// ShareRepository manages the share links
+type ShareRepository struct {
+	db *Database
+}
+
+// NewShareRepository creates a new repository
+func NewShareRepository(db *Database) *ShareRepository {
+	return &ShareRepository{db: db}
+}
+
+// Create stores a new share
+func (r *ShareRepository) Create(share *Share) error {
+	return r.db.Create(share).Error
+}
+
+// Get retrieves a share by its ID
+func (r *ShareRepository) Get(id string) (*Share, error) {
+	var share Share
+	if err := r.db.First(&share, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// List returns all shares, the most recent first
+func (r *ShareRepository) List() ([]Share, error) {
+	var shares []Share
+	err := r.db.Order("created_at DESC").Find(&shares).Error
+	return shares, err
+}
+
+// ListByUser returns the shares created by a user, the most recent first
+func (r *ShareRepository) ListByUser(userID uint) ([]Share, error) {
+	var shares []Share
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&shares).Error
+	return shares, err
+}
+
+// Revoke disables a share (the revocation date of a revoked share is kept)
+func (r *ShareRepository) Revoke(id string) error {
+	return r.db.Model(&Share{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now()).Error
+}
+
+// RecordAccess stores the date of the last opening of a share
+func (r *ShareRepository) RecordAccess(id string) error {
+	return r.db.Model(&Share{}).Where("id = ?", id).Update("last_access_at", time.Now()).Error
+}
+
+// CountDownload increments the number of downloads of a share
+func (r *ShareRepository) CountDownload(id string) error {
+	return r.db.Model(&Share{}).Where("id = ?", id).UpdateColumn("downloads", gorm.Expr("downloads + 1")).Error
+}
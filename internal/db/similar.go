@@ -0,0 +1,68 @@
+package db
+
+// PendingPerceptualHashes returns images with a thumbnail but no perceptual hash yet (indexed
+// before hashes existed), ordered by ID and starting after the given ID
+func (r *FileItemRepository) PendingPerceptualHashes(afterID string, limit int) ([]FileItem, error) {
+	var items []FileItem
+	err := r.db.Select("id, abs_path, thumb_path").
+		Where("perceptual_hash = '' AND thumb_path IS NOT NULL AND thumb_path != '' AND id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&items).Error
+	return items, err
+}
+
+// SetPerceptualHash stores the perceptual hash of an image
+func (r *FileItemRepository) SetPerceptualHash(id, perceptualHash string) error {
+	return r.retryOperation(func() error {
+		return r.db.Model(&FileItem{}).Where("id = ?", id).UpdateColumn("perceptual_hash", perceptualHash).Error
+	})
+}
+
+// PerceptualHashes returns the perceptual hashes of the images matching the filters, by file ID
+func (r *FileItemRepository) PerceptualHashes(filters ListFilters) (map[string]string, error) {
+	var rows []struct {
+		ID             string
+		PerceptualHash string
+	}
+	err := applyFilters(r.db.Model(&FileItem{}), filters, r.searchMatch(filters)).
+		Select("id, perceptual_hash").
+		Where("perceptual_hash != ''").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[string]string, len(rows))
+	for _, row := range rows {
+		hashes[row.ID] = row.PerceptualHash
+	}
+	return hashes, nil
+}
+
+// GetByIDs retrieves files with their annotations, in the order of the given IDs
+func (r *FileItemRepository) GetByIDs(ids []string) ([]FileItem, error) {
+	if len(ids) == 0 {
+		return []FileItem{}, nil
+	}
+
+	var found []FileItem
+	if err := r.db.Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	if err := r.annotations().loadAnnotations(found); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]FileItem, len(found))
+	for _, item := range found {
+		byID[item.ID] = item
+	}
+	items := make([]FileItem, 0, len(found))
+	for _, id := range ids {
+		if item, ok := byID[id]; ok {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DateCandidates stores the dates reported by each date source, as JSON
+type DateCandidates map[string]time.Time
+
+// Value implements driver.Valuer
+func (d DateCandidates) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (d *DateCandidates) Scan(value interface{}) error {
+	return scanJSON(value, d)
+}
+
+// Metadata stores the raw metadata embedded in a file, as JSON
+type Metadata map[string]string
+
+// Value implements driver.Valuer
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (m *Metadata) Scan(value interface{}) error {
+	return scanJSON(value, m)
+}
+
+// scanJSON decodes a JSON column into dest
+func scanJSON(value interface{}, dest interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		if v == "" {
+			return nil
+		}
+		return json.Unmarshal([]byte(v), dest)
+	case []byte:
+		if len(v) == 0 {
+			return nil
+		}
+		return json.Unmarshal(v, dest)
+	default:
+		return fmt.Errorf("unsupported JSON column type: %T", value)
+	}
+}
@@ -0,0 +1,317 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Roles of the users, from the least to the most privileged
+const (
+	RoleViewer   = "viewer"   // Browses, previews and downloads the files
+	RoleUploader = "uploader" // Also uploads and annotates files
+	RoleAdmin    = "admin"    // Also deletes, renames and moves files, rescans the roots and manages the users
+)
+
+// legacyRoleUser is the role of the users created before the viewer and uploader roles
+const legacyRoleUser = "user"
+
+// Providers of the accounts
+const (
+	ProviderLocal = "local" // Password stored in the database
+	ProviderOIDC  = "oidc"  // Single sign-on, created on first login
+)
+
+// ErrUserExists is returned when a username is already taken
+var ErrUserExists = errors.New("username already taken")
+
+// User is an account allowed to use the web UI and the API
+type User struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Username     string     `gorm:"uniqueIndex;not null" json:"username"` // Normalized (trimmed, lowercase)
+	PasswordHash string     `json:"-"`                                    // bcrypt hash (empty: no password login)
+	Role         string     `gorm:"not null;default:'viewer'" json:"role"`
+	Provider     string     `gorm:"not null;default:'local';uniqueIndex:idx_users_identity" json:"provider"`
+	Subject      *string    `gorm:"uniqueIndex:idx_users_identity" json:"-"` // Identifier at the provider (nil for local users)
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+}
+
+// TableName specifies the table name
+func (User) TableName() string {
+	return "users"
+}
+
+// IsAdmin checks if the user manages the other users (administrators are never limited by scopes)
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// Session is a browser login, identified by the hash of its cookie
+type Session struct {
+	ID         string    `gorm:"primaryKey"` // SHA256 of the session cookie
+	UserID     uint      `gorm:"index;not null"`
+	CSRFToken  string    `gorm:"not null"` // Sent back by the browser with the requests changing data
+	ExpiresAt  time.Time `gorm:"index"`
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+// TableName specifies the table name
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// APIToken is a long-lived credential for scripts, identified by the hash of its value
+type APIToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"-"`
+	Name       string     `gorm:"not null" json:"name"`
+	Hash       string     `gorm:"uniqueIndex;not null" json:"-"` // SHA256 of the token
+	Prefix     string     `json:"prefix"`                        // Beginning of the token, to recognize it
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// TableName specifies the table name
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+// Scope limits a user to a folder of a root, with a role in this folder. A user with scopes
+// only accesses the folders of their scopes.
+type Scope struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"index;not null" json:"-"`
+	RootID string `gorm:"not null" json:"root"`
+	Prefix string `gorm:"not null;default:''" json:"prefix"` // Folder in the root, with forward slashes (empty: the whole root)
+	Role   string `gorm:"not null" json:"role"`
+}
+
+// TableName specifies the table name
+func (Scope) TableName() string {
+	return "user_scopes"
+}
+
+// authModels are the tables of the accounts, kept when the index is reset
+var authModels = []interface{}{&User{}, &Session{}, &APIToken{}, &Scope{}}
+
+// migrateRoles gives the uploader role to the users created with the former "user" role,
+// which allowed uploads
+func migrateRoles(db *gorm.DB) error {
+	return db.Model(&User{}).Where("role = ?", legacyRoleUser).Update("role", RoleUploader).Error
+}
+
+// NormalizeUsername trims and lowercases a username
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// UserRepository manages the users, their sessions and their API tokens
+type UserRepository struct {
+	db *Database
+}
+
+// NewUserRepository creates a new repository
+func NewUserRepository(db *Database) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+// Count returns the number of users
+func (r *UserRepository) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&User{}).Count(&count).Error
+	return count, err
+}
+
+// List returns all users ordered by username
+func (r *UserRepository) List() ([]User, error) {
+	var users []User
+	err := r.db.Order("username").Find(&users).Error
+	return users, err
+}
+
+// Create adds a user, failing with ErrUserExists if the username is taken
+func (r *UserRepository) Create(user *User) error {
+	user.Username = NormalizeUsername(user.Username)
+	if _, err := r.GetByUsername(user.Username); err == nil {
+		return ErrUserExists
+	}
+	return r.db.Create(user).Error
+}
+
+// GetByID retrieves a user by its ID
+func (r *UserRepository) GetByID(id uint) (*User, error) {
+	var user User
+	if err := r.db.First(&user, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetByUsername retrieves a user by its username
+func (r *UserRepository) GetByUsername(username string) (*User, error) {
+	var user User
+	if err := r.db.First(&user, "username = ?", NormalizeUsername(username)).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetBySubject retrieves a user by its identifier at a single sign-on provider
+func (r *UserRepository) GetBySubject(provider, subject string) (*User, error) {
+	var user User
+	if err := r.db.First(&user, "provider = ? AND subject = ?", provider, subject).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// AvailableUsername returns the username, or the username with a numeric suffix if it is taken
+func (r *UserRepository) AvailableUsername(username string) string {
+	username = NormalizeUsername(username)
+	candidate := username
+	for n := 2; ; n++ {
+		if _, err := r.GetByUsername(candidate); err != nil {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d", username, n)
+	}
+}
+
+// Update saves the password hash and the role of a user
+func (r *UserRepository) Update(user *User) error {
+	return r.db.Model(user).Select("password_hash", "role", "updated_at").Updates(user).Error
+}
+
+// RecordLogin stores the date of the last login of a user
+func (r *UserRepository) RecordLogin(id uint) error {
+	return r.db.Model(&User{}).Where("id = ?", id).Update("last_login_at", time.Now()).Error
+}
+
+// Delete removes a user with its sessions, tokens, scopes and share links
+func (r *UserRepository) Delete(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&Session{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&APIToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&Scope{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&Share{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&User{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// CreateSession stores a new session
+func (r *UserRepository) CreateSession(session *Session) error {
+	return r.db.Create(session).Error
+}
+
+// GetSession retrieves an unexpired session by the hash of its cookie
+func (r *UserRepository) GetSession(id string) (*Session, error) {
+	var session Session
+	if err := r.db.First(&session, "id = ? AND expires_at > ?", id, time.Now()).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// TouchSession records the activity of a session
+func (r *UserRepository) TouchSession(id string) error {
+	return r.db.Model(&Session{}).Where("id = ?", id).Update("last_seen_at", time.Now()).Error
+}
+
+// DeleteSession removes a session (logout)
+func (r *UserRepository) DeleteSession(id string) error {
+	return r.db.Where("id = ?", id).Delete(&Session{}).Error
+}
+
+// DeleteUserSessions removes the sessions of a user, except one (the current session)
+func (r *UserRepository) DeleteUserSessions(userID uint, except string) error {
+	return r.db.Where("user_id = ? AND id <> ?", userID, except).Delete(&Session{}).Error
+}
+
+// DeleteExpiredSessions removes the expired sessions
+func (r *UserRepository) DeleteExpiredSessions() error {
+	return r.db.Where("expires_at <= ?", time.Now()).Delete(&Session{}).Error
+}
+
+// CreateToken stores a new API token
+func (r *UserRepository) CreateToken(token *APIToken) error {
+	return r.db.Create(token).Error
+}
+
+// GetToken retrieves an unexpired API token by its hash
+func (r *UserRepository) GetToken(hash string) (*APIToken, error) {
+	var token APIToken
+	if err := r.db.First(&token, "hash = ? AND (expires_at IS NULL OR expires_at > ?)", hash, time.Now()).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ListTokens returns the API tokens of a user
+func (r *UserRepository) ListTokens(userID uint) ([]APIToken, error) {
+	var tokens []APIToken
+	err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&tokens).Error
+	return tokens, err
+}
+
+// TouchToken records the use of an API token
+func (r *UserRepository) TouchToken(id uint) error {
+	return r.db.Model(&APIToken{}).Where("id = ?", id).Update("last_used_at", time.Now()).Error
+}
+
+// DeleteToken revokes an API token of a user
+func (r *UserRepository) DeleteToken(userID, id uint) error {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&APIToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListScopes returns the scopes of a user
+func (r *UserRepository) ListScopes(userID uint) ([]Scope, error) {
+	var scopes []Scope
+	err := r.db.Where("user_id = ?", userID).Order("root_id, prefix").Find(&scopes).Error
+	return scopes, err
+}
+
+// SetScopes replaces the scopes of a user (none: no limit)
+func (r *UserRepository) SetScopes(userID uint, scopes []Scope) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&Scope{}).Error; err != nil {
+			return err
+		}
+		for idx := range scopes {
+			scopes[idx].ID = 0
+			scopes[idx].UserID = userID
+			if err := tx.Create(&scopes[idx]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,411 @@
+package uploads
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned by the store
+var (
+	ErrNotFound         = errors.New("upload not found")
+	ErrLocked           = errors.New("upload in use by another request")
+	ErrOffsetMismatch   = errors.New("offset does not match the uploaded size")
+	ErrTooLarge         = errors.New("data beyond the upload length")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrInvalidChecksum  = errors.New("invalid checksum")
+	ErrUnknownAlgorithm = errors.New("unsupported checksum algorithm")
+	ErrCompleted        = errors.New("upload already completed")
+)
+
+// ChecksumAlgorithms are the algorithms accepted to verify the chunks
+var ChecksumAlgorithms = []string{"md5", "sha1", "sha256"}
+
+// Upload is a resumable upload and its state
+type Upload struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`            // Total size announced by the client
+	Offset    int64             `json:"offset"`            // Bytes received (size of the partial file)
+	Metadata  map[string]string `json:"metadata"`          // Upload-Metadata (filename, filetype, lastModified...)
+	OwnerID   uint              `json:"owner_id,omitempty"` // User who created the upload (0 without authentication)
+	Status    string            `json:"status,omitempty"`  // Outcome once complete (created, renamed, overwritten, skipped, failed)
+	Path      string            `json:"path,omitempty"`    // Path of the stored file in its root
+	FileID    string            `json:"file_id,omitempty"` // Indexed file (the existing one if skipped)
+	Error     string            `json:"error,omitempty"`   // Why the file was refused or could not be indexed
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"` // Last received chunk, for the expiry
+}
+
+// Done reports whether all the bytes were received
+func (u *Upload) Done() bool {
+	return u.Offset >= u.Length
+}
+
+// Store keeps the partial files and the state of the uploads in a directory outside the
+// library roots. Uploads without activity during the expiry are removed.
+type Store struct {
+	dir    string
+	expiry time.Duration
+
+	mu     sync.Mutex
+	locked map[string]bool // Uploads receiving data
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewStore creates the directory of the uploads and starts the removal of expired ones
+func NewStore(dir string, expiry time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create the uploads directory: %w", err)
+	}
+
+	s := &Store{
+		dir:    dir,
+		expiry: expiry,
+		locked: make(map[string]bool),
+		stop:   make(chan struct{}),
+	}
+
+	s.RemoveExpired()
+	s.wg.Add(1)
+	go s.expiryWorker()
+
+	return s, nil
+}
+
+// Close stops the removal of expired uploads
+func (s *Store) Close() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// Expiry returns the time after which an upload without activity is removed
+func (s *Store) Expiry() time.Duration {
+	return s.expiry
+}
+
+// ExpiresAt returns when an upload will be removed if no data is received
+func (s *Store) ExpiresAt(upload *Upload) time.Time {
+	return upload.UpdatedAt.Add(s.expiry)
+}
+
+// Create registers a new upload of the given length for a user
+func (s *Store) Create(length int64, metadata map[string]string, ownerID uint) (*Upload, error) {
+	now := time.Now()
+	upload := &Upload{
+		ID:        strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Length:    length,
+		Metadata:  metadata,
+		OwnerID:   ownerID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	file, err := os.OpenFile(s.dataPath(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	if err := s.save(upload); err != nil {
+		os.Remove(s.dataPath(upload.ID))
+		return nil, err
+	}
+	return upload, nil
+}
+
+// Get returns an upload and its current offset
+func (s *Store) Get(id string) (*Upload, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var upload Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("corrupted upload %s: %w", id, err)
+	}
+
+	// The partial file is the reference: it survives interrupted requests and restarts
+	if upload.Status == "" {
+		stat, err := os.Stat(s.dataPath(id))
+		if err != nil {
+			return nil, ErrNotFound
+		}
+		upload.Offset = stat.Size()
+	}
+	return &upload, nil
+}
+
+// Lock reserves an upload for a request writing to it or completing it
+func (s *Store) Lock(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locked[id] {
+		return ErrLocked
+	}
+	s.locked[id] = true
+	return nil
+}
+
+// Unlock releases an upload reserved with Lock
+func (s *Store) Unlock(id string) {
+	s.mu.Lock()
+	delete(s.locked, id)
+	s.mu.Unlock()
+}
+
+// WriteChunk appends the body of a request at the given offset. Without checksum, the bytes
+// received before an interruption are kept so that the client can resume from them. With a
+// checksum ("<algorithm> <base64 digest>"), the chunk is discarded unless it matches.
+// The upload must be locked.
+func (s *Store) WriteChunk(upload *Upload, offset int64, body io.Reader, checksum string) (int64, error) {
+	if upload.Status != "" {
+		return 0, ErrCompleted
+	}
+	if offset != upload.Offset {
+		return 0, ErrOffsetMismatch
+	}
+
+	var digest hash.Hash
+	var expected []byte
+	if checksum != "" {
+		var err error
+		if digest, expected, err = parseChecksum(checksum); err != nil {
+			return 0, err
+		}
+	}
+
+	file, err := os.OpenFile(s.dataPath(upload.ID), os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// One extra byte to detect data beyond the announced length
+	remaining := upload.Length - offset
+	var writer io.Writer = file
+	if digest != nil {
+		writer = io.MultiWriter(file, digest)
+	}
+	written, copyErr := io.Copy(writer, io.LimitReader(body, remaining+1))
+
+	if written > remaining {
+		copyErr = ErrTooLarge
+	} else if copyErr == nil && digest != nil && !bytes.Equal(digest.Sum(nil), expected) {
+		copyErr = ErrChecksumMismatch
+	}
+	if copyErr != nil && (digest != nil || written > remaining) {
+		// Back to the last verified offset
+		if err := file.Truncate(offset); err != nil {
+			return 0, err
+		}
+		written = 0
+	}
+
+	upload.Offset = offset + written
+	if written > 0 {
+		upload.UpdatedAt = time.Now()
+		if err := s.save(upload); err != nil {
+			return upload.Offset, err
+		}
+	}
+	return upload.Offset, copyErr
+}
+
+// DataPath returns the partial file of an upload, to be moved once complete
+func (s *Store) DataPath(upload *Upload) string {
+	return s.dataPath(upload.ID)
+}
+
+// Outcome is what became of a complete upload
+type Outcome struct {
+	Status string // created, renamed, overwritten, skipped or failed (content refused)
+	Path   string // Path of the file in its root
+	FileID string // Indexed file (empty if it could not be indexed)
+	Reason string // Why the file was skipped, refused or not indexed
+}
+
+// Complete records the outcome of a complete upload and removes its partial file, if it was
+// not moved. The state is kept until the expiry so that clients can retrieve the file.
+func (s *Store) Complete(upload *Upload, outcome Outcome) error {
+	upload.Status = outcome.Status
+	upload.Path = outcome.Path
+	upload.FileID = outcome.FileID
+	upload.Error = outcome.Reason
+	upload.UpdatedAt = time.Now()
+	if err := s.save(upload); err != nil {
+		return err
+	}
+	if err := os.Remove(s.dataPath(upload.ID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Delete removes an upload and its partial file
+func (s *Store) Delete(id string) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+	if err := os.Remove(s.infoPath(id)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if err := os.Remove(s.dataPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RemoveExpired removes the uploads without activity during the expiry
+func (s *Store) RemoveExpired() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		log.Printf("Error listing the uploads: %v", err)
+		return
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".info")
+		if !ok {
+			continue
+		}
+
+		if s.Lock(id) != nil {
+			continue // Receiving data
+		}
+		// Uploads whose state cannot be read are removed as well
+		if upload, err := s.Get(id); err != nil || !time.Now().Before(s.ExpiresAt(upload)) {
+			if err := s.Delete(id); err != nil && err != ErrNotFound {
+				log.Printf("Error removing the expired upload %s: %v", id, err)
+			} else {
+				removed++
+			}
+		}
+		s.Unlock(id)
+	}
+
+	// Partial files whose state was lost
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".bin")
+		if !ok {
+			continue
+		}
+		if _, err := os.Stat(s.infoPath(id)); os.IsNotExist(err) {
+			os.Remove(s.dataPath(id))
+		}
+	}
+
+	if removed > 0 {
+		log.Printf("Expired uploads removed: %d", removed)
+	}
+}
+
+// expiryWorker removes the expired uploads periodically
+func (s *Store) expiryWorker() {
+	defer s.wg.Done()
+
+	interval := s.expiry / 4
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.RemoveExpired()
+		}
+	}
+}
+
+// save writes the state of an upload atomically
+func (s *Store) save(upload *Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	tmp := s.infoPath(upload.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.infoPath(upload.ID))
+}
+
+func (s *Store) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".info")
+}
+
+func (s *Store) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+// validID checks that an ID sent by a client cannot designate another file
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseChecksum parses an Upload-Checksum header ("<algorithm> <base64 digest>")
+func parseChecksum(value string) (hash.Hash, []byte, error) {
+	algorithm, encoded, ok := strings.Cut(strings.TrimSpace(value), " ")
+	if !ok {
+		return nil, nil, ErrInvalidChecksum
+	}
+	expected, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, nil, ErrInvalidChecksum
+	}
+
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New(), expected, nil
+	case "sha1":
+		return sha1.New(), expected, nil
+	case "sha256":
+		return sha256.New(), expected, nil
+	default:
+		return nil, nil, ErrUnknownAlgorithm
+	}
+}
@@ -0,0 +1,287 @@
+package web
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/content"
+	"tokilane/internal/db"
+)
+
+// Maximum length of a note
+const maxNoteLength = 10000
+
+// tagsRequest is the body of the requests setting or adding tags
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+	Tag  string   `json:"tag"`
+}
+
+// noteRequest is the body of the requests creating or updating a note
+type noteRequest struct {
+	Body string `json:"body"`
+}
+
+// annotatedFile retrieves the file of the request, or the status and reason of the refusal.
+// Before a change, it records the anchor of the file, so that its annotations follow it if it
+// is re-indexed or renamed.
+func (h *Handlers) annotatedFile(c echo.Context) (*db.FileItem, int, error) {
+	action := ActionView
+	if c.Request().Method != http.MethodGet {
+		action = ActionAnnotate
+	}
+	item, status, err := h.fileForAction(c, action)
+	if err != nil {
+		return nil, status, err
+	}
+
+	if action == ActionAnnotate {
+		h.saveAnchor(item)
+	}
+
+	return item, http.StatusOK, nil
+}
+
+// saveAnchor records the location and fingerprint of a file about to be annotated
+func (h *Handlers) saveAnchor(item *db.FileItem) {
+	fingerprint, _ := content.AnchorFingerprint(item)
+	if err := h.annotations.SaveAnchor(item, fingerprint); err != nil {
+		log.Printf("Error saving the annotation anchor of %s: %v", item.AbsPath, err)
+	}
+}
+
+// respondAnnotations returns the annotations of a file
+func (h *Handlers) respondAnnotations(c echo.Context, fileID string) error {
+	annotations, err := h.annotations.Get(fileID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error retrieving annotations",
+		})
+	}
+	return c.JSON(http.StatusOK, annotations)
+}
+
+// normalizeTags normalizes and deduplicates tag names
+func normalizeTags(names []string) ([]string, bool) {
+	seen := make(map[string]bool)
+	tags := make([]string, 0, len(names))
+	for _, name := range names {
+		tag := db.NormalizeTag(name)
+		if tag == "" {
+			return nil, false
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags, true
+}
+
+// ListTags returns all tags with their number of files
+func (h *Handlers) ListTags(c echo.Context) error {
+	tags, err := h.annotations.ListTags(h.visibleScopes(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error retrieving tags",
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"tags": tags,
+	})
+}
+
+// GetFileTags returns the tags of a file
+func (h *Handlers) GetFileTags(c echo.Context) error {
+	item, status, err := h.annotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	return h.respondAnnotations(c, item.ID)
+}
+
+// SetFileTags replaces the tags of a file (PUT) or adds tags to it (POST)
+func (h *Handlers) SetFileTags(c echo.Context) error {
+	var request tagsRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request",
+		})
+	}
+	names := request.Tags
+	if request.Tag != "" {
+		names = append(names, request.Tag)
+	}
+	tags, ok := normalizeTags(names)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid tag name",
+		})
+	}
+
+	item, status, err := h.annotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if c.Request().Method == http.MethodPut {
+		err = h.annotations.SetTags(item.ID, tags)
+	} else {
+		for _, tag := range tags {
+			if err = h.annotations.AddTag(item.ID, tag); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error saving tags",
+		})
+	}
+
+	return h.respondAnnotations(c, item.ID)
+}
+
+// DeleteFileTag removes a tag from a file
+func (h *Handlers) DeleteFileTag(c echo.Context) error {
+	item, status, err := h.annotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.annotations.RemoveTag(item.ID, db.NormalizeTag(c.Param("tag"))); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error removing tag",
+		})
+	}
+
+	return h.respondAnnotations(c, item.ID)
+}
+
+// SetFileFavorite stars (PUT) or unstars (DELETE) a file
+func (h *Handlers) SetFileFavorite(c echo.Context) error {
+	item, status, err := h.annotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.annotations.SetFavorite(item.ID, c.Request().Method != http.MethodDelete); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error saving favorite",
+		})
+	}
+
+	return h.respondAnnotations(c, item.ID)
+}
+
+// GetFileNotes returns the notes of a file
+func (h *Handlers) GetFileNotes(c echo.Context) error {
+	item, status, err := h.annotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	return h.respondAnnotations(c, item.ID)
+}
+
+// CreateFileNote adds a note to a file
+func (h *Handlers) CreateFileNote(c echo.Context) error {
+	body, ok := bindNoteBody(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid note",
+		})
+	}
+
+	item, status, err := h.annotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	note := &db.Note{FileID: item.ID, Body: body}
+	if err := h.annotations.CreateNote(note); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error saving note",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, note)
+}
+
+// UpdateFileNote replaces the text of a note
+func (h *Handlers) UpdateFileNote(c echo.Context) error {
+	body, ok := bindNoteBody(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid note",
+		})
+	}
+
+	item, status, err := h.annotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	noteID, _ := strconv.ParseUint(c.Param("noteId"), 10, 64)
+	note, err := h.annotations.GetNote(item.ID, uint(noteID))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Note not found",
+		})
+	}
+
+	note.Body = body
+	if err := h.annotations.UpdateNote(note); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error saving note",
+		})
+	}
+
+	return c.JSON(http.StatusOK, note)
+}
+
+// DeleteFileNote removes a note
+func (h *Handlers) DeleteFileNote(c echo.Context) error {
+	item, status, err := h.annotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	noteID, _ := strconv.ParseUint(c.Param("noteId"), 10, 64)
+	if err := h.annotations.DeleteNote(item.ID, uint(noteID)); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error removing note",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// bindNoteBody reads and validates the text of a note
+func bindNoteBody(c echo.Context) (string, bool) {
+	var request noteRequest
+	if err := c.Bind(&request); err != nil {
+		return "", false
+	}
+	body := strings.TrimSpace(request.Body)
+	return body, body != "" && len(body) <= maxNoteLength
+}
@@ -0,0 +1,225 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/db"
+)
+
+// indexTestFile writes and indexes a file of the root of an upload test
+func (u *uploadTest) indexTestFile(t *testing.T, rel, data string) *db.FileItem {
+	t.Helper()
+	path := filepath.Join(u.rootPath, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	item, err := u.handlers.indexer.IndexPath(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+// annotate calls a handler of the annotations of a file as a user and returns the response
+func annotate(t *testing.T, h *Handlers, identity *Identity, method string, handler echo.HandlerFunc, params map[string]string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, "/api/files/"+params["id"], strings.NewReader(body))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(request, rec)
+	var names, values []string
+	for name, value := range params {
+		names, values = append(names, name), append(values, value)
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	c.Set(contextIdentity, identity)
+	if err := handler(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// decodeAnnotations reads the annotations of a response
+func decodeAnnotations(t *testing.T, rec *httptest.ResponseRecorder) db.Annotations {
+	t.Helper()
+	var annotations db.Annotations
+	if err := json.Unmarshal(rec.Body.Bytes(), &annotations); err != nil {
+		t.Fatalf("invalid annotations %q: %v", rec.Body.String(), err)
+	}
+	return annotations
+}
+
+func TestFileAnnotations(t *testing.T) {
+	u := newUploadTest(t)
+	h := u.handlers
+	uploader := &Identity{User: &db.User{ID: 1, Username: "alice", Role: db.RoleUploader}}
+	item := u.indexTestFile(t, "notes.txt", "some notes")
+	file := map[string]string{"id": item.ID}
+	tags := func(rec *httptest.ResponseRecorder) []string {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+		}
+		return decodeAnnotations(t, rec).Tags
+	}
+
+	// Tags are normalized, replaced, added and removed
+	if got := tags(annotate(t, h, uploader, http.MethodPut, h.SetFileTags, file, `{"tags":[" Holidays ","beach","holidays"]}`)); !reflect.DeepEqual(got, []string{"beach", "holidays"}) {
+		t.Errorf("tags %v after the replacement", got)
+	}
+	if got := tags(annotate(t, h, uploader, http.MethodPost, h.SetFileTags, file, `{"tag":"Family"}`)); !reflect.DeepEqual(got, []string{"beach", "family", "holidays"}) {
+		t.Errorf("tags %v after the addition", got)
+	}
+	if got := tags(annotate(t, h, uploader, http.MethodDelete, h.DeleteFileTag, map[string]string{"id": item.ID, "tag": "Beach"}, "")); !reflect.DeepEqual(got, []string{"family", "holidays"}) {
+		t.Errorf("tags %v after the removal", got)
+	}
+	if rec := annotate(t, h, uploader, http.MethodPost, h.SetFileTags, file, `{"tag":"   "}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty tag: status %d, want 400", rec.Code)
+	}
+
+	// Favourites
+	if rec := annotate(t, h, uploader, http.MethodPut, h.SetFileFavorite, file, ""); !decodeAnnotations(t, rec).Favorite {
+		t.Error("file not starred")
+	}
+	if rec := annotate(t, h, uploader, http.MethodDelete, h.SetFileFavorite, file, ""); decodeAnnotations(t, rec).Favorite {
+		t.Error("file still starred")
+	}
+
+	// Notes
+	rec := annotate(t, h, uploader, http.MethodPost, h.CreateFileNote, file, `{"body":" To print "}`)
+	var note db.Note
+	if err := json.Unmarshal(rec.Body.Bytes(), &note); err != nil || rec.Code != http.StatusCreated || note.Body != "To print" {
+		t.Fatalf("note creation: status %d %s", rec.Code, rec.Body.String())
+	}
+	noteParams := map[string]string{"id": item.ID, "noteId": fmt.Sprint(note.ID)}
+	if rec := annotate(t, h, uploader, http.MethodPut, h.UpdateFileNote, noteParams, `{"body":"Printed"}`); rec.Code != http.StatusOK {
+		t.Errorf("note update: status %d", rec.Code)
+	}
+	if rec := annotate(t, h, uploader, http.MethodPut, h.UpdateFileNote, map[string]string{"id": item.ID, "noteId": "999"}, `{"body":"Printed"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("update of an unknown note: status %d, want 404", rec.Code)
+	}
+	if rec := annotate(t, h, uploader, http.MethodPost, h.CreateFileNote, file, `{"body":"  "}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty note: status %d, want 400", rec.Code)
+	}
+	if rec := annotate(t, h, uploader, http.MethodPost, h.CreateFileNote, file, fmt.Sprintf(`{"body":%q}`, strings.Repeat("a", maxNoteLength+1))); rec.Code != http.StatusBadRequest {
+		t.Errorf("note too long: status %d, want 400", rec.Code)
+	}
+	annotations := decodeAnnotations(t, annotate(t, h, uploader, http.MethodGet, h.GetFileNotes, file, ""))
+	if len(annotations.Notes) != 1 || annotations.Notes[0].Body != "Printed" {
+		t.Errorf("notes %+v, want the updated note", annotations.Notes)
+	}
+
+	// Annotations follow a renamed file
+	admin := &Identity{User: &db.User{ID: 2, Username: "admin", Role: db.RoleAdmin}}
+	if rec := annotate(t, h, admin, http.MethodPatch, h.RenameFile, file, `{"name":"printed.txt"}`); rec.Code != http.StatusOK {
+		t.Fatalf("rename: status %d %s", rec.Code, rec.Body.String())
+	}
+	renamed, err := u.repo.GetByPath(filepath.Join(u.rootPath, "printed.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotations = decodeAnnotations(t, annotate(t, h, uploader, http.MethodGet, h.GetFileTags, map[string]string{"id": renamed.ID}, ""))
+	if !reflect.DeepEqual(annotations.Tags, []string{"family", "holidays"}) || len(annotations.Notes) != 1 {
+		t.Errorf("annotations %+v after the rename", annotations)
+	}
+
+	if rec := annotate(t, h, uploader, http.MethodDelete, h.DeleteFileNote, map[string]string{"id": renamed.ID, "noteId": fmt.Sprint(note.ID)}, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("note deletion: status %d", rec.Code)
+	}
+	if annotations := decodeAnnotations(t, annotate(t, h, uploader, http.MethodGet, h.GetFileNotes, map[string]string{"id": renamed.ID}, "")); len(annotations.Notes) != 0 {
+		t.Errorf("notes %+v after the deletion", annotations.Notes)
+	}
+}
+
+func TestFileAnnotationPermissions(t *testing.T) {
+	u := newUploadTest(t)
+	h := u.handlers
+	shared := u.indexTestFile(t, "shared/a.txt", "a")
+	private := u.indexTestFile(t, "private/b.txt", "b")
+	other := u.indexTestFile(t, "shared/c.txt", "c")
+	if err := h.annotations.AddTag(shared.ID, "original"); err != nil {
+		t.Fatal(err)
+	}
+
+	viewer := &Identity{User: &db.User{ID: 1, Username: "viewer", Role: db.RoleViewer}}
+	uploader := &Identity{User: &db.User{ID: 2, Username: "uploader", Role: db.RoleUploader}}
+	scoped := &Identity{
+		User: &db.User{ID: 3, Username: "scoped", Role: db.RoleUploader},
+		Scopes: []db.Scope{
+			{RootID: "files", Prefix: "shared", Role: db.RoleViewer},
+			{RootID: "files", Prefix: "private", Role: db.RoleUploader},
+		},
+	}
+	outsider := &Identity{
+		User:   &db.User{ID: 4, Username: "outsider", Role: db.RoleUploader},
+		Scopes: []db.Scope{{RootID: "files", Prefix: "private", Role: db.RoleUploader}},
+	}
+
+	requests := []struct {
+		name    string
+		method  string
+		handler echo.HandlerFunc
+		body    string
+	}{
+		{"read", http.MethodGet, h.GetFileTags, ""},
+		{"tag", http.MethodPost, h.SetFileTags, `{"tag":"changed"}`},
+		{"untag", http.MethodDelete, h.DeleteFileTag, ""},
+		{"star", http.MethodPut, h.SetFileFavorite, ""},
+		{"note", http.MethodPost, h.CreateFileNote, `{"body":"changed"}`},
+	}
+	tests := []struct {
+		name     string
+		identity *Identity
+		file     *db.FileItem
+		read     int // Status of a read
+		write    int // Status of a change
+	}{
+		{"viewer", viewer, shared, http.StatusOK, http.StatusForbidden},
+		{"uploader", uploader, other, http.StatusOK, http.StatusOK},
+		{"viewer in a folder", scoped, shared, http.StatusOK, http.StatusForbidden},
+		{"uploader in a folder", scoped, private, http.StatusOK, http.StatusOK},
+		{"file not visible", outsider, shared, http.StatusNotFound, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		for _, request := range requests {
+			t.Run(tt.name+" "+request.name, func(t *testing.T) {
+				want := tt.write
+				if request.method == http.MethodGet {
+					want = tt.read
+				}
+				params := map[string]string{"id": tt.file.ID, "tag": "original"}
+				rec := annotate(t, h, tt.identity, request.method, request.handler, params, request.body)
+				if rec.Code == http.StatusCreated {
+					rec.Code = http.StatusOK
+				}
+				if rec.Code != want {
+					t.Errorf("status %d, want %d", rec.Code, want)
+				}
+			})
+		}
+	}
+
+	// Refused changes leave the annotations as they were
+	annotations, err := h.annotations.Get(shared.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotations.Tags) != 1 || annotations.Tags[0] != "original" || annotations.Favorite || len(annotations.Notes) != 0 {
+		t.Errorf("annotations %+v changed by refused requests", annotations)
+	}
+}
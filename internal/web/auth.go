@@ -0,0 +1,374 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+
+	"tokilane/internal/config"
+	"tokilane/internal/db"
+)
+
+// Names of the cookies and headers of the authentication
+const (
+	sessionCookie = "tokilane_session"
+	csrfCookie    = "tokilane_csrf" // Readable by the frontend, which sends it back in csrfHeader
+	csrfHeader    = "X-CSRF-Token"
+	tokenPrefix   = "tkl_" // Prefix of the API tokens, to recognize them in scripts and logs
+)
+
+// Minimum length of a password
+const minPasswordLength = 8
+
+// Delay between two updates of the last activity of a session or token
+const activityInterval = time.Minute
+
+// Context key of the identity of an authenticated request
+const contextIdentity = "identity"
+
+// Errors of the authentication
+var (
+	errInvalidCredentials = errors.New("Invalid username or password")
+	errTooManyLogins      = errors.New("Too many failed logins, try again later")
+	errInvalidToken       = errors.New("Invalid or expired token")
+)
+
+// dummyHash is compared with the password of unknown users, so that their login takes
+// as long as the one of existing users
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("tokilane-dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// Identity is the user of a request and the credentials it was authenticated with
+type Identity struct {
+	User    *db.User
+	Session *db.Session // Browser session (nil for an API token), whose CSRF token is checked
+	Scopes  []db.Scope  // Folders the user is limited to (none: no limit)
+}
+
+// Authenticator identifies the user of a request from one kind of credentials. It returns
+// nil without error when the request does not carry its credentials, so that the next
+// authenticator is tried.
+type Authenticator interface {
+	Authenticate(c echo.Context) (*Identity, error)
+}
+
+// Auth guards the API and the files with the configured authenticators
+type Auth struct {
+	config         *config.Config
+	users          *db.UserRepository
+	authenticators []Authenticator
+	failures       *unlockFailures // Failed logins, by username and by client address
+}
+
+// NewAuth creates the authentication with the session cookies and the API tokens
+func NewAuth(cfg *config.Config, users *db.UserRepository) *Auth {
+	a := &Auth{config: cfg, users: users, failures: newUnlockFailures()}
+	a.Use(&sessionAuthenticator{auth: a})
+	a.Use(&tokenAuthenticator{users: users})
+	return a
+}
+
+// Use adds an authenticator, tried after the previous ones
+func (a *Auth) Use(authenticator Authenticator) {
+	a.authenticators = append(a.authenticators, authenticator)
+}
+
+// Enabled reports whether a login is required
+func (a *Auth) Enabled() bool {
+	return a.config.AuthEnabled
+}
+
+// Bootstrap creates the administrator account when there is no user yet
+func (a *Auth) Bootstrap() error {
+	count, err := a.users.Count()
+	if err != nil || count > 0 {
+		return err
+	}
+
+	password := a.config.AuthAdminPassword
+	generated := password == ""
+	if generated {
+		if password, err = randomToken(12); err != nil {
+			return err
+		}
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	admin := &db.User{Username: a.config.AuthAdminUser, PasswordHash: hash, Role: db.RoleAdmin}
+	if err := a.users.Create(admin); err != nil {
+		return err
+	}
+	if generated {
+		log.Printf("Administrator account created: %s / %s (change this password)", admin.Username, password)
+	} else {
+		log.Printf("Administrator account created: %s", admin.Username)
+	}
+	return nil
+}
+
+// Identify returns the identity of a request with the scopes of its user, nil if it carries
+// no credentials
+func (a *Auth) Identify(c echo.Context) (*Identity, error) {
+	for _, authenticator := range a.authenticators {
+		identity, err := authenticator.Authenticate(c)
+		if err != nil {
+			return nil, err
+		}
+		if identity == nil {
+			continue
+		}
+
+		if !identity.User.IsAdmin() {
+			if identity.Scopes, err = a.users.ListScopes(identity.User.ID); err != nil {
+				return nil, err
+			}
+		}
+		return identity, nil
+	}
+	return nil, nil
+}
+
+// Middleware rejects the requests without valid credentials, and the requests changing
+// data with a session cookie but without its CSRF token
+func (a *Auth) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !a.Enabled() {
+				return next(c)
+			}
+
+			identity, err := a.Identify(c)
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": err.Error(),
+				})
+			}
+			if identity == nil {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "Authentication required",
+				})
+			}
+
+			if identity.Session != nil && !safeMethod(c.Request().Method) {
+				sent := c.Request().Header.Get(csrfHeader)
+				if subtle.ConstantTimeCompare([]byte(sent), []byte(identity.Session.CSRFToken)) != 1 {
+					return c.JSON(http.StatusForbidden, map[string]string{
+						"error": "Invalid CSRF token",
+					})
+				}
+			}
+
+			c.Set(contextIdentity, identity)
+			return next(c)
+		}
+	}
+}
+
+// StartSession logs a user in: it stores a new session and sets its cookies
+func (a *Auth) StartSession(c echo.Context, user *db.User) (*db.Session, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &db.Session{
+		ID:         hashToken(secret),
+		UserID:     user.ID,
+		CSRFToken:  csrf,
+		ExpiresAt:  now.Add(time.Duration(a.config.SessionLifetime) * time.Hour),
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	if err := a.users.CreateSession(session); err != nil {
+		return nil, err
+	}
+	if err := a.users.RecordLogin(user.ID); err != nil {
+		log.Printf("Error recording the login of %s: %v", user.Username, err)
+	}
+	if err := a.users.DeleteExpiredSessions(); err != nil {
+		log.Printf("Error removing the expired sessions: %v", err)
+	}
+
+	a.setCookie(c, sessionCookie, secret, session.ExpiresAt, true)
+	a.setCookie(c, csrfCookie, csrf, session.ExpiresAt, false)
+	return session, nil
+}
+
+// EndSession logs the current session out and clears its cookies
+func (a *Auth) EndSession(c echo.Context) error {
+	if identity := currentIdentity(c); identity != nil && identity.Session != nil {
+		if err := a.users.DeleteSession(identity.Session.ID); err != nil {
+			return err
+		}
+	}
+	a.setCookie(c, sessionCookie, "", time.Unix(0, 0), true)
+	a.setCookie(c, csrfCookie, "", time.Unix(0, 0), false)
+	return nil
+}
+
+// setCookie sets a cookie of the authentication (removed if it expires in the past)
+func (a *Auth) setCookie(c echo.Context, name, value string, expires time.Time, httpOnly bool) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: httpOnly,
+		Secure:   a.config.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if !expires.After(time.Now()) {
+		cookie.MaxAge = -1
+	}
+	c.SetCookie(cookie)
+}
+
+// sessionAuthenticator identifies the browsers by their session cookie
+type sessionAuthenticator struct {
+	auth *Auth
+}
+
+// Authenticate implements Authenticator
+func (s *sessionAuthenticator) Authenticate(c echo.Context) (*Identity, error) {
+	cookie, err := c.Cookie(sessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+
+	session, err := s.auth.users.GetSession(hashToken(cookie.Value))
+	if err != nil {
+		// Expired or logged out: the browser must log in again
+		return nil, nil
+	}
+	user, err := s.auth.users.GetByID(session.UserID)
+	if err != nil {
+		return nil, nil
+	}
+
+	if time.Since(session.LastSeenAt) > activityInterval {
+		if err := s.auth.users.TouchSession(session.ID); err != nil {
+			log.Printf("Error updating the session of %s: %v", user.Username, err)
+		}
+	}
+	return &Identity{User: user, Session: session}, nil
+}
+
+// tokenAuthenticator identifies the scripts by their API token (Authorization: Bearer)
+type tokenAuthenticator struct {
+	users *db.UserRepository
+}
+
+// Authenticate implements Authenticator
+func (t *tokenAuthenticator) Authenticate(c echo.Context) (*Identity, error) {
+	scheme, value, ok := strings.Cut(c.Request().Header.Get(echo.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || !strings.HasPrefix(strings.TrimSpace(value), tokenPrefix) {
+		return nil, nil
+	}
+
+	token, err := t.users.GetToken(hashToken(strings.TrimSpace(value)))
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	user, err := t.users.GetByID(token.UserID)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > activityInterval {
+		if err := t.users.TouchToken(token.ID); err != nil {
+			log.Printf("Error updating the token %s: %v", token.Prefix, err)
+		}
+	}
+	return &Identity{User: user}, nil
+}
+
+// currentIdentity returns the identity set by the middleware (nil without authentication)
+func currentIdentity(c echo.Context) *Identity {
+	identity, _ := c.Get(contextIdentity).(*Identity)
+	return identity
+}
+
+// currentUser returns the authenticated user of a request (nil without authentication)
+func currentUser(c echo.Context) *db.User {
+	if identity := currentIdentity(c); identity != nil {
+		return identity.User
+	}
+	return nil
+}
+
+// HashPassword hashes a password with bcrypt
+func HashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("Password too short (%d characters minimum)", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// checkPassword compares a password with the hash of a user (nil for an unknown user)
+func checkPassword(user *db.User, password string) bool {
+	if user == nil || user.PasswordHash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
+// newAPIToken generates the value of an API token
+func newAPIToken() (string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	return tokenPrefix + secret, nil
+}
+
+// randomToken returns n random bytes encoded for cookies and headers
+func randomToken(n int) (string, error) {
+	buffer := make([]byte, n)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+// hashToken returns the hash stored in place of a session or API token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// safeMethod reports whether a request method does not change data
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,294 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/content"
+	"tokilane/internal/db"
+)
+
+// Interval between keep-alive comments sent on idle streams
+const eventHeartbeatInterval = 30 * time.Second
+
+// Number of messages a client can lag behind before being disconnected
+const eventClientBufferSize = 64
+
+// eventPayload is the JSON data of a file event sent to browsers
+type eventPayload struct {
+	Type    string               `json:"type"`
+	FileID  string               `json:"file_id"`
+	RootID  string               `json:"root_id,omitempty"`
+	Ext     string               `json:"ext,omitempty"`
+	Path    string               `json:"path,omitempty"`     // New path of a moved file
+	OldPath string               `json:"old_path,omitempty"` // Previous path of a moved file
+	File    *db.FileItemResponse `json:"file,omitempty"`
+}
+
+// eventMessage is a published event with its sequence ID
+type eventMessage struct {
+	ID        uint64
+	Type      string
+	RootID    string
+	Ext       string
+	Path      string // Absolute path of the file
+	OldRootID string // Root of the previous path of a moved file
+	OldPath   string // Previous path of a moved file
+	Data      []byte
+	Redacted  []byte // Data without the previous path, for the clients who may not see it
+}
+
+// eventClient is a subscriber of the event stream
+type eventClient struct {
+	messages chan eventMessage
+	root     string
+	ext      string
+	visible  func(rootID, path string) bool // Files the user may see (nil: all)
+}
+
+// matches checks if a message passes the filters of the client
+func (c *eventClient) matches(message eventMessage) bool {
+	if c.root != "" && c.root != message.RootID {
+		return false
+	}
+	if c.ext != "" && !strings.EqualFold(c.ext, message.Ext) {
+		return false
+	}
+	if c.visible != nil && !c.visible(message.RootID, message.Path) {
+		return false
+	}
+	return true
+}
+
+// prepare returns the message as sent to the client: the previous path of a moved file is
+// only given to the clients who may see it
+func (c *eventClient) prepare(message eventMessage) eventMessage {
+	if message.OldPath != "" && c.visible != nil && !c.visible(message.OldRootID, message.OldPath) {
+		message.Data = message.Redacted
+	}
+	return message
+}
+
+// EventBroker fans file events out to the connected clients and keeps the
+// latest ones so reconnecting clients can resume with Last-Event-ID
+type EventBroker struct {
+	mu         sync.Mutex
+	lastID     uint64
+	replay     []eventMessage // Ring buffer of the latest messages
+	replayNext int
+	replaySize int
+	clients    map[*eventClient]struct{}
+	slow       uint64 // Clients disconnected for lagging behind
+}
+
+// NewEventBroker creates a broker keeping the given number of events for replay
+func NewEventBroker(replaySize int) *EventBroker {
+	if replaySize < 1 {
+		replaySize = 1
+	}
+	return &EventBroker{
+		replay:  make([]eventMessage, replaySize),
+		clients: make(map[*eventClient]struct{}),
+	}
+}
+
+// Publish sends a file event to all the matching clients.
+// Clients too slow to keep up are disconnected and resume from the replay buffer.
+func (b *EventBroker) Publish(event content.FileEvent) {
+	payload := eventPayload{
+		Type:   event.Type,
+		FileID: event.FileID,
+	}
+	if event.OldPath != "" {
+		payload.Path = event.FilePath
+		payload.OldPath = event.OldPath
+	}
+	if event.FileItem != nil {
+		response := event.FileItem.ToResponse()
+		payload.RootID = event.FileItem.RootID
+		payload.Ext = event.FileItem.Ext
+		payload.File = &response
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding event: %v", err)
+		return
+	}
+	redacted := data
+	if payload.OldPath != "" {
+		payload.OldPath = ""
+		if redacted, err = json.Marshal(payload); err != nil {
+			log.Printf("Error encoding event: %v", err)
+			return
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	message := eventMessage{
+		ID:        b.lastID,
+		Type:      payload.Type,
+		RootID:    payload.RootID,
+		Ext:       payload.Ext,
+		Path:      event.FilePath,
+		OldRootID: event.OldRootID,
+		OldPath:   event.OldPath,
+		Data:      data,
+		Redacted:  redacted,
+	}
+
+	b.replay[b.replayNext] = message
+	b.replayNext = (b.replayNext + 1) % len(b.replay)
+	if b.replaySize < len(b.replay) {
+		b.replaySize++
+	}
+
+	for client := range b.clients {
+		if !client.matches(message) {
+			continue
+		}
+		select {
+		case client.messages <- client.prepare(message):
+		default:
+			delete(b.clients, client)
+			close(client.messages)
+			b.slow++
+		}
+	}
+}
+
+// subscribe registers a client and returns the buffered messages following lastID
+func (b *EventBroker) subscribe(root, ext string, visible func(rootID, path string) bool, lastID uint64) (*eventClient, []eventMessage) {
+	client := &eventClient{
+		messages: make(chan eventMessage, eventClientBufferSize),
+		root:     root,
+		ext:      ext,
+		visible:  visible,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var missed []eventMessage
+	if lastID > 0 {
+		start := (b.replayNext - b.replaySize + len(b.replay)) % len(b.replay)
+		for i := 0; i < b.replaySize; i++ {
+			message := b.replay[(start+i)%len(b.replay)]
+			if message.ID > lastID && client.matches(message) {
+				missed = append(missed, client.prepare(message))
+			}
+		}
+	}
+
+	b.clients[client] = struct{}{}
+	return client, missed
+}
+
+// unsubscribe removes a client
+func (b *EventBroker) unsubscribe(client *eventClient) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.clients[client]; ok {
+		delete(b.clients, client)
+		close(client.messages)
+	}
+}
+
+// ClientCount returns the number of connected clients
+func (b *EventBroker) ClientCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
+
+// SlowDisconnects returns the number of clients disconnected for lagging behind
+func (b *EventBroker) SlowDisconnects() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.slow
+}
+
+// StreamEvents streams file events to the browser using Server-Sent Events.
+// Query parameters root and ext filter the events, Last-Event-ID resumes a stream.
+func (h *Handlers) StreamEvents(c echo.Context) error {
+	flusher, ok := c.Response().Writer.(http.Flusher)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Streaming not supported",
+		})
+	}
+
+	lastEventID := c.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.QueryParam("last_event_id")
+	}
+	lastID, _ := strconv.ParseUint(lastEventID, 10, 64)
+
+	ext := c.QueryParam("ext")
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	// Users limited to some folders only receive the events of their files
+	var visible func(rootID, path string) bool
+	if h.visibleScopes(c) != nil {
+		identity := currentIdentity(c)
+		visible = func(rootID, path string) bool {
+			return h.identityPermitted(identity, ActionView, rootID, path)
+		}
+	}
+
+	client, missed := h.events.subscribe(c.QueryParam("root"), ext, visible, lastID)
+	defer h.events.unsubscribe(client)
+
+	header := c.Response().Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+	c.Response().WriteHeader(http.StatusOK)
+
+	writer := c.Response().Writer
+	fmt.Fprint(writer, "retry: 3000\n\n")
+	for _, message := range missed {
+		writeEventMessage(writer, message)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case message, ok := <-client.messages:
+			if !ok {
+				// Disconnected by the broker: the browser reconnects with Last-Event-ID
+				return nil
+			}
+			writeEventMessage(writer, message)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(writer, ": ping\n\n")
+			flusher.Flush()
+		case <-c.Request().Context().Done():
+			return nil
+		}
+	}
+}
+
+// writeEventMessage writes a message in the SSE format
+func writeEventMessage(writer http.ResponseWriter, message eventMessage) {
+	fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", message.ID, message.Type, message.Data)
+}
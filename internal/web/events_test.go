@@ -0,0 +1,210 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/config"
+	"tokilane/internal/content"
+	"tokilane/internal/db"
+)
+
+// streamedEvent is an event read from the stream
+type streamedEvent struct {
+	ID      uint64
+	Payload eventPayload
+}
+
+// newEventTest returns handlers with two roots and a broker holding six events:
+//
+//	1 photos/a.jpg added
+//	2 photos/b.png added
+//	3 scans/c.jpg added
+//	4 photos/private/d.jpg added
+//	5 photos/private/e.jpg moved to photos/family/e.jpg
+//	6 photos/family/old.jpg moved to photos/family/f.jpg
+func newEventTest(t *testing.T) (*Handlers, func(rootID, rel string) string) {
+	t.Helper()
+	cfg := &config.Config{
+		AuthEnabled: true,
+		Roots: []config.RootConfig{
+			{ID: "photos", Path: filepath.Join(string(filepath.Separator), "library", "photos")},
+			{ID: "scans", Path: filepath.Join(string(filepath.Separator), "library", "scans")},
+		},
+	}
+	path := func(rootID, rel string) string {
+		root, _ := cfg.Root(rootID)
+		return filepath.Join(root.Path, filepath.FromSlash(rel))
+	}
+
+	events := NewEventBroker(10)
+	publish := func(eventType, rootID, rel, oldRel string) {
+		item := &db.FileItem{ID: rel, RootID: rootID, AbsPath: path(rootID, rel), Name: filepath.Base(rel), Ext: filepath.Ext(rel)}
+		event := content.FileEvent{Type: eventType, FileID: item.ID, FilePath: item.AbsPath, FileItem: item}
+		if oldRel != "" {
+			event.OldPath, event.OldRootID = path(rootID, oldRel), rootID
+		}
+		events.Publish(event)
+	}
+	publish("added", "photos", "a.jpg", "")
+	publish("added", "photos", "b.png", "")
+	publish("added", "scans", "c.jpg", "")
+	publish("added", "photos", "private/d.jpg", "")
+	publish("moved", "photos", "family/e.jpg", "private/e.jpg")
+	publish("moved", "photos", "family/f.jpg", "family/old.jpg")
+
+	return &Handlers{config: cfg, auth: NewAuth(cfg, nil), events: events}, path
+}
+
+// streamEvents opens the event stream of a closed connection: only the replayed events are sent
+func streamEvents(t *testing.T, h *Handlers, identity *Identity, query, lastEventID string) []streamedEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request := httptest.NewRequest(http.MethodGet, "/api/events?"+query, nil).WithContext(ctx)
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(request, rec)
+	c.Set(contextIdentity, identity)
+	if err := h.StreamEvents(c); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []streamedEvent
+	for _, block := range strings.Split(rec.Body.String(), "\n\n") {
+		var event streamedEvent
+		for _, line := range strings.Split(block, "\n") {
+			if value, ok := strings.CutPrefix(line, "id: "); ok {
+				event.ID, _ = strconv.ParseUint(value, 10, 64)
+			}
+			if value, ok := strings.CutPrefix(line, "data: "); ok {
+				if err := json.Unmarshal([]byte(value), &event.Payload); err != nil {
+					t.Fatalf("invalid event data %q: %v", value, err)
+				}
+			}
+		}
+		if event.ID != 0 {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func eventIDs(events []streamedEvent) []uint64 {
+	ids := []uint64{}
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestStreamEventsReplayAndFilters(t *testing.T) {
+	h, _ := newEventTest(t)
+	admin := &Identity{User: &db.User{ID: 1, Username: "admin", Role: db.RoleAdmin}}
+	scoped := &Identity{
+		User: &db.User{ID: 2, Username: "kid", Role: db.RoleViewer},
+		Scopes: []db.Scope{
+			{RootID: "photos", Prefix: "family", Role: db.RoleViewer},
+			{RootID: "scans", Role: db.RoleViewer},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		identity    *Identity
+		query       string
+		lastEventID string
+		want        []uint64
+	}{
+		{"new stream", admin, "", "", []uint64{}},
+		{"resumed stream", admin, "", "4", []uint64{5, 6}},
+		{"resumed from the query", admin, "last_event_id=2", "", []uint64{3, 4, 5, 6}},
+		{"header before the query", admin, "last_event_id=2", "5", []uint64{6}},
+		{"up to date", admin, "", "6", []uint64{}},
+		{"invalid ID", admin, "", "abc", []uint64{}},
+		{"root filter", admin, "root=scans", "1", []uint64{3}},
+		{"extension without dot", admin, "ext=png", "1", []uint64{2}},
+		{"root and extension", admin, "root=photos&ext=.JPG", "1", []uint64{4, 5, 6}},
+		{"visible files only", scoped, "", "1", []uint64{3, 5, 6}},
+		{"visible files of a root", scoped, "root=photos", "1", []uint64{5, 6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := streamEvents(t, h, tt.identity, tt.query, tt.lastEventID)
+			if got := eventIDs(events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamEventsHidesInvisibleOldPaths(t *testing.T) {
+	h, path := newEventTest(t)
+	admin := &Identity{User: &db.User{ID: 1, Username: "admin", Role: db.RoleAdmin}}
+	scoped := &Identity{
+		User:   &db.User{ID: 2, Username: "kid", Role: db.RoleViewer},
+		Scopes: []db.Scope{{RootID: "photos", Prefix: "family", Role: db.RoleViewer}},
+	}
+
+	newPaths := map[uint64]string{5: path("photos", "family/e.jpg"), 6: path("photos", "family/f.jpg")}
+	tests := []struct {
+		name     string
+		identity *Identity
+		want     map[uint64]string // Old path of each moved event
+	}{
+		{"admin", admin, map[uint64]string{5: path("photos", "private/e.jpg"), 6: path("photos", "family/old.jpg")}},
+		{"scoped user", scoped, map[uint64]string{5: "", 6: path("photos", "family/old.jpg")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := streamEvents(t, h, tt.identity, "", "4")
+			if got := eventIDs(events); !reflect.DeepEqual(got, []uint64{5, 6}) {
+				t.Fatalf("events %v, want [5 6]", got)
+			}
+			for _, event := range events {
+				if event.Payload.OldPath != tt.want[event.ID] {
+					t.Errorf("event %d has the old path %q, want %q", event.ID, event.Payload.OldPath, tt.want[event.ID])
+				}
+				if event.Payload.Path != newPaths[event.ID] {
+					t.Errorf("event %d has the path %q, want %q", event.ID, event.Payload.Path, newPaths[event.ID])
+				}
+			}
+		})
+	}
+
+	// Live events are filtered the same way
+	visible := func(rootID, path string) bool {
+		return h.identityPermitted(scoped, ActionView, rootID, path)
+	}
+	client, _ := h.events.subscribe("", "", visible, 0)
+	defer h.events.unsubscribe(client)
+	h.events.Publish(content.FileEvent{
+		Type:      "moved",
+		FileID:    "g",
+		FilePath:  path("photos", "family/g.jpg"),
+		OldPath:   path("photos", "private/g.jpg"),
+		OldRootID: "photos",
+		FileItem:  &db.FileItem{ID: "g", RootID: "photos", AbsPath: path("photos", "family/g.jpg"), Ext: ".jpg"},
+	})
+	message := <-client.messages
+	var payload eventPayload
+	if err := json.Unmarshal(message.Data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.OldPath != "" || payload.Path != path("photos", "family/g.jpg") {
+		t.Errorf("live event sent with the paths %q and %q", payload.Path, payload.OldPath)
+	}
+}
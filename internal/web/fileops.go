@@ -0,0 +1,234 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/config"
+	"tokilane/internal/content"
+	"tokilane/internal/db"
+)
+
+// maxFileNameLength is the longest file name accepted by a rename (in bytes, like most file systems)
+const maxFileNameLength = 255
+
+// renameRequest is the body of a rename
+type renameRequest struct {
+	Name string `json:"name"`
+}
+
+// moveRequest is the body of a move: a folder of a root (the root of the file by default,
+// its top when empty), and optionally a new name
+type moveRequest struct {
+	Root   string `json:"root"`
+	Folder string `json:"folder"`
+	Name   string `json:"name"`
+}
+
+// DeleteFile deletes a file from disk and from the index
+func (h *Handlers) DeleteFile(c echo.Context) error {
+	item, status, err := h.fileForAction(c, ActionModify)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.indexer.DeleteFile(item); err != nil {
+		return h.fileOperationError(c, err, "Unable to delete the file")
+	}
+	log.Printf("File deleted by %s: %s", operatorName(c), item.AbsPath)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RenameFile renames a file in its folder
+func (h *Handlers) RenameFile(c echo.Context) error {
+	item, status, err := h.fileForAction(c, ActionModify)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	var request renameRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request",
+		})
+	}
+
+	root, ok := h.config.Root(item.RootID)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Unknown root",
+		})
+	}
+	return h.relocateFile(c, item, root, filepath.Dir(item.AbsPath), request.Name)
+}
+
+// MoveFile moves a file to a folder of its root or of another root, optionally renaming it
+func (h *Handlers) MoveFile(c echo.Context) error {
+	item, status, err := h.fileForAction(c, ActionModify)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	var request moveRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request",
+		})
+	}
+
+	rootID := request.Root
+	if rootID == "" {
+		rootID = item.RootID
+	}
+	root, ok := h.config.Root(rootID)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Unknown root",
+		})
+	}
+
+	// The folder is only created once the move is known to be valid and allowed
+	dir, err := resolveFolder(root, request.Folder)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if !h.permitted(c, ActionModify, root.ID, dir) {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": errPermissionDenied.Error(),
+		})
+	}
+
+	name := request.Name
+	if name == "" {
+		name = item.Name
+	}
+	return h.relocateFile(c, item, root, dir, name)
+}
+
+// relocateFile gives a file a new name in a folder of a root, and returns its updated record.
+// A missing destination folder is created last, just before the file is moved.
+func (h *Handlers) relocateFile(c echo.Context, item *db.FileItem, root *config.RootConfig, dir, name string) error {
+	name, err := h.checkFileName(item, name)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	destPath := filepath.Join(dir, name)
+	if err := content.ValidatePath(root.Path, destPath); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid destination",
+		})
+	}
+	if !h.permitted(c, ActionModify, root.ID, destPath) {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": errPermissionDenied.Error(),
+		})
+	}
+
+	if dir != filepath.Dir(item.AbsPath) {
+		if err := makeFolder(root, dir); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	oldPath := item.AbsPath
+	if err := h.indexer.MoveFile(item, destPath); err != nil {
+		return h.fileOperationError(c, err, "Unable to move the file")
+	}
+	if oldPath != item.AbsPath {
+		log.Printf("File moved by %s: %s -> %s", operatorName(c), oldPath, item.AbsPath)
+	}
+
+	return c.JSON(http.StatusOK, item.ToResponse())
+}
+
+// checkFileName cleans the new name of a file. A new extension must be allowed and match the
+// content of the file, as for an upload.
+func (h *Handlers) checkFileName(item *db.FileItem, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return "", fmt.Errorf("Missing name")
+	case len(name) > maxFileNameLength:
+		return "", fmt.Errorf("Name too long (max %d bytes)", maxFileNameLength)
+	case strings.ContainsAny(name, `/\`) || name == "." || name == "..":
+		return "", fmt.Errorf("Invalid name: %s", name)
+	case content.IsHiddenFile(name):
+		return "", fmt.Errorf("Hidden files are not indexed: %s", name)
+	}
+
+	ext := content.GetFileExtension(name)
+	if ext == content.GetFileExtension(item.Name) {
+		return name, nil
+	}
+	if !h.config.IsAllowedExtension(ext) {
+		return "", fmt.Errorf("extension not allowed: %s", ext)
+	}
+
+	file, err := os.Open(item.AbsPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	mimeType, err := content.VerifyContentType(file, name)
+	if err != nil {
+		return "", err
+	}
+	if !h.config.IsAllowedMime(mimeType) {
+		return "", fmt.Errorf("type not allowed: %s", mimeType)
+	}
+	return name, nil
+}
+
+// fileOperationError answers a failed deletion, rename or move
+func (h *Handlers) fileOperationError(c echo.Context, err error, message string) error {
+	switch {
+	case errors.Is(err, content.ErrDestinationExists):
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "A file with the same name exists",
+		})
+	case errors.Is(err, content.ErrInvalidDestination):
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	case errors.Is(err, fs.ErrNotExist):
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": errFileNotFound.Error(),
+		})
+	}
+
+	log.Printf("%s: %v", message, err)
+	return c.JSON(http.StatusInternalServerError, map[string]string{
+		"error": message,
+	})
+}
+
+// operatorName names the user of a request in the logs
+func operatorName(c echo.Context) string {
+	if user := currentUser(c); user != nil {
+		return user.Username
+	}
+	return c.RealIP()
+}
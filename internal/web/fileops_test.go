@@ -0,0 +1,179 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/db"
+)
+
+func TestMoveFileCreatesFolderLast(t *testing.T) {
+	u := newUploadTest(t)
+	path := filepath.Join(u.rootPath, "work", "notes.txt")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	item, err := u.handlers.indexer.IndexPath(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Allowed to modify the files of one folder only
+	scoped := &Identity{
+		User: &db.User{ID: 1, Username: "editor", Role: db.RoleUploader},
+		Scopes: []db.Scope{
+			{RootID: "files", Prefix: "", Role: db.RoleViewer},
+			{RootID: "files", Prefix: "work", Role: db.RoleAdmin},
+		},
+	}
+	move := func(body string) int {
+		request := httptest.NewRequest(http.MethodPost, "/api/files/"+item.ID+"/move", strings.NewReader(body))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(request, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(item.ID)
+		c.Set(contextIdentity, scoped)
+		if err := u.handlers.MoveFile(c); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code
+	}
+
+	// Refused or invalid moves leave no folder behind
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		folder string
+	}{
+		{"folder not allowed", `{"folder":"archive/2024"}`, http.StatusForbidden, "archive"},
+		{"invalid name", `{"folder":"work/new","name":"a/b.txt"}`, http.StatusBadRequest, "work/new"},
+		{"hidden name", `{"folder":"work/new","name":".notes.txt"}`, http.StatusBadRequest, "work/new"},
+		{"extension not allowed", `{"folder":"work/new","name":"notes.exe"}`, http.StatusBadRequest, "work/new"},
+		{"hidden folder", `{"folder":"work/.cache/new"}`, http.StatusBadRequest, "work/.cache"},
+		{"outside of the root", `{"folder":"../elsewhere"}`, http.StatusBadRequest, "../elsewhere"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := move(tt.body); status != tt.status {
+				t.Errorf("status %d, want %d", status, tt.status)
+			}
+			if _, err := os.Stat(filepath.Join(u.rootPath, tt.folder)); !os.IsNotExist(err) {
+				t.Errorf("folder %s created by a refused move: %v", tt.folder, err)
+			}
+		})
+	}
+
+	// A valid move creates its folder
+	if status := move(`{"folder":"work/2024/may"}`); status != http.StatusOK {
+		t.Fatalf("valid move: status %d", status)
+	}
+	if got := readTestFile(t, filepath.Join(u.rootPath, "work", "2024", "may", "notes.txt")); got != "notes" {
+		t.Errorf("moved file contains %q", got)
+	}
+}
+
+func TestRenameFileChecksContentType(t *testing.T) {
+	html := "<!DOCTYPE html>\n<html><body><script>alert(document.cookie)</script></body></html>\n"
+	tests := []struct {
+		name    string
+		data    string // Content of notes.txt
+		newName string
+		denied  []string // DENIED_MIME
+		status  int
+		wantErr string
+	}{
+		{"same extension", html, "page.txt", nil, http.StatusOK, ""},
+		{"allowed extension and content", "notes\n", "notes.md", nil, http.StatusOK, ""},
+		{"extension not allowed", "notes\n", "notes.html", nil, http.StatusBadRequest, "extension not allowed: .html"},
+		{"content of another type", html, "photo.jpg", nil, http.StatusBadRequest, "content does not match"},
+		{"type denied", "notes\n", "notes.md", []string{"text/markdown"}, http.StatusBadRequest, "type not allowed: text/markdown"},
+	}
+
+	admin := &Identity{User: &db.User{ID: 1, Username: "admin", Role: db.RoleAdmin}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newUploadTest(t)
+			u.handlers.config.AllowedExt = []string{".txt", ".md", ".jpg"}
+			u.handlers.config.DeniedMime = tt.denied
+			path := filepath.Join(u.rootPath, "notes.txt")
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			item, err := u.handlers.indexer.IndexPath(path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body := fmt.Sprintf(`{"name":%q}`, tt.newName)
+			request := httptest.NewRequest(http.MethodPatch, "/api/files/"+item.ID, strings.NewReader(body))
+			request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(request, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(item.ID)
+			c.Set(contextIdentity, admin)
+			if err := u.handlers.RenameFile(c); err != nil {
+				t.Fatal(err)
+			}
+
+			if rec.Code != tt.status || !strings.Contains(rec.Body.String(), tt.wantErr) {
+				t.Fatalf("rename to %s: status %d %s, want %d %q", tt.newName, rec.Code, rec.Body.String(), tt.status, tt.wantErr)
+			}
+			_, err = os.Stat(path)
+			if renamed := os.IsNotExist(err); renamed != (tt.status == http.StatusOK) {
+				t.Errorf("file renamed: %v", renamed)
+			}
+		})
+	}
+}
+
+func TestDeleteFileForgetsAnnotations(t *testing.T) {
+	u := newUploadTest(t)
+	u.enableShares(t)
+	h := u.handlers
+	admin := &Identity{User: &db.User{ID: 1, Username: "admin", Role: db.RoleAdmin}}
+	item := u.indexTestFile(t, "notes.txt", "notes of a deleted file")
+	file := map[string]string{"id": item.ID}
+
+	annotate(t, h, admin, http.MethodPut, h.SetFileTags, file, `{"tags":["private"]}`)
+	annotate(t, h, admin, http.MethodPut, h.SetFileFavorite, file, "")
+	annotate(t, h, admin, http.MethodPost, h.CreateFileNote, file, `{"body":"Do not share"}`)
+	link := shareFile(t, h, item.ID)
+
+	if rec := annotate(t, h, admin, http.MethodDelete, h.DeleteFile, file, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("deletion: status %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Another file uploaded or copied at the same path
+	other := u.indexTestFile(t, "notes.txt", "another file")
+	if other.ID == item.ID {
+		t.Errorf("deleted record brought back for another file")
+	}
+	for _, id := range []string{item.ID, other.ID} {
+		annotations, err := h.annotations.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(annotations.Tags) != 0 || annotations.Favorite || len(annotations.Notes) != 0 {
+			t.Errorf("annotations %+v left for %s", annotations, id)
+		}
+	}
+	if orphans, err := h.annotations.OrphanAnchors(); err != nil || len(orphans) != 0 {
+		t.Errorf("anchors of the deleted file left: %+v, %v", orphans, err)
+	}
+	if rec := openShareLink(t, h, link); rec.Code != http.StatusNotFound {
+		t.Errorf("link to the deleted file: status %d %s, want 404", rec.Code, rec.Body.String())
+	}
+}
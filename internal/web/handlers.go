@@ -3,6 +3,8 @@ package web
 import (
 	"fmt"
 	"io"
+	"log"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -16,23 +18,38 @@ import (
 	"tokilane/internal/config"
 	"tokilane/internal/db"
 	"tokilane/internal/content"
+	"tokilane/internal/uploads"
 )
 
 // Handlers contains all application handlers
 type Handlers struct {
 	config       *config.Config
 	repo         *db.FileItemRepository
+	annotations  *db.AnnotationRepository
 	thumbnailSvc *content.ThumbnailService
 	indexer      *content.Indexer
+	events       *EventBroker
+	resumable    *uploads.Store // Resumable uploads (nil if unavailable)
+	users        *db.UserRepository
+	auth         *Auth
+	oidc         *OIDC // Single sign-on (nil if not configured)
+	shares       *ShareLinks // Public share links (nil if disabled)
 }
 
 // NewHandlers creates a new handlers instance
-func NewHandlers(cfg *config.Config, repo *db.FileItemRepository, thumbnailSvc *content.ThumbnailService, indexer *content.Indexer) *Handlers {
+func NewHandlers(cfg *config.Config, repo *db.FileItemRepository, annotations *db.AnnotationRepository, thumbnailSvc *content.ThumbnailService, indexer *content.Indexer, events *EventBroker, resumable *uploads.Store, users *db.UserRepository, auth *Auth, sso *OIDC, shares *ShareLinks) *Handlers {
 	return &Handlers{
 		config:       cfg,
 		repo:         repo,
+		annotations:  annotations,
 		thumbnailSvc: thumbnailSvc,
 		indexer:      indexer,
+		events:       events,
+		resumable:    resumable,
+		users:        users,
+		auth:         auth,
+		oidc:         sso,
+		shares:       shares,
 	}
 }
 
@@ -101,7 +118,7 @@ func (h *Handlers) GetTimelineData(c echo.Context) error {
 	}
 
 	// Count the total number of files for statistics
-	totalResult, err := h.repo.List(db.ListFilters{Page: 1, PageSize: 1})
+	totalResult, err := h.repo.List(db.ListFilters{Page: 1, PageSize: 1, Scopes: filters.Scopes})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Error counting files",
@@ -113,7 +130,8 @@ func (h *Handlers) GetTimelineData(c echo.Context) error {
 		"timeline":     timelineData,
 		"filters":      filters,
 		"total":        totalResult.Total,
-		"enableUpload": h.config.EnableUpload,
+		"enableUpload": h.config.EnableUpload && h.uploadPermitted(c),
+		"enableShare":  h.shares != nil && h.sharePermitted(c),
 		"allowedExt":   h.config.AllowedExt,
 	}
 
@@ -122,17 +140,66 @@ func (h *Handlers) GetTimelineData(c echo.Context) error {
 
 // GetAppConfig returns application configuration including language
 func (h *Handlers) GetAppConfig(c echo.Context) error {
+	roots := make([]map[string]interface{}, 0, len(h.config.Roots))
+	for _, root := range h.config.Roots {
+		roots = append(roots, map[string]interface{}{
+			"id":     root.ID,
+			"upload": h.config.EnableUpload && root.Upload && h.permittedInRoot(c, ActionUpload, root.ID),
+		})
+	}
+
+	response := map[string]interface{}{
+		"app_lang":         h.config.AppLang,
+		"version":          "1.0.0",
+		"upload":           h.config.EnableUpload && h.uploadPermitted(c),
+		"files_root":       h.config.FilesRoot,
+		"roots":            roots,
+		"allowed_ext":      h.config.AllowedExt,
+		"allowed_mime":     h.config.AllowedMime,
+		"denied_mime":      h.config.DeniedMime,
+		"resumable_upload": h.resumable != nil,
+		"shares":           h.shares != nil && h.sharePermitted(c),
+		"file_operations":  h.config.EnableFileOperations && h.modifyPermitted(c),
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// GetMetrics returns the counters of the file event delivery and of the watcher queue
+func (h *Handlers) GetMetrics(c echo.Context) error {
 	response := map[string]interface{}{
-		"app_lang":     h.config.AppLang,
-		"version":      "1.0.0",
-		"upload":       h.config.EnableUpload,
-		"files_root":   h.config.FilesRoot,
-		"allowed_ext":  h.config.AllowedExt,
+		"events":      h.indexer.EventStats(),
+		"index_queue": h.indexer.QueueStats(),
+		"event_stream": map[string]interface{}{
+			"clients":           h.events.ClientCount(),
+			"slow_disconnects": h.events.SlowDisconnects(),
+		},
 	}
 
 	return c.JSON(http.StatusOK, response)
 }
 
+// Rescan starts a scan of all the roots in the background
+func (h *Handlers) Rescan(c echo.Context) error {
+	h.indexer.Rescan()
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"status": "scheduled",
+	})
+}
+
+// ResetIndex empties the index and the thumbnails, then scans all the roots again in the background
+func (h *Handlers) ResetIndex(c echo.Context) error {
+	if err := h.indexer.Reset(); err != nil {
+		log.Printf("Error resetting the index: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error resetting the index",
+		})
+	}
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"status": "scheduled",
+	})
+}
+
 // ListFiles API to retrieve the list of files with pagination
 func (h *Handlers) ListFiles(c echo.Context) error {
 	filters := h.parseFilters(c)
@@ -159,35 +226,100 @@ func (h *Handlers) ListFiles(c echo.Context) error {
 	})
 }
 
+// GetDuplicates API to retrieve the groups of files with identical content and the space they waste
+func (h *Handlers) GetDuplicates(c echo.Context) error {
+	filters := h.parseFilters(c)
+
+	result, err := h.repo.Duplicates(filters)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error retrieving duplicates",
+		})
+	}
+
+	// Files whose content has not been hashed yet cannot be compared, among those the user may see
+	pending, err := h.repo.CountPendingContentHashes(filters.Root, filters.Scopes)
+	if err != nil {
+		pending = 0
+	}
+
+	groups := make([]map[string]interface{}, 0, len(result.Groups))
+	for _, group := range result.Groups {
+		items := make([]db.FileItemResponse, 0, len(group.Items))
+		for _, item := range group.Items {
+			items = append(items, item.ToResponse())
+		}
+		groups = append(groups, map[string]interface{}{
+			"content_hash":     group.ContentHash,
+			"size":             group.Size,
+			"size_formatted":   content.FormatFileSize(group.Size),
+			"count":            group.Count,
+			"wasted":           group.Wasted,
+			"wasted_formatted": content.FormatFileSize(group.Wasted),
+			"items":            items,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"groups":           groups,
+		"total_groups":     result.TotalGroups,
+		"duplicate_files":  result.DuplicateFiles,
+		"wasted_bytes":     result.WastedBytes,
+		"wasted_formatted": content.FormatFileSize(result.WastedBytes),
+		"pending":          pending,
+		"page":             result.Page,
+		"page_size":        result.PageSize,
+		"total_pages":      result.TotalPages,
+	})
+}
+
 // GetFile retrieves the detailed metadata of a file
 func (h *Handlers) GetFile(c echo.Context) error {
-	fileID := c.Param("id")
-	
-	item, err := h.repo.GetByID(fileID)
+	item, status, err := h.fileForAction(c, ActionView)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "File not found",
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
 		})
 	}
 
 	// Additional information for the details
 	response := item.ToResponse()
 	
-	// Add the full path (for copying the path)
 	detailedResponse := map[string]interface{}{
-		"id":             response.ID,
-		"name":           response.Name,
-		"ext":            response.Ext,
-		"mime":           response.Mime,
-		"size":           response.Size,
-		"size_formatted": response.SizeFormatted,
-		"created_at":     response.CreatedAt,
-		"has_preview":    response.HasPreview,
-		"has_thumbnail":  response.HasThumbnail,
-		"thumb_url":      response.ThumbUrl,
-		"abs_path":       item.AbsPath,
-		"hash":           item.Hash,
-		"added_at":       item.AddedAt,
+		"id":              response.ID,
+		"root_id":         item.RootID,
+		"name":            response.Name,
+		"ext":             response.Ext,
+		"mime":            response.Mime,
+		"size":            response.Size,
+		"size_formatted":  response.SizeFormatted,
+		"created_at":      response.CreatedAt,
+		"date_source":     response.DateSource,
+		"date_candidates": item.DateCandidates,
+		"date_override":   item.DateOverride,
+		"metadata":        item.Metadata,
+		"has_preview":     response.HasPreview,
+		"has_thumbnail":   response.HasThumbnail,
+		"thumb_url":       response.ThumbUrl,
+		"hash":            item.Hash,
+		"content_hash":    item.ContentHash,
+		"perceptual_hash": item.PerceptualHash,
+		"added_at":        item.AddedAt,
+	}
+
+	// Add the path in the root (for copying the path); the absolute path on the server only for admins
+	if root, ok := h.config.Root(item.RootID); ok {
+		detailedResponse["path"] = relativeToRoot(root, item.AbsPath)
+	}
+	if user := currentUser(c); user == nil || user.IsAdmin() {
+		detailedResponse["abs_path"] = item.AbsPath
+	}
+
+	// Add the tags, favourite flag and notes
+	if annotations, err := h.annotations.Get(item.ID); err == nil {
+		detailedResponse["tags"] = annotations.Tags
+		detailedResponse["favorite"] = annotations.Favorite
+		detailedResponse["notes"] = annotations.Notes
 	}
 
 	return c.JSON(http.StatusOK, detailedResponse)
@@ -195,16 +327,26 @@ func (h *Handlers) GetFile(c echo.Context) error {
 
 // PreviewFile serves the content of a file for preview or download
 func (h *Handlers) PreviewFile(c echo.Context) error {
-	fileID := c.Param("id")
 	download := c.QueryParam("download") == "1"
 	
-	item, err := h.repo.GetByID(fileID)
+	item, status, err := h.fileForAction(c, ActionDownload)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "File not found",
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
 		})
 	}
 
+	if !download {
+		// For preview, add cache headers
+		c.Response().Header().Set("Cache-Control", h.cacheControl(3600))
+		c.Response().Header().Set("ETag", fmt.Sprintf("\"%s\"", item.Hash))
+	}
+
+	return h.serveFile(c, item, download)
+}
+
+// serveFile sends the content of a file, as an attachment for a download
+func (h *Handlers) serveFile(c echo.Context, item *db.FileItem, download bool) error {
 	// Check if the file exists on the disk
 	if _, err := os.Stat(item.AbsPath); os.IsNotExist(err) {
 		return c.JSON(http.StatusNotFound, map[string]string{
@@ -212,8 +354,14 @@ func (h *Handlers) PreviewFile(c echo.Context) error {
 		})
 	}
 
-	// Validate path to prevent path traversal
-	if err := content.ValidatePath(h.config.FilesRoot, item.AbsPath); err != nil {
+	// Validate path against the root of the file to prevent path traversal
+	root, ok := h.config.Root(item.RootID)
+	if !ok {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Access denied",
+		})
+	}
+	if err := content.ValidatePath(root.Path, item.AbsPath); err != nil {
 		return c.JSON(http.StatusForbidden, map[string]string{
 			"error": "Access denied",
 		})
@@ -221,29 +369,59 @@ func (h *Handlers) PreviewFile(c echo.Context) error {
 
 	// Configure the headers
 	c.Response().Header().Set("Content-Type", item.Mime)
-	
+
+	// Documents able to run scripts (HTML, XML, SVG) are never rendered on the origin of
+	// the application: they are downloaded, without access to it if opened anyway
+	if activeContent(item.Mime) {
+		download = true
+		c.Response().Header().Set("Content-Security-Policy", "sandbox")
+	}
+
+	// The name is quoted, or encoded (RFC 2231) when it is not plain ASCII
+	disposition := "inline"
 	if download {
-		c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", item.Name))
-	} else {
-		// For preview, add cache headers
-		c.Response().Header().Set("Cache-Control", "public, max-age=3600")
-		c.Response().Header().Set("ETag", fmt.Sprintf("\"%s\"", item.Hash))
+		disposition = "attachment"
 	}
+	c.Response().Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": item.Name}))
 
 	return c.File(item.AbsPath)
 }
 
+// activeContent reports whether a browser may run the scripts of a document of this type
+func activeContent(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(mimeType))
+	}
+	return mediaType == "text/html" || strings.HasSuffix(mediaType, "/xml") || strings.HasSuffix(mediaType, "+xml")
+}
+
 // ThumbnailFile serves the thumbnail of a file
 func (h *Handlers) ThumbnailFile(c echo.Context) error {
-	fileID := c.Param("id")
-	
-	item, err := h.repo.GetByID(fileID)
+	item, status, err := h.fileForAction(c, ActionView)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "File not found",
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
 		})
 	}
 
+	// Headers for the cache
+	c.Response().Header().Set("Cache-Control", h.cacheControl(86400)) // 24h
+
+	return h.serveThumbnail(c, item)
+}
+
+// cacheControl returns the cache policy of a file or thumbnail kept for maxAge seconds.
+// Shared caches must not keep the files of a login-protected library.
+func (h *Handlers) cacheControl(maxAge int) string {
+	if h.auth.Enabled() {
+		return fmt.Sprintf("private, max-age=%d", maxAge)
+	}
+	return fmt.Sprintf("public, max-age=%d", maxAge)
+}
+
+// serveThumbnail sends the thumbnail of a file
+func (h *Handlers) serveThumbnail(c echo.Context, item *db.FileItem) error {
 	// Check if the file has a thumbnail
 	if !item.HasThumbnail() {
 		return c.JSON(http.StatusNotFound, map[string]string{
@@ -258,10 +436,7 @@ func (h *Handlers) ThumbnailFile(c echo.Context) error {
 		})
 	}
 
-	// Headers for the cache
 	c.Response().Header().Set("Content-Type", "image/jpeg")
-	c.Response().Header().Set("Cache-Control", "public, max-age=86400") // 24h
-	
 	return c.File(*item.ThumbPath)
 }
 
@@ -288,30 +463,78 @@ func (h *Handlers) UploadFiles(c echo.Context) error {
 		})
 	}
 
-	var uploadedFiles []string
-	var errors []string
+	// Select the target root (the first one accepting uploads by default)
+	root, status, err := h.uploadRoot(c.FormValue("root"))
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
 
-	// Create the upload directory with the current date
-	now := time.Now()
-	uploadDir := filepath.Join(h.config.FilesRoot, "uploads", now.Format("2006"), now.Format("01"))
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Unable to create upload directory",
+	// The role of the user in the destination folder must allow uploads
+	if !h.permitted(c, ActionUpload, root.ID, folderPath(root, c.FormValue("folder"))) {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": errPermissionDenied.Error(),
+		})
+	}
+
+	// What to do when a file with the same name exists
+	policy, err := parseConflictPolicy(c.FormValue("conflict"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if !h.overwritePermitted(c, policy, root.ID, folderPath(root, c.FormValue("folder"))) {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": errPermissionDenied.Error(),
 		})
 	}
 
-	for _, file := range files {
-		fileID, err := h.uploadSingleFile(file, uploadDir)
+	// Create the destination folder (the upload directory of the current month by default)
+	uploadDir, err := uploadFolder(root, c.FormValue("folder"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	uploadedFiles := []string{}
+	items := []db.FileItemResponse{}
+	outcomes := make([]uploadOutcome, 0, len(files))
+	var errors []string
+
+	// Dates of the files on the client: one value per file, in the order of the files
+	lastModified := form.Value["lastModified"]
+	createdAt := form.Value["created_at"]
+
+	for idx, file := range files {
+		var outcome uploadOutcome
+		times, err := parseClientTimes(valueAt(lastModified, idx), valueAt(createdAt, idx))
 		if err != nil {
-			errors = append(errors, fmt.Sprintf("%s: %v", file.Filename, err))
+			outcome = uploadOutcome{Name: file.Filename, Status: uploadFailed, Reason: err.Error()}
 		} else {
-			uploadedFiles = append(uploadedFiles, fileID)
+			outcome = h.uploadSingleFile(file, root, uploadDir, policy, times)
+		}
+		outcomes = append(outcomes, outcome)
+
+		switch {
+		case outcome.Status == uploadFailed:
+			errors = append(errors, fmt.Sprintf("%s: %s", file.Filename, outcome.Reason))
+		case outcome.Status != uploadSkipped && outcome.File != nil:
+			uploadedFiles = append(uploadedFiles, outcome.File.ID)
+			items = append(items, *outcome.File)
 		}
 	}
 
 	result := map[string]interface{}{
 		"uploaded": uploadedFiles,
+		"files":    items,
 		"count":    len(uploadedFiles),
+		"root":     root.ID,
+		"folder":   relativeToRoot(root, uploadDir),
+		"conflict": policy,
+		"results":  outcomes,
 	}
 
 	if len(errors) > 0 {
@@ -321,76 +544,181 @@ func (h *Handlers) UploadFiles(c echo.Context) error {
 	return c.JSON(http.StatusOK, result)
 }
 
-// uploadSingleFile upload a single file
-func (h *Handlers) uploadSingleFile(fileHeader *multipart.FileHeader, uploadDir string) (string, error) {
+// clientTimes are the dates of an uploaded file on the client
+type clientTimes struct {
+	ModifiedAt *time.Time // lastModified of the file, its modification time on disk
+	CreatedAt  *time.Time // Explicit creation date, replacing the date sources of the file
+}
+
+// parseClientTimes parses the lastModified and created_at fields of a file, given as
+// milliseconds since the epoch (File.lastModified) or RFC 3339 dates. Empty values are absent.
+func parseClientTimes(lastModified, createdAt string) (clientTimes, error) {
+	var times clientTimes
+	var err error
+	if times.ModifiedAt, err = parseClientTime(lastModified); err != nil {
+		return times, fmt.Errorf("invalid lastModified: %w", err)
+	}
+	if times.CreatedAt, err = parseClientTime(createdAt); err != nil {
+		return times, fmt.Errorf("invalid created_at: %w", err)
+	}
+	return times, nil
+}
+
+// parseClientTime parses a date sent by the client, rejecting dates in the future
+func parseClientTime(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	var date time.Time
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if millis <= 0 {
+			return nil, nil // Unknown date
+		}
+		date = time.UnixMilli(millis)
+	} else if date, err = time.Parse(time.RFC3339, value); err != nil {
+		return nil, fmt.Errorf("expected milliseconds or an RFC 3339 date")
+	}
+
+	// Tolerate clocks slightly ahead of the server
+	if date.After(time.Now().Add(24 * time.Hour)) {
+		return nil, fmt.Errorf("date in the future")
+	}
+	return &date, nil
+}
+
+// valueAt returns the value of a repeated form field for the file at the given index
+func valueAt(values []string, idx int) string {
+	if idx < len(values) {
+		return values[idx]
+	}
+	return ""
+}
+
+// uploadSingleFile uploads a single file, applies its client dates and indexes it
+func (h *Handlers) uploadSingleFile(fileHeader *multipart.FileHeader, root *config.RootConfig, uploadDir string, policy conflictPolicy, times clientTimes) uploadOutcome {
+	failed := func(reason string) uploadOutcome {
+		return uploadOutcome{Name: fileHeader.Filename, Status: uploadFailed, Reason: reason}
+	}
+
 	// Check the size
 	maxSize := h.config.MaxUploadSize * 1024 * 1024 // Convertir MB en bytes
 	if fileHeader.Size > maxSize {
-		return "", fmt.Errorf("file too large (max %dMB)", h.config.MaxUploadSize)
+		return failed(fmt.Sprintf("file too large (max %dMB)", h.config.MaxUploadSize))
 	}
 
 	// Check the extension
 	ext := content.GetFileExtension(fileHeader.Filename)
 	if !h.config.IsAllowedExtension(ext) {
-		return "", fmt.Errorf("extension not allowed: %s", ext)
+		return failed(fmt.Sprintf("extension not allowed: %s", ext))
+	}
+
+	source := uploadSource{
+		Name: fileHeader.Filename,
+		Open: func() (io.ReadCloser, error) {
+			return fileHeader.Open()
+		},
+		Store: func(path string) error {
+			src, err := fileHeader.Open()
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+
+			dst, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(dst, src); err != nil {
+				dst.Close()
+				return err
+			}
+			return dst.Close()
+		},
+	}
+
+	// Check the content: the extension alone does not tell what the file is
+	if err := h.checkUploadContent(source); err != nil {
+		return failed(err.Error())
+	}
+
+	return h.placeUpload(root, uploadDir, source, policy, times)
+}
+
+// uploadRoot returns the root receiving an upload (the first one accepting uploads by default),
+// or the status and reason of the refusal
+func (h *Handlers) uploadRoot(rootID string) (*config.RootConfig, int, error) {
+	var root *config.RootConfig
+	var ok bool
+	if rootID != "" {
+		root, ok = h.config.Root(rootID)
+		if !ok {
+			return nil, http.StatusBadRequest, fmt.Errorf("Unknown root")
+		}
+	} else {
+		root, ok = h.config.DefaultUploadRoot()
 	}
+	if !ok || !root.Upload {
+		return nil, http.StatusForbidden, fmt.Errorf("Upload disabled for this root")
+	}
+	return root, http.StatusOK, nil
+}
 
-	// Open the source file
-	src, err := fileHeader.Open()
-	if err != nil {
+// uploadDirectory creates the upload directory of a root for the current month
+func uploadDirectory(root *config.RootConfig) (string, error) {
+	uploadDir := folderPath(root, "")
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
 		return "", err
 	}
-	defer src.Close()
+	return uploadDir, nil
+}
 
-	// Create the destination path
-	destPath := filepath.Join(uploadDir, fileHeader.Filename)
-	
-	// If a file with the same name exists, add a suffix
-	counter := 1
-	for {
+// availablePath returns a path for a file in a directory, adding a numeric suffix to the
+// name if a file with the same name exists
+func availablePath(dir, filename string) string {
+	ext := content.GetFileExtension(filename)
+	destPath := filepath.Join(dir, filename)
+	for counter := 1; ; counter++ {
 		if _, err := os.Stat(destPath); os.IsNotExist(err) {
-			break
+			return destPath
 		}
-		
-		// Add a numeric suffix
-		name := strings.TrimSuffix(fileHeader.Filename, ext)
-		destPath = filepath.Join(uploadDir, fmt.Sprintf("%s_%d%s", name, counter, ext))
-		counter++
+		name := strings.TrimSuffix(filename, ext)
+		destPath = filepath.Join(dir, fmt.Sprintf("%s_%d%s", name, counter, ext))
 	}
+}
 
-	// Create the destination file
-	dst, err := os.Create(destPath)
-	if err != nil {
-		return "", err
+// indexUploadedFile applies the client dates of an uploaded file and indexes it
+func (h *Handlers) indexUploadedFile(destPath string, times clientTimes) (*db.FileItem, error) {
+	// Keep the date of the file on the client on disk too (other tools, rebuilt index)
+	if mtime := times.ModifiedAt; mtime != nil || times.CreatedAt != nil {
+		if mtime == nil {
+			mtime = times.CreatedAt
+		}
+		if err := os.Chtimes(destPath, *mtime, *mtime); err != nil {
+			log.Printf("Error setting the dates of %s: %v", destPath, err)
+		}
 	}
-	defer dst.Close()
 
-	// Copy the content
-	if _, err := io.Copy(dst, src); err != nil {
-		os.Remove(destPath) // Nettoyer en cas d'erreur
-		return "", err
+	// Index it right away to return its record. lastModified is only a candidate of the date
+	// sources, which the embedded metadata or the file name take precedence over.
+	item, err := h.indexer.IndexPath(destPath, times.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("stored but not indexed: %w", err)
 	}
 
-	// The indexer will automatically detect the new file
-	// via fsnotify, mais on peut forcer une indexation immédiate
-	go func() {
-		time.Sleep(100 * time.Millisecond) // Small delay to ensure the file is completely written
-		if err := h.indexer.ScanAll(); err != nil {
-			fmt.Printf("Error during indexing after upload: %v\n", err)
-		}
-	}()
-
-	// Return a temporary ID (the real ID will be generated during indexing)
-	return filepath.Base(destPath), nil
+	return item, nil
 }
 
 // parseFilters parse the filters from the query parameters
 func (h *Handlers) parseFilters(c echo.Context) db.ListFilters {
 	filters := db.ListFilters{
 		Query:     c.QueryParam("q"),
+		Root:      c.QueryParam("root"),
 		Extension: c.QueryParam("ext"),
 		Page:      1,
 		PageSize:  50,
+		Scopes:    h.visibleScopes(c),
 	}
 
 	// Parse the page
@@ -407,6 +735,19 @@ func (h *Handlers) parseFilters(c echo.Context) db.ListFilters {
 		}
 	}
 
+	// Parse the tags (repeated "tag" parameters or a comma-separated "tags" list)
+	tags := c.QueryParams()["tag"]
+	if list := c.QueryParam("tags"); list != "" {
+		tags = append(tags, strings.Split(list, ",")...)
+	}
+	for _, tag := range tags {
+		if tag = db.NormalizeTag(tag); tag != "" {
+			filters.Tags = append(filters.Tags, tag)
+		}
+	}
+	filters.Favorite = c.QueryParam("favorite") == "true" || c.QueryParam("favorite") == "1"
+	filters.Duplicates = c.QueryParam("duplicates") == "true" || c.QueryParam("duplicates") == "1"
+
 	// Parse the dates
 	if dateFrom := c.QueryParam("date_from"); dateFrom != "" {
 		filters.DateFrom = &dateFrom
@@ -0,0 +1,346 @@
+package web
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/config"
+	"tokilane/internal/content"
+	"tokilane/internal/db"
+)
+
+func TestCacheControl(t *testing.T) {
+	for _, tt := range []struct {
+		authEnabled bool
+		want        string
+	}{
+		{false, "public, max-age=3600"},
+		{true, "private, max-age=3600"},
+	} {
+		cfg := &config.Config{AuthEnabled: tt.authEnabled}
+		h := &Handlers{config: cfg, auth: NewAuth(cfg, nil)}
+		if got := h.cacheControl(3600); got != tt.want {
+			t.Errorf("cacheControl with the authentication enabled %v = %q, want %q", tt.authEnabled, got, tt.want)
+		}
+	}
+}
+
+// serveTestFile serves a file of a temporary root with serveFile
+func serveTestFile(t *testing.T, name, mimeType string, download bool) *httptest.ResponseRecorder {
+	t.Helper()
+	rootPath := t.TempDir()
+	path := filepath.Join(rootPath, name)
+	if err := os.WriteFile(path, []byte("<svg onload=\"alert(document.cookie)\"/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &Handlers{config: &config.Config{Roots: []config.RootConfig{{ID: "files", Path: rootPath}}}}
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/files/1/preview", nil), rec)
+	item := &db.FileItem{RootID: "files", AbsPath: path, Name: name, Mime: mimeType}
+	if err := h.serveFile(c, item, download); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	return rec
+}
+
+func TestServeFileActiveContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		mime     string
+		download bool
+		active   bool
+	}{
+		{"page.html", "text/html; charset=utf-8", false, true},
+		{"page.xhtml", "application/xhtml+xml", false, true},
+		{"feed.xml", "text/xml", false, true},
+		{"data.xml", "application/xml", false, true},
+		{"drawing.svg", "image/svg+xml", false, true},
+		{"DRAWING.SVG", "Image/SVG+XML", false, true},
+		{"photo.jpg", "image/jpeg", false, false},
+		{"report.pdf", "application/pdf", false, false},
+		{"notes.txt", "text/plain; charset=utf-8", false, false},
+		{"photo.jpg", "image/jpeg", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := serveTestFile(t, tt.name, tt.mime, tt.download).Header()
+			disposition := header.Get("Content-Disposition")
+			sandboxed := header.Get("Content-Security-Policy") == "sandbox"
+			attachment := strings.HasPrefix(disposition, "attachment")
+
+			if tt.active && (!sandboxed || !attachment) {
+				t.Errorf("active content served inline: disposition %q, CSP %q", disposition, header.Get("Content-Security-Policy"))
+			}
+			if !tt.active && sandboxed {
+				t.Errorf("passive content sandboxed")
+			}
+			if !tt.active && attachment != tt.download {
+				t.Errorf("disposition %q for a download %v", disposition, tt.download)
+			}
+		})
+	}
+}
+
+func TestServeFileDisposition(t *testing.T) {
+	names := []string{"photo.jpg", "my \"best\" photo.jpg", "été 2023.jpg", "a;b=c.jpg", "back\\slash.jpg", "写真.jpg"}
+
+	for _, name := range names {
+		for _, download := range []bool{false, true} {
+			disposition := serveTestFile(t, name, "image/jpeg", download).Header().Get("Content-Disposition")
+			kind, params, err := mime.ParseMediaType(disposition)
+			if err != nil {
+				t.Errorf("invalid disposition %q for %q: %v", disposition, name, err)
+				continue
+			}
+			want := "inline"
+			if download {
+				want = "attachment"
+			}
+			if kind != want || params["filename"] != name {
+				t.Errorf("disposition %q parsed as %s %q, want %s %q", disposition, kind, params["filename"], want, name)
+			}
+		}
+	}
+}
+
+func TestDuplicatesPendingCountsVisibleFiles(t *testing.T) {
+	u := newUploadTest(t)
+	for _, name := range []string{"work/a.txt", "work/b.txt", "private/c.txt"} {
+		path := filepath.Join(u.rootPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Content hashing is disabled: the files stay pending
+		if _, err := u.handlers.indexer.IndexPath(path, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		identity *Identity
+		query    string
+		want     float64
+	}{
+		{"admin", &Identity{User: &db.User{ID: 1, Username: "admin", Role: db.RoleAdmin}}, "", 3},
+		{"other root", &Identity{User: &db.User{ID: 1, Username: "admin", Role: db.RoleAdmin}}, "?root=photos", 0},
+		{"unscoped viewer", &Identity{User: &db.User{ID: 2, Username: "alice", Role: db.RoleViewer}}, "", 3},
+		{
+			"scoped viewer",
+			&Identity{
+				User:   &db.User{ID: 3, Username: "bob", Role: db.RoleViewer},
+				Scopes: []db.Scope{{RootID: "files", Prefix: "work", Role: db.RoleViewer}},
+			},
+			"",
+			2,
+		},
+		{
+			"scoped to another root",
+			&Identity{
+				User:   &db.User{ID: 4, Username: "carol", Role: db.RoleViewer},
+				Scopes: []db.Scope{{RootID: "photos", Role: db.RoleViewer}},
+			},
+			"",
+			0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/duplicates"+tt.query, nil), rec)
+			c.Set(contextIdentity, tt.identity)
+			if err := u.handlers.GetDuplicates(c); err != nil {
+				t.Fatal(err)
+			}
+			var response map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("status %d: %v", rec.Code, err)
+			}
+			if response["pending"] != tt.want {
+				t.Errorf("pending %v, want %v", response["pending"], tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClientTime(t *testing.T) {
+	moonLanding := time.Date(1969, 7, 20, 20, 17, 0, 0, time.UTC)
+	photo := time.Date(2024, 5, 1, 10, 30, 15, 250*int(time.Millisecond), time.UTC)
+	soon := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	tests := []struct {
+		name    string
+		value   string
+		want    *time.Time
+		wantErr string
+	}{
+		{"missing", "", nil, ""},
+		{"blank", "   ", nil, ""},
+		{"milliseconds", "1714559415250", &photo, ""},
+		{"milliseconds with spaces", " 1714559415250 ", &photo, ""},
+		{"unknown date of the browser", "0", nil, ""},
+		{"negative milliseconds", "-1000", nil, ""},
+		{"RFC 3339 in UTC", "2024-05-01T10:30:15.25Z", &photo, ""},
+		{"RFC 3339 with an offset", "2024-05-01T12:30:15.25+02:00", &photo, ""},
+		{"before the epoch", "1969-07-20T20:17:00Z", &moonLanding, ""},
+		{"clock slightly ahead", strconv.FormatInt(soon.UnixMilli(), 10), &soon, ""},
+		{"future milliseconds", strconv.FormatInt(time.Now().Add(48*time.Hour).UnixMilli(), 10), nil, "date in the future"},
+		{"future RFC 3339", time.Now().AddDate(1, 0, 0).UTC().Format(time.RFC3339), nil, "date in the future"},
+		{"far future", "9999999999999999", nil, "date in the future"},
+		{"milliseconds out of range", "99999999999999999999", nil, "expected milliseconds or an RFC 3339 date"},
+		{"seconds with a fraction", "1714559415.25", nil, "expected milliseconds or an RFC 3339 date"},
+		{"date without time", "2024-05-01", nil, "expected milliseconds or an RFC 3339 date"},
+		{"invalid month", "2024-13-01T10:00:00Z", nil, "expected milliseconds or an RFC 3339 date"},
+		{"year out of range", "10000-01-01T00:00:00Z", nil, "expected milliseconds or an RFC 3339 date"},
+		{"text", "yesterday", nil, "expected milliseconds or an RFC 3339 date"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseClientTime(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("parseClientTime(%q) = %v, %v, want the error %q", tt.value, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseClientTime(%q) refused: %v", tt.value, err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("parseClientTime(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	// The field of an invalid date is reported
+	if _, err := parseClientTimes("1714559415250", "yesterday"); err == nil || !strings.HasPrefix(err.Error(), "invalid created_at") {
+		t.Errorf("invalid created_at reported as %v", err)
+	}
+	if _, err := parseClientTimes("yesterday", ""); err == nil || !strings.HasPrefix(err.Error(), "invalid lastModified") {
+		t.Errorf("invalid lastModified reported as %v", err)
+	}
+}
+
+func TestIndexUploadedFileAppliesClientTimes(t *testing.T) {
+	modified := time.Date(2023, 8, 14, 9, 0, 0, 0, time.UTC)
+	created := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	named := time.Date(2022, 11, 30, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		name         string
+		file         string
+		lastModified string
+		createdAt    string
+		mtime        *time.Time // On disk, nil: the time of the upload
+		date         *time.Time // Of the record, nil: the time of the upload
+		source       string     // Empty: a date of the file system
+	}{
+		{"no date", "notes.txt", "", "", nil, nil, ""},
+		{"unknown date", "notes.txt", "0", "", nil, nil, ""},
+		{"lastModified", "notes.txt", "1692003600000", "", &modified, &modified, ""},
+		{"lastModified of a dated name", "notes_2022_11_30.txt", "1692003600000", "", &modified, &named, content.DateSourceFilename},
+		{"creation date", "notes.txt", "", "2021-02-03T04:05:06Z", &created, &created, content.DateSourceClient},
+		{"both dates", "notes.txt", "1692003600000", "2021-02-03T04:05:06Z", &modified, &created, content.DateSourceClient},
+		{"creation date of a dated name", "notes_2022_11_30.txt", "", "2021-02-03T04:05:06Z", &created, &created, content.DateSourceClient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newUploadTest(t)
+			path := filepath.Join(u.rootPath, tt.file)
+			if err := os.WriteFile(path, []byte("notes"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			uploadedAt := time.Now()
+
+			times, err := parseClientTimes(tt.lastModified, tt.createdAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			item, err := u.handlers.indexUploadedFile(path, times)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			near := func(date time.Time, want *time.Time) bool {
+				if want == nil {
+					return date.Sub(uploadedAt).Abs() < time.Minute
+				}
+				return date.Equal(*want)
+			}
+			stat, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !near(stat.ModTime(), tt.mtime) {
+				t.Errorf("modification time %v on disk, want %v", stat.ModTime(), tt.mtime)
+			}
+			source := item.DateSource
+			if source == content.DateSourceBirthtime || source == content.DateSourceMtime {
+				source = "" // Birth time where the file system records it, otherwise mtime
+			}
+			if !near(item.CreatedAt, tt.date) || source != tt.source {
+				t.Errorf("date %v from %s, want %v from %s", item.CreatedAt, item.DateSource, tt.date, tt.source)
+			}
+			if mtime := item.DateCandidates[content.DateSourceMtime]; !near(mtime, tt.mtime) {
+				t.Errorf("mtime candidate %v, want %v", mtime, tt.mtime)
+			}
+		})
+	}
+}
+
+func TestGetFilePaths(t *testing.T) {
+	u := newUploadTest(t)
+	h := u.handlers
+	item := u.indexTestFile(t, "family/2024/notes.txt", "notes")
+
+	tests := []struct {
+		name    string
+		role    string
+		absPath bool
+	}{
+		{"viewer", db.RoleViewer, false},
+		{"uploader", db.RoleUploader, false},
+		{"admin", db.RoleAdmin, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity := &Identity{User: &db.User{ID: 1, Username: tt.name, Role: tt.role}}
+			rec := annotate(t, h, identity, http.MethodGet, h.GetFile, map[string]string{"id": item.ID}, "")
+			var response map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || rec.Code != http.StatusOK {
+				t.Fatalf("status %d %s", rec.Code, rec.Body.String())
+			}
+			if path := response["path"]; path != "family/2024/notes.txt" {
+				t.Errorf("path %v, want the path in the root", path)
+			}
+			absPath, ok := response["abs_path"]
+			if ok != tt.absPath || (ok && absPath != item.AbsPath) {
+				t.Errorf("abs_path %v, want it: %v", absPath, tt.absPath)
+			}
+			if strings.Contains(rec.Body.String(), u.rootPath) != tt.absPath {
+				t.Errorf("path of the root on the server in %s", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package web
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/oauth2"
+
+	"tokilane/internal/config"
+	"tokilane/internal/db"
+)
+
+// Cookie keeping the state of a single sign-on login between the redirections
+const (
+	oidcCookie     = "tokilane_oidc"
+	oidcCookiePath = "/api/auth/oidc"
+	oidcLoginDelay = 10 * time.Minute // Time allowed to log in at the provider
+)
+
+// Role refusing the users whose claims are not mapped to a role
+const oidcNoRole = "none"
+
+// Errors of the single sign-on
+var (
+	errOIDCState     = errors.New("invalid or expired login state")
+	errOIDCForbidden = errors.New("your account is not allowed to use this application")
+)
+
+// oidcState is what the login keeps in a cookie until the callback
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"` // PKCE code verifier
+	Redirect string `json:"redirect"` // Page to return to after the login
+}
+
+// OIDC logs users in with an OpenID Connect provider (authorization code flow with PKCE).
+// The users are created on first login, as accounts of the "oidc" provider.
+type OIDC struct {
+	config *config.Config
+	users  *db.UserRepository
+
+	mu       sync.Mutex
+	provider *oidc.Provider // Discovered on first use, so that the server starts while the provider is down
+}
+
+// NewOIDC creates the single sign-on, nil if no provider is configured
+func NewOIDC(cfg *config.Config, users *db.UserRepository) *OIDC {
+	if cfg.OIDCIssuer == "" || cfg.OIDCClientID == "" {
+		return nil
+	}
+	return &OIDC{config: cfg, users: users}
+}
+
+// discover returns the provider, fetching its configuration on first use
+func (o *OIDC) discover(ctx context.Context) (*oidc.Provider, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.provider == nil {
+		provider, err := oidc.NewProvider(ctx, o.config.OIDCIssuer)
+		if err != nil {
+			return nil, fmt.Errorf("unable to discover the provider %s: %w", o.config.OIDCIssuer, err)
+		}
+		o.provider = provider
+	}
+	return o.provider, nil
+}
+
+// oauth2Config returns the client configuration, with the callback URL of the request
+func (o *OIDC) oauth2Config(c echo.Context, provider *oidc.Provider) *oauth2.Config {
+	redirectURL := o.config.OIDCRedirectURL
+	if redirectURL == "" {
+		redirectURL = c.Scheme() + "://" + c.Request().Host + oidcCookiePath + "/callback"
+	}
+
+	scopes := []string{oidc.ScopeOpenID}
+	for _, scope := range o.config.OIDCScopes {
+		if scope = strings.TrimSpace(scope); scope != "" && scope != oidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return &oauth2.Config{
+		ClientID:     o.config.OIDCClientID,
+		ClientSecret: o.config.OIDCClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+	}
+}
+
+// userFromClaims returns the user of a login, created on first login. The role is taken
+// from the claims at each login when a role claim is configured.
+func (o *OIDC) userFromClaims(subject string, claims map[string]interface{}) (*db.User, error) {
+	role, mapped := o.mapRole(claims)
+	if role == oidcNoRole {
+		return nil, errOIDCForbidden
+	}
+
+	user, err := o.users.GetBySubject(db.ProviderOIDC, subject)
+	if err != nil {
+		username := claimString(claims, o.config.OIDCUsernameClaim)
+		if username == "" {
+			username = claimString(claims, "email")
+		}
+		if username == "" {
+			username = subject
+		}
+
+		user = &db.User{
+			Username: o.users.AvailableUsername(username),
+			Role:     role,
+			Provider: db.ProviderOIDC,
+			Subject:  &subject,
+		}
+		if err := o.users.Create(user); err != nil {
+			return nil, err
+		}
+		log.Printf("Single sign-on user created: %s (%s)", user.Username, user.Role)
+		return user, nil
+	}
+
+	if mapped && user.Role != role {
+		user.Role = role
+		if err := o.users.Update(user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// mapRole returns the role given by the claims, and whether a role claim is configured
+func (o *OIDC) mapRole(claims map[string]interface{}) (string, bool) {
+	if o.config.OIDCRoleClaim == "" {
+		return normalizeRole(o.config.OIDCDefaultRole), false
+	}
+
+	values := make(map[string]bool)
+	for _, value := range claimStrings(claims, o.config.OIDCRoleClaim) {
+		values[value] = true
+	}
+
+	// The most privileged matching role wins
+	role := ""
+	for _, entry := range o.config.OIDCRoleMap {
+		value, mappedRole, ok := strings.Cut(entry, "=")
+		if !ok || !values[strings.TrimSpace(value)] {
+			continue
+		}
+		if mappedRole = normalizeRole(mappedRole); roleRank[mappedRole] > roleRank[role] {
+			role = mappedRole
+		}
+	}
+	if role == "" {
+		role = normalizeRole(o.config.OIDCDefaultRole)
+	}
+	return role, true
+}
+
+// OIDCLogin redirects the browser to the provider
+func (h *Handlers) OIDCLogin(c echo.Context) error {
+	provider, err := h.oidc.discover(c.Request().Context())
+	if err != nil {
+		log.Printf("Single sign-on unavailable: %v", err)
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{
+			"error": "Single sign-on provider unavailable",
+		})
+	}
+
+	state := oidcState{Verifier: oauth2.GenerateVerifier(), Redirect: localRedirect(c.QueryParam("redirect"))}
+	if state.State, err = randomToken(24); err == nil {
+		state.Nonce, err = randomToken(24)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Unable to start the login",
+		})
+	}
+
+	data, _ := json.Marshal(state)
+	h.setOIDCCookie(c, base64.RawURLEncoding.EncodeToString(data), time.Now().Add(oidcLoginDelay))
+
+	authURL := h.oidc.oauth2Config(c, provider).AuthCodeURL(state.State, oidc.Nonce(state.Nonce), oauth2.S256ChallengeOption(state.Verifier))
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback completes the login: it checks the state, exchanges the code for the tokens,
+// verifies the ID token and opens a session for the user
+func (h *Handlers) OIDCCallback(c echo.Context) error {
+	state, err := h.readOIDCState(c)
+	h.setOIDCCookie(c, "", time.Unix(0, 0))
+	if err != nil {
+		return h.oidcFailure(c, "", err)
+	}
+
+	if errorCode := c.QueryParam("error"); errorCode != "" {
+		// Refused or cancelled at the provider
+		return h.oidcFailure(c, state.Redirect, fmt.Errorf("%s: %s", errorCode, c.QueryParam("error_description")))
+	}
+
+	ctx := c.Request().Context()
+	provider, err := h.oidc.discover(ctx)
+	if err != nil {
+		return h.oidcFailure(c, state.Redirect, err)
+	}
+
+	oauthConfig := h.oidc.oauth2Config(c, provider)
+	token, err := oauthConfig.Exchange(ctx, c.QueryParam("code"), oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		return h.oidcFailure(c, state.Redirect, fmt.Errorf("code exchange: %w", err))
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return h.oidcFailure(c, state.Redirect, errors.New("no ID token in the response"))
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: h.config.OIDCClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return h.oidcFailure(c, state.Redirect, fmt.Errorf("ID token: %w", err))
+	}
+	if idToken.Nonce != state.Nonce {
+		return h.oidcFailure(c, state.Redirect, errors.New("ID token: invalid nonce"))
+	}
+
+	claims := make(map[string]interface{})
+	if err := idToken.Claims(&claims); err != nil {
+		return h.oidcFailure(c, state.Redirect, fmt.Errorf("ID token claims: %w", err))
+	}
+	// Some providers only return the profile and the groups from the user info endpoint
+	if info, err := provider.UserInfo(ctx, oauthConfig.TokenSource(ctx, token)); err == nil {
+		extra := make(map[string]interface{})
+		if info.Claims(&extra) == nil {
+			for name, value := range extra {
+				if _, ok := claims[name]; !ok {
+					claims[name] = value
+				}
+			}
+		}
+	}
+
+	user, err := h.oidc.userFromClaims(idToken.Subject, claims)
+	if err != nil {
+		return h.oidcFailure(c, state.Redirect, err)
+	}
+	if _, err := h.auth.StartSession(c, user); err != nil {
+		return h.oidcFailure(c, state.Redirect, err)
+	}
+
+	return c.Redirect(http.StatusFound, state.Redirect)
+}
+
+// readOIDCState reads the login state and checks it against the state returned by the provider
+func (h *Handlers) readOIDCState(c echo.Context) (*oidcState, error) {
+	cookie, err := c.Cookie(oidcCookie)
+	if err != nil {
+		return nil, errOIDCState
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil, errOIDCState
+	}
+	var state oidcState
+	if err := json.Unmarshal(data, &state); err != nil || state.State == "" || state.State != c.QueryParam("state") {
+		return nil, errOIDCState
+	}
+	state.Redirect = localRedirect(state.Redirect)
+	return &state, nil
+}
+
+// setOIDCCookie sets the login state cookie (removed if it expires in the past)
+func (h *Handlers) setOIDCCookie(c echo.Context, value string, expires time.Time) {
+	cookie := &http.Cookie{
+		Name:     oidcCookie,
+		Value:    value,
+		Path:     oidcCookiePath,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   h.config.CookieSecure,
+		SameSite: http.SameSiteLaxMode, // Sent with the redirection from the provider
+	}
+	if !expires.After(time.Now()) {
+		cookie.MaxAge = -1
+	}
+	c.SetCookie(cookie)
+}
+
+// oidcFailure sends the browser back to the application with the reason of the failure
+func (h *Handlers) oidcFailure(c echo.Context, redirect string, err error) error {
+	log.Printf("Single sign-on failed from %s: %v", c.RealIP(), err)
+
+	reason := "Single sign-on failed"
+	if errors.Is(err, errOIDCForbidden) || errors.Is(err, errOIDCState) {
+		reason = err.Error()
+	}
+	if redirect == "" {
+		redirect = "/"
+	}
+	target, _ := url.Parse(redirect)
+	query := target.Query()
+	query.Set("login_error", reason)
+	target.RawQuery = query.Encode()
+	return c.Redirect(http.StatusFound, target.String())
+}
+
+// normalizeRole validates a role of the configuration ("none" if it is unknown)
+func normalizeRole(value string) string {
+	role := strings.ToLower(strings.TrimSpace(value))
+	if role == "" || role == oidcNoRole {
+		return oidcNoRole
+	}
+	if role, ok := parseRole(role); ok {
+		return role
+	}
+	log.Printf("Unknown single sign-on role %q, login refused", value)
+	return oidcNoRole
+}
+
+// localRedirect keeps the redirections within the application ("/" by default)
+func localRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		return "/"
+	}
+	return redirect
+}
+
+// claimString returns a claim as a string
+func claimString(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return strings.TrimSpace(value)
+}
+
+// claimStrings returns a claim holding a string or a list of strings
+func claimStrings(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,394 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/config"
+	"tokilane/internal/db"
+	"tokilane/internal/mockoidc"
+)
+
+// oidcTest is an application using the mock provider for its single sign-on
+type oidcTest struct {
+	provider *mockoidc.Provider
+	app      *httptest.Server
+	users    *db.UserRepository
+}
+
+// newOIDCTest starts the mock provider and an application using it, with the default user
+// alice (subject mock-user-1) and the given role mapping
+func newOIDCTest(t *testing.T, claims map[string]interface{}, configure func(cfg *config.Config)) *oidcTest {
+	t.Helper()
+
+	var provider *mockoidc.Provider
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provider.ServeHTTP(w, r)
+	}))
+	t.Cleanup(idp.Close)
+
+	defaults := map[string]interface{}{
+		"sub":                "mock-user-1",
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+	}
+	for name, value := range claims {
+		defaults[name] = value
+	}
+	var err error
+	if provider, err = mockoidc.New(idp.URL, "tokilane", "secret", defaults); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		AuthEnabled:       true,
+		SessionLifetime:   1,
+		OIDCIssuer:        idp.URL,
+		OIDCClientID:      "tokilane",
+		OIDCClientSecret:  "secret",
+		OIDCScopes:        []string{"openid", "profile", "email"},
+		OIDCUsernameClaim: "preferred_username",
+		OIDCDefaultRole:   db.RoleViewer,
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	database, err := db.New(filepath.Join(t.TempDir(), "app.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	users := db.NewUserRepository(database)
+	auth := NewAuth(cfg, users)
+	handlers := NewHandlers(cfg, nil, nil, nil, nil, nil, nil, users, auth, NewOIDC(cfg, users), nil)
+
+	e := echo.New()
+	e.GET("/api/auth/status", handlers.GetAuthStatus)
+	e.GET("/api/auth/oidc/login", handlers.OIDCLogin)
+	e.GET("/api/auth/oidc/callback", handlers.OIDCCallback)
+	app := httptest.NewServer(e)
+	t.Cleanup(app.Close)
+
+	return &oidcTest{provider: provider, app: app, users: users}
+}
+
+// newBrowser returns a client keeping its cookies and stopping at the redirections
+func newBrowser(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// redirection requests a URL and returns where it redirects to
+func redirection(t *testing.T, browser *http.Client, target string) *url.URL {
+	t.Helper()
+	resp, err := browser.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("GET %s: status %d, want a redirection", target, resp.StatusCode)
+	}
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+// startLogin opens the login of the application and returns the authorization URL at the provider
+func (o *oidcTest) startLogin(t *testing.T, browser *http.Client) *url.URL {
+	t.Helper()
+	return redirection(t, browser, o.app.URL+"/api/auth/oidc/login?redirect=/photos")
+}
+
+// authorize approves the login at the provider and returns the callback URL
+func (o *oidcTest) authorize(t *testing.T, browser *http.Client, authURL *url.URL) *url.URL {
+	t.Helper()
+	callback := redirection(t, browser, authURL.String())
+	if !strings.HasPrefix(callback.String(), o.app.URL+oidcCookiePath+"/callback?") {
+		t.Fatalf("redirected to %s instead of the callback", callback)
+	}
+	return callback
+}
+
+// login goes through the whole login, as the user of the login hint when set, and returns
+// the page the application redirects to
+func (o *oidcTest) login(t *testing.T, browser *http.Client, hint string) *url.URL {
+	t.Helper()
+	authURL := o.startLogin(t, browser)
+	if hint != "" {
+		query := authURL.Query()
+		query.Set("login_hint", hint)
+		authURL.RawQuery = query.Encode()
+	}
+	return redirection(t, browser, o.authorize(t, browser, authURL).String())
+}
+
+// currentUser returns the user logged in with the cookies of a browser, nil if none
+func (o *oidcTest) currentUser(t *testing.T, browser *http.Client) *db.User {
+	t.Helper()
+	resp, err := browser.Get(o.app.URL + "/api/auth/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status struct {
+		User *db.User `json:"user"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status.User
+}
+
+// loginState returns the login state kept in the cookie of a browser
+func (o *oidcTest) loginState(t *testing.T, browser *http.Client) (*oidcState, *url.URL) {
+	t.Helper()
+	cookieURL, _ := url.Parse(o.app.URL + oidcCookiePath + "/callback")
+	for _, cookie := range browser.Jar.Cookies(cookieURL) {
+		if cookie.Name != oidcCookie {
+			continue
+		}
+		data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var state oidcState
+		if err := json.Unmarshal(data, &state); err != nil {
+			t.Fatal(err)
+		}
+		return &state, cookieURL
+	}
+	t.Fatal("no login state cookie")
+	return nil, nil
+}
+
+// setLoginState replaces the login state kept in the cookie of a browser
+func (o *oidcTest) setLoginState(t *testing.T, browser *http.Client, state *oidcState) {
+	t.Helper()
+	_, cookieURL := o.loginState(t, browser)
+	data, _ := json.Marshal(state)
+	browser.Jar.SetCookies(cookieURL, []*http.Cookie{{
+		Name:  oidcCookie,
+		Value: base64.RawURLEncoding.EncodeToString(data),
+		Path:  oidcCookiePath,
+	}})
+}
+
+// loginError returns the reason of a failed login given in the redirection
+func loginError(target *url.URL) string {
+	return target.Query().Get("login_error")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	o := newOIDCTest(t, nil, nil)
+	browser := newBrowser(t)
+
+	// The authorization request carries the state, the nonce and the PKCE challenge
+	authURL := o.startLogin(t, browser)
+	query := authURL.Query()
+	if !strings.HasPrefix(authURL.String(), o.provider.Issuer()+"/authorize?") {
+		t.Fatalf("redirected to %s instead of the provider", authURL)
+	}
+	state, _ := o.loginState(t, browser)
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	expected := map[string]string{
+		"client_id":             "tokilane",
+		"response_type":         "code",
+		"redirect_uri":          o.app.URL + oidcCookiePath + "/callback",
+		"state":                 state.State,
+		"nonce":                 state.Nonce,
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(challenge[:]),
+		"code_challenge_method": "S256",
+		"scope":                 "openid profile email",
+	}
+	for name, value := range expected {
+		if query.Get(name) != value {
+			t.Errorf("authorization parameter %s = %q, want %q", name, query.Get(name), value)
+		}
+	}
+	if state.State == "" || state.Nonce == "" || state.Verifier == "" || state.State == state.Nonce {
+		t.Errorf("weak login state: %+v", state)
+	}
+	if state.Redirect != "/photos" {
+		t.Errorf("redirect after the login = %q, want /photos", state.Redirect)
+	}
+
+	// The callback opens a session and provisions the user
+	callback := o.authorize(t, browser, authURL)
+	if callback.Query().Get("state") != state.State || callback.Query().Get("code") == "" {
+		t.Fatalf("unexpected callback %s", callback)
+	}
+	target := redirection(t, browser, callback.String())
+	if target.Path != "/photos" || loginError(target) != "" {
+		t.Fatalf("redirected to %s after the login", target)
+	}
+
+	user := o.currentUser(t, browser)
+	if user == nil {
+		t.Fatal("no session after the login")
+	}
+	if user.Username != "alice" || user.Role != db.RoleViewer || user.Provider != db.ProviderOIDC {
+		t.Errorf("provisioned user %s (%s, %s), want alice (viewer, oidc)", user.Username, user.Role, user.Provider)
+	}
+	provisioned, err := o.users.GetBySubject(db.ProviderOIDC, "mock-user-1")
+	if err != nil || provisioned.ID != user.ID {
+		t.Fatalf("user not found by its subject: %v", err)
+	}
+
+	// The login state cannot be used twice
+	if target := redirection(t, browser, callback.String()); loginError(target) != errOIDCState.Error() {
+		t.Errorf("replayed callback redirected to %s", target)
+	}
+
+	// The next login finds the same user; another subject gets a new account
+	if target := o.login(t, newBrowser(t), ""); loginError(target) != "" {
+		t.Fatalf("second login failed: %s", target)
+	}
+	bob := newBrowser(t)
+	if target := o.login(t, bob, "bob"); loginError(target) != "" {
+		t.Fatalf("login of bob failed: %s", target)
+	}
+	if user := o.currentUser(t, bob); user == nil || user.Username != "bob" {
+		t.Errorf("logged in as %+v, want bob", user)
+	}
+	if count, err := o.users.Count(); err != nil || count != 2 {
+		t.Errorf("%d users provisioned, want 2", count)
+	}
+}
+
+func TestOIDCRoleMapping(t *testing.T) {
+	o := newOIDCTest(t, map[string]interface{}{"groups": []string{"family"}}, func(cfg *config.Config) {
+		cfg.OIDCRoleClaim = "groups"
+		cfg.OIDCRoleMap = []string{"family=uploader", "admins=admin", "typo=superuser"}
+		cfg.OIDCDefaultRole = oidcNoRole
+	})
+
+	tests := []struct {
+		name   string
+		groups []string
+		want   string // Empty when the login is refused
+	}{
+		{"mapped group", []string{"family"}, db.RoleUploader},
+		{"most privileged group wins", []string{"family", "admins"}, db.RoleAdmin},
+		{"role updated at each login", []string{"family"}, db.RoleUploader},
+		{"unknown mapped role", []string{"typo"}, ""},
+		{"no mapped group", []string{"friends"}, ""},
+		{"no group", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := map[string]interface{}{
+				"sub":                "mock-user-1",
+				"preferred_username": "alice",
+			}
+			if tt.groups != nil {
+				claims["groups"] = tt.groups
+			}
+			o.provider.SetClaims(claims)
+
+			browser := newBrowser(t)
+			target := o.login(t, browser, "")
+			user := o.currentUser(t, browser)
+			if tt.want == "" {
+				if loginError(target) != errOIDCForbidden.Error() || user != nil {
+					t.Errorf("login not refused: redirected to %s, user %+v", target, user)
+				}
+				return
+			}
+			if user == nil || user.Role != tt.want {
+				t.Fatalf("logged in as %+v (redirected to %s), want the role %s", user, target, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejectsBadState(t *testing.T) {
+	o := newOIDCTest(t, nil, nil)
+
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, browser *http.Client, callback *url.URL)
+		reason string
+	}{
+		{"state of another login", func(t *testing.T, browser *http.Client, callback *url.URL) {
+			query := callback.Query()
+			query.Set("state", "forged")
+			callback.RawQuery = query.Encode()
+		}, errOIDCState.Error()},
+		{"missing state", func(t *testing.T, browser *http.Client, callback *url.URL) {
+			query := callback.Query()
+			query.Del("state")
+			callback.RawQuery = query.Encode()
+		}, errOIDCState.Error()},
+		{"no login state cookie", func(t *testing.T, browser *http.Client, callback *url.URL) {
+			browser.Jar, _ = cookiejar.New(nil)
+		}, errOIDCState.Error()},
+		{"corrupted login state cookie", func(t *testing.T, browser *http.Client, callback *url.URL) {
+			cookieURL, _ := url.Parse(o.app.URL + oidcCookiePath)
+			browser.Jar.SetCookies(cookieURL, []*http.Cookie{{Name: oidcCookie, Value: "%%%", Path: oidcCookiePath}})
+		}, errOIDCState.Error()},
+		{"nonce of another login", func(t *testing.T, browser *http.Client, callback *url.URL) {
+			state, _ := o.loginState(t, browser)
+			state.Nonce = "forged"
+			o.setLoginState(t, browser, state)
+		}, "Single sign-on failed"},
+		{"PKCE verifier of another login", func(t *testing.T, browser *http.Client, callback *url.URL) {
+			state, _ := o.loginState(t, browser)
+			state.Verifier = strings.Repeat("x", len(state.Verifier))
+			o.setLoginState(t, browser, state)
+		}, "Single sign-on failed"},
+		{"refused at the provider", func(t *testing.T, browser *http.Client, callback *url.URL) {
+			query := callback.Query()
+			query.Del("code")
+			query.Set("error", "access_denied")
+			callback.RawQuery = query.Encode()
+		}, "Single sign-on failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			browser := newBrowser(t)
+			callback := o.authorize(t, browser, o.startLogin(t, browser))
+			tt.tamper(t, browser, callback)
+
+			target := redirection(t, browser, callback.String())
+			if reason := loginError(target); reason != tt.reason {
+				t.Errorf("login error %q, want %q", reason, tt.reason)
+			}
+			if user := o.currentUser(t, browser); user != nil {
+				t.Errorf("session opened for %s", user.Username)
+			}
+		})
+	}
+
+	if count, err := o.users.Count(); err != nil || count != 0 {
+		t.Errorf("%d users provisioned by failed logins", count)
+	}
+}
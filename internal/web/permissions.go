@@ -0,0 +1,242 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/db"
+)
+
+// Action is an operation allowed or refused by the role of a user
+type Action string
+
+// Actions on the files and on the application
+const (
+	ActionView     Action = "view"     // Browse the files, their metadata and thumbnails
+	ActionDownload Action = "download" // Preview or download the original files
+	ActionAnnotate Action = "annotate" // Tag, star and annotate the files
+	ActionUpload   Action = "upload"   // Upload files
+	ActionModify   Action = "modify"   // Delete, rename and move files
+	ActionShare    Action = "share"    // Create public links to files
+	ActionRescan   Action = "rescan"   // Scan the roots again
+	ActionReset    Action = "reset"    // Empty the index and scan the roots again
+	ActionManage   Action = "manage"   // Manage the users and read the metrics
+)
+
+// Refusals of an action on a file
+var (
+	errFileNotFound     = errors.New("File not found")
+	errPermissionDenied = errors.New("Permission denied")
+)
+
+// permissionMatrix lists the actions allowed to each role. Rescan, reset and manage apply to the whole
+// application: they are only checked against the role of the user, never against their scopes.
+var permissionMatrix = map[string]map[Action]bool{
+	db.RoleViewer: {
+		ActionView:     true,
+		ActionDownload: true,
+	},
+	db.RoleUploader: {
+		ActionView:     true,
+		ActionDownload: true,
+		ActionAnnotate: true,
+		ActionUpload:   true,
+		ActionShare:    true,
+	},
+	db.RoleAdmin: {
+		ActionView:     true,
+		ActionDownload: true,
+		ActionAnnotate: true,
+		ActionUpload:   true,
+		ActionModify:   true,
+		ActionShare:    true,
+		ActionRescan:   true,
+		ActionReset:    true,
+		ActionManage:   true,
+	},
+}
+
+// roleRank orders the roles from the least to the most privileged
+var roleRank = map[string]int{
+	db.RoleViewer:   1,
+	db.RoleUploader: 2,
+	db.RoleAdmin:    3,
+}
+
+// Allowed reports whether a role allows an action (never for an unknown role)
+func Allowed(role string, action Action) bool {
+	return permissionMatrix[role][action]
+}
+
+// effectiveRole returns the role of a user in a folder of a root: their role everywhere without
+// scopes, otherwise the most privileged role of the scopes containing the folder ("" if none).
+// rel is the path in the root, with forward slashes.
+func effectiveRole(user *db.User, scopes []db.Scope, rootID, rel string) string {
+	if user == nil {
+		return ""
+	}
+	if user.IsAdmin() || len(scopes) == 0 {
+		return user.Role
+	}
+
+	role := ""
+	for _, scope := range scopes {
+		if scope.RootID == rootID && inPrefix(scope.Prefix, rel) && roleRank[scope.Role] > roleRank[role] {
+			role = scope.Role
+		}
+	}
+	return role
+}
+
+// inPrefix reports whether a path of a root is within a folder of this root (empty: the root)
+func inPrefix(prefix, rel string) bool {
+	prefix = strings.Trim(prefix, "/")
+	return prefix == "" || rel == prefix || strings.HasPrefix(rel, prefix+"/")
+}
+
+// normalizePrefix cleans the folder of a scope ("" for the whole root), false if it leaves the root
+func normalizePrefix(prefix string) (string, bool) {
+	prefix = strings.Trim(strings.TrimSpace(filepath.ToSlash(prefix)), "/")
+	if prefix == "" {
+		return "", true
+	}
+	prefix = filepath.ToSlash(filepath.Clean(prefix))
+	if prefix == "." {
+		return "", true
+	}
+	if prefix == ".." || strings.HasPrefix(prefix, "../") {
+		return "", false
+	}
+	return prefix, true
+}
+
+// RequirePermission rejects the users whose role does not allow an application-wide action
+func (a *Auth) RequirePermission(action Action) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !a.Enabled() {
+				return next(c)
+			}
+			if user := currentUser(c); user == nil || !Allowed(user.Role, action) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": errPermissionDenied.Error(),
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// permitted reports whether the user of a request may do an action on a path of a root
+// (always when the authentication is disabled)
+func (h *Handlers) permitted(c echo.Context, action Action, rootID, path string) bool {
+	if !h.auth.Enabled() {
+		return true
+	}
+	return h.identityPermitted(currentIdentity(c), action, rootID, path)
+}
+
+// identityPermitted reports whether an identity may do an action on a path of a root
+func (h *Handlers) identityPermitted(identity *Identity, action Action, rootID, path string) bool {
+	if identity == nil {
+		return false
+	}
+
+	rel := ""
+	if root, ok := h.config.Root(rootID); ok && path != "" {
+		rel = relativeToRoot(root, path)
+	}
+	return Allowed(effectiveRole(identity.User, identity.Scopes, rootID, rel), action)
+}
+
+// permittedInRoot reports whether the user of a request may do an action somewhere in a root
+func (h *Handlers) permittedInRoot(c echo.Context, action Action, rootID string) bool {
+	if !h.auth.Enabled() {
+		return true
+	}
+	identity := currentIdentity(c)
+	if identity == nil {
+		return false
+	}
+	if identity.User.IsAdmin() || len(identity.Scopes) == 0 {
+		return Allowed(identity.User.Role, action)
+	}
+	for _, scope := range identity.Scopes {
+		if scope.RootID == rootID && Allowed(scope.Role, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadPermitted reports whether the user of a request may upload to at least one root
+func (h *Handlers) uploadPermitted(c echo.Context) bool {
+	for _, root := range h.config.Roots {
+		if h.permittedInRoot(c, ActionUpload, root.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// modifyPermitted reports whether the user of a request may delete, rename or move files in at least one root
+func (h *Handlers) modifyPermitted(c echo.Context) bool {
+	for _, root := range h.config.Roots {
+		if h.permittedInRoot(c, ActionModify, root.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleScopes returns the folders the user of a request may browse (nil: everything)
+func (h *Handlers) visibleScopes(c echo.Context) []db.PathScope {
+	if !h.auth.Enabled() {
+		return nil
+	}
+	return h.scopesFor(currentIdentity(c), ActionView)
+}
+
+// scopesFor returns the folders where an identity may do an action (nil: wherever its role allows it)
+func (h *Handlers) scopesFor(identity *Identity, action Action) []db.PathScope {
+	if identity == nil || identity.User.IsAdmin() || len(identity.Scopes) == 0 {
+		return nil
+	}
+
+	scopes := []db.PathScope{}
+	for _, scope := range identity.Scopes {
+		root, ok := h.config.Root(scope.RootID)
+		if !ok || !Allowed(scope.Role, action) {
+			continue
+		}
+		pathScope := db.PathScope{RootID: root.ID}
+		if scope.Prefix != "" {
+			pathScope.Dir = filepath.Join(root.Path, filepath.FromSlash(scope.Prefix))
+		}
+		scopes = append(scopes, pathScope)
+	}
+	return scopes
+}
+
+// fileForAction retrieves the file of the :id parameter if the user may do an action on it,
+// or the status and reason of the refusal. The files the user may not see are not found,
+// so that their existence is not disclosed.
+func (h *Handlers) fileForAction(c echo.Context, action Action) (*db.FileItem, int, error) {
+	return h.fileByID(c, c.Param("id"), action)
+}
+
+// fileByID retrieves a file if the user of a request may do an action on it, like fileForAction
+func (h *Handlers) fileByID(c echo.Context, id string, action Action) (*db.FileItem, int, error) {
+	item, err := h.repo.GetByID(id)
+	if err != nil || !h.permitted(c, ActionView, item.RootID, item.AbsPath) {
+		return nil, http.StatusNotFound, errFileNotFound
+	}
+	if !h.permitted(c, action, item.RootID, item.AbsPath) {
+		return nil, http.StatusForbidden, errPermissionDenied
+	}
+	return item, http.StatusOK, nil
+}
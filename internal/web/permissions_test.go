@@ -0,0 +1,153 @@
+package web
+
+import (
+	"testing"
+
+	"tokilane/internal/db"
+)
+
+func TestAllowed(t *testing.T) {
+	actions := []Action{ActionView, ActionDownload, ActionAnnotate, ActionUpload, ActionShare, ActionModify, ActionRescan, ActionReset, ActionManage}
+	expected := map[string][]Action{
+		db.RoleViewer:   {ActionView, ActionDownload},
+		db.RoleUploader: {ActionView, ActionDownload, ActionAnnotate, ActionUpload, ActionShare},
+		db.RoleAdmin:    {ActionView, ActionDownload, ActionAnnotate, ActionUpload, ActionShare, ActionModify, ActionRescan, ActionReset, ActionManage},
+		"":              {},
+		"user":          {}, // Legacy role, migrated on startup
+		"superuser":     {},
+	}
+
+	for role, allowed := range expected {
+		granted := make(map[Action]bool, len(allowed))
+		for _, action := range allowed {
+			granted[action] = true
+		}
+		for _, action := range actions {
+			if got := Allowed(role, action); got != granted[action] {
+				t.Errorf("Allowed(%q, %q) = %v, want %v", role, action, got, granted[action])
+			}
+		}
+	}
+}
+
+func TestPermissionMatrixKnowsEveryRole(t *testing.T) {
+	for role := range roleRank {
+		if _, ok := permissionMatrix[role]; !ok {
+			t.Errorf("role %q has no entry in the permission matrix", role)
+		}
+	}
+	for role := range permissionMatrix {
+		if _, ok := roleRank[role]; !ok {
+			t.Errorf("role %q of the permission matrix has no rank", role)
+		}
+	}
+}
+
+func TestEffectiveRole(t *testing.T) {
+	viewer := &db.User{Role: db.RoleViewer}
+	uploader := &db.User{Role: db.RoleUploader}
+	admin := &db.User{Role: db.RoleAdmin}
+
+	overlapping := []db.Scope{
+		{RootID: "photos", Prefix: "family", Role: db.RoleViewer},
+		{RootID: "photos", Prefix: "family/kids", Role: db.RoleUploader},
+		{RootID: "scans", Prefix: "", Role: db.RoleViewer},
+	}
+	sharedStart := []db.Scope{
+		{RootID: "photos", Prefix: "a", Role: db.RoleUploader},
+		{RootID: "photos", Prefix: "ab/", Role: db.RoleViewer},
+	}
+
+	tests := []struct {
+		name   string
+		user   *db.User
+		scopes []db.Scope
+		root   string
+		rel    string
+		want   string
+	}{
+		{"no user", nil, nil, "photos", "x.jpg", ""},
+		{"unscoped viewer", viewer, nil, "photos", "x.jpg", db.RoleViewer},
+		{"unscoped uploader", uploader, nil, "scans", "2020/x.pdf", db.RoleUploader},
+		{"admin ignores scopes", admin, overlapping, "docs", "x.pdf", db.RoleAdmin},
+		{"scope folder itself", uploader, overlapping, "photos", "family", db.RoleViewer},
+		{"inside outer scope", uploader, overlapping, "photos", "family/x.jpg", db.RoleViewer},
+		{"inside both scopes: most privileged", uploader, overlapping, "photos", "family/kids/x.jpg", db.RoleUploader},
+		{"outside the scopes", uploader, overlapping, "photos", "work/x.jpg", ""},
+		{"root top outside prefixed scopes", uploader, overlapping, "photos", "", ""},
+		{"whole root scope", uploader, overlapping, "scans", "2020/x.pdf", db.RoleViewer},
+		{"other root", uploader, overlapping, "docs", "x.pdf", ""},
+		{"prefix a does not cover ab", viewer, sharedStart, "photos", "ab/x.jpg", db.RoleViewer},
+		{"prefix a covers a/", viewer, sharedStart, "photos", "a/x.jpg", db.RoleUploader},
+		{"prefix a does not cover abc", viewer, sharedStart, "photos", "abc/x.jpg", ""},
+		{"scope role above user role", viewer, sharedStart, "photos", "a/b/x.jpg", db.RoleUploader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := effectiveRole(tt.user, tt.scopes, tt.root, tt.rel); got != tt.want {
+				t.Errorf("effectiveRole(%q, %q) = %q, want %q", tt.root, tt.rel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		rel    string
+		want   bool
+	}{
+		{"", "anything/x.jpg", true},
+		{"", "", true},
+		{"a", "a", true},
+		{"a", "a/x.jpg", true},
+		{"a", "ab", false},
+		{"a", "ab/x.jpg", false},
+		{"ab/", "ab/x.jpg", true},
+		{"ab/", "a/x.jpg", false},
+		{"/family/", "family/x.jpg", true},
+		{"family/kids", "family/x.jpg", false},
+		{"family/kids", "family/kids2/x.jpg", false},
+		{"family", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := inPrefix(tt.prefix, tt.rel); got != tt.want {
+			t.Errorf("inPrefix(%q, %q) = %v, want %v", tt.prefix, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizePrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+		ok     bool
+	}{
+		{"", "", true},
+		{"  ", "", true},
+		{"/", "", true},
+		{".", "", true},
+		{"family", "family", true},
+		{"/family/kids/", "family/kids", true},
+		{" family ", "family", true},
+		{"family//kids", "family/kids", true},
+		{"family/./kids", "family/kids", true},
+		{"family/..", "", true},
+		{"family/../work", "work", true},
+		{"..", "", false},
+		{"../photos", "", false},
+		{"/../photos", "", false},
+		{"family/../..", "", false},
+		{"family/../../etc", "", false},
+		{"..family", "..family", true}, // A folder whose name starts with two dots
+	}
+
+	for _, tt := range tests {
+		got, ok := normalizePrefix(tt.prefix)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizePrefix(%q) = %q, %v, want %q, %v", tt.prefix, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package web
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/config"
+	"tokilane/internal/content"
+	"tokilane/internal/db"
+)
+
+// conflictPolicy is what an upload does when a file with the same name exists
+type conflictPolicy string
+
+const (
+	conflictRename        conflictPolicy = "rename"         // Keep both, adding a numeric suffix to the new file
+	conflictOverwrite     conflictPolicy = "overwrite"      // Replace the existing file, keeping its record and annotations
+	conflictSkip          conflictPolicy = "skip"           // Keep the existing file
+	conflictSkipIdentical conflictPolicy = "skip-identical" // Keep the existing file if it has the same content, rename otherwise
+)
+
+// parseConflictPolicy parses the conflict policy of a request (rename by default)
+func parseConflictPolicy(value string) (conflictPolicy, error) {
+	switch policy := conflictPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "":
+		return conflictRename, nil
+	case conflictRename, conflictOverwrite, conflictSkip, conflictSkipIdentical:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("Unknown conflict policy: %s (rename, overwrite, skip or skip-identical)", value)
+	}
+}
+
+// Status of an uploaded file
+const (
+	uploadCreated     = "created"
+	uploadRenamed     = "renamed"
+	uploadOverwritten = "overwritten"
+	uploadSkipped     = "skipped"
+	uploadFailed      = "failed"
+)
+
+// overwritePermitted reports whether the user of a request may use a conflict policy in a
+// folder: replacing a file destroys it, so overwriting requires the right to modify files
+func (h *Handlers) overwritePermitted(c echo.Context, policy conflictPolicy, rootID, dir string) bool {
+	return policy != conflictOverwrite || h.permitted(c, ActionModify, rootID, dir)
+}
+
+// uploadOutcome is the result of the upload of a file
+type uploadOutcome struct {
+	Name   string               `json:"name"`             // Name sent by the client
+	Status string               `json:"status"`           // created, renamed, overwritten, skipped or failed
+	Path   string               `json:"path,omitempty"`   // Path of the stored (or kept) file in its root
+	File   *db.FileItemResponse `json:"file,omitempty"`   // Indexed file (the existing one when skipped)
+	Reason string               `json:"reason,omitempty"` // Why the file was skipped, failed or not indexed
+}
+
+// uploadSource is the content of an uploaded file
+type uploadSource struct {
+	Name  string
+	Open  func() (io.ReadCloser, error) // Reads the content, to compare it with an existing file
+	Store func(path string) error       // Writes the content to a new file
+}
+
+// uploadFolder creates the destination directory of an upload from a folder relative to its
+// root. Without folder, files go to the upload directory of the current month.
+func uploadFolder(root *config.RootConfig, folder string) (string, error) {
+	if cleanFolder(folder) == "" {
+		return uploadDirectory(root)
+	}
+	return createFolder(root, folder)
+}
+
+// createFolder creates a folder relative to a root (the root itself when empty), refusing the
+// hidden folders and the paths leading outside of the root
+func createFolder(root *config.RootConfig, folder string) (string, error) {
+	dir, err := resolveFolder(root, folder)
+	if err != nil {
+		return "", err
+	}
+	if err := makeFolder(root, dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// resolveFolder returns the directory of a folder relative to a root without creating it,
+// refusing the hidden folders and the paths leading outside of the root
+func resolveFolder(root *config.RootConfig, folder string) (string, error) {
+	folder = cleanFolder(folder)
+	dir := filepath.Join(root.Path, folder)
+	if err := content.ValidatePath(root.Path, dir); err != nil {
+		return "", fmt.Errorf("Invalid folder: %s", folder)
+	}
+	if folder != "" {
+		for _, part := range strings.Split(filepath.Clean(folder), string(filepath.Separator)) {
+			if content.IsHiddenFile(part) {
+				return "", fmt.Errorf("Invalid folder: %s", folder)
+			}
+		}
+	}
+	return dir, nil
+}
+
+// makeFolder creates a directory of a root resolved by resolveFolder
+func makeFolder(root *config.RootConfig, dir string) error {
+	folder := relativeToRoot(root, dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("Unable to create the folder %s", folder)
+	}
+
+	// A symbolic link could lead outside of the root
+	resolvedRoot, err := filepath.EvalSymlinks(root.Path)
+	if err != nil {
+		return err
+	}
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if err := content.ValidatePath(resolvedRoot, resolvedDir); err != nil {
+		return fmt.Errorf("Invalid folder: %s", folder)
+	}
+	return nil
+}
+
+// folderPath returns the destination directory of an upload without creating it (the upload
+// directory of the current month without folder)
+func folderPath(root *config.RootConfig, folder string) string {
+	folder = cleanFolder(folder)
+	if folder == "" {
+		now := time.Now()
+		return filepath.Join(root.Path, "uploads", now.Format("2006"), now.Format("01"))
+	}
+	return filepath.Join(root.Path, folder)
+}
+
+// cleanFolder trims the spaces and separators around a folder relative to a root
+func cleanFolder(folder string) string {
+	return strings.Trim(strings.TrimSpace(filepath.FromSlash(folder)), string(filepath.Separator))
+}
+
+// relativeToRoot returns the path of a file in its root, with forward slashes
+func relativeToRoot(root *config.RootConfig, path string) string {
+	rel, err := filepath.Rel(root.Path, path)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// placeUpload stores an uploaded file in a folder according to the conflict policy, then
+// applies its client dates and indexes it. The content is written to a hidden temporary
+// file first, so that the watcher never sees a partial file.
+func (h *Handlers) placeUpload(root *config.RootConfig, dir string, source uploadSource, policy conflictPolicy, times clientTimes) uploadOutcome {
+	outcome := uploadOutcome{Name: source.Name}
+	failed := func(reason string) uploadOutcome {
+		outcome.Status = uploadFailed
+		outcome.Reason = reason
+		return outcome
+	}
+
+	destPath := filepath.Join(dir, source.Name)
+	status := uploadCreated
+	if stat, err := os.Stat(destPath); err == nil {
+		if stat.IsDir() && policy != conflictRename {
+			return failed("a folder has the same name")
+		}
+
+		switch policy {
+		case conflictSkip:
+			return h.skippedUpload(outcome, root, destPath, "a file with the same name exists")
+		case conflictSkipIdentical:
+			identical, err := sameContent(source, destPath)
+			if err != nil {
+				return failed(err.Error())
+			}
+			if identical {
+				return h.skippedUpload(outcome, root, destPath, "identical content")
+			}
+			destPath, status = availablePath(dir, source.Name), uploadRenamed
+		case conflictOverwrite:
+			status = uploadOverwritten
+		default:
+			destPath, status = availablePath(dir, source.Name), uploadRenamed
+		}
+	}
+
+	tmpPath := filepath.Join(dir, ".tokilane-upload-"+uuid.New().String())
+	if err := source.Store(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return failed(err.Error())
+	}
+	var err error
+	if destPath, status, err = moveUpload(tmpPath, dir, source.Name, destPath, status); err != nil {
+		os.Remove(tmpPath)
+		return failed(err.Error())
+	}
+
+	outcome.Status = status
+	outcome.Path = relativeToRoot(root, destPath)
+
+	item, err := h.indexUploadedFile(destPath, times)
+	if err != nil {
+		outcome.Reason = err.Error()
+		return outcome
+	}
+	response := item.ToResponse()
+	outcome.File = &response
+	return outcome
+}
+
+// maxPlacementAttempts bounds the names tried when other files keep taking the free names
+const maxPlacementAttempts = 100
+
+// moveUpload moves the temporary file of an upload to its destination and returns where it
+// went. Only an overwrite replaces a file: otherwise, when another file took the name since it
+// was chosen, the next free name is used and the upload is reported as renamed.
+func moveUpload(tmpPath, dir, name, destPath, status string) (string, string, error) {
+	if status == uploadOverwritten {
+		return destPath, status, os.Rename(tmpPath, destPath)
+	}
+	for attempt := 0; attempt < maxPlacementAttempts; attempt++ {
+		err := content.MoveNoReplace(tmpPath, destPath)
+		if !errors.Is(err, content.ErrDestinationExists) {
+			return destPath, status, err
+		}
+		destPath, status = availablePath(dir, name), uploadRenamed
+	}
+	return destPath, status, fmt.Errorf("no free name for %s", name)
+}
+
+// skippedUpload reports an upload skipped in favour of an existing file
+func (h *Handlers) skippedUpload(outcome uploadOutcome, root *config.RootConfig, existingPath, reason string) uploadOutcome {
+	outcome.Status = uploadSkipped
+	outcome.Reason = reason
+	outcome.Path = relativeToRoot(root, existingPath)
+	if item, err := h.repo.GetByPath(existingPath); err == nil {
+		response := item.ToResponse()
+		outcome.File = &response
+	}
+	return outcome
+}
+
+// checkUploadContent verifies that the content of an upload matches its extension and that
+// its type is allowed
+func (h *Handlers) checkUploadContent(source uploadSource) error {
+	reader, err := source.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	mimeType, err := content.VerifyContentType(reader, source.Name)
+	if err != nil {
+		return err
+	}
+	if !h.config.IsAllowedMime(mimeType) {
+		return fmt.Errorf("type not allowed: %s", mimeType)
+	}
+	return nil
+}
+
+// sameContent compares an uploaded file with an existing one
+func sameContent(source uploadSource, path string) (bool, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	reader, err := source.Open()
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, reader)
+	if err != nil {
+		return false, err
+	}
+	if size != stat.Size() {
+		return false, nil
+	}
+
+	existingHash, err := content.ComputeContentHash(path)
+	if err != nil {
+		return false, err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)) == existingHash, nil
+}
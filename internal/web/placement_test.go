@@ -0,0 +1,275 @@
+package web
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/db"
+)
+
+// testSource is an upload with the given content
+func testSource(name, data string) uploadSource {
+	return uploadSource{
+		Name: name,
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(data)), nil
+		},
+		Store: func(path string) error {
+			return os.WriteFile(path, []byte(data), 0644)
+		},
+	}
+}
+
+// readTestFile returns the content of a file of a test, or "" when it does not exist
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestPlaceUploadConflictPolicies(t *testing.T) {
+	tests := []struct {
+		policy  conflictPolicy
+		upload  string
+		status  string
+		path    string
+		content map[string]string // Content of the files of the folder afterwards
+	}{
+		{conflictRename, "new", uploadRenamed, "notes_1.txt", map[string]string{"notes.txt": "old", "notes_1.txt": "new"}},
+		{conflictOverwrite, "new", uploadOverwritten, "notes.txt", map[string]string{"notes.txt": "new", "notes_1.txt": ""}},
+		{conflictSkip, "new", uploadSkipped, "notes.txt", map[string]string{"notes.txt": "old", "notes_1.txt": ""}},
+		{conflictSkipIdentical, "old", uploadSkipped, "notes.txt", map[string]string{"notes.txt": "old", "notes_1.txt": ""}},
+		{conflictSkipIdentical, "new", uploadRenamed, "notes_1.txt", map[string]string{"notes.txt": "old", "notes_1.txt": "new"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy)+" "+tt.upload, func(t *testing.T) {
+			u := newUploadTest(t)
+			existing := filepath.Join(u.rootPath, "notes.txt")
+			if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			kept, err := u.handlers.indexer.IndexPath(existing, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			outcome := u.handlers.placeUpload(u.root, u.rootPath, testSource("notes.txt", tt.upload), tt.policy, clientTimes{})
+			if outcome.Status != tt.status || outcome.Path != tt.path {
+				t.Fatalf("outcome %+v, want %s at %s", outcome, tt.status, tt.path)
+			}
+			for name, want := range tt.content {
+				if got := readTestFile(t, filepath.Join(u.rootPath, name)); got != want {
+					t.Errorf("%s contains %q, want %q", name, got, want)
+				}
+			}
+
+			// The kept or replaced file keeps its record
+			if outcome.File == nil {
+				t.Fatalf("no file returned: %s", outcome.Reason)
+			}
+			if tt.path == "notes.txt" && outcome.File.ID != kept.ID {
+				t.Errorf("file %s returned, want the record %s of the existing file", outcome.File.ID, kept.ID)
+			}
+		})
+	}
+
+	// Without conflict, every policy creates the file
+	u := newUploadTest(t)
+	outcome := u.handlers.placeUpload(u.root, u.rootPath, testSource("new.txt", "data"), conflictSkip, clientTimes{})
+	if outcome.Status != uploadCreated || readTestFile(t, filepath.Join(u.rootPath, "new.txt")) != "data" {
+		t.Errorf("upload without conflict: %+v", outcome)
+	}
+}
+
+func TestPlaceUploadNeverReplacesConcurrentFile(t *testing.T) {
+	for _, policy := range []conflictPolicy{conflictRename, conflictSkip, conflictSkipIdentical} {
+		t.Run(string(policy), func(t *testing.T) {
+			u := newUploadTest(t)
+			concurrent := filepath.Join(u.rootPath, "notes.txt")
+
+			// A file synced in while the upload is written, after the name was checked
+			source := testSource("notes.txt", "uploaded")
+			store := source.Store
+			source.Store = func(path string) error {
+				if err := os.WriteFile(concurrent, []byte("synced"), 0644); err != nil {
+					return err
+				}
+				return store(path)
+			}
+
+			outcome := u.handlers.placeUpload(u.root, u.rootPath, source, policy, clientTimes{})
+			if outcome.Status != uploadRenamed || outcome.Path != "notes_1.txt" {
+				t.Errorf("outcome %+v, want renamed to notes_1.txt", outcome)
+			}
+			if got := readTestFile(t, concurrent); got != "synced" {
+				t.Errorf("concurrent file replaced: %q", got)
+			}
+			if got := readTestFile(t, filepath.Join(u.rootPath, "notes_1.txt")); got != "uploaded" {
+				t.Errorf("upload stored as %q", got)
+			}
+		})
+	}
+}
+
+// multipartUpload builds the request of a form upload of one file to a folder
+func multipartUpload(t *testing.T, folder, name, data, conflict string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for field, value := range map[string]string{"folder": folder, "conflict": conflict} {
+		if err := form.WriteField(field, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	part, err := form.CreateFormFile("files", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	return request
+}
+
+func TestOverwriteRequiresModify(t *testing.T) {
+	u := newUploadTest(t)
+	h := u.handlers
+	uploader := &Identity{User: &db.User{ID: 1, Username: "alice", Role: db.RoleUploader}}
+	admin := &Identity{User: &db.User{ID: 2, Username: "admin", Role: db.RoleAdmin}}
+	existing := filepath.Join(u.rootPath, "docs", "notes.txt")
+	if err := os.MkdirAll(filepath.Dir(existing), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	formUpload := func(identity *Identity, conflict string) int {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(multipartUpload(t, "docs", "notes.txt", "new", conflict), rec)
+		c.Set(contextIdentity, identity)
+		if err := h.UploadFiles(c); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code
+	}
+
+	// An uploader cannot replace files, by a form or by a resumable upload
+	if status := formUpload(uploader, "overwrite"); status != http.StatusForbidden {
+		t.Errorf("form overwrite by an uploader: status %d, want 403", status)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/api/uploads", nil)
+	request.Header.Set("Tus-Resumable", tusVersion)
+	request.Header.Set("Upload-Length", "3")
+	request.Header.Set("Upload-Metadata", formatUploadMetadata(map[string]string{"filename": "notes.txt", "folder": "docs", "conflict": "overwrite"}))
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(request, rec)
+	c.Set(contextIdentity, uploader)
+	if err := h.CreateUpload(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("resumable overwrite by an uploader: status %d, want 403", rec.Code)
+	}
+
+	// Nor complete an overwrite started before their role changed
+	upload, err := u.store.Create(3, map[string]string{"filename": "notes.txt", "folder": "docs", "conflict": "overwrite"}, uploader.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := u.request(uploader, http.MethodPatch, upload.ID, "new", h.PatchUpload); rec.Code != http.StatusForbidden {
+		t.Errorf("completion of an overwrite by an uploader: status %d, want 403", rec.Code)
+	}
+	if got := readTestFile(t, existing); got != "old" {
+		t.Fatalf("file replaced by an uploader: %q", got)
+	}
+
+	// The other policies remain allowed, and an admin may overwrite
+	if status := formUpload(uploader, "rename"); status != http.StatusOK {
+		t.Errorf("form rename by an uploader: status %d", status)
+	}
+	if status := formUpload(admin, "overwrite"); status != http.StatusOK {
+		t.Errorf("form overwrite by an admin: status %d", status)
+	}
+	if got := readTestFile(t, existing); got != "new" {
+		t.Errorf("file not replaced by an admin: %q", got)
+	}
+}
+
+func TestCheckUploadContent(t *testing.T) {
+	jpeg := "\xFF\xD8\xFF\xE0\x00\x10JFIF\x00" + strings.Repeat("\x00", 64)
+	html := "<!DOCTYPE html>\n<html><body><script>alert(document.cookie)</script></body></html>\n"
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		allowed []string // ALLOWED_MIME
+		denied  []string // DENIED_MIME
+		wantErr string
+	}{
+		{"allowed type", "photo.jpg", jpeg, nil, nil, ""},
+		{"allowed by a wildcard", "photo.jpg", jpeg, []string{"image/*"}, nil, ""},
+		{"text allowed by a wildcard", "notes.txt", "notes\n", []string{"text/*", "image/*"}, nil, ""},
+		{"HTML as a JPEG image", "photo.jpg", html, nil, nil, "content does not match"},
+		{"not in the allowed types", "notes.txt", "notes\n", []string{"image/*"}, nil, "type not allowed: text/plain"},
+		{"denied type", "photo.jpg", jpeg, nil, []string{"image/jpeg"}, "type not allowed: image/jpeg"},
+		{"denied before allowed", "photo.jpg", jpeg, []string{"image/*"}, []string{"image/jpeg"}, "type not allowed: image/jpeg"},
+		{"denied by a wildcard", "notes.txt", "notes\n", nil, []string{"text/*"}, "type not allowed: text/plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newUploadTest(t)
+			u.handlers.config.AllowedMime, u.handlers.config.DeniedMime = tt.allowed, tt.denied
+
+			err := u.handlers.checkUploadContent(testSource(tt.file, tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("upload of %s refused: %v", tt.file, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("upload of %s: error %v, want %q", tt.file, err, tt.wantErr)
+			}
+		})
+	}
+
+	// A form upload of a mismatched file fails without writing it
+	u := newUploadTest(t)
+	u.handlers.config.AllowedExt = append(u.handlers.config.AllowedExt, ".jpg")
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(multipartUpload(t, "", "photo.jpg", html, ""), rec)
+	c.Set(contextIdentity, &Identity{User: &db.User{ID: 1, Username: "alice", Role: db.RoleUploader}})
+	if err := u.handlers.UploadFiles(c); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rec.Body.String(), "content does not match") {
+		t.Errorf("upload of HTML as a JPEG image answered %d %s", rec.Code, rec.Body.String())
+	}
+	filepath.WalkDir(u.rootPath, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			t.Errorf("refused upload written: %s", path)
+		}
+		return nil
+	})
+}
@@ -2,9 +2,12 @@ package web
 
 import (
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -12,6 +15,7 @@ import (
 	"tokilane/internal/config"
 	"tokilane/internal/db"
 	"tokilane/internal/content"
+	"tokilane/internal/uploads"
 )
 
 // Server represents the web server
@@ -19,6 +23,9 @@ type Server struct {
 	echo     *echo.Echo
 	config   *config.Config
 	handlers *Handlers
+	events   *EventBroker
+	uploads  *uploads.Store
+	auth     *Auth
 }
 
 // NewServer creates a new server
@@ -30,18 +37,61 @@ func NewServer(cfg *config.Config, database *db.Database, indexer *content.Index
 	if cfg.Debug {
 		e.Debug = true
 	}
+	e.IPExtractor = clientIPExtractor(cfg.TrustedProxies)
 
 	// Repository and services
 	repo := db.NewFileItemRepository(database)
+	annotations := db.NewAnnotationRepository(database)
 	thumbnailSvc := content.NewThumbnailService(cfg.DBPath + "/../thumbs")
 	
+	// Real-time events broker
+	events := NewEventBroker(cfg.EventReplaySize)
+
+	// Partial files of the resumable uploads, next to the database and outside the roots
+	var resumable *uploads.Store
+	if cfg.EnableUpload {
+		store, err := uploads.NewStore(filepath.Join(filepath.Dir(cfg.DBPath), "uploads"), time.Duration(cfg.ResumableExpiry)*time.Hour)
+		if err != nil {
+			log.Printf("Resumable uploads disabled: %v", err)
+		} else {
+			resumable = store
+		}
+	}
+
+	// Authentication (the administrator is created on first start)
+	users := db.NewUserRepository(database)
+	auth := NewAuth(cfg, users)
+	if auth.Enabled() {
+		if err := auth.Bootstrap(); err != nil {
+			log.Printf("Error creating the administrator account: %v", err)
+		}
+	}
+	var sso *OIDC
+	if auth.Enabled() {
+		sso = NewOIDC(cfg, users)
+	}
+
+	// Public links to files, signed with a key kept next to the database
+	var shares *ShareLinks
+	if cfg.SharesEnabled {
+		links, err := NewShareLinks(cfg, db.NewShareRepository(database))
+		if err != nil {
+			log.Printf("Share links disabled: %v", err)
+		} else {
+			shares = links
+		}
+	}
+
 	// Handlers
-	handlers := NewHandlers(cfg, repo, thumbnailSvc, indexer)
+	handlers := NewHandlers(cfg, repo, annotations, thumbnailSvc, indexer, events, resumable, users, auth, sso, shares)
 
 	server := &Server{
 		echo:     e,
 		config:   cfg,
 		handlers: handlers,
+		events:   events,
+		uploads:  resumable,
+		auth:     auth,
 	}
 
 	server.setupMiddleware()
@@ -62,13 +112,29 @@ func (s *Server) setupMiddleware() {
 
 	// CORS
 	s.echo.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
+		// Plain OPTIONS requests (not preflights) describe the resumable upload protocol
+		Skipper: func(c echo.Context) bool {
+			request := c.Request()
+			return request.Method == http.MethodOptions && strings.HasPrefix(request.URL.Path, "/api/uploads") &&
+				request.Header.Get(echo.HeaderAccessControlRequestMethod) == ""
+		},
+		AllowOrigins: s.config.CORSOrigins,
+		// Browsers only send the session cookie to the origins listed explicitly
+		AllowCredentials: !allowsAnyOrigin(s.config.CORSOrigins),
+		AllowMethods: []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
 		AllowHeaders: []string{"*"},
+		// Headers of the resumable upload protocol read by browser clients
+		ExposeHeaders: []string{"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Tus-Checksum-Algorithm", "Upload-Offset", "Upload-Length", "Upload-Metadata", "Upload-Expires"},
 	}))
 
-	// Gzip
-	s.echo.Use(middleware.Gzip())
+	// Gzip (except for the event stream, which must be flushed as it goes,
+	// and the resumable uploads, whose responses are headers only)
+	s.echo.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+		Skipper: func(c echo.Context) bool {
+			path := c.Request().URL.Path
+			return path == "/api/events" || strings.HasPrefix(path, "/api/uploads")
+		},
+	}))
 
 	// Security headers
 	s.echo.Use(middleware.SecureWithConfig(middleware.SecureConfig{
@@ -100,22 +166,105 @@ func (s *Server) setupMiddleware() {
 
 // setupRoutes configure the routes
 func (s *Server) setupRoutes() {
-	// API routes
-	api := s.echo.Group("/api")
+	// Login (public)
+	s.echo.GET("/api/auth/status", s.handlers.GetAuthStatus)
+	if s.auth.Enabled() {
+		s.echo.POST("/api/auth/login", s.handlers.Login)
+	}
+	if s.handlers.oidc != nil {
+		s.echo.GET("/api/auth/oidc/login", s.handlers.OIDCLogin)
+		s.echo.GET("/api/auth/oidc/callback", s.handlers.OIDCCallback)
+	}
+
+	// Share links (public, the token is checked by the handlers)
+	if s.handlers.shares != nil {
+		s.echo.GET("/s/:token", s.handlers.TimelinePage)
+		s.echo.GET("/s/:token/files/:id/preview", s.handlers.SharePreview)
+		s.echo.GET("/s/:token/files/:id/thumb", s.handlers.ShareThumbnail)
+		s.echo.GET("/api/s/:token", s.handlers.OpenShare)
+		s.echo.POST("/api/s/:token/unlock", s.handlers.UnlockShare)
+	}
+
+	// API routes (login required when the authentication is enabled)
+	api := s.echo.Group("/api", s.auth.Middleware())
 	{
 		api.GET("/config", s.handlers.GetAppConfig)
 		api.GET("/timeline", s.handlers.GetTimelineData)
 		api.GET("/files", s.handlers.ListFiles)
 		api.GET("/files/:id", s.handlers.GetFile)
+		api.GET("/tags", s.handlers.ListTags)
+		api.GET("/duplicates", s.handlers.GetDuplicates)
+		api.GET("/similar", s.handlers.GetSimilarClusters)
+		api.GET("/files/:id/similar", s.handlers.GetSimilarFiles)
+
+		// Annotations
+		api.GET("/files/:id/tags", s.handlers.GetFileTags)
+		api.PUT("/files/:id/tags", s.handlers.SetFileTags)
+		api.POST("/files/:id/tags", s.handlers.SetFileTags)
+		api.DELETE("/files/:id/tags/:tag", s.handlers.DeleteFileTag)
+		api.PUT("/files/:id/favorite", s.handlers.SetFileFavorite)
+		api.DELETE("/files/:id/favorite", s.handlers.SetFileFavorite)
+		api.GET("/files/:id/notes", s.handlers.GetFileNotes)
+		api.POST("/files/:id/notes", s.handlers.CreateFileNote)
+		api.PUT("/files/:id/notes/:noteId", s.handlers.UpdateFileNote)
+		api.DELETE("/files/:id/notes/:noteId", s.handlers.DeleteFileNote)
+		api.GET("/events", s.handlers.StreamEvents)
+
+		// Share links of the current user
+		if s.handlers.shares != nil {
+			api.GET("/shares", s.handlers.ListShares)
+			api.POST("/shares", s.handlers.CreateShare)
+			api.DELETE("/shares/:id", s.handlers.RevokeShare)
+		}
+
+		// Administration
+		api.GET("/metrics", s.handlers.GetMetrics, s.auth.RequirePermission(ActionManage))
+		api.POST("/rescan", s.handlers.Rescan, s.auth.RequirePermission(ActionRescan))
+		api.POST("/reset", s.handlers.ResetIndex, s.auth.RequirePermission(ActionReset))
 		
+		// Account of the current user, and users management
+		if s.auth.Enabled() {
+			api.POST("/auth/logout", s.handlers.Logout)
+			api.PUT("/auth/password", s.handlers.ChangePassword)
+			api.GET("/auth/tokens", s.handlers.ListTokens)
+			api.POST("/auth/tokens", s.handlers.CreateToken)
+			api.DELETE("/auth/tokens/:id", s.handlers.DeleteToken)
+
+			admin := api.Group("/users", s.auth.RequirePermission(ActionManage))
+			admin.GET("", s.handlers.ListUsers)
+			admin.POST("", s.handlers.CreateUser)
+			admin.PUT("/:id", s.handlers.UpdateUser)
+			admin.DELETE("/:id", s.handlers.DeleteUser)
+			admin.GET("/:id/scopes", s.handlers.GetUserScopes)
+			admin.PUT("/:id/scopes", s.handlers.SetUserScopes)
+		}
+
 		// Upload (if enabled)
 		if s.config.EnableUpload {
 			api.POST("/upload", s.handlers.UploadFiles)
 		}
+
+		// Deleting, renaming and moving files (if enabled)
+		if s.config.EnableFileOperations {
+			api.DELETE("/files/:id", s.handlers.DeleteFile)
+			api.PATCH("/files/:id", s.handlers.RenameFile)
+			api.POST("/files/:id/move", s.handlers.MoveFile)
+		}
+
+		// Resumable uploads (tus protocol)
+		if s.uploads != nil {
+			api.OPTIONS("/uploads", s.handlers.TusOptions)
+			api.POST("/uploads", s.handlers.CreateUpload)
+			api.OPTIONS("/uploads/:id", s.handlers.TusOptions)
+			api.HEAD("/uploads/:id", s.handlers.HeadUpload)
+			api.PATCH("/uploads/:id", s.handlers.PatchUpload)
+			api.DELETE("/uploads/:id", s.handlers.DeleteUpload)
+			api.GET("/uploads/:id", s.handlers.GetUpload)
+		}
 	}
 
 	// Routes for serving files
-	files := s.echo.Group("/files")
+	files := s.echo.Group("/files", s.auth.Middleware())
 	{
 		files.GET("/:id/preview", s.handlers.PreviewFile)
 		files.GET("/:id/thumb", s.handlers.ThumbnailFile)
@@ -131,6 +280,30 @@ func (s *Server) setupRoutes() {
 	}
 }
 
+// allowsAnyOrigin checks if the CORS origins contain the wildcard
+func allowsAnyOrigin(origins []string) bool {
+	for _, origin := range origins {
+		if strings.TrimSpace(origin) == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIPExtractor reads the address of the clients, used by the lockouts and the logs: the
+// address of the connection, or the X-Forwarded-For header set by one of the trusted proxies.
+// The headers are never trusted otherwise, since any client can send them.
+func clientIPExtractor(proxies []*net.IPNet) echo.IPExtractor {
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range proxies {
+		options = append(options, echo.TrustIPRange(proxy))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
 // setupDevProxy configure the proxy to Vite in development
 func (s *Server) setupDevProxy() {
 	// In development mode, we can either:
@@ -150,16 +323,27 @@ func (s *Server) Start() error {
 	
 	if s.config.Debug {
 		log.Println("Debug mode activated")
-		log.Printf("Files folder: %s", s.config.FilesRoot)
+		for _, root := range s.config.Roots {
+			log.Printf("Files folder (%s): %s", root.ID, root.Path)
+		}
 		log.Printf("Upload activated: %v", s.config.EnableUpload)
+		log.Printf("File operations activated: %v", s.config.EnableFileOperations)
 	}
 
 	return s.echo.Start(addr)
 }
 
+// PublishEvent sends a file event to the connected browsers
+func (s *Server) PublishEvent(event content.FileEvent) {
+	s.events.Publish(event)
+}
+
 // Stop stops the server
 func (s *Server) Stop() error {
 	log.Println("Stopping server...")
+	if s.uploads != nil {
+		s.uploads.Close()
+	}
 	return s.echo.Close()
 }
 
@@ -170,6 +354,7 @@ func (s *Server) HealthCheck(c echo.Context) error {
 		"version":      "1.0.0",
 		"upload":       s.config.EnableUpload,
 		"files_root":   s.config.FilesRoot,
+		"roots":        len(s.config.Roots),
 		"allowed_ext":  s.config.AllowedExt,
 	})
 }
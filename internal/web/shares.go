@@ -0,0 +1,775 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+
+	"tokilane/internal/config"
+	"tokilane/internal/db"
+)
+
+// File storing the generated key of the share links, next to the database
+const shareKeyFile = "share.key"
+
+// Prefix of the cookies proving that the password of a share was given, followed by its ID
+const shareCookiePrefix = "tokilane_share_"
+
+// Maximum length of the name of a share link
+const maxShareNameLength = 200
+
+// Number of files per page of a shared set of files
+const sharePageSize = 100
+
+// Lockout after wrong passwords, per share link or username and per client address: the first
+// failures are free, then each failure doubles the delay before the next attempt
+const (
+	unlockFreeFailures = 5
+	unlockBaseDelay    = time.Second
+	unlockMaxDelay     = 15 * time.Minute
+	unlockForgetAfter  = time.Hour // Failures forgotten after this time without a new one
+	unlockMaxEntries   = 10000     // Tracked shares and addresses before the forgotten ones are removed
+)
+
+// Refusals of a share link
+var (
+	errShareNotFound        = errors.New("Share link not found")
+	errShareExpired         = errors.New("Share link expired")
+	errShareRevoked         = errors.New("Share link revoked")
+	errSharePasswordNeeded  = errors.New("Password required")
+	errSharePasswordInvalid = errors.New("Invalid password")
+	errShareTooManyAttempts = errors.New("Too many wrong passwords, try again later")
+)
+
+// shareErrorCodes identify the refusals of a share link for the frontend, which translates them
+var shareErrorCodes = map[error]string{
+	errShareNotFound:        "not_found",
+	errShareExpired:         "expired",
+	errShareRevoked:         "revoked",
+	errSharePasswordNeeded:  "password_required",
+	errSharePasswordInvalid: "invalid_password",
+	errShareTooManyAttempts: "too_many_attempts",
+	errFileNotFound:         "not_found",
+}
+
+// ShareLinks signs and resolves the public links to files. A token is the ID of the share, its
+// expiry and an HMAC of both with the shared file or filters, so that it cannot be forged nor
+// extended, and stops working when the share is revoked.
+type ShareLinks struct {
+	repo     *db.ShareRepository
+	secret   []byte
+	failures *unlockFailures
+}
+
+// NewShareLinks creates the share links, with the configured key or the key stored next to the database
+func NewShareLinks(cfg *config.Config, repo *db.ShareRepository) (*ShareLinks, error) {
+	secret, err := loadShareSecret(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &ShareLinks{repo: repo, secret: secret, failures: newUnlockFailures()}, nil
+}
+
+// loadShareSecret returns SHARE_SECRET, or a random key generated on first start
+func loadShareSecret(cfg *config.Config) ([]byte, error) {
+	if cfg.ShareSecret != "" {
+		return []byte(cfg.ShareSecret), nil
+	}
+
+	path := filepath.Join(filepath.Dir(cfg.DBPath), shareKeyFile)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		secret, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(secret) < sha256.Size {
+			return nil, fmt.Errorf("invalid key in %s", path)
+		}
+		return secret, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	secret := make([]byte, sha256.Size)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(secret)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	log.Printf("Share link key generated in %s", path)
+	return secret, nil
+}
+
+// Token returns the token of the URL of a share
+func (s *ShareLinks) Token(share *db.Share) string {
+	expiry := share.ExpiresAt.Unix()
+	return share.ID + "." + strconv.FormatInt(expiry, 36) + "." +
+		base64.RawURLEncoding.EncodeToString(s.signShare(share, expiry))
+}
+
+// Resolve returns the share of a token, unless the token is invalid or the share expired or revoked
+func (s *ShareLinks) Resolve(token string) (*db.Share, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errShareNotFound
+	}
+	expiry, err := strconv.ParseInt(parts[1], 36, 64)
+	if err != nil {
+		return nil, errShareNotFound
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errShareNotFound
+	}
+
+	share, err := s.repo.Get(parts[0])
+	if err != nil || share.ExpiresAt.Unix() != expiry || !hmac.Equal(signature, s.signShare(share, expiry)) {
+		return nil, errShareNotFound
+	}
+	if share.RevokedAt != nil {
+		return nil, errShareRevoked
+	}
+	if !share.Active() {
+		return nil, errShareExpired
+	}
+	return share, nil
+}
+
+// Unlocked reports whether the password of a share was given by the browser of a request
+func (s *ShareLinks) Unlocked(c echo.Context, share *db.Share) bool {
+	if share.PasswordHash == "" {
+		return true
+	}
+	cookie, err := c.Cookie(shareCookiePrefix + share.ID)
+	if err != nil {
+		return false
+	}
+	proof, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	return err == nil && hmac.Equal(proof, s.sign("unlock", share.ID, share.PasswordHash))
+}
+
+// unlockProof returns the value of the cookie proving that the password of a share was given
+func (s *ShareLinks) unlockProof(share *db.Share) string {
+	return base64.RawURLEncoding.EncodeToString(s.sign("unlock", share.ID, share.PasswordHash))
+}
+
+// signShare returns the signature of the target of a share until an expiry
+func (s *ShareLinks) signShare(share *db.Share, expiry int64) []byte {
+	return s.sign("share", share.ID, share.Kind, share.Target, strconv.FormatInt(expiry, 10))
+}
+
+// sign returns the HMAC of values with the key of the share links
+func (s *ShareLinks) sign(values ...string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strings.Join(values, "\n")))
+	return mac.Sum(nil)
+}
+
+// unlockFailures counts the wrong passwords given for the share links or the logins, by key
+// (a share link, a username or a client address), to lock the key out for a delay growing
+// with each failure
+type unlockFailures struct {
+	mu      sync.Mutex
+	entries map[string]*unlockFailure
+}
+
+// unlockFailure is the state of a locked key
+type unlockFailure struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func newUnlockFailures() *unlockFailures {
+	return &unlockFailures{entries: make(map[string]*unlockFailure)}
+}
+
+// retryAfter returns how long the most locked of the keys must still wait (0 if none)
+func (f *unlockFailures) retryAfter(keys ...string) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		if entry, ok := f.entries[key]; ok && entry.lockedUntil.After(now) && entry.lockedUntil.Sub(now) > wait {
+			wait = entry.lockedUntil.Sub(now)
+		}
+	}
+	return wait
+}
+
+// fail records a wrong password for the keys
+func (f *unlockFailures) fail(keys ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if len(f.entries) >= unlockMaxEntries {
+		for key, entry := range f.entries {
+			if now.Sub(entry.lastFailure) > unlockForgetAfter {
+				delete(f.entries, key)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		entry, ok := f.entries[key]
+		if !ok || now.Sub(entry.lastFailure) > unlockForgetAfter {
+			entry = &unlockFailure{}
+			f.entries[key] = entry
+		}
+		entry.count++
+		entry.lastFailure = now
+		if entry.count > unlockFreeFailures {
+			entry.lockedUntil = now.Add(unlockDelay(entry.count - unlockFreeFailures))
+		}
+	}
+}
+
+// reset forgets the failures of the keys, after the right password
+func (f *unlockFailures) reset(keys ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range keys {
+		delete(f.entries, key)
+	}
+}
+
+// setRetryAfter tells a locked out client how many seconds to wait
+func setRetryAfter(c echo.Context, wait time.Duration) {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+}
+
+// unlockDelay returns the lockout after the nth failure beyond the free ones
+func unlockDelay(n int) time.Duration {
+	delay := unlockBaseDelay
+	for i := 1; i < n && delay < unlockMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > unlockMaxDelay {
+		return unlockMaxDelay
+	}
+	return delay
+}
+
+// checkSharePassword compares a password with the hash of a share (bcrypt compares the hashes
+// in constant time)
+func checkSharePassword(share *db.Share, password string) bool {
+	return share.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)) == nil
+}
+
+// shareRequest is the body of the creation of a share link, for a file or for filters
+type shareRequest struct {
+	FileID         string          `json:"file_id"`
+	Filters        *db.ListFilters `json:"filters"`          // Such as date_from and date_to for a date range
+	Name           string          `json:"name"`             // Title shown to the visitors
+	Password       string          `json:"password"`         // Optional
+	ExpiresInHours int             `json:"expires_in_hours"` // 0 = SHARE_DEFAULT_HOURS
+}
+
+// unlockRequest is the body of the unlocking of a share link protected by a password
+type unlockRequest struct {
+	Password string `json:"password"`
+}
+
+// shareResponse is a share link as listed to its creator
+type shareResponse struct {
+	db.Share
+	URL         string          `json:"url"`
+	Filters     *db.ListFilters `json:"filters,omitempty"`
+	HasPassword bool            `json:"has_password"`
+	Active      bool            `json:"active"`
+}
+
+// sharedFile is a file as shown by a share link, without its path nor its annotations
+type sharedFile struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Ext           string    `json:"ext"`
+	Mime          string    `json:"mime"`
+	Size          int64     `json:"size"`
+	SizeFormatted string    `json:"size_formatted"`
+	CreatedAt     time.Time `json:"created_at"`
+	HasPreview    bool      `json:"has_preview"`
+	ThumbURL      string    `json:"thumb_url,omitempty"`
+	PreviewURL    string    `json:"preview_url"`
+	DownloadURL   string    `json:"download_url"`
+}
+
+// CreateShare creates a share link to a file or to the files matching filters
+func (h *Handlers) CreateShare(c echo.Context) error {
+	var request shareRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request",
+		})
+	}
+
+	hours := request.ExpiresInHours
+	if hours == 0 {
+		hours = min(h.config.ShareDefaultHours, h.config.ShareMaxHours)
+	}
+	if hours < 1 || hours > h.config.ShareMaxHours {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("The link must expire within 1 to %d hours", h.config.ShareMaxHours),
+		})
+	}
+
+	share := &db.Share{
+		Name:      strings.TrimSpace(request.Name),
+		ExpiresAt: time.Now().Add(time.Duration(hours) * time.Hour).Truncate(time.Second),
+	}
+	if len(share.Name) > maxShareNameLength {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("Name too long (%d characters maximum)", maxShareNameLength),
+		})
+	}
+	if user := currentUser(c); user != nil {
+		share.UserID = user.ID
+	}
+
+	switch {
+	case request.FileID != "" && request.Filters == nil:
+		item, status, err := h.fileByID(c, request.FileID, ActionShare)
+		if err != nil {
+			return c.JSON(status, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		share.Kind, share.Target, share.FileID = db.ShareFile, item.ID, item.ID
+		if share.Name == "" {
+			share.Name = item.Name
+		}
+
+	case request.Filters != nil && request.FileID == "":
+		filters, status, err := h.shareFilters(c, *request.Filters)
+		if err != nil {
+			return c.JSON(status, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		target, err := db.ShareTarget(filters)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid filters",
+			})
+		}
+		share.Kind, share.Target = db.ShareFilter, target
+
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "A file_id or filters is required",
+		})
+	}
+
+	if request.Password != "" {
+		hash, err := HashPassword(request.Password)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		share.PasswordHash = hash
+	}
+
+	id, err := randomToken(12)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Unable to create the share link",
+		})
+	}
+	share.ID = id
+	if err := h.shares.repo.Create(share); err != nil {
+		log.Printf("Error creating a share link: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Unable to create the share link",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, h.shareResponse(share))
+}
+
+// shareFilters validates the filters of a new share link, which the user must be allowed to
+// share in the root of the filters (in any root without one)
+func (h *Handlers) shareFilters(c echo.Context, filters db.ListFilters) (db.ListFilters, int, error) {
+	filters.Query = strings.TrimSpace(filters.Query)
+	filters.DateFrom = optionalString(filters.DateFrom)
+	filters.DateTo = optionalString(filters.DateTo)
+	tags, ok := normalizeTags(filters.Tags)
+	if !ok {
+		return filters, http.StatusBadRequest, errors.New("Invalid tag")
+	}
+	filters.Tags = nil
+	if len(tags) > 0 {
+		filters.Tags = tags
+	}
+
+	if filters.Root != "" {
+		if _, ok := h.config.Root(filters.Root); !ok {
+			return filters, http.StatusBadRequest, errors.New("Unknown root")
+		}
+		if !h.permittedInRoot(c, ActionShare, filters.Root) {
+			return filters, http.StatusForbidden, errPermissionDenied
+		}
+		return filters, http.StatusOK, nil
+	}
+	if !h.sharePermitted(c) {
+		return filters, http.StatusForbidden, errPermissionDenied
+	}
+	return filters, http.StatusOK, nil
+}
+
+// optionalString trims an optional value, nil if it is empty
+func optionalString(value *string) *string {
+	if value == nil || strings.TrimSpace(*value) == "" {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	return &trimmed
+}
+
+// sharePermitted reports whether the user of a request may share files of at least one root
+func (h *Handlers) sharePermitted(c echo.Context) bool {
+	for _, root := range h.config.Roots {
+		if h.permittedInRoot(c, ActionShare, root.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListShares returns the share links of the current user (all of them for the administrators)
+func (h *Handlers) ListShares(c echo.Context) error {
+	var shares []db.Share
+	var err error
+	if user := currentUser(c); user == nil || user.IsAdmin() {
+		shares, err = h.shares.repo.List()
+	} else {
+		shares, err = h.shares.repo.ListByUser(user.ID)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error retrieving share links",
+		})
+	}
+
+	response := make([]shareResponse, 0, len(shares))
+	for idx := range shares {
+		response = append(response, h.shareResponse(&shares[idx]))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// RevokeShare disables a share link of the current user (any link for the administrators)
+func (h *Handlers) RevokeShare(c echo.Context) error {
+	share, err := h.shares.repo.Get(c.Param("id"))
+	user := currentUser(c)
+	if err != nil || (user != nil && !user.IsAdmin() && share.UserID != user.ID) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": errShareNotFound.Error(),
+		})
+	}
+
+	if err := h.shares.repo.Revoke(share.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Unable to revoke the share link",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// shareResponse returns a share link with its URL: under SHARE_BASE_URL, otherwise relative
+// to the server, as the Host header of a request is chosen by its client
+func (h *Handlers) shareResponse(share *db.Share) shareResponse {
+	response := shareResponse{
+		Share:       *share,
+		URL:         h.config.ShareBaseURL + "/s/" + h.shares.Token(share),
+		HasPassword: share.PasswordHash != "",
+		Active:      share.Active(),
+	}
+	if share.Kind == db.ShareFilter {
+		if filters, err := share.Filters(); err == nil {
+			response.Filters = &filters
+		}
+	}
+	return response
+}
+
+// OpenShare returns the file of a share link, or a page of its files (public)
+func (h *Handlers) OpenShare(c echo.Context) error {
+	share, creator, status, err := h.openShare(c)
+	if err != nil {
+		return h.shareError(c, status, err)
+	}
+	if err := h.shares.repo.RecordAccess(share.ID); err != nil {
+		log.Printf("Error recording the access to the share link %s: %v", share.ID, err)
+	}
+
+	response := map[string]interface{}{
+		"name":       share.Name,
+		"kind":       share.Kind,
+		"expires_at": share.ExpiresAt,
+		"app_lang":   h.config.AppLang,
+	}
+
+	if share.Kind == db.ShareFile {
+		item, err := h.sharedItem(share, creator, share.FileID)
+		if err != nil {
+			return h.shareError(c, http.StatusNotFound, err)
+		}
+		response["file"] = h.sharedFile(c, item)
+		return c.JSON(http.StatusOK, response)
+	}
+
+	filters, err := h.shareListFilters(share, creator)
+	if err != nil {
+		return h.shareError(c, http.StatusNotFound, errShareNotFound)
+	}
+	filters.Page, filters.PageSize = 1, sharePageSize
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil && page > 0 {
+		filters.Page = page
+	}
+	result, err := h.repo.List(filters)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error retrieving files",
+		})
+	}
+
+	items := make([]sharedFile, 0, len(result.Items))
+	for idx := range result.Items {
+		items = append(items, h.sharedFile(c, &result.Items[idx]))
+	}
+	response["items"] = items
+	response["total"] = result.Total
+	response["page"] = result.Page
+	response["total_pages"] = result.TotalPages
+	return c.JSON(http.StatusOK, response)
+}
+
+// UnlockShare checks the password of a share link and lets the browser open it (public)
+func (h *Handlers) UnlockShare(c echo.Context) error {
+	share, err := h.shares.Resolve(c.Param("token"))
+	if err != nil {
+		return h.shareError(c, shareStatus(err), err)
+	}
+
+	var request unlockRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request",
+		})
+	}
+
+	// Locked out share links and addresses are refused before the password is hashed. The
+	// right password only clears the failures of the share, not those of the address.
+	shareKey, addressKey := "share:"+share.ID, "ip:"+c.RealIP()
+	if wait := h.shares.failures.retryAfter(shareKey, addressKey); wait > 0 {
+		setRetryAfter(c, wait)
+		return h.shareError(c, http.StatusTooManyRequests, errShareTooManyAttempts)
+	}
+	if !checkSharePassword(share, request.Password) {
+		h.shares.failures.fail(shareKey, addressKey)
+		log.Printf("Failed unlock of the share link %s from %s", share.ID, c.RealIP())
+		return h.shareError(c, http.StatusUnauthorized, errSharePasswordInvalid)
+	}
+	h.shares.failures.reset(shareKey)
+
+	if share.PasswordHash != "" {
+		c.SetCookie(&http.Cookie{
+			Name:     shareCookiePrefix + share.ID,
+			Value:    h.shares.unlockProof(share),
+			Path:     "/",
+			Expires:  share.ExpiresAt,
+			HttpOnly: true,
+			Secure:   h.config.CookieSecure,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SharePreview serves a file of a share link for preview or download, counting the downloads (public)
+func (h *Handlers) SharePreview(c echo.Context) error {
+	download := c.QueryParam("download") == "1"
+
+	share, creator, status, err := h.openShare(c)
+	if err != nil {
+		return h.shareError(c, status, err)
+	}
+	item, err := h.sharedItem(share, creator, c.Param("id"))
+	if err != nil {
+		return h.shareError(c, http.StatusNotFound, err)
+	}
+
+	// Revalidated on each use, so that a revocation takes effect immediately. The files opened
+	// by visitors cannot run scripts in the application.
+	c.Response().Header().Set("Cache-Control", "private, no-cache")
+	c.Response().Header().Set("Content-Security-Policy", "sandbox")
+
+	// Resumed downloads are counted once, by their first request
+	if download && !resumedRequest(c.Request()) {
+		if err := h.shares.repo.CountDownload(share.ID); err != nil {
+			log.Printf("Error counting a download of the share link %s: %v", share.ID, err)
+		}
+	}
+
+	return h.serveFile(c, item, download)
+}
+
+// ShareThumbnail serves the thumbnail of a file of a share link (public)
+func (h *Handlers) ShareThumbnail(c echo.Context) error {
+	share, creator, status, err := h.openShare(c)
+	if err != nil {
+		return h.shareError(c, status, err)
+	}
+	item, err := h.sharedItem(share, creator, c.Param("id"))
+	if err != nil {
+		return h.shareError(c, http.StatusNotFound, err)
+	}
+
+	c.Response().Header().Set("Cache-Control", "private, max-age=300")
+	return h.serveThumbnail(c, item)
+}
+
+// openShare resolves the share link of a public request with the identity of its creator,
+// or returns the status and reason of the refusal
+func (h *Handlers) openShare(c echo.Context) (*db.Share, *Identity, int, error) {
+	share, err := h.shares.Resolve(c.Param("token"))
+	if err != nil {
+		return nil, nil, shareStatus(err), err
+	}
+	if !h.shares.Unlocked(c, share) {
+		return nil, nil, http.StatusUnauthorized, errSharePasswordNeeded
+	}
+
+	creator, err := h.shareCreator(share)
+	if err != nil {
+		return nil, nil, http.StatusNotFound, errShareNotFound
+	}
+	return share, creator, http.StatusOK, nil
+}
+
+// shareCreator returns the identity of the creator of a share, whose current permissions limit
+// what the share exposes (nil when the authentication is disabled)
+func (h *Handlers) shareCreator(share *db.Share) (*Identity, error) {
+	if !h.auth.Enabled() {
+		return nil, nil
+	}
+	user, err := h.users.GetByID(share.UserID)
+	if err != nil {
+		return nil, err
+	}
+	identity := &Identity{User: user}
+	if !user.IsAdmin() {
+		if identity.Scopes, err = h.users.ListScopes(user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return identity, nil
+}
+
+// shareListFilters returns the filters of a share of files, limited to the folders its creator
+// may still share
+func (h *Handlers) shareListFilters(share *db.Share, creator *Identity) (db.ListFilters, error) {
+	filters, err := share.Filters()
+	if err != nil || !h.auth.Enabled() {
+		return filters, err
+	}
+
+	filters.Scopes = h.scopesFor(creator, ActionShare)
+	if filters.Scopes == nil && !Allowed(creator.User.Role, ActionShare) {
+		filters.Scopes = []db.PathScope{}
+	}
+	return filters, nil
+}
+
+// sharedItem retrieves a file of a share link, if its creator may still share it
+func (h *Handlers) sharedItem(share *db.Share, creator *Identity, id string) (*db.FileItem, error) {
+	item, err := h.repo.GetByID(id)
+	if err != nil {
+		return nil, errFileNotFound
+	}
+	if h.auth.Enabled() && !h.identityPermitted(creator, ActionShare, item.RootID, item.AbsPath) {
+		return nil, errFileNotFound
+	}
+
+	if share.Kind == db.ShareFile {
+		if item.ID != share.FileID {
+			return nil, errFileNotFound
+		}
+		return item, nil
+	}
+
+	filters, err := h.shareListFilters(share, creator)
+	if err != nil {
+		return nil, errFileNotFound
+	}
+	if found, err := h.repo.Contains(filters, item.ID); err != nil || !found {
+		return nil, errFileNotFound
+	}
+	return item, nil
+}
+
+// sharedFile returns a file of a share link with its URLs under the link
+func (h *Handlers) sharedFile(c echo.Context, item *db.FileItem) sharedFile {
+	base := "/s/" + c.Param("token") + "/files/" + item.ID
+	file := sharedFile{
+		ID:            item.ID,
+		Name:          item.Name,
+		Ext:           item.Ext,
+		Mime:          item.Mime,
+		Size:          item.Size,
+		SizeFormatted: item.FormatSize(),
+		CreatedAt:     item.CreatedAt,
+		HasPreview:    item.IsPreviewable(),
+		PreviewURL:    base + "/preview",
+		DownloadURL:   base + "/preview?download=1",
+	}
+	if item.HasThumbnail() {
+		file.ThumbURL = base + "/thumb"
+	}
+	return file
+}
+
+// shareError returns the refusal of a share link with a code translated by the frontend
+func (h *Handlers) shareError(c echo.Context, status int, err error) error {
+	return c.JSON(status, map[string]string{
+		"error":    err.Error(),
+		"code":     shareErrorCodes[err],
+		"app_lang": h.config.AppLang,
+	})
+}
+
+// shareStatus returns the HTTP status of a share link that cannot be resolved
+func shareStatus(err error) int {
+	if err == errShareExpired || err == errShareRevoked {
+		return http.StatusGone
+	}
+	return http.StatusNotFound
+}
+
+// resumedRequest reports whether a request asks for the rest of a file rather than its beginning
+func resumedRequest(r *http.Request) bool {
+	ranges := r.Header.Get("Range")
+	return ranges != "" && !strings.HasPrefix(strings.TrimSpace(ranges), "bytes=0-")
+}
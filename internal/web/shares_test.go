@@ -0,0 +1,339 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+
+	"tokilane/internal/config"
+	"tokilane/internal/db"
+)
+
+func TestUnlockDelay(t *testing.T) {
+	tests := []struct {
+		failure int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{10, 512 * time.Second},
+		{11, unlockMaxDelay},
+		{1000, unlockMaxDelay},
+	}
+	for _, tt := range tests {
+		if got := unlockDelay(tt.failure); got != tt.want {
+			t.Errorf("unlockDelay(%d) = %v, want %v", tt.failure, got, tt.want)
+		}
+	}
+}
+
+func TestUnlockFailures(t *testing.T) {
+	failures := newUnlockFailures()
+
+	for n := 0; n < unlockFreeFailures; n++ {
+		failures.fail("share:a", "ip:1")
+		if wait := failures.retryAfter("share:a", "ip:1"); wait != 0 {
+			t.Fatalf("locked out after %d failures", n+1)
+		}
+	}
+	failures.fail("share:a", "ip:1")
+	if wait := failures.retryAfter("share:a"); wait <= 0 || wait > unlockBaseDelay {
+		t.Errorf("share locked out for %v after a failure beyond the free ones, want up to %v", wait, unlockBaseDelay)
+	}
+	// Both the share and the address are locked out, whatever the other key
+	if failures.retryAfter("share:b", "ip:1") == 0 || failures.retryAfter("share:a", "ip:2") == 0 {
+		t.Error("lockout not applied to the share and the address")
+	}
+	if failures.retryAfter("share:b", "ip:2") != 0 {
+		t.Error("unrelated share and address locked out")
+	}
+
+	failures.reset("share:a")
+	if failures.retryAfter("share:a") != 0 || failures.retryAfter("ip:1") == 0 {
+		t.Error("reset of the share cleared the address, or not the share")
+	}
+
+	// Old failures are forgotten
+	failures.entries["ip:1"].lastFailure = time.Now().Add(-2 * unlockForgetAfter)
+	failures.entries["ip:1"].lockedUntil = time.Now().Add(-time.Minute)
+	failures.fail("ip:1")
+	if count := failures.entries["ip:1"].count; count != 1 {
+		t.Errorf("%d failures counted after a long pause, want 1", count)
+	}
+}
+
+func TestUnlockShareLockout(t *testing.T) {
+	dir := t.TempDir()
+	database, err := db.New(filepath.Join(dir, "app.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	cfg := &config.Config{DBPath: filepath.Join(dir, "app.db"), ShareSecret: strings.Repeat("k", 32)}
+	links, err := NewShareLinks(cfg, db.NewShareRepository(database))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("right password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	share := &db.Share{ID: "share1", Kind: "file", Target: "file1", FileID: "file1", PasswordHash: string(hash), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := links.repo.Create(share); err != nil {
+		t.Fatal(err)
+	}
+	token := links.Token(share)
+	h := &Handlers{config: cfg, shares: links}
+
+	// The server reads the address of the connection, whatever the forwarding headers say
+	e := echo.New()
+	e.IPExtractor = clientIPExtractor(nil)
+	attempts := 0
+	unlock := func(password, address string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/api/s/"+token+"/unlock", strings.NewReader(`{"password":"`+password+`"}`))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		request.RemoteAddr = address + ":1234"
+		attempts++
+		request.Header.Set(echo.HeaderXForwardedFor, fmt.Sprintf("203.0.113.%d", attempts))
+		request.Header.Set(echo.HeaderXRealIP, fmt.Sprintf("203.0.113.%d", attempts))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(request, rec)
+		c.SetParamNames("token")
+		c.SetParamValues(token)
+		if err := h.UnlockShare(c); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	for n := 0; n < unlockFreeFailures; n++ {
+		if rec := unlock("guess", "192.0.2.1"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: status %d, want 401", n+1, rec.Code)
+		}
+	}
+	if rec := unlock("guess", "192.0.2.1"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("last free failure: status %d, want 401", rec.Code)
+	}
+	if entry := links.failures.entries["ip:192.0.2.1"]; entry == nil || entry.count != unlockFreeFailures+1 {
+		t.Fatalf("failures of the address not counted together: %+v", entry)
+	}
+
+	// Locked out, even with the right password and from another address
+	for _, address := range []string{"192.0.2.1", "198.51.100.7"} {
+		rec := unlock("right password", address)
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Errorf("attempt from %s while locked out: status %d, Retry-After %q", address, rec.Code, rec.Header().Get("Retry-After"))
+		}
+		if !strings.Contains(rec.Body.String(), "too_many_attempts") {
+			t.Errorf("no error code in %s", rec.Body.String())
+		}
+	}
+
+	// Once the delay is over, the right password opens the share
+	links.failures.entries["share:"+share.ID].lockedUntil = time.Now()
+	links.failures.entries["ip:192.0.2.1"].lockedUntil = time.Now()
+	rec := unlock("right password", "198.51.100.7")
+	if rec.Code != http.StatusNoContent || !strings.HasPrefix(rec.Header().Get("Set-Cookie"), shareCookiePrefix+share.ID+"=") {
+		t.Errorf("right password after the delay: status %d, cookie %q", rec.Code, rec.Header().Get("Set-Cookie"))
+	}
+}
+
+func TestClientIPExtractor(t *testing.T) {
+	_, proxy, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		proxies   []*net.IPNet
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"no proxy", nil, "192.0.2.1", "203.0.113.9", "192.0.2.1"},
+		{"no proxy from loopback", nil, "127.0.0.1", "203.0.113.9", "127.0.0.1"},
+		{"trusted proxy", []*net.IPNet{proxy}, "10.1.2.3", "203.0.113.9", "203.0.113.9"},
+		{"chain of trusted proxies", []*net.IPNet{proxy}, "10.1.2.3", "203.0.113.9, 10.4.5.6", "203.0.113.9"},
+		{"spoofed chain", []*net.IPNet{proxy}, "10.1.2.3", "198.51.100.1, 203.0.113.9", "203.0.113.9"},
+		{"untrusted client", []*net.IPNet{proxy}, "192.0.2.1", "203.0.113.9", "192.0.2.1"},
+		{"private network not configured", []*net.IPNet{proxy}, "192.168.1.1", "203.0.113.9", "192.168.1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remote + ":1234"
+			request.Header.Set(echo.HeaderXForwardedFor, tt.forwarded)
+			request.Header.Set(echo.HeaderXRealIP, tt.forwarded)
+			if got := clientIPExtractor(tt.proxies)(request); got != tt.want {
+				t.Errorf("client address %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShareURL(t *testing.T) {
+	dir := t.TempDir()
+	database, err := db.New(filepath.Join(dir, "app.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	admin := &Identity{User: &db.User{ID: 1, Username: "admin", Role: db.RoleAdmin}}
+
+	tests := []struct {
+		name    string
+		baseURL string // SHARE_BASE_URL, as parsed by the configuration
+		prefix  string
+	}{
+		{"relative without base URL", "", "/s/"},
+		{"base URL", "https://photos.example.com", "https://photos.example.com/s/"},
+		{"base URL with a path", "https://example.com/photos", "https://example.com/photos/s/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				AuthEnabled:       true,
+				DBPath:            filepath.Join(dir, "app.db"),
+				ShareSecret:       strings.Repeat("k", 32),
+				ShareDefaultHours: 24,
+				ShareMaxHours:     48,
+				ShareBaseURL:      tt.baseURL,
+				Roots:             []config.RootConfig{{ID: "files", Path: filepath.Join(dir, "files")}},
+			}
+			links, err := NewShareLinks(cfg, db.NewShareRepository(database))
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := &Handlers{config: cfg, auth: NewAuth(cfg, nil), shares: links}
+
+			// The Host header is chosen by the client and never used in the link
+			request := httptest.NewRequest(http.MethodPost, "/api/shares", strings.NewReader(`{"filters":{"date_from":"2024-05-01"}}`))
+			request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			request.Host = "attacker.example"
+			request.Header.Set("X-Forwarded-Host", "attacker.example")
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(request, rec)
+			c.Set(contextIdentity, admin)
+			if err := h.CreateShare(c); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("creation: status %d %s", rec.Code, rec.Body.String())
+			}
+
+			var response shareResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			token, ok := strings.CutPrefix(response.URL, tt.prefix)
+			if !ok {
+				t.Fatalf("URL %q, want it under %q", response.URL, tt.prefix)
+			}
+			if share, err := links.Resolve(token); err != nil || share.ID != response.ID {
+				t.Errorf("token of the URL %q not resolved to the share: %v", response.URL, err)
+			}
+		})
+	}
+}
+
+// shareFile creates a link to a file as an admin and returns its token
+func shareFile(t *testing.T, h *Handlers, id string) string {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodPost, "/api/shares", strings.NewReader(`{"file_id":"`+id+`"}`))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(request, rec)
+	if err := h.CreateShare(c); err != nil {
+		t.Fatal(err)
+	}
+	var response shareResponse
+	if rec.Code != http.StatusCreated || json.Unmarshal(rec.Body.Bytes(), &response) != nil {
+		t.Fatalf("share creation: status %d %s", rec.Code, rec.Body.String())
+	}
+	return strings.TrimPrefix(response.URL, "/s/")
+}
+
+// openShareLink opens a share link anonymously and returns the response
+func openShareLink(t *testing.T, h *Handlers, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/s/"+token, nil), rec)
+	c.SetParamNames("token")
+	c.SetParamValues(token)
+	if err := h.OpenShare(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// enableShares adds the share links to an upload test, without login so that links are opened
+// without the account of their creator
+func (u *uploadTest) enableShares(t *testing.T) {
+	t.Helper()
+	cfg := u.handlers.config
+	cfg.AuthEnabled = false
+	cfg.DBPath = filepath.Join(t.TempDir(), "app.db")
+	cfg.ShareSecret = strings.Repeat("k", 32)
+	cfg.ShareDefaultHours, cfg.ShareMaxHours = 24, 48
+	links, err := NewShareLinks(cfg, db.NewShareRepository(u.database))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.handlers.shares = links
+}
+
+func TestShareOfRemovedFile(t *testing.T) {
+	u := newUploadTest(t)
+	u.enableShares(t)
+	h := u.handlers
+
+	removed := u.indexTestFile(t, "removed.txt", "a shared file")
+	moved := u.indexTestFile(t, "moved.txt", "a shared file renamed")
+	removedLink, movedLink := shareFile(t, h, removed.ID), shareFile(t, h, moved.ID)
+
+	// A link follows its file when it is moved
+	if err := h.indexer.MoveFile(moved, filepath.Join(u.rootPath, "renamed.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if rec := openShareLink(t, h, movedLink); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "renamed.txt") {
+		t.Errorf("link to the moved file: status %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Removed by the watcher, then replaced by another file at the same path
+	if err := os.Remove(removed.AbsPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.repo.DeleteByPath(removed.AbsPath); err != nil {
+		t.Fatal(err)
+	}
+	other := u.indexTestFile(t, "removed.txt", "another file, never shared")
+	if other.ID != removed.ID {
+		t.Fatalf("record not brought back: ID %s, want %s", other.ID, removed.ID)
+	}
+	if rec := openShareLink(t, h, removedLink); rec.Code != http.StatusNotFound {
+		t.Errorf("link to the removed file: status %d %s, want 404", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,170 @@
+package web
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/content"
+	"tokilane/internal/db"
+)
+
+// Maximum number of similar images returned for a file
+const maxSimilarFiles = 200
+
+// similarFile is a file close to a reference image
+type similarFile struct {
+	db.FileItemResponse
+	Distance int `json:"distance"` // Number of differing bits of the perceptual hashes
+}
+
+// similarityThreshold reads the maximum distance of the request, defaulting to the configuration
+func (h *Handlers) similarityThreshold(c echo.Context) int {
+	threshold := h.config.SimilarityThreshold
+	if value, err := strconv.Atoi(c.QueryParam("threshold")); err == nil {
+		threshold = value
+	}
+	if threshold < 0 {
+		threshold = 0
+	}
+	if threshold > content.PerceptualHashBits {
+		threshold = content.PerceptualHashBits
+	}
+	return threshold
+}
+
+// GetSimilarFiles API to retrieve the images that look like a file, the closest first
+func (h *Handlers) GetSimilarFiles(c echo.Context) error {
+	item, status, err := h.fileForAction(c, ActionView)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	threshold := h.similarityThreshold(c)
+	limit := 50
+	if value, err := strconv.Atoi(c.QueryParam("limit")); err == nil && value > 0 && value <= maxSimilarFiles {
+		limit = value
+	}
+
+	response := map[string]interface{}{
+		"file_id":   item.ID,
+		"hashed":    item.PerceptualHash != "", // Images are hashed with their thumbnail
+		"threshold": threshold,
+		"items":     []similarFile{},
+	}
+	if item.PerceptualHash == "" {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	hashes, err := h.repo.PerceptualHashes(h.parseFilters(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error retrieving similar files",
+		})
+	}
+
+	var ids []string
+	distances := make(map[string]int)
+	for _, match := range content.NewSimilarityIndex(hashes).Search(item.PerceptualHash, threshold) {
+		if match.FileID == item.ID {
+			continue
+		}
+		ids = append(ids, match.FileID)
+		distances[match.FileID] = match.Distance
+		if len(ids) == limit {
+			break
+		}
+	}
+
+	items, err := h.repo.GetByIDs(ids)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error retrieving similar files",
+		})
+	}
+
+	similar := make([]similarFile, 0, len(items))
+	for _, match := range items {
+		similar = append(similar, similarFile{
+			FileItemResponse: match.ToResponse(),
+			Distance:         distances[match.ID],
+		})
+	}
+	response["items"] = similar
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// GetSimilarClusters API to retrieve the groups of similar images (bursts, resized or
+// re-compressed copies), the largest first
+func (h *Handlers) GetSimilarClusters(c echo.Context) error {
+	filters := h.parseFilters(c)
+	threshold := h.similarityThreshold(c)
+
+	hashes, err := h.repo.PerceptualHashes(filters)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error retrieving similar files",
+		})
+	}
+	clusters := content.NewSimilarityIndex(hashes).Clusters(threshold)
+
+	similarFiles := 0
+	for _, cluster := range clusters {
+		similarFiles += len(cluster)
+	}
+
+	// Pagination
+	start := (filters.Page - 1) * filters.PageSize
+	if start > len(clusters) {
+		start = len(clusters)
+	}
+	end := start + filters.PageSize
+	if end > len(clusters) {
+		end = len(clusters)
+	}
+
+	groups := make([]map[string]interface{}, 0, end-start)
+	for _, cluster := range clusters[start:end] {
+		items, err := h.repo.GetByIDs(cluster)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Error retrieving similar files",
+			})
+		}
+
+		// Bursts and copies in chronological order
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].CreatedAt.Before(items[j].CreatedAt)
+		})
+
+		responseItems := make([]db.FileItemResponse, 0, len(items))
+		for _, item := range items {
+			responseItems = append(responseItems, item.ToResponse())
+		}
+		groups = append(groups, map[string]interface{}{
+			"count": len(responseItems),
+			"items": responseItems,
+		})
+	}
+
+	totalPages := len(clusters) / filters.PageSize
+	if len(clusters)%filters.PageSize > 0 {
+		totalPages++
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"clusters":       groups,
+		"total_clusters": len(clusters),
+		"similar_files":  similarFiles,
+		"hashed_images":  len(hashes),
+		"threshold":      threshold,
+		"page":           filters.Page,
+		"page_size":      filters.PageSize,
+		"total_pages":    totalPages,
+	})
+}
@@ -0,0 +1,440 @@
+package web
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/content"
+	"tokilane/internal/uploads"
+)
+
+// Resumable uploads follow the tus 1.0 protocol (https://tus.io/protocols/resumable-upload),
+// with the creation, creation-with-upload, termination, checksum and expiration extensions
+const (
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,creation-with-upload,termination,checksum,expiration"
+	tusContentType = "application/offset+octet-stream"
+
+	// Status of a chunk whose checksum does not match (defined by the checksum extension)
+	statusChecksumMismatch = 460
+)
+
+// tusHeaders sets the headers of every response of the protocol
+func tusHeaders(c echo.Context) {
+	c.Response().Header().Set("Tus-Resumable", tusVersion)
+	c.Response().Header().Set("Cache-Control", "no-store")
+}
+
+// tusError answers a request of the protocol with an error
+func tusError(c echo.Context, status int, message string) error {
+	tusHeaders(c)
+	return c.JSON(status, map[string]string{
+		"error": message,
+	})
+}
+
+// checkTusVersion refuses the requests of clients speaking another version of the protocol
+func checkTusVersion(c echo.Context) error {
+	if c.Request().Header.Get("Tus-Resumable") != tusVersion {
+		c.Response().Header().Set("Tus-Version", tusVersion)
+		return tusError(c, http.StatusPreconditionFailed, "Unsupported tus version")
+	}
+	return nil
+}
+
+// uploadHeaders sets the state of an upload in the response headers
+func (h *Handlers) uploadHeaders(c echo.Context, upload *uploads.Upload) {
+	header := c.Response().Header()
+	header.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	header.Set("Upload-Expires", h.resumable.ExpiresAt(upload).UTC().Format(http.TimeFormat))
+}
+
+// ownsUpload reports whether the user of a request may resume, cancel or follow an upload:
+// its creator or an administrator
+func (h *Handlers) ownsUpload(c echo.Context, upload *uploads.Upload) bool {
+	if !h.auth.Enabled() {
+		return true
+	}
+	user := currentUser(c)
+	return user != nil && (user.IsAdmin() || user.ID == upload.OwnerID)
+}
+
+// TusOptions API describing the supported protocol and extensions
+func (h *Handlers) TusOptions(c echo.Context) error {
+	tusHeaders(c)
+	header := c.Response().Header()
+	header.Set("Tus-Version", tusVersion)
+	header.Set("Tus-Extension", tusExtensions)
+	header.Set("Tus-Checksum-Algorithm", strings.Join(uploads.ChecksumAlgorithms, ","))
+	if h.config.ResumableMaxSize > 0 {
+		header.Set("Tus-Max-Size", strconv.FormatInt(h.config.ResumableMaxSize*1024*1024, 10))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CreateUpload API to start a resumable upload. The file name, root, folder, conflict policy
+// and dates are given in Upload-Metadata (filename or name, root, folder, conflict,
+// lastModified, created_at) and checked right away.
+func (h *Handlers) CreateUpload(c echo.Context) error {
+	if err := checkTusVersion(c); err != nil {
+		return err
+	}
+
+	request := c.Request()
+	if request.Header.Get("Upload-Defer-Length") != "" {
+		return tusError(c, http.StatusBadRequest, "Deferred length not supported")
+	}
+	length, err := strconv.ParseInt(request.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return tusError(c, http.StatusBadRequest, "Invalid Upload-Length")
+	}
+	if maxSize := h.config.ResumableMaxSize * 1024 * 1024; maxSize > 0 && length > maxSize {
+		return tusError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("File too large (max %dMB)", h.config.ResumableMaxSize))
+	}
+
+	metadata, err := parseUploadMetadata(request.Header.Get("Upload-Metadata"))
+	if err != nil {
+		return tusError(c, http.StatusBadRequest, "Invalid Upload-Metadata")
+	}
+
+	filename := uploadFilename(metadata)
+	if filename == "" {
+		return tusError(c, http.StatusBadRequest, "Missing file name")
+	}
+	if ext := content.GetFileExtension(filename); !h.config.IsAllowedExtension(ext) {
+		return tusError(c, http.StatusBadRequest, fmt.Sprintf("Extension not allowed: %s", ext))
+	}
+	root, status, err := h.uploadRoot(metadata["root"])
+	if err != nil {
+		return tusError(c, status, err.Error())
+	}
+	if !h.permitted(c, ActionUpload, root.ID, folderPath(root, metadata["folder"])) {
+		return tusError(c, http.StatusForbidden, errPermissionDenied.Error())
+	}
+	policy, err := parseConflictPolicy(metadata["conflict"])
+	if err != nil {
+		return tusError(c, http.StatusBadRequest, err.Error())
+	}
+	if !h.overwritePermitted(c, policy, root.ID, folderPath(root, metadata["folder"])) {
+		return tusError(c, http.StatusForbidden, errPermissionDenied.Error())
+	}
+	if _, err := uploadFolder(root, metadata["folder"]); err != nil {
+		return tusError(c, http.StatusBadRequest, err.Error())
+	}
+	if _, err := parseClientTimes(metadata["lastModified"], metadata["created_at"]); err != nil {
+		return tusError(c, http.StatusBadRequest, err.Error())
+	}
+
+	var ownerID uint
+	if user := currentUser(c); user != nil {
+		ownerID = user.ID
+	}
+	upload, err := h.resumable.Create(length, metadata, ownerID)
+	if err != nil {
+		log.Printf("Error creating an upload: %v", err)
+		return tusError(c, http.StatusInternalServerError, "Unable to create the upload")
+	}
+
+	tusHeaders(c)
+	c.Response().Header().Set("Location", "/api/uploads/"+upload.ID)
+
+	// First chunk sent with the creation request
+	if request.Header.Get("Content-Type") == tusContentType || length == 0 {
+		if err := h.resumable.Lock(upload.ID); err != nil {
+			return tusError(c, http.StatusLocked, err.Error())
+		}
+		defer h.resumable.Unlock(upload.ID)
+
+		if status, err := h.receiveChunk(c, upload, 0, request.Body, request.Header.Get("Upload-Checksum")); err != nil {
+			h.uploadHeaders(c, upload)
+			return tusError(c, status, err.Error())
+		}
+	}
+
+	h.uploadHeaders(c, upload)
+	return c.NoContent(http.StatusCreated)
+}
+
+// HeadUpload API returning the offset from which an upload resumes
+func (h *Handlers) HeadUpload(c echo.Context) error {
+	if err := checkTusVersion(c); err != nil {
+		return err
+	}
+
+	// The uploads of other users are not disclosed
+	upload, err := h.resumable.Get(c.Param("id"))
+	if err != nil || !h.ownsUpload(c, upload) {
+		tusHeaders(c)
+		return c.NoContent(http.StatusNotFound)
+	}
+
+	tusHeaders(c)
+	h.uploadHeaders(c, upload)
+	c.Response().Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if len(upload.Metadata) > 0 {
+		c.Response().Header().Set("Upload-Metadata", formatUploadMetadata(upload.Metadata))
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// PatchUpload API receiving a chunk of an upload at the current offset
+func (h *Handlers) PatchUpload(c echo.Context) error {
+	if err := checkTusVersion(c); err != nil {
+		return err
+	}
+
+	request := c.Request()
+	if request.Header.Get("Content-Type") != tusContentType {
+		return tusError(c, http.StatusUnsupportedMediaType, "Expected "+tusContentType)
+	}
+	offset, err := strconv.ParseInt(request.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return tusError(c, http.StatusBadRequest, "Invalid Upload-Offset")
+	}
+
+	id := c.Param("id")
+	if err := h.resumable.Lock(id); err != nil {
+		return tusError(c, http.StatusLocked, err.Error())
+	}
+	defer h.resumable.Unlock(id)
+
+	upload, err := h.resumable.Get(id)
+	if err != nil || !h.ownsUpload(c, upload) {
+		return tusError(c, http.StatusNotFound, "Upload not found")
+	}
+
+	status, err := h.receiveChunk(c, upload, offset, request.Body, request.Header.Get("Upload-Checksum"))
+	h.uploadHeaders(c, upload)
+	if err != nil {
+		return tusError(c, status, err.Error())
+	}
+
+	tusHeaders(c)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DeleteUpload API cancelling an upload and removing its partial file
+func (h *Handlers) DeleteUpload(c echo.Context) error {
+	if err := checkTusVersion(c); err != nil {
+		return err
+	}
+
+	id := c.Param("id")
+	if err := h.resumable.Lock(id); err != nil {
+		return tusError(c, http.StatusLocked, err.Error())
+	}
+	defer h.resumable.Unlock(id)
+
+	upload, err := h.resumable.Get(id)
+	if err != nil || !h.ownsUpload(c, upload) {
+		return tusError(c, http.StatusNotFound, "Upload not found")
+	}
+
+	if err := h.resumable.Delete(id); err != nil {
+		if errors.Is(err, uploads.ErrNotFound) {
+			return tusError(c, http.StatusNotFound, "Upload not found")
+		}
+		log.Printf("Error deleting the upload %s: %v", id, err)
+		return tusError(c, http.StatusInternalServerError, "Unable to delete the upload")
+	}
+
+	tusHeaders(c)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetUpload API returning the state of an upload and, once complete, the indexed file
+func (h *Handlers) GetUpload(c echo.Context) error {
+	upload, err := h.resumable.Get(c.Param("id"))
+	if err != nil || !h.ownsUpload(c, upload) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Upload not found",
+		})
+	}
+
+	response := map[string]interface{}{
+		"id":         upload.ID,
+		"length":     upload.Length,
+		"offset":     upload.Offset,
+		"metadata":   upload.Metadata,
+		"expires_at": h.resumable.ExpiresAt(upload),
+		"complete":   upload.Status != "",
+	}
+	if upload.Status != "" {
+		response["status"] = upload.Status
+		response["path"] = upload.Path
+	}
+	if upload.Error != "" {
+		response["error"] = upload.Error
+	}
+	// The indexed file may be one the user cannot see (an existing file kept by a skipped
+	// upload, or a file moved since)
+	if upload.FileID != "" {
+		if item, _, err := h.fileByID(c, upload.FileID, ActionView); err == nil {
+			response["file_id"] = upload.FileID
+			response["file"] = item.ToResponse()
+		}
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// receiveChunk writes a chunk of a locked upload and stores the file once all its bytes
+// are received. Returns the status of the failure.
+func (h *Handlers) receiveChunk(c echo.Context, upload *uploads.Upload, offset int64, body io.Reader, checksum string) (int, error) {
+	if _, err := h.resumable.WriteChunk(upload, offset, body, checksum); err != nil {
+		switch {
+		case errors.Is(err, uploads.ErrOffsetMismatch), errors.Is(err, uploads.ErrCompleted):
+			return http.StatusConflict, err
+		case errors.Is(err, uploads.ErrTooLarge):
+			return http.StatusRequestEntityTooLarge, err
+		case errors.Is(err, uploads.ErrChecksumMismatch):
+			return statusChecksumMismatch, err
+		case errors.Is(err, uploads.ErrInvalidChecksum), errors.Is(err, uploads.ErrUnknownAlgorithm):
+			return http.StatusBadRequest, err
+		default:
+			// Interrupted request: the bytes received are kept for the resume
+			log.Printf("Error receiving the upload %s: %v", upload.ID, err)
+			return http.StatusInternalServerError, fmt.Errorf("error receiving the data")
+		}
+	}
+
+	if !upload.Done() {
+		return http.StatusOK, nil
+	}
+	return h.completeUpload(c, upload)
+}
+
+// completeUpload checks the content of a complete upload, moves it into its folder according
+// to its conflict policy, and indexes it. Returns the status of the failure.
+func (h *Handlers) completeUpload(c echo.Context, upload *uploads.Upload) (int, error) {
+	dataPath := h.resumable.DataPath(upload)
+	source := uploadSource{
+		Name: uploadFilename(upload.Metadata),
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(dataPath)
+		},
+		Store: func(path string) error {
+			return content.MoveNoReplace(dataPath, path)
+		},
+	}
+
+	// The role or the scopes of the user may have changed since the upload started: a refused
+	// file is removed
+	policy, _ := parseConflictPolicy(upload.Metadata["conflict"])
+	if root, _, err := h.uploadRoot(upload.Metadata["root"]); err == nil {
+		dir := folderPath(root, upload.Metadata["folder"])
+		if !h.permitted(c, ActionUpload, root.ID, dir) || !h.overwritePermitted(c, policy, root.ID, dir) {
+			h.refuseUpload(upload, errPermissionDenied)
+			return http.StatusForbidden, errPermissionDenied
+		}
+	}
+
+	// The content is only known once all the bytes are received
+	if err := h.checkUploadContent(source); err != nil {
+		h.refuseUpload(upload, err)
+		return http.StatusUnsupportedMediaType, err
+	}
+
+	if err := h.storeUpload(upload, source); err != nil {
+		// The partial file is kept: a new empty chunk at the final offset retries
+		log.Printf("Error storing the upload %s: %v", upload.ID, err)
+		return http.StatusInternalServerError, fmt.Errorf("unable to store the file")
+	}
+	return http.StatusOK, nil
+}
+
+// refuseUpload records the failure of a complete upload and removes its file
+func (h *Handlers) refuseUpload(upload *uploads.Upload, reason error) {
+	if err := h.resumable.Complete(upload, uploads.Outcome{Status: uploadFailed, Reason: reason.Error()}); err != nil {
+		log.Printf("Error removing the refused upload %s: %v", upload.ID, err)
+	}
+}
+
+// storeUpload moves a complete upload into its folder and records its outcome
+func (h *Handlers) storeUpload(upload *uploads.Upload, source uploadSource) error {
+	root, _, err := h.uploadRoot(upload.Metadata["root"])
+	if err != nil {
+		return err
+	}
+	uploadDir, err := uploadFolder(root, upload.Metadata["folder"])
+	if err != nil {
+		return err
+	}
+	policy, _ := parseConflictPolicy(upload.Metadata["conflict"])
+	times, _ := parseClientTimes(upload.Metadata["lastModified"], upload.Metadata["created_at"])
+
+	outcome := h.placeUpload(root, uploadDir, source, policy, times)
+	if outcome.Status == uploadFailed {
+		return fmt.Errorf("%s", outcome.Reason)
+	}
+
+	// The file is stored (or skipped): an indexing failure is reported with the upload
+	var fileID string
+	if outcome.File != nil {
+		fileID = outcome.File.ID
+	}
+	return h.resumable.Complete(upload, uploads.Outcome{
+		Status: outcome.Status,
+		Path:   outcome.Path,
+		FileID: fileID,
+		Reason: outcome.Reason,
+	})
+}
+
+// uploadFilename returns the file name of an upload, without any directory
+func uploadFilename(metadata map[string]string) string {
+	name := metadata["filename"]
+	if name == "" {
+		name = metadata["name"] // Uppy
+	}
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+	return name
+}
+
+// parseUploadMetadata parses an Upload-Metadata header: comma-separated pairs of a key and
+// a base64-encoded value (the value may be absent)
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// formatUploadMetadata encodes metadata as an Upload-Metadata header
+func formatUploadMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(metadata[key])))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,265 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/config"
+	"tokilane/internal/content"
+	"tokilane/internal/db"
+	"tokilane/internal/uploads"
+)
+
+// uploadTest holds handlers with resumable uploads and an indexer, the login required
+type uploadTest struct {
+	handlers *Handlers
+	store    *uploads.Store
+	database *db.Database
+	repo     *db.FileItemRepository
+	root     *config.RootConfig
+	rootPath string
+}
+
+func newUploadTest(t *testing.T) *uploadTest {
+	t.Helper()
+	dir := t.TempDir()
+	rootPath := filepath.Join(dir, "files")
+
+	store, err := uploads.NewStore(filepath.Join(dir, "uploads"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Close)
+
+	database, err := db.New(filepath.Join(dir, "app.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := os.MkdirAll(rootPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	indexer, err := content.NewIndexer(&content.IndexerConfig{
+		Roots:      []content.LibraryRoot{{ID: "files", Path: rootPath, Upload: true}},
+		ThumbsPath: filepath.Join(dir, "thumbs"),
+	}, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { indexer.Stop() })
+
+	cfg := &config.Config{
+		AuthEnabled:   true,
+		EnableUpload:  true,
+		MaxUploadSize: 1,
+		AllowedExt:    []string{".txt"},
+		Roots:         []config.RootConfig{{ID: "files", Path: rootPath, Upload: true}},
+	}
+	repo := db.NewFileItemRepository(database)
+	return &uploadTest{
+		handlers: &Handlers{
+			config:      cfg,
+			auth:        NewAuth(cfg, nil),
+			resumable:   store,
+			repo:        repo,
+			annotations: db.NewAnnotationRepository(database),
+			indexer:     indexer,
+		},
+		store:    store,
+		database: database,
+		repo:     repo,
+		root:     &cfg.Roots[0],
+		rootPath: rootPath,
+	}
+}
+
+// request calls a handler of the upload protocol as a user and returns the response
+func (u *uploadTest) request(identity *Identity, method, id string, body string, handler echo.HandlerFunc) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, "/api/uploads/"+id, strings.NewReader(body))
+	request.Header.Set("Tus-Resumable", tusVersion)
+	if method == http.MethodPatch {
+		request.Header.Set("Content-Type", tusContentType)
+		request.Header.Set("Upload-Offset", "0")
+	}
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(request, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	c.Set(contextIdentity, identity)
+	if err := handler(c); err != nil {
+		rec.Code = http.StatusInternalServerError
+	}
+	return rec
+}
+
+func TestUploadsOfOtherUsers(t *testing.T) {
+	u := newUploadTest(t)
+	h := u.handlers
+	alice := &Identity{User: &db.User{ID: 1, Username: "alice", Role: db.RoleUploader}}
+	bob := &Identity{User: &db.User{ID: 2, Username: "bob", Role: db.RoleUploader}}
+	admin := &Identity{User: &db.User{ID: 3, Username: "admin", Role: db.RoleAdmin}}
+
+	upload, err := u.store.Create(10, map[string]string{"filename": "notes.txt"}, alice.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another user cannot see, resume or cancel the upload
+	for _, call := range []struct {
+		method  string
+		body    string
+		handler echo.HandlerFunc
+	}{
+		{http.MethodHead, "", h.HeadUpload},
+		{http.MethodPatch, "abc", h.PatchUpload},
+		{http.MethodGet, "", h.GetUpload},
+		{http.MethodDelete, "", h.DeleteUpload},
+	} {
+		if rec := u.request(bob, call.method, upload.ID, call.body, call.handler); rec.Code != http.StatusNotFound {
+			t.Errorf("%s by another user: status %d, want 404", call.method, rec.Code)
+		}
+	}
+	if current, err := u.store.Get(upload.ID); err != nil || current.Offset != 0 {
+		t.Fatalf("upload changed by another user: %+v, %v", current, err)
+	}
+
+	// Its creator and the administrators can
+	if rec := u.request(alice, http.MethodPatch, upload.ID, "abc", h.PatchUpload); rec.Code != http.StatusNoContent {
+		t.Errorf("PATCH by the creator: status %d", rec.Code)
+	}
+	rec := u.request(admin, http.MethodHead, upload.ID, "", h.HeadUpload)
+	if rec.Code != http.StatusOK || rec.Header().Get("Upload-Offset") != "3" {
+		t.Errorf("HEAD by an admin: status %d, offset %q", rec.Code, rec.Header().Get("Upload-Offset"))
+	}
+	if rec := u.request(alice, http.MethodGet, upload.ID, "", h.GetUpload); rec.Code != http.StatusOK {
+		t.Errorf("GET by the creator: status %d", rec.Code)
+	}
+	if rec := u.request(alice, http.MethodDelete, upload.ID, "", h.DeleteUpload); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE by the creator: status %d", rec.Code)
+	}
+
+	// Uploads created without the authentication belong to the administrators only
+	orphan, err := u.store.Create(10, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := u.request(alice, http.MethodHead, orphan.ID, "", h.HeadUpload); rec.Code != http.StatusNotFound {
+		t.Errorf("HEAD of an upload without owner: status %d, want 404", rec.Code)
+	}
+	if rec := u.request(admin, http.MethodDelete, orphan.ID, "", h.DeleteUpload); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE of an upload without owner by an admin: status %d", rec.Code)
+	}
+}
+
+func TestGetUploadHidesInvisibleFile(t *testing.T) {
+	u := newUploadTest(t)
+	scoped := &Identity{
+		User:   &db.User{ID: 1, Username: "kid", Role: db.RoleUploader},
+		Scopes: []db.Scope{{RootID: "files", Prefix: "kids", Role: db.RoleUploader}},
+	}
+
+	// A skipped upload pointing at an existing file outside the folders of the user
+	item := &db.FileItem{ID: "existing", RootID: "files", AbsPath: filepath.Join(u.rootPath, "work", "notes.txt"), Name: "notes.txt"}
+	if err := u.repo.Create(item); err != nil {
+		t.Fatal(err)
+	}
+	upload, err := u.store.Create(0, map[string]string{"filename": "notes.txt", "folder": "kids"}, scoped.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.store.Complete(upload, uploads.Outcome{Status: "skipped", Path: "work/notes.txt", FileID: item.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := u.request(scoped, http.MethodGet, upload.ID, "", u.handlers.GetUpload)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := response["file"]; ok {
+		t.Error("file outside the scopes of the user returned")
+	}
+	if _, ok := response["file_id"]; ok {
+		t.Error("ID of a file outside the scopes of the user returned")
+	}
+
+	// Visible once the user may view it
+	scoped.Scopes = append(scoped.Scopes, db.Scope{RootID: "files", Prefix: "work", Role: db.RoleViewer})
+	rec = u.request(scoped, http.MethodGet, upload.ID, "", u.handlers.GetUpload)
+	response = nil
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if file, ok := response["file"].(map[string]interface{}); !ok || file["id"] != item.ID {
+		t.Errorf("visible file not returned: %v", response["file"])
+	}
+}
+
+func TestCompleteUploadRechecksPermissions(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity *Identity
+		want     int
+	}{
+		{"upload still allowed", &Identity{
+			User:   &db.User{ID: 1, Username: "kid", Role: db.RoleViewer},
+			Scopes: []db.Scope{{RootID: "files", Prefix: "kids", Role: db.RoleUploader}},
+		}, http.StatusNoContent},
+		{"role revoked", &Identity{
+			User: &db.User{ID: 1, Username: "kid", Role: db.RoleViewer},
+		}, http.StatusForbidden},
+		{"scope revoked", &Identity{
+			User:   &db.User{ID: 1, Username: "kid", Role: db.RoleViewer},
+			Scopes: []db.Scope{{RootID: "files", Prefix: "work", Role: db.RoleUploader}},
+		}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newUploadTest(t)
+			upload, err := u.store.Create(3, map[string]string{"filename": "notes.txt", "folder": "kids"}, tt.identity.User.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec := u.request(tt.identity, http.MethodPatch, upload.ID, "abc", u.handlers.PatchUpload)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d", rec.Code, tt.want)
+			}
+			current, err := u.store.Get(upload.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, statErr := os.Stat(filepath.Join(u.rootPath, "kids", "notes.txt"))
+			if tt.want == http.StatusNoContent {
+				if current.Status != uploadCreated || statErr != nil {
+					t.Errorf("upload %q, file: %v", current.Status, statErr)
+				}
+				return
+			}
+			if current.Status != uploadFailed || !os.IsNotExist(statErr) {
+				t.Errorf("refused upload %q stored: %v", current.Status, statErr)
+			}
+			if _, err := os.Stat(u.store.DataPath(current)); !os.IsNotExist(err) {
+				t.Errorf("data of the refused upload kept: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package web
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"tokilane/internal/db"
+)
+
+// Maximum length of a username or token name
+const maxNameLength = 64
+
+// loginRequest is the body of a login
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// passwordRequest is the body of a password change
+type passwordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// tokenRequest is the body of the creation of an API token
+type tokenRequest struct {
+	Name          string `json:"name"`
+	ExpiresInDays int    `json:"expires_in_days"` // 0 = never
+}
+
+// userRequest is the body of the creation or update of a user by an administrator
+type userRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"` // Unchanged if empty on update
+	Role     string `json:"role"`     // Unchanged if empty on update
+}
+
+// scopesRequest is the body of the update of the scopes of a user
+type scopesRequest struct {
+	Scopes []struct {
+		Root   string `json:"root"`
+		Prefix string `json:"prefix"` // Folder in the root (empty: the whole root)
+		Role   string `json:"role"`   // viewer or uploader
+	} `json:"scopes"`
+}
+
+// GetAuthStatus tells the frontend whether a login is required and who is logged in
+func (h *Handlers) GetAuthStatus(c echo.Context) error {
+	response := map[string]interface{}{
+		"auth_enabled": h.auth.Enabled(),
+		"oidc_enabled": h.oidc != nil,
+		"app_lang":     h.config.AppLang,
+	}
+	if !h.auth.Enabled() {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	response["user"] = nil
+	if identity, err := h.auth.Identify(c); err == nil && identity != nil {
+		response["user"] = identity.User
+		if identity.Session != nil {
+			response["csrf_token"] = identity.Session.CSRFToken
+		}
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// Login checks a username and password and opens a session
+func (h *Handlers) Login(c echo.Context) error {
+	// A JSON body cannot be sent by a cross-site form
+	if !strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{
+			"error": "JSON body expected",
+		})
+	}
+
+	var request loginRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request",
+		})
+	}
+
+	// Locked out usernames and addresses are refused before the password is hashed. A
+	// successful login only clears the failures of the username, not those of the address.
+	username := db.NormalizeUsername(request.Username)
+	userKey, addressKey := "user:"+username, "ip:"+c.RealIP()
+	if wait := h.auth.failures.retryAfter(userKey, addressKey); wait > 0 {
+		setRetryAfter(c, wait)
+		return c.JSON(http.StatusTooManyRequests, map[string]string{
+			"error": errTooManyLogins.Error(),
+		})
+	}
+
+	user, err := h.users.GetByUsername(request.Username)
+	if err != nil {
+		user = nil
+	}
+	if !checkPassword(user, request.Password) {
+		h.auth.failures.fail(userKey, addressKey)
+		log.Printf("Failed login for %q from %s", username, c.RealIP())
+		return c.JSON(http.StatusUnauthorized, map[string]string{
+			"error": errInvalidCredentials.Error(),
+		})
+	}
+	h.auth.failures.reset(userKey)
+
+	session, err := h.auth.StartSession(c, user)
+	if err != nil {
+		log.Printf("Error opening a session for %s: %v", user.Username, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Unable to open a session",
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"user":       user,
+		"csrf_token": session.CSRFToken,
+	})
+}
+
+// Logout closes the current session
+func (h *Handlers) Logout(c echo.Context) error {
+	if err := h.auth.EndSession(c); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Unable to close the session",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ChangePassword replaces the password of the current user and closes their other sessions
+func (h *Handlers) ChangePassword(c echo.Context) error {
+	var request passwordRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request",
+		})
+	}
+
+	user := currentUser(c)
+	if !checkPassword(user, request.CurrentPassword) {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Invalid current password",
+		})
+	}
+	hash, err := HashPassword(request.NewPassword)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	user.PasswordHash = hash
+	if err := h.users.Update(user); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error saving password",
+		})
+	}
+
+	var current string
+	if session := currentIdentity(c).Session; session != nil {
+		current = session.ID
+	}
+	if err := h.users.DeleteUserSessions(user.ID, current); err != nil {
+		log.Printf("Error closing the sessions of %s: %v", user.Username, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListTokens returns the API tokens of the current user
+func (h *Handlers) ListTokens(c echo.Context) error {
+	tokens, err := h.users.ListTokens(currentUser(c).ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error retrieving tokens",
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"tokens": tokens,
+	})
+}
+
+// CreateToken creates an API token for the current user. Its value is only returned once.
+func (h *Handlers) CreateToken(c echo.Context) error {
+	var request tokenRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request",
+		})
+	}
+	name := strings.TrimSpace(request.Name)
+	if name == "" || len(name) > maxNameLength || request.ExpiresInDays < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid token name or expiry",
+		})
+	}
+
+	value, err := newAPIToken()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Unable to generate a token",
+		})
+	}
+
+	token := &db.APIToken{
+		UserID: currentUser(c).ID,
+		Name:   name,
+		Hash:   hashToken(value),
+		Prefix: value[:len(tokenPrefix)+6],
+	}
+	if request.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := h.users.CreateToken(token); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error saving token",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"token": token,
+		"value": value,
+	})
+}
+
+// DeleteToken revokes an API token of the current user
+func (h *Handlers) DeleteToken(c echo.Context) error {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err := h.users.DeleteToken(currentUser(c).ID, uint(id)); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Token not found",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListUsers returns all users (administrators only)
+func (h *Handlers) ListUsers(c echo.Context) error {
+	users, err := h.users.List()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error retrieving users",
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"users": users,
+	})
+}
+
+// CreateUser adds a local user (administrators only)
+func (h *Handlers) CreateUser(c echo.Context) error {
+	var request userRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request",
+		})
+	}
+
+	username := db.NormalizeUsername(request.Username)
+	if username == "" || len(username) > maxNameLength {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid username",
+		})
+	}
+	role, ok := parseRole(request.Role)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Unknown role",
+		})
+	}
+	hash, err := HashPassword(request.Password)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	user := &db.User{Username: username, PasswordHash: hash, Role: role}
+	if err := h.users.Create(user); err != nil {
+		if errors.Is(err, db.ErrUserExists) {
+			return c.JSON(http.StatusConflict, map[string]string{
+				"error": "Username already taken",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error saving user",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, user)
+}
+
+// UpdateUser changes the password or the role of a user (administrators only)
+func (h *Handlers) UpdateUser(c echo.Context) error {
+	var request userRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request",
+		})
+	}
+
+	user, err := h.userParam(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "User not found",
+		})
+	}
+
+	if request.Role != "" {
+		role, ok := parseRole(request.Role)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Unknown role",
+			})
+		}
+		if user.ID == currentUser(c).ID && role != user.Role {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "You cannot change your own role",
+			})
+		}
+		user.Role = role
+	}
+	if request.Password != "" {
+		hash, err := HashPassword(request.Password)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		user.PasswordHash = hash
+	}
+
+	if err := h.users.Update(user); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error saving user",
+		})
+	}
+	if request.Password != "" {
+		// The sessions opened with the previous password are closed
+		if err := h.users.DeleteUserSessions(user.ID, ""); err != nil {
+			log.Printf("Error closing the sessions of %s: %v", user.Username, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser removes a user with their sessions and tokens (administrators only)
+func (h *Handlers) DeleteUser(c echo.Context) error {
+	user, err := h.userParam(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "User not found",
+		})
+	}
+	if user.ID == currentUser(c).ID {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "You cannot delete your own account",
+		})
+	}
+
+	if err := h.users.Delete(user.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error removing user",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetUserScopes returns the folders a user is limited to (administrators only)
+func (h *Handlers) GetUserScopes(c echo.Context) error {
+	user, err := h.userParam(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "User not found",
+		})
+	}
+
+	scopes, err := h.users.ListScopes(user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error retrieving scopes",
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"scopes": scopes,
+	})
+}
+
+// SetUserScopes replaces the folders a user is limited to, with their role in each folder.
+// An empty list removes the limits (administrators only).
+func (h *Handlers) SetUserScopes(c echo.Context) error {
+	var request scopesRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request",
+		})
+	}
+
+	user, err := h.userParam(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "User not found",
+		})
+	}
+	if user.IsAdmin() && len(request.Scopes) > 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Administrators cannot be limited to folders",
+		})
+	}
+
+	scopes := make([]db.Scope, 0, len(request.Scopes))
+	for _, scope := range request.Scopes {
+		if _, ok := h.config.Root(scope.Root); !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Unknown root: " + scope.Root,
+			})
+		}
+		prefix, ok := normalizePrefix(scope.Prefix)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid folder: " + scope.Prefix,
+			})
+		}
+		role, ok := parseRole(scope.Role)
+		if !ok || role == db.RoleAdmin {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Unknown role",
+			})
+		}
+		scopes = append(scopes, db.Scope{RootID: scope.Root, Prefix: prefix, Role: role})
+	}
+
+	if err := h.users.SetScopes(user.ID, scopes); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error saving scopes",
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"scopes": scopes,
+	})
+}
+
+// userParam returns the user designated by the :id parameter
+func (h *Handlers) userParam(c echo.Context) (*db.User, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return h.users.GetByID(uint(id))
+}
+
+// parseRole validates a role (viewer by default, "user" being the former name of uploader)
+func parseRole(value string) (string, bool) {
+	switch role := strings.ToLower(strings.TrimSpace(value)); role {
+	case "":
+		return db.RoleViewer, true
+	case "user":
+		return db.RoleUploader, true
+	case db.RoleViewer, db.RoleUploader, db.RoleAdmin:
+		return role, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,97 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+
+	"tokilane/internal/config"
+	"tokilane/internal/db"
+)
+
+func TestLoginLockout(t *testing.T) {
+	database, err := db.New(filepath.Join(t.TempDir(), "app.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	users := db.NewUserRepository(database)
+	for _, username := range []string{"alice", "bob"} {
+		hash, err := bcrypt.GenerateFromPassword([]byte("right password"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := users.Create(&db.User{Username: username, PasswordHash: string(hash), Role: db.RoleViewer}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &config.Config{AuthEnabled: true, SessionLifetime: 1}
+	auth := NewAuth(cfg, users)
+	h := &Handlers{config: cfg, users: users, auth: auth}
+
+	// The server reads the address of the connection, whatever the forwarding headers say
+	e := echo.New()
+	e.IPExtractor = clientIPExtractor(nil)
+	attempts := 0
+	login := func(username, password, address string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"username":%q,"password":%q}`, username, password)
+		request := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(body))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		request.RemoteAddr = address + ":1234"
+		attempts++
+		request.Header.Set(echo.HeaderXForwardedFor, fmt.Sprintf("203.0.113.%d", attempts))
+		rec := httptest.NewRecorder()
+		if err := h.Login(e.NewContext(request, rec)); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	for n := 0; n <= unlockFreeFailures; n++ {
+		if rec := login("alice", "guess", "192.0.2.1"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: status %d, want 401", n+1, rec.Code)
+		}
+	}
+	if entry := auth.failures.entries["user:alice"]; entry == nil || entry.count != unlockFreeFailures+1 {
+		t.Fatalf("failures of the username not counted: %+v", entry)
+	}
+
+	// Locked out, even with the right password, from another address or another case
+	for _, username := range []string{"alice", " Alice "} {
+		rec := login(username, "right password", "198.51.100.7")
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Errorf("login of %q while locked out: status %d, Retry-After %q", username, rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+	// The address is locked out too, for any username
+	if rec := login("bob", "right password", "192.0.2.1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("login from a locked out address: status %d, want 429", rec.Code)
+	}
+	// Other users and addresses are not affected
+	if rec := login("bob", "right password", "198.51.100.7"); rec.Code != http.StatusOK {
+		t.Errorf("login of another user: status %d, want 200", rec.Code)
+	}
+
+	// Once the delay is over, the right password clears the failures of the username only
+	auth.failures.entries["user:alice"].lockedUntil = auth.failures.entries["user:alice"].lastFailure
+	if rec := login("alice", "right password", "198.51.100.7"); rec.Code != http.StatusOK {
+		t.Fatalf("login after the lockout: status %d, want 200", rec.Code)
+	}
+	if _, ok := auth.failures.entries["user:alice"]; ok {
+		t.Error("failures of the username kept after a successful login")
+	}
+	if auth.failures.retryAfter("ip:192.0.2.1") == 0 {
+		t.Error("failures of the address cleared by a login from another address")
+	}
+}
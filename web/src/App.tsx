@@ -1,13 +1,18 @@
 import { useState, useEffect } from 'react'
 import TimelineSeekbar from './pages/TimelineSeekbar'
 import TimelineExplorer from './pages/TimelineStandalone'
+import Login from './pages/Login'
 import { useAppConfig } from './hooks/useAppConfig'
+import { useAuth } from './hooks/useAuth'
 
 type ViewMode = 'seekbar' | 'explorer'
 
 function App() {
+  // Login required before loading anything else
+  const { status: authStatus, isLoaded: authLoaded, needsLogin, reload: reloadAuth } = useAuth()
+
   // Load app configuration from backend
-  const { isLoaded: configLoaded, error: configError } = useAppConfig()
+  const { isLoaded: configLoaded, error: configError } = useAppConfig(authLoaded && !needsLogin)
   
   // Load preference from localStorage or use 'seekbar' as default
   const [viewMode, setViewMode] = useState<ViewMode>(() => {
@@ -70,6 +75,10 @@ function App() {
     }
   }, [viewMode])
 
+  if (authLoaded && needsLogin) {
+    return <Login onLogin={reloadAuth} ssoEnabled={!!authStatus?.oidc_enabled} />
+  }
+
   // Show loading screen while configuration is loading
   if (!configLoaded) {
     return (
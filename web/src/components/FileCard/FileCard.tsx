@@ -13,6 +13,7 @@ import {
   PreviewIcon,
   InfoContainer,
   FileName,
+  Snippet,
   FileDetails,
   SizeTime,
   MimeType,
@@ -86,6 +87,11 @@ export const FileCard: React.FC<FileCardProps> = ({ file, onClick, className })
           {file.name}
         </FileName>
 
+        {file.snippet && (
+          // The snippet is escaped by the server, only <mark> elements are HTML
+          <Snippet dangerouslySetInnerHTML={{ __html: file.snippet }} />
+        )}
+
         <FileDetails>
           <SizeTime>
             <span>{file.size_formatted}</span>
@@ -124,6 +124,23 @@ export const FileName = styled.h3`
   }
 `
 
+export const Snippet = styled.p`
+  font-size: 0.75rem;
+  color: rgba(255, 255, 255, 0.6);
+  line-height: 1.4;
+  margin-bottom: ${({ theme }) => theme.spacing[2]};
+  overflow: hidden;
+  display: -webkit-box;
+  -webkit-line-clamp: 3;
+  -webkit-box-orient: vertical;
+
+  mark {
+    background: rgba(255, 64, 129, 0.3);
+    color: white;
+    border-radius: 2px;
+  }
+`
+
 export const FileDetails = styled.div`
   display: flex;
   flex-direction: column;
@@ -20,9 +20,10 @@ interface FileGroupProps {
   date: string
   files: FileItem[]
   onFileClick: (file: FileItem) => void
+  onShare?: (date: string) => void // Absent si l'utilisateur ne peut pas partager
 }
 
-export const FileGroup: React.FC<FileGroupProps> = ({ date, files, onFileClick }) => {
+export const FileGroup: React.FC<FileGroupProps> = ({ date, files, onFileClick, onShare }) => {
   const { t } = useTranslation()
   const formattedDate = formatDate(date + 'T00:00:00Z')
   const fileCount = files.length
@@ -44,6 +45,15 @@ export const FileGroup: React.FC<FileGroupProps> = ({ date, files, onFileClick }
           </DateInfo>
           
           <GroupActions>
+            {onShare && (
+              <ActionButton title={t('share.shareDay')} onClick={() => onShare(date)}>
+                <ActionIcon>
+                  <svg width="16" height="16" fill="none" viewBox="0 0 24 24" stroke="currentColor">
+                    <path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M8.684 13.342C8.886 12.938 9 12.482 9 12c0-.482-.114-.938-.316-1.342m0 2.684a3 3 0 110-2.684m0 2.684l6.632 3.316m-6.632-6l6.632-3.316m0 0a3 3 0 105.367-2.684 3 3 0 00-5.367 2.684zm0 9.316a3 3 0 105.368 2.684 3 3 0 00-5.368-2.684z" />
+                  </svg>
+                </ActionIcon>
+              </ActionButton>
+            )}
             <ActionButton
               title={isCollapsed ? t('fileGroups.expandGroup') : t('fileGroups.collapseGroup')}
               onClick={toggleCollapse}
@@ -94,6 +94,10 @@ export const FiltersBar: React.FC<FiltersBarProps> = ({
     onFiltersChange({ ...filters, extension: newExt, page: 1 })
   }
 
+  const handleDuplicatesFilter = () => {
+    onFiltersChange({ ...filters, duplicates: !filters.duplicates, page: 1 })
+  }
+
   const handleDateFromChange = (date: string) => {
     onFiltersChange({ ...filters, date_from: date || undefined, page: 1 })
   }
@@ -120,6 +124,7 @@ export const FiltersBar: React.FC<FiltersBarProps> = ({
     onFiltersChange({
       query: '',
       extension: '',
+      duplicates: false,
       date_from: undefined,
       date_to: undefined,
       min_size: undefined,
@@ -131,6 +136,7 @@ export const FiltersBar: React.FC<FiltersBarProps> = ({
   const hasActiveFilters = !!(
     filters.query ||
     filters.extension ||
+    filters.duplicates ||
     filters.date_from ||
     filters.date_to ||
     filters.min_size ||
@@ -182,6 +188,12 @@ export const FiltersBar: React.FC<FiltersBarProps> = ({
                 {ext}
               </ExtensionButton>
             ))}
+            <ExtensionButton
+              $active={!!filters.duplicates}
+              onClick={handleDuplicatesFilter}
+            >
+              {t('filters.duplicates')}
+            </ExtensionButton>
           </QuickFiltersSection>
         )}
 
@@ -1,6 +1,7 @@
 import React from 'react'
 import ViewSwitcher, { ViewMode } from '../ViewSwitcher/ViewSwitcher'
 import { useTranslation } from '@/lib/translations'
+import { csrfHeaders, logout } from '@/lib/api'
 import {
   HeaderContainer,
   HeaderContent,
@@ -48,6 +49,17 @@ export const Header: React.FC<HeaderProps> = ({
     return () => clearInterval(timer)
   }, [])
 
+  // Session ouverte (connexion activée sur le serveur)
+  const loggedIn = 'X-CSRF-Token' in csrfHeaders()
+
+  const handleLogout = async () => {
+    try {
+      await logout()
+    } finally {
+      window.location.reload()
+    }
+  }
+
   const formatTime = (date: Date) => {
     return date.toLocaleTimeString('fr-FR', {
       hour: '2-digit',
@@ -115,6 +127,20 @@ export const Header: React.FC<HeaderProps> = ({
               </ActionIcon>
               <ActionText>{t('header.refresh')}</ActionText>
             </ActionButton>
+
+            {loggedIn && (
+              <ActionButton
+                onClick={handleLogout}
+                title={t('header.logout')}
+              >
+                <ActionIcon>
+                  <svg width="16" height="16" fill="none" viewBox="0 0 24 24" stroke="currentColor">
+                    <path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M17 16l4-4m0 0l-4-4m4 4H7m6 4v1a3 3 0 01-3 3H6a3 3 0 01-3-3V7a3 3 0 013-3h4a3 3 0 013 3v1" />
+                  </svg>
+                </ActionIcon>
+                <ActionText>{t('header.logout')}</ActionText>
+              </ActionButton>
+            )}
           </ActionsContainer>
         </ActionsSection>
       </HeaderContent>
@@ -60,6 +60,7 @@ interface PreviewPanelProps {
   onClose: () => void
   onPrevious?: () => void
   onNext?: () => void
+  onShare?: (file: FileItem) => void // Absent si l'utilisateur ne peut pas partager
 }
 
 export const PreviewPanel: React.FC<PreviewPanelProps> = ({
@@ -67,6 +68,7 @@ export const PreviewPanel: React.FC<PreviewPanelProps> = ({
   onClose,
   onPrevious,
   onNext,
+  onShare,
 }) => {
   const { t } = useTranslation()
   const [detailedFile, setDetailedFile] = useState<FileItem | null>(null)
@@ -164,18 +166,21 @@ export const PreviewPanel: React.FC<PreviewPanelProps> = ({
     }
   }
 
+  // Path on the server for admins, otherwise the path in the root
+  const filePath = detailedFile?.abs_path ?? detailedFile?.path
+
   const handleCopyPath = async () => {
-    if (detailedFile?.abs_path) {
-      const success = await copyToClipboard(detailedFile.abs_path)
+    if (filePath) {
+      const success = await copyToClipboard(filePath)
       if (success) {
-        // console.log('Path copied:', detailedFile.abs_path)
+        // console.log('Path copied:', filePath)
       }
     }
   }
 
   const handleOpenInFolder = () => {
-    if (detailedFile?.abs_path) {
-      alert(`${t('preview.fileLocationMessage')}\n${detailedFile.abs_path}`)
+    if (filePath) {
+      alert(`${t('preview.fileLocationMessage')}\n${filePath}`)
     }
   }
 
@@ -258,6 +263,16 @@ export const PreviewPanel: React.FC<PreviewPanelProps> = ({
                 </ActionButton>
               )}
 
+              {onShare && !isDirectory(file) && (
+                <ActionButton onClick={() => onShare(detailedFile)} title={t('share.shareFile')}>
+                  <ActionIcon>
+                    <svg width="16" height="16" fill="none" viewBox="0 0 24 24" stroke="currentColor">
+                      <path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M8.684 13.342C8.886 12.938 9 12.482 9 12c0-.482-.114-.938-.316-1.342m0 2.684a3 3 0 110-2.684m0 2.684l6.632 3.316m-6.632-6l6.632-3.316m0 0a3 3 0 105.367-2.684 3 3 0 00-5.367 2.684zm0 9.316a3 3 0 105.368 2.684 3 3 0 00-5.368-2.684z" />
+                    </svg>
+                  </ActionIcon>
+                </ActionButton>
+              )}
+
               <ActionButton onClick={handleCopyPath} title={t('preview.copyPath')}>
                 <ActionIcon>
                   <svg width="16" height="16" fill="none" viewBox="0 0 24 24" stroke="currentColor">
@@ -375,6 +390,12 @@ export const PreviewPanel: React.FC<PreviewPanelProps> = ({
               <MetadataLabel>{t('preview.createdOn')}</MetadataLabel>
               <MetadataValue>{formatDateTime(detailedFile.created_at)}</MetadataValue>
             </MetadataItem>
+            {detailedFile.date_source && (
+              <MetadataItem>
+                <MetadataLabel>{t('preview.dateSource')}</MetadataLabel>
+                <MetadataValue>{t(`preview.dateSources.${detailedFile.date_source}`)}</MetadataValue>
+              </MetadataItem>
+            )}
             <MetadataItem>
               <MetadataLabel>{t('preview.hash')}</MetadataLabel>
               <MetadataValue title={detailedFile.hash}>
@@ -8,7 +8,8 @@ interface AppConfig {
   error: string | null
 }
 
-export const useAppConfig = (): AppConfig => {
+// enabled: false until the user is logged in, the configuration being protected
+export const useAppConfig = (enabled = true): AppConfig => {
   const [config, setConfig] = useState<AppConfig>({
     locale: 'en',
     isLoaded: false,
@@ -16,6 +17,8 @@ export const useAppConfig = (): AppConfig => {
   })
 
   useEffect(() => {
+    if (!enabled) return
+
     const loadConfig = async () => {
       try {
         const backendConfig = await getAppConfig()
@@ -47,7 +50,7 @@ export const useAppConfig = (): AppConfig => {
     }
 
     loadConfig()
-  }, [])
+  }, [enabled])
 
   return config
 }
@@ -0,0 +1,42 @@
+import { useState, useEffect, useCallback } from 'react'
+import { getAuthStatus } from '@/lib/api'
+import { setAppLocale } from '@/lib/translations'
+import { AuthStatus } from '@/types'
+
+interface AuthState {
+  status: AuthStatus | null
+  isLoaded: boolean
+  needsLogin: boolean
+  reload: () => void
+}
+
+// État de la connexion : l'application n'est chargée qu'une fois l'utilisateur connecté
+export const useAuth = (): AuthState => {
+  const [status, setStatus] = useState<AuthStatus | null>(null)
+  const [isLoaded, setIsLoaded] = useState(false)
+
+  const reload = useCallback(async () => {
+    try {
+      const authStatus = await getAuthStatus()
+      // The login page is shown before the configuration is loaded
+      setAppLocale(authStatus.app_lang === 'fr' ? 'fr' : 'en')
+      setStatus(authStatus)
+    } catch (error) {
+      // Older servers without authentication
+      console.error('Failed to load authentication status:', error)
+      setStatus(null)
+    }
+    setIsLoaded(true)
+  }, [])
+
+  useEffect(() => {
+    reload()
+  }, [reload])
+
+  return {
+    status,
+    isLoaded,
+    needsLogin: !!status?.auth_enabled && !status.user,
+    reload,
+  }
+}
@@ -0,0 +1,55 @@
+import { useEffect, useRef } from 'react'
+import { FileEvent } from '@/types'
+
+interface UseFileEventsOptions {
+  root?: string
+  extension?: string
+  debounceMs?: number
+}
+
+// Subscribe to the real-time file events stream (/api/events).
+// Events are coalesced so a burst of changes triggers a single callback.
+export const useFileEvents = (
+  onEvents: (events: FileEvent[]) => void,
+  { root, extension, debounceMs = 500 }: UseFileEventsOptions = {}
+) => {
+  const callbackRef = useRef(onEvents)
+  callbackRef.current = onEvents
+
+  useEffect(() => {
+    if (typeof EventSource === 'undefined') return
+
+    const params = new URLSearchParams()
+    if (root) params.append('root', root)
+    if (extension) params.append('ext', extension)
+    const query = params.toString()
+
+    // EventSource reconnects automatically and resumes with Last-Event-ID
+    const source = new EventSource(`/api/events${query ? `?${query}` : ''}`)
+    let pending: FileEvent[] = []
+    let timer: ReturnType<typeof setTimeout> | null = null
+
+    const handleEvent = (message: MessageEvent) => {
+      try {
+        pending.push(JSON.parse(message.data))
+      } catch {
+        return
+      }
+      if (timer) clearTimeout(timer)
+      timer = setTimeout(() => {
+        const events = pending
+        pending = []
+        callbackRef.current(events)
+      }, debounceMs)
+    }
+
+    const eventTypes = ['added', 'updated', 'removed', 'moved']
+    eventTypes.forEach(type => source.addEventListener(type, handleEvent))
+
+    return () => {
+      if (timer) clearTimeout(timer)
+      eventTypes.forEach(type => source.removeEventListener(type, handleEvent))
+      source.close()
+    }
+  }, [root, extension, debounceMs])
+}
@@ -1,4 +1,4 @@
-import { FileFilters, FileListResponse, FileItem, UploadResponse } from '@/types'
+import { AuthStatus, AuthUser, DuplicatesResponse, FileAnnotations, FileFilters, FileListResponse, FileItem, FileNote, ShareLink, ShareRequest, SharedContent, SimilarClustersResponse, SimilarFilesResponse, TagCount, UploadConflictPolicy, UploadResponse, UploadStatus } from '@/types'
 
 // Configuration de base pour les appels API
 const API_BASE = '/api'
@@ -15,14 +15,21 @@ export class ApiError extends Error {
   }
 }
 
+// Jeton CSRF de la session, renvoyé avec les requêtes qui modifient des données
+export const csrfHeaders = (): Record<string, string> => {
+  const match = document.cookie.match(/(?:^|;\s*)tokilane_csrf=([^;]+)/)
+  return match ? { 'X-CSRF-Token': decodeURIComponent(match[1]) } : {}
+}
+
 // Fonction utilitaire pour faire des appels fetch avec gestion d'erreur
 const apiFetch = async <T>(url: string, options: RequestInit = {}): Promise<T> => {
   const response = await fetch(url, {
+    ...options,
     headers: {
       'Content-Type': 'application/json',
+      ...csrfHeaders(),
       ...options.headers,
     },
-    ...options,
   })
 
   if (!response.ok) {
@@ -56,16 +63,115 @@ export const getFile = async (id: string): Promise<FileItem> => {
   return apiFetch<FileItem>(`${API_BASE}/files/${id}`)
 }
 
+// API pour récupérer les groupes de fichiers identiques
+export const getDuplicates = async (filters: FileFilters = {}): Promise<DuplicatesResponse> => {
+  const queryParams = new URLSearchParams()
+
+  Object.entries(filters).forEach(([key, value]) => {
+    if (value !== undefined && value !== null && value !== '') {
+      queryParams.append(key, String(value))
+    }
+  })
+
+  const url = `${API_BASE}/duplicates${queryParams.toString() ? `?${queryParams}` : ''}`
+  return apiFetch<DuplicatesResponse>(url)
+}
+
+// API pour récupérer les images similaires à un fichier
+export const getSimilarFiles = async (id: string, threshold?: number): Promise<SimilarFilesResponse> => {
+  const query = threshold !== undefined ? `?threshold=${threshold}` : ''
+  return apiFetch<SimilarFilesResponse>(`${API_BASE}/files/${id}/similar${query}`)
+}
+
+// API pour récupérer les groupes d'images similaires
+export const getSimilarClusters = async (filters: FileFilters = {}, threshold?: number): Promise<SimilarClustersResponse> => {
+  const queryParams = new URLSearchParams()
+
+  Object.entries(filters).forEach(([key, value]) => {
+    if (value !== undefined && value !== null && value !== '') {
+      queryParams.append(key, String(value))
+    }
+  })
+  if (threshold !== undefined) {
+    queryParams.append('threshold', String(threshold))
+  }
+
+  const url = `${API_BASE}/similar${queryParams.toString() ? `?${queryParams}` : ''}`
+  return apiFetch<SimilarClustersResponse>(url)
+}
+
+// API pour les tags, favoris et notes d'un fichier
+export const getTags = async (): Promise<{ tags: TagCount[] }> => {
+  return apiFetch(`${API_BASE}/tags`)
+}
+
+export const setFileTags = async (id: string, tags: string[]): Promise<FileAnnotations> => {
+  return apiFetch<FileAnnotations>(`${API_BASE}/files/${id}/tags`, {
+    method: 'PUT',
+    body: JSON.stringify({ tags }),
+  })
+}
+
+export const removeFileTag = async (id: string, tag: string): Promise<FileAnnotations> => {
+  return apiFetch<FileAnnotations>(`${API_BASE}/files/${id}/tags/${encodeURIComponent(tag)}`, {
+    method: 'DELETE',
+  })
+}
+
+export const setFileFavorite = async (id: string, favorite: boolean): Promise<FileAnnotations> => {
+  return apiFetch<FileAnnotations>(`${API_BASE}/files/${id}/favorite`, {
+    method: favorite ? 'PUT' : 'DELETE',
+  })
+}
+
+export const getFileNotes = async (id: string): Promise<FileAnnotations> => {
+  return apiFetch<FileAnnotations>(`${API_BASE}/files/${id}/notes`)
+}
+
+export const createFileNote = async (id: string, body: string): Promise<FileNote> => {
+  return apiFetch<FileNote>(`${API_BASE}/files/${id}/notes`, {
+    method: 'POST',
+    body: JSON.stringify({ body }),
+  })
+}
+
+export const updateFileNote = async (id: string, noteId: number, body: string): Promise<FileNote> => {
+  return apiFetch<FileNote>(`${API_BASE}/files/${id}/notes/${noteId}`, {
+    method: 'PUT',
+    body: JSON.stringify({ body }),
+  })
+}
+
+export const deleteFileNote = async (id: string, noteId: number): Promise<void> => {
+  const response = await fetch(`${API_BASE}/files/${id}/notes/${noteId}`, { method: 'DELETE', headers: csrfHeaders() })
+  if (!response.ok) {
+    throw new ApiError(`Erreur HTTP ${response.status}`, response.status)
+  }
+}
+
 // API pour uploader des fichiers
 export const uploadFiles = async (
   files: File[],
-  onProgress?: (progress: { loaded: number; total: number }) => void
+  onProgress?: (progress: { loaded: number; total: number }) => void,
+  root?: string,
+  options: { folder?: string; conflict?: UploadConflictPolicy } = {}
 ): Promise<UploadResponse> => {
   const formData = new FormData()
   
   files.forEach(file => {
     formData.append('files', file)
+    // Keep the date of the file on this device (one value per file, in order)
+    formData.append('lastModified', String(file.lastModified))
   })
+  if (root) {
+    formData.append('root', root)
+  }
+  if (options.folder) {
+    formData.append('folder', options.folder)
+  }
+  if (options.conflict) {
+    formData.append('conflict', options.conflict)
+  }
 
   return new Promise((resolve, reject) => {
     const xhr = new XMLHttpRequest()
@@ -112,10 +218,77 @@ export const uploadFiles = async (
 
     // Envoyer la requête
     xhr.open('POST', `${API_BASE}/upload`)
+    Object.entries(csrfHeaders()).forEach(([name, value]) => xhr.setRequestHeader(name, value))
     xhr.send(formData)
   })
 }
 
+// Resumable upload (tus 1.0) of a large file, in chunks resumed after network failures.
+// Resolves with the indexed file once the last chunk is stored.
+const RESUMABLE_CHUNK_SIZE = 8 * 1024 * 1024
+const RESUMABLE_RETRIES = 5
+
+export const uploadFileResumable = async (
+  file: File,
+  onProgress?: (progress: { loaded: number; total: number }) => void,
+  root?: string,
+  options: { folder?: string; conflict?: UploadConflictPolicy } = {}
+): Promise<UploadStatus> => {
+  const tusHeaders = { 'Tus-Resumable': '1.0.0', ...csrfHeaders() }
+  const metadata = [
+    `filename ${btoa(unescape(encodeURIComponent(file.name)))}`,
+    `lastModified ${btoa(String(file.lastModified))}`,
+    ...(root ? [`root ${btoa(root)}`] : []),
+    ...(options.folder ? [`folder ${btoa(unescape(encodeURIComponent(options.folder)))}`] : []),
+    ...(options.conflict ? [`conflict ${btoa(options.conflict)}`] : []),
+  ].join(',')
+
+  const created = await fetch(`${API_BASE}/uploads`, {
+    method: 'POST',
+    headers: { ...tusHeaders, 'Upload-Length': String(file.size), 'Upload-Metadata': metadata },
+  })
+  const location = created.headers.get('Location')
+  if (!created.ok || !location) {
+    const errorData = await created.json().catch(() => ({}))
+    throw new ApiError(errorData.error || `Erreur HTTP ${created.status}`, created.status, errorData)
+  }
+
+  let offset = 0
+  let failures = 0
+  while (offset < file.size) {
+    try {
+      const response = await fetch(location, {
+        method: 'PATCH',
+        headers: { ...tusHeaders, 'Content-Type': 'application/offset+octet-stream', 'Upload-Offset': String(offset) },
+        body: file.slice(offset, offset + RESUMABLE_CHUNK_SIZE),
+      })
+      if (!response.ok) {
+        const errorData = await response.json().catch(() => ({}))
+        throw new ApiError(errorData.error || `Erreur HTTP ${response.status}`, response.status, errorData)
+      }
+      offset = Number(response.headers.get('Upload-Offset'))
+      failures = 0
+    } catch (error) {
+      // Contenu refusé par le serveur : inutile de réessayer
+      if (error instanceof ApiError && error.status === 415) {
+        throw error
+      }
+      if (++failures > RESUMABLE_RETRIES) {
+        throw error instanceof ApiError ? error : new ApiError('Erreur réseau', 0)
+      }
+      // Resume from the bytes received by the server
+      await new Promise(resolve => setTimeout(resolve, 1000 * failures))
+      const head = await fetch(location, { method: 'HEAD', headers: tusHeaders }).catch(() => null)
+      if (head?.ok) {
+        offset = Number(head.headers.get('Upload-Offset'))
+      }
+    }
+    onProgress?.({ loaded: offset, total: file.size })
+  }
+
+  return apiFetch(location)
+}
+
 // Fonction utilitaire pour télécharger un fichier
 export const downloadFile = async (id: string, filename: string): Promise<void> => {
   try {
@@ -146,13 +319,74 @@ export const downloadFile = async (id: string, filename: string): Promise<void>
   }
 }
 
+// Authentification : état de la session, connexion et déconnexion
+export const getAuthStatus = async (): Promise<AuthStatus> => {
+  return apiFetch<AuthStatus>(`${API_BASE}/auth/status`)
+}
+
+export const login = async (username: string, password: string): Promise<{ user: AuthUser; csrf_token: string }> => {
+  return apiFetch(`${API_BASE}/auth/login`, {
+    method: 'POST',
+    body: JSON.stringify({ username, password }),
+  })
+}
+
+export const logout = async (): Promise<void> => {
+  const response = await fetch(`${API_BASE}/auth/logout`, { method: 'POST', headers: csrfHeaders() })
+  if (!response.ok && response.status !== 401) {
+    throw new ApiError(`Erreur HTTP ${response.status}`, response.status)
+  }
+}
+
+// Liens de partage : création, liste et révocation (utilisateur connecté)
+export const createShare = async (request: ShareRequest): Promise<ShareLink> => {
+  return apiFetch<ShareLink>(`${API_BASE}/shares`, {
+    method: 'POST',
+    body: JSON.stringify(request),
+  })
+}
+
+export const listShares = async (): Promise<ShareLink[]> => {
+  return apiFetch<ShareLink[]>(`${API_BASE}/shares`)
+}
+
+export const revokeShare = async (id: string): Promise<void> => {
+  const response = await fetch(`${API_BASE}/shares/${encodeURIComponent(id)}`, { method: 'DELETE', headers: csrfHeaders() })
+  if (!response.ok) {
+    const errorData = await response.json().catch(() => ({}))
+    throw new ApiError(errorData.error || `Erreur HTTP ${response.status}`, response.status, errorData)
+  }
+}
+
+// Contenu public d'un lien de partage (data.code indique la raison d'un refus)
+export const getSharedContent = async (token: string, page = 1): Promise<SharedContent> => {
+  return apiFetch<SharedContent>(`${API_BASE}/s/${encodeURIComponent(token)}?page=${page}`)
+}
+
+// Déverrouille un lien protégé par un mot de passe (cookie posé par le serveur)
+export const unlockShare = async (token: string, password: string): Promise<void> => {
+  const response = await fetch(`${API_BASE}/s/${encodeURIComponent(token)}/unlock`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ password }),
+  })
+  if (!response.ok) {
+    const errorData = await response.json().catch(() => ({}))
+    throw new ApiError(errorData.error || `Erreur HTTP ${response.status}`, response.status, errorData)
+  }
+}
+
 // Function to get app configuration from backend
 export const getAppConfig = async (): Promise<{
   app_lang: string
   version?: string
   upload?: boolean
   files_root?: string
+  roots?: { id: string; upload: boolean }[]
   allowed_ext?: string[]
+  resumable_upload?: boolean // tus endpoint available at /api/uploads
+  shares?: boolean // The user may create share links
+  file_operations?: boolean // The user may delete, rename and move files
 }> => {
   try {
     return await apiFetch('/api/config')
@@ -14,6 +14,22 @@ export interface Translations {
     files: string
     refresh: string
     help: string
+    logout: string
+  }
+
+  // Login
+  auth: {
+    title: string
+    subtitle: string
+    username: string
+    password: string
+    submit: string
+    submitting: string
+    invalidCredentials: string
+    tooManyAttempts: string
+    error: string
+    sso: string
+    ssoError: string
   }
   
   // Filtres
@@ -31,6 +47,7 @@ export interface Translations {
     maxSize: string
     customExtension: string
     extensionExamples: string
+    duplicates: string
     file: string
     files: string
   }
@@ -66,10 +83,46 @@ export interface Translations {
     mimeType: string
     size: string
     createdOn: string
+    dateSource: string
+    dateSources: {
+      exif: string
+      pdf: string
+      office: string
+      quicktime: string
+      id3: string
+      filename: string
+      birthtime: string
+      mtime: string
+      ctime: string
+      upload: string
+      client: string
+    }
     hash: string
     unableToLoadTextContent: string
     fileLocationMessage: string
   }
+
+  // Share links
+  share: {
+    shareFile: string
+    shareDay: string
+    linkCopied: string
+    linkError: string
+    validUntil: string
+    passwordTitle: string
+    passwordPrompt: string
+    unlock: string
+    invalidPassword: string
+    tooManyAttempts: string
+    notFound: string
+    expired: string
+    revoked: string
+    error: string
+    noFiles: string
+    download: string
+    previousPage: string
+    nextPage: string
+  }
   
   // Upload
   upload: {
@@ -150,7 +203,21 @@ export const translations: Record<Language, Translations> = {
       subtitle: 'Your files timeline',
       files: 'Files',
       refresh: 'Refresh',
-      help: 'Help'
+      help: 'Help',
+      logout: 'Log out'
+    },
+    auth: {
+      title: 'Sign in',
+      subtitle: 'Log in to access your files',
+      username: 'Username',
+      password: 'Password',
+      submit: 'Log in',
+      submitting: 'Logging in...',
+      invalidCredentials: 'Invalid username or password',
+      tooManyAttempts: 'Too many failed logins, please try again later',
+      error: 'Unable to log in, please try again',
+      sso: 'Log in with single sign-on',
+      ssoError: 'Single sign-on failed'
     },
     filters: {
       searchPlaceholder: 'Search files...',
@@ -166,6 +233,7 @@ export const translations: Record<Language, Translations> = {
       maxSize: 'Max. size',
       customExtension: 'Custom extension',
       extensionExamples: 'Examples: .zip, .mp3, .xlsx',
+      duplicates: 'Duplicates',
       file: 'file',
       files: 'files'
     },
@@ -197,10 +265,44 @@ export const translations: Record<Language, Translations> = {
       mimeType: 'MIME Type:',
       size: 'Size:',
       createdOn: 'Created on:',
+      dateSource: 'Date from:',
+      dateSources: {
+        exif: 'EXIF',
+        pdf: 'PDF properties',
+        office: 'Document properties',
+        quicktime: 'Video metadata',
+        id3: 'ID3 tag',
+        filename: 'File name',
+        birthtime: 'File creation time',
+        mtime: 'File modification time',
+        ctime: 'File status change time',
+        upload: 'Indexing time',
+        client: 'Date on the uploading device'
+      },
       hash: 'Hash:',
       unableToLoadTextContent: 'Unable to load file content.',
       fileLocationMessage: 'File located at:'
     },
+    share: {
+      shareFile: 'Share a link to this file',
+      shareDay: 'Share a link to this day',
+      linkCopied: 'Share link copied to the clipboard:',
+      linkError: 'Unable to create the share link',
+      validUntil: 'Link valid until',
+      passwordTitle: 'Protected link',
+      passwordPrompt: 'Enter the password to see the shared files',
+      unlock: 'Open',
+      invalidPassword: 'Incorrect password',
+      tooManyAttempts: 'Too many incorrect passwords, please try again later',
+      notFound: 'This link does not exist',
+      expired: 'This link has expired',
+      revoked: 'This link has been revoked',
+      error: 'Unable to open this link, please try again',
+      noFiles: 'No shared file is available',
+      download: 'Download',
+      previousPage: 'Previous page',
+      nextPage: 'Next page'
+    },
     upload: {
       uploadFiles: 'Upload files',
       dragAndDrop: 'Drag and drop files here',
@@ -266,7 +368,21 @@ export const translations: Record<Language, Translations> = {
       subtitle: 'Timeline de vos fichiers',
       files: 'Fichiers',
       refresh: 'Actualiser',
-      help: 'Aide'
+      help: 'Aide',
+      logout: 'Se déconnecter'
+    },
+    auth: {
+      title: 'Connexion',
+      subtitle: 'Connectez-vous pour accéder à vos fichiers',
+      username: 'Nom d\'utilisateur',
+      password: 'Mot de passe',
+      submit: 'Se connecter',
+      submitting: 'Connexion...',
+      invalidCredentials: 'Nom d\'utilisateur ou mot de passe incorrect',
+      tooManyAttempts: 'Trop de connexions échouées, veuillez réessayer plus tard',
+      error: 'Connexion impossible, veuillez réessayer',
+      sso: 'Se connecter avec l\'authentification unique',
+      ssoError: 'Échec de l\'authentification unique'
     },
     filters: {
       searchPlaceholder: 'Rechercher des fichiers...',
@@ -282,6 +398,7 @@ export const translations: Record<Language, Translations> = {
       maxSize: 'Taille max.',
       customExtension: 'Extension personnalisée',
       extensionExamples: 'Exemples : .zip, .mp3, .xlsx',
+      duplicates: 'Doublons',
       file: 'fichier',
       files: 'fichiers'
     },
@@ -313,10 +430,44 @@ export const translations: Record<Language, Translations> = {
       mimeType: 'Type MIME :',
       size: 'Taille :',
       createdOn: 'Créé le :',
+      dateSource: 'Date issue de :',
+      dateSources: {
+        exif: 'EXIF',
+        pdf: 'Propriétés PDF',
+        office: 'Propriétés du document',
+        quicktime: 'Métadonnées vidéo',
+        id3: 'Tag ID3',
+        filename: 'Nom du fichier',
+        birthtime: 'Date de création du fichier',
+        mtime: 'Date de modification du fichier',
+        ctime: 'Date de changement d\'état du fichier',
+        upload: 'Date d\'indexation',
+        client: 'Date sur l\'appareil d\'envoi'
+      },
       hash: 'Hash :',
       unableToLoadTextContent: 'Impossible de charger le contenu du fichier.',
       fileLocationMessage: 'Fichier situé dans :'
     },
+    share: {
+      shareFile: 'Partager un lien vers ce fichier',
+      shareDay: 'Partager un lien vers cette journée',
+      linkCopied: 'Lien de partage copié dans le presse-papiers :',
+      linkError: 'Impossible de créer le lien de partage',
+      validUntil: 'Lien valable jusqu\'au',
+      passwordTitle: 'Lien protégé',
+      passwordPrompt: 'Saisissez le mot de passe pour voir les fichiers partagés',
+      unlock: 'Ouvrir',
+      invalidPassword: 'Mot de passe incorrect',
+      tooManyAttempts: 'Trop de mots de passe incorrects, veuillez réessayer plus tard',
+      notFound: 'Ce lien n\'existe pas',
+      expired: 'Ce lien a expiré',
+      revoked: 'Ce lien a été révoqué',
+      error: 'Impossible d\'ouvrir ce lien, veuillez réessayer',
+      noFiles: 'Aucun fichier partagé n\'est disponible',
+      download: 'Télécharger',
+      previousPage: 'Page précédente',
+      nextPage: 'Page suivante'
+    },
     upload: {
       uploadFiles: 'Uploader des fichiers',
       dragAndDrop: 'Glissez-déposez vos fichiers ici',
@@ -3,14 +3,18 @@ import ReactDOM from 'react-dom/client'
 import { ThemeProvider } from 'styled-components'
 import { theme } from './theme'
 import App from './App'
+import SharePage from './pages/SharePage'
 import './index.css'
 
 const root = ReactDOM.createRoot(document.getElementById('app') as HTMLElement)
 
+// Les liens de partage (/s/:token) sont publics : ils n'utilisent ni la session ni l'application
+const shareMatch = window.location.pathname.match(/^\/s\/([^/]+)/)
+
 root.render(
   <React.StrictMode>
     <ThemeProvider theme={theme}>
-      <App />
+      {shareMatch ? <SharePage token={decodeURIComponent(shareMatch[1])} /> : <App />}
     </ThemeProvider>
   </React.StrictMode>
 )
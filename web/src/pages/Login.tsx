@@ -0,0 +1,103 @@
+import React, { useEffect, useState } from 'react'
+import { ApiError, login } from '@/lib/api'
+import { useTranslation } from '@/lib/translations'
+import {
+  LoginContainer,
+  LoginForm,
+  LoginTitle,
+  LoginSubtitle,
+  LoginLabel,
+  LoginInput,
+  LoginButton,
+  LoginSSOButton,
+  LoginError,
+} from './styled'
+
+interface LoginProps {
+  onLogin: () => void
+  ssoEnabled?: boolean
+}
+
+const Login: React.FC<LoginProps> = ({ onLogin, ssoEnabled = false }) => {
+  const { t } = useTranslation()
+  const [username, setUsername] = useState('')
+  const [password, setPassword] = useState('')
+  const [submitting, setSubmitting] = useState(false)
+  const [error, setError] = useState<string | null>(null)
+
+  // Single sign-on failures come back in the URL
+  useEffect(() => {
+    const url = new URL(window.location.href)
+    if (url.searchParams.has('login_error')) {
+      setError(t('auth.ssoError'))
+      url.searchParams.delete('login_error')
+      window.history.replaceState(null, '', url.pathname + url.search + url.hash)
+    }
+  }, [t])
+
+  const handleSubmit = async (event: React.FormEvent) => {
+    event.preventDefault()
+    setSubmitting(true)
+    setError(null)
+
+    try {
+      await login(username, password)
+      onLogin()
+    } catch (err) {
+      if (err instanceof ApiError && err.status === 401) {
+        setError(t('auth.invalidCredentials'))
+      } else if (err instanceof ApiError && err.status === 429) {
+        setError(t('auth.tooManyAttempts'))
+      } else {
+        setError(t('auth.error'))
+      }
+      setSubmitting(false)
+    }
+  }
+
+  return (
+    <LoginContainer>
+      <LoginForm onSubmit={handleSubmit}>
+        <LoginTitle>{t('auth.title')}</LoginTitle>
+        <LoginSubtitle>{t('auth.subtitle')}</LoginSubtitle>
+
+        <LoginLabel>
+          {t('auth.username')}
+          <LoginInput
+            type="text"
+            autoComplete="username"
+            autoFocus
+            required
+            value={username}
+            onChange={(e) => setUsername(e.target.value)}
+          />
+        </LoginLabel>
+
+        <LoginLabel>
+          {t('auth.password')}
+          <LoginInput
+            type="password"
+            autoComplete="current-password"
+            required
+            value={password}
+            onChange={(e) => setPassword(e.target.value)}
+          />
+        </LoginLabel>
+
+        {error && <LoginError>{error}</LoginError>}
+
+        <LoginButton type="submit" disabled={submitting}>
+          {submitting ? t('auth.submitting') : t('auth.submit')}
+        </LoginButton>
+
+        {ssoEnabled && (
+          <LoginSSOButton href={`/api/auth/oidc/login?redirect=${encodeURIComponent(window.location.pathname)}`}>
+            {t('auth.sso')}
+          </LoginSSOButton>
+        )}
+      </LoginForm>
+    </LoginContainer>
+  )
+}
+
+export default Login
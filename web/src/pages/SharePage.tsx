@@ -0,0 +1,193 @@
+import React, { useCallback, useEffect, useState } from 'react'
+import { ApiError, getSharedContent, unlockShare } from '@/lib/api'
+import { setAppLocale, useTranslation } from '@/lib/translations'
+import { formatDate, formatDateTime, getFileIconByMime, isImageFile } from '@/lib/utils'
+import { SharedContent, SharedFile } from '@/types'
+import {
+  LoginContainer,
+  LoginForm,
+  LoginTitle,
+  LoginSubtitle,
+  LoginInput,
+  LoginButton,
+  LoginError,
+  SharePageButton,
+  SharePageContainer,
+  ShareHeader,
+  ShareTitle,
+  ShareSubtitle,
+  ShareDateTitle,
+  ShareGrid,
+  ShareCard,
+  ShareThumb,
+  ShareCardBody,
+  ShareFileName,
+  ShareDownloadLink,
+  SharePreviewImage,
+  ShareSingleFile,
+  SharePagination,
+} from './styled'
+
+interface SharePageProps {
+  token: string
+}
+
+// Messages des refus renvoyés par le serveur (data.code)
+const errorMessages: Record<string, string> = {
+  not_found: 'share.notFound',
+  expired: 'share.expired',
+  revoked: 'share.revoked',
+}
+
+// Page publique d'un lien de partage : un fichier, ou une mini-timeline en lecture seule
+const SharePage: React.FC<SharePageProps> = ({ token }) => {
+  const { t } = useTranslation()
+  const [content, setContent] = useState<SharedContent | null>(null)
+  const [errorCode, setErrorCode] = useState<string | null>(null)
+  const [page, setPage] = useState(1)
+  const [password, setPassword] = useState('')
+  const [passwordError, setPasswordError] = useState<string | null>(null)
+  const [submitting, setSubmitting] = useState(false)
+
+  const load = useCallback(async () => {
+    try {
+      const data = await getSharedContent(token, page)
+      setAppLocale(data.app_lang === 'fr' ? 'fr' : 'en')
+      setErrorCode(null)
+      setContent(data)
+    } catch (err) {
+      const data = err instanceof ApiError ? err.data : undefined
+      setAppLocale(data?.app_lang === 'fr' ? 'fr' : 'en')
+      setErrorCode(data?.code || 'error')
+    }
+  }, [token, page])
+
+  useEffect(() => {
+    load()
+  }, [load])
+
+  const handleUnlock = async (event: React.FormEvent) => {
+    event.preventDefault()
+    setSubmitting(true)
+    setPasswordError(null)
+    try {
+      await unlockShare(token, password)
+      await load()
+    } catch (err) {
+      // Trop d'essais : le serveur refuse les mots de passe pendant un moment
+      const code = err instanceof ApiError ? err.data?.code : undefined
+      setPasswordError(code === 'too_many_attempts' ? 'share.tooManyAttempts' : 'share.invalidPassword')
+    } finally {
+      setSubmitting(false)
+    }
+  }
+
+  if (errorCode === 'password_required') {
+    return (
+      <LoginContainer>
+        <LoginForm onSubmit={handleUnlock}>
+          <LoginTitle>{t('share.passwordTitle')}</LoginTitle>
+          <LoginSubtitle>{t('share.passwordPrompt')}</LoginSubtitle>
+          <LoginInput
+            type="password"
+            autoComplete="off"
+            autoFocus
+            required
+            value={password}
+            onChange={(e) => setPassword(e.target.value)}
+          />
+          {passwordError && <LoginError>{t(passwordError)}</LoginError>}
+          <LoginButton type="submit" disabled={submitting}>{t('share.unlock')}</LoginButton>
+        </LoginForm>
+      </LoginContainer>
+    )
+  }
+
+  if (errorCode) {
+    return (
+      <LoginContainer>
+        <LoginSubtitle>{t(errorMessages[errorCode] || 'share.error')}</LoginSubtitle>
+      </LoginContainer>
+    )
+  }
+
+  if (!content) {
+    return (
+      <LoginContainer>
+        <LoginSubtitle>{t('general.loading')}</LoginSubtitle>
+      </LoginContainer>
+    )
+  }
+
+  // Fichiers regroupés par jour, dans l'ordre renvoyé par le serveur (du plus récent au plus ancien)
+  const groups: { date: string; files: SharedFile[] }[] = []
+  for (const file of content.items || []) {
+    const date = file.created_at.slice(0, 10)
+    if (groups.length === 0 || groups[groups.length - 1].date !== date) {
+      groups.push({ date, files: [] })
+    }
+    groups[groups.length - 1].files.push(file)
+  }
+
+  return (
+    <SharePageContainer>
+      <ShareHeader>
+        <ShareTitle>{content.name || 'Tokilane'}</ShareTitle>
+        <ShareSubtitle>
+          {t('share.validUntil')} {formatDateTime(content.expires_at)}
+        </ShareSubtitle>
+      </ShareHeader>
+
+      {content.file && (
+        <ShareSingleFile>
+          {isImageFile(content.file.mime) && (
+            <SharePreviewImage src={content.file.preview_url} alt={content.file.name} />
+          )}
+          <ShareFileName>{content.file.name}</ShareFileName>
+          <ShareSubtitle>
+            {content.file.size_formatted} • {formatDateTime(content.file.created_at)}
+          </ShareSubtitle>
+          <ShareDownloadLink href={content.file.download_url}>{t('share.download')}</ShareDownloadLink>
+        </ShareSingleFile>
+      )}
+
+      {content.kind === 'filter' && groups.length === 0 && (
+        <ShareSubtitle style={{ textAlign: 'center' }}>{t('share.noFiles')}</ShareSubtitle>
+      )}
+
+      {groups.map((group) => (
+        <React.Fragment key={group.date}>
+          <ShareDateTitle>{formatDate(group.date + 'T00:00:00Z')}</ShareDateTitle>
+          <ShareGrid>
+            {group.files.map((file) => (
+              <ShareCard key={file.id}>
+                <ShareThumb href={file.has_preview ? file.preview_url : file.download_url} target="_blank" rel="noopener">
+                  {file.thumb_url ? <img src={file.thumb_url} alt={file.name} loading="lazy" /> : getFileIconByMime(file.mime)}
+                </ShareThumb>
+                <ShareCardBody>
+                  <ShareFileName title={file.name}>{file.name}</ShareFileName>
+                  <span>{file.size_formatted}</span>
+                  <a href={file.download_url} style={{ color: '#ff4081' }}>{t('share.download')}</a>
+                </ShareCardBody>
+              </ShareCard>
+            ))}
+          </ShareGrid>
+        </React.Fragment>
+      ))}
+
+      {(content.total_pages || 0) > 1 && (
+        <SharePagination>
+          <SharePageButton disabled={page <= 1} onClick={() => setPage(page - 1)}>
+            {t('share.previousPage')}
+          </SharePageButton>
+          <span>{page} / {content.total_pages}</span>
+          <SharePageButton disabled={page >= (content.total_pages || 1)} onClick={() => setPage(page + 1)}>
+            {t('share.nextPage')}
+          </SharePageButton>
+        </SharePagination>
+      )}
+    </SharePageContainer>
+  )
+}
+
+export default SharePage
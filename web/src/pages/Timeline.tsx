@@ -128,6 +128,7 @@ const Timeline: React.FC<TimelinePageProps> = ({
   const hasFilters = !!(
     filters.query ||
     filters.extension ||
+    filters.duplicates ||
     filters.date_from ||
     filters.date_to ||
     filters.min_size ||
@@ -1,6 +1,9 @@
 import React, { useState, useEffect, useCallback } from 'react'
-import { FileItem, FileFilters } from '@/types'
-import { buildQueryString, parseQueryString } from '@/lib/utils'
+import { FileItem, FileFilters, ShareRequest } from '@/types'
+import { buildQueryString, copyToClipboard, formatDate, parseQueryString } from '@/lib/utils'
+import { createShare, handleApiError } from '@/lib/api'
+import { useTranslation } from '@/lib/translations'
+import { useFileEvents } from '@/hooks/useFileEvents'
 import Header from '@/components/Header/Header'
 import FiltersBar from '@/components/FiltersBar/FiltersBar'
 import FileGroup from '@/components/FileGroup/FileGroup'
@@ -35,6 +38,7 @@ interface TimelineData {
   filters: FileFilters
   total: number
   enableUpload: boolean
+  enableShare?: boolean
   allowedExt: string[]
 }
 
@@ -47,6 +51,7 @@ const TimelineStandalone: React.FC<TimelineStandaloneProps> = ({
   viewMode = 'explorer',
   onViewModeChange 
 }) => {
+  const { t } = useTranslation()
   const [timelineData, setTimelineData] = useState<TimelineData | null>(null)
   const [selectedFile, setSelectedFile] = useState<FileItem | null>(null)
   const [filters, setFilters] = useState<FileFilters>({})
@@ -104,6 +109,7 @@ const TimelineStandalone: React.FC<TimelineStandaloneProps> = ({
     const initialFilters: FileFilters = {
       query: params.q || '',
       extension: params.ext || '',
+      duplicates: params.duplicates === 'true' || params.duplicates === '1' || undefined,
       date_from: params.date_from || undefined,
       date_to: params.date_to || undefined,
       min_size: params.min_size ? parseInt(params.min_size) : undefined,
@@ -206,6 +212,36 @@ const TimelineStandalone: React.FC<TimelineStandaloneProps> = ({
     }, 1000)
   }, [filters, loadTimelineData])
 
+  // Création d'un lien de partage, copié dans le presse-papiers
+  const handleShare = useCallback(async (request: ShareRequest) => {
+    try {
+      const share = await createShare(request)
+      // Lien relatif au serveur sans SHARE_BASE_URL
+      const url = new URL(share.url, window.location.origin).href
+      await copyToClipboard(url)
+      alert(`${t('share.linkCopied')}\n${url}`)
+    } catch (error) {
+      alert(`${t('share.linkError')} : ${handleApiError(error)}`)
+    }
+  }, [t])
+
+  const handleShareFile = useCallback((file: FileItem) => {
+    handleShare({ file_id: file.id })
+  }, [handleShare])
+
+  // Toute la journée, jusqu'à la dernière fraction de seconde
+  const handleShareDay = useCallback((date: string) => {
+    handleShare({
+      filters: { date_from: date, date_to: `${date} 23:59:59.999999999` },
+      name: formatDate(date + 'T00:00:00Z'),
+    })
+  }, [handleShare])
+
+  // Recharger les données quand des fichiers changent sur le disque
+  useFileEvents(() => {
+    loadTimelineData(filters)
+  })
+
   const handleUploadError = (error: string) => {
     console.error('Upload error:', error)
     alert('Erreur lors de l\'upload: ' + error)
@@ -241,6 +277,7 @@ const TimelineStandalone: React.FC<TimelineStandaloneProps> = ({
   const hasFilters = !!(
     filters.query ||
     filters.extension ||
+    filters.duplicates ||
     filters.date_from ||
     filters.date_to ||
     filters.min_size ||
@@ -300,6 +337,7 @@ const TimelineStandalone: React.FC<TimelineStandaloneProps> = ({
                 date={date}
                 files={timelineData.timeline[date]}
                 onFileClick={handleFileClick}
+                onShare={timelineData.enableShare ? handleShareDay : undefined}
               />
             ))}
           </div>
@@ -313,6 +351,7 @@ const TimelineStandalone: React.FC<TimelineStandaloneProps> = ({
           onClose={closePreview}
           onPrevious={handlePrevious}
           onNext={handleNext}
+          onShare={timelineData.enableShare ? handleShareFile : undefined}
         />
       )}
 
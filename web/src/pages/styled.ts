@@ -240,3 +240,233 @@ export const SecondaryButton = styled.button`
     box-shadow: 0 0 0 2px ${({ theme }) => theme.colors.primary[500]};
   }
 `
+
+// Page de connexion
+export const LoginContainer = styled.div`
+  display: flex;
+  align-items: center;
+  justify-content: center;
+  min-height: 100vh;
+  background-color: #0a0a0a;
+  color: white;
+`
+
+export const LoginForm = styled.form`
+  display: flex;
+  flex-direction: column;
+  gap: ${({ theme }) => theme.spacing[4]};
+  width: 100%;
+  max-width: 22rem;
+  padding: ${({ theme }) => theme.spacing[8]};
+  background-color: rgba(255, 255, 255, 0.05);
+  border: 1px solid rgba(255, 255, 255, 0.1);
+  border-radius: ${({ theme }) => theme.borderRadius.lg};
+`
+
+export const LoginTitle = styled.h1`
+  margin: 0;
+  font-size: 1.5rem;
+  font-weight: 600;
+`
+
+export const LoginSubtitle = styled.p`
+  margin: 0;
+  font-size: 0.875rem;
+  color: rgba(255, 255, 255, 0.6);
+`
+
+export const LoginLabel = styled.label`
+  display: flex;
+  flex-direction: column;
+  gap: ${({ theme }) => theme.spacing[1]};
+  font-size: 0.875rem;
+  color: rgba(255, 255, 255, 0.8);
+`
+
+export const LoginInput = styled.input`
+  padding: ${({ theme }) => theme.spacing[2]} ${({ theme }) => theme.spacing[3]};
+  font-size: 1rem;
+  color: white;
+  background-color: rgba(255, 255, 255, 0.08);
+  border: 1px solid rgba(255, 255, 255, 0.2);
+  border-radius: ${({ theme }) => theme.borderRadius.md};
+
+  &:focus {
+    outline: none;
+    border-color: #ff0050;
+  }
+`
+
+export const LoginButton = styled.button`
+  padding: ${({ theme }) => theme.spacing[2]} ${({ theme }) => theme.spacing[4]};
+  font-size: 1rem;
+  font-weight: 500;
+  color: white;
+  background: linear-gradient(45deg, #ff0050, #ff4081);
+  border: none;
+  border-radius: ${({ theme }) => theme.borderRadius.md};
+  cursor: pointer;
+
+  &:disabled {
+    opacity: 0.6;
+    cursor: default;
+  }
+`
+
+export const LoginSSOButton = styled.a`
+  padding: ${({ theme }) => theme.spacing[2]} ${({ theme }) => theme.spacing[4]};
+  font-size: 1rem;
+  font-weight: 500;
+  text-align: center;
+  text-decoration: none;
+  color: white;
+  border: 1px solid rgba(255, 255, 255, 0.3);
+  border-radius: ${({ theme }) => theme.borderRadius.md};
+
+  &:hover {
+    border-color: #ff0050;
+  }
+`
+
+export const LoginError = styled.p`
+  margin: 0;
+  font-size: 0.875rem;
+  color: #ff6b6b;
+`
+
+export const SharePageContainer = styled.div`
+  min-height: 100vh;
+  padding: ${({ theme }) => theme.spacing[8]} ${({ theme }) => theme.spacing[4]};
+  background-color: #0a0a0a;
+  color: white;
+  overflow-y: auto;
+`
+
+export const ShareHeader = styled.header`
+  max-width: 72rem;
+  margin: 0 auto ${({ theme }) => theme.spacing[6]};
+`
+
+export const ShareTitle = styled.h1`
+  margin: 0;
+  font-size: 1.5rem;
+  font-weight: 600;
+  word-break: break-word;
+`
+
+export const ShareSubtitle = styled.p`
+  margin: ${({ theme }) => theme.spacing[1]} 0 0;
+  font-size: 0.875rem;
+  color: rgba(255, 255, 255, 0.6);
+`
+
+export const ShareDateTitle = styled.h2`
+  max-width: 72rem;
+  margin: ${({ theme }) => theme.spacing[6]} auto ${({ theme }) => theme.spacing[3]};
+  font-size: 1rem;
+  font-weight: 600;
+  color: rgba(255, 255, 255, 0.8);
+`
+
+export const ShareGrid = styled.div`
+  display: grid;
+  grid-template-columns: repeat(auto-fill, minmax(10rem, 1fr));
+  gap: ${({ theme }) => theme.spacing[4]};
+  max-width: 72rem;
+  margin: 0 auto;
+`
+
+export const ShareCard = styled.div`
+  display: flex;
+  flex-direction: column;
+  overflow: hidden;
+  background-color: rgba(255, 255, 255, 0.05);
+  border: 1px solid rgba(255, 255, 255, 0.1);
+  border-radius: ${({ theme }) => theme.borderRadius.lg};
+`
+
+export const ShareThumb = styled.a`
+  display: flex;
+  align-items: center;
+  justify-content: center;
+  aspect-ratio: 1;
+  font-size: 2.5rem;
+  text-decoration: none;
+  background-color: rgba(255, 255, 255, 0.03);
+
+  img {
+    width: 100%;
+    height: 100%;
+    object-fit: cover;
+  }
+`
+
+export const ShareCardBody = styled.div`
+  display: flex;
+  flex-direction: column;
+  gap: ${({ theme }) => theme.spacing[1]};
+  padding: ${({ theme }) => theme.spacing[3]};
+  font-size: 0.75rem;
+  color: rgba(255, 255, 255, 0.6);
+`
+
+export const ShareFileName = styled.span`
+  overflow: hidden;
+  font-size: 0.875rem;
+  color: white;
+  text-overflow: ellipsis;
+  white-space: nowrap;
+`
+
+export const ShareDownloadLink = styled.a`
+  align-self: flex-start;
+  padding: ${({ theme }) => theme.spacing[2]} ${({ theme }) => theme.spacing[4]};
+  font-size: 0.875rem;
+  font-weight: 500;
+  text-decoration: none;
+  color: white;
+  background: linear-gradient(45deg, #ff0050, #ff4081);
+  border-radius: ${({ theme }) => theme.borderRadius.md};
+`
+
+export const SharePreviewImage = styled.img`
+  display: block;
+  max-width: 100%;
+  max-height: 70vh;
+  margin: 0 auto ${({ theme }) => theme.spacing[4]};
+  border-radius: ${({ theme }) => theme.borderRadius.lg};
+`
+
+export const ShareSingleFile = styled.div`
+  display: flex;
+  flex-direction: column;
+  align-items: center;
+  gap: ${({ theme }) => theme.spacing[3]};
+  max-width: 72rem;
+  margin: 0 auto;
+`
+
+export const SharePagination = styled.nav`
+  display: flex;
+  justify-content: center;
+  align-items: center;
+  gap: ${({ theme }) => theme.spacing[4]};
+  margin-top: ${({ theme }) => theme.spacing[8]};
+  font-size: 0.875rem;
+  color: rgba(255, 255, 255, 0.6);
+`
+
+export const SharePageButton = styled.button`
+  padding: ${({ theme }) => theme.spacing[2]} ${({ theme }) => theme.spacing[4]};
+  font-size: 0.875rem;
+  color: white;
+  background-color: rgba(255, 255, 255, 0.08);
+  border: 1px solid rgba(255, 255, 255, 0.15);
+  border-radius: ${({ theme }) => theme.borderRadius.md};
+  cursor: pointer;
+
+  &:disabled {
+    opacity: 0.4;
+    cursor: not-allowed;
+  }
+`
@@ -1,24 +1,39 @@
 // Types pour les fichiers
 export interface FileItem {
   id: string
+  root_id?: string
   name: string
   ext: string
   mime: string
   size: number
   size_formatted: string
   created_at: string
+  date_source?: string
   has_preview: boolean
   has_thumbnail: boolean
   thumb_url?: string
-  abs_path?: string
+  path?: string // Path in the root
+  abs_path?: string // Path on the server, for admins only
   hash?: string
+  content_hash?: string // SHA256 of the full content, once computed in the background
+  perceptual_hash?: string // dHash of images, computed with the thumbnail
+  date_candidates?: Record<string, string>
+  date_override?: string // Date provided by the uploading client
   added_at?: string
+  snippet?: string // Matching excerpt of the content (HTML, terms in <mark>)
+  tags?: string[]
+  favorite?: boolean
+  note_count?: number
 }
 
 // Types pour les filtres
 export interface FileFilters {
   query?: string
+  root?: string
   extension?: string
+  tags?: string // Comma-separated, files must carry all of them
+  favorite?: boolean
+  duplicates?: boolean // Only files with identical copies
   date_from?: string
   date_to?: string
   min_size?: number
@@ -40,19 +55,203 @@ export interface GroupedFiles {
   [date: string]: FileItem[]
 }
 
+// Types pour les annotations (tags, favoris, notes)
+export interface FileNote {
+  id: number
+  file_id: string
+  body: string
+  created_at: string
+  updated_at: string
+}
+
+export interface FileAnnotations {
+  tags: string[]
+  favorite: boolean
+  notes: FileNote[]
+}
+
+export interface TagCount {
+  name: string
+  count: number
+}
+
+// Types pour les doublons (/api/duplicates)
+export interface DuplicateGroup {
+  content_hash: string
+  size: number
+  size_formatted: string
+  count: number
+  wasted: number
+  wasted_formatted: string
+  items: FileItem[]
+}
+
+export interface DuplicatesResponse {
+  groups: DuplicateGroup[]
+  total_groups: number
+  duplicate_files: number
+  wasted_bytes: number
+  wasted_formatted: string
+  pending: number // Files not hashed yet
+  page: number
+  page_size: number
+  total_pages: number
+}
+
+// Types pour les images similaires (/api/similar, /api/files/:id/similar)
+export interface SimilarFile extends FileItem {
+  distance: number // Number of differing bits (out of 64)
+}
+
+export interface SimilarFilesResponse {
+  file_id: string
+  hashed: boolean
+  threshold: number
+  items: SimilarFile[]
+}
+
+export interface SimilarCluster {
+  count: number
+  items: FileItem[]
+}
+
+export interface SimilarClustersResponse {
+  clusters: SimilarCluster[]
+  total_clusters: number
+  similar_files: number
+  hashed_images: number
+  threshold: number
+  page: number
+  page_size: number
+  total_pages: number
+}
+
 // Types pour l'upload
+export type UploadConflictPolicy = 'rename' | 'overwrite' | 'skip' | 'skip-identical'
+
+export interface UploadResult {
+  name: string
+  status: 'created' | 'renamed' | 'overwritten' | 'skipped' | 'failed'
+  path?: string // Path of the stored (or kept) file in its root
+  file?: FileItem // Indexed file (the existing one when skipped)
+  reason?: string
+}
+
 export interface UploadResponse {
-  uploaded: string[]
+  uploaded: string[] // IDs of the indexed files
+  files: FileItem[]
   count: number
+  root?: string
+  folder?: string
+  conflict?: UploadConflictPolicy
+  results: UploadResult[]
   errors?: string[]
 }
 
+// State of a resumable upload (/api/uploads/:id)
+export interface UploadStatus {
+  id: string
+  length: number
+  offset: number
+  metadata: Record<string, string>
+  expires_at: string
+  complete: boolean
+  status?: UploadResult['status']
+  path?: string
+  file_id?: string
+  file?: FileItem
+  error?: string
+}
+
+// Types pour l'authentification (/api/auth)
+export interface AuthUser {
+  id: number
+  username: string
+  role: 'viewer' | 'uploader' | 'admin'
+  provider?: 'local' | 'oidc'
+  created_at: string
+  last_login_at?: string
+}
+
+export interface AuthStatus {
+  auth_enabled: boolean
+  oidc_enabled?: boolean
+  app_lang: string
+  user?: AuthUser | null
+  csrf_token?: string
+}
+
+// Types pour les liens de partage (/api/shares et /s/:token)
+export interface ShareRequest {
+  file_id?: string
+  filters?: FileFilters // Par exemple date_from et date_to pour une journée
+  name?: string
+  password?: string
+  expires_in_hours?: number // Durée par défaut du serveur si absent
+}
+
+export interface ShareLink {
+  id: string
+  user_id: number
+  kind: 'file' | 'filter'
+  file_id?: string
+  filters?: FileFilters
+  name: string
+  url: string
+  expires_at: string
+  revoked_at?: string
+  downloads: number
+  last_access_at?: string
+  created_at: string
+  has_password: boolean
+  active: boolean
+}
+
+// Fichier vu par un visiteur d'un lien de partage, sans son chemin
+export interface SharedFile {
+  id: string
+  name: string
+  ext: string
+  mime: string
+  size: number
+  size_formatted: string
+  created_at: string
+  has_preview: boolean
+  thumb_url?: string
+  preview_url: string
+  download_url: string
+}
+
+export interface SharedContent {
+  name: string
+  kind: 'file' | 'filter'
+  expires_at: string
+  app_lang: string
+  file?: SharedFile // Lien vers un fichier
+  items?: SharedFile[] // Lien vers un ensemble de fichiers, par pages
+  total?: number
+  page?: number
+  total_pages?: number
+}
+
+// Types pour les événements temps réel (/api/events)
+export interface FileEvent {
+  type: 'added' | 'updated' | 'removed' | 'moved'
+  file_id: string
+  root_id?: string
+  ext?: string
+  path?: string // New path of a moved file
+  old_path?: string // Previous path of a moved file
+  file?: FileItem
+}
+
 // Types pour les props des pages Inertia
 export interface TimelinePageProps {
   timeline: GroupedFiles
   filters: FileFilters
   total: number
   enableUpload: boolean
+  enableShare?: boolean
   allowedExt: string[]
 }
 
@@ -74,13 +273,18 @@ export interface FileUpload {
 // Types pour la prévisualisation
 export interface PreviewFile {
   id: string
+  root_id?: string
   name: string
   ext: string
   mime: string
   size: number
   size_formatted: string
   created_at: string
-  abs_path: string
+  date_source?: string
+  date_candidates?: Record<string, string>
+  metadata?: Record<string, string>
+  path?: string
+  abs_path?: string
   hash: string
   has_thumbnail: boolean
   thumb_url?: string